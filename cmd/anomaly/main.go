@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/anomaly"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+const usage = `Usage:
+  anomaly backtest [flags]   run anomaly detection over stored connections
+
+Run "anomaly <command> -h" for the command's flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "backtest":
+		runBacktest(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func runBacktest(args []string) {
+	fs := flag.NewFlagSet("backtest", flag.ExitOnError)
+	driver := fs.String("storage-driver", "sqlite", "Storage backend: sqlite or postgres")
+	dsn := fs.String("dsn", "network.db", "Database path or connection string")
+	from := fs.String("from", "", "Start of the replay (RFC 3339 or YYYY-MM-DD); defaults to 7 days ago")
+	to := fs.String("to", "", "End of the replay (RFC 3339 or YYYY-MM-DD); defaults to now")
+	interval := fs.Duration("interval", anomaly.DefaultConfig.Interval, "Rollup interval")
+	window := fs.Int("window", anomaly.DefaultConfig.Window, "Number of intervals in a baseline")
+	minHistory := fs.Int("min-history", anomaly.DefaultConfig.MinHistory, "Intervals a series needs before it is scored")
+	threshold := fs.Float64("threshold", anomaly.DefaultConfig.Threshold, "Robust z-score at which a deviation is reported")
+	minCount := fs.Int("min-count", anomaly.DefaultConfig.MinCount, "Smallest change in connections or errors that is reported")
+	store := fs.Bool("store", false, "Save the anomalies found so the API serves them")
+	asJSON := fs.Bool("json", false, "Print anomalies as JSON lines")
+	fs.Parse(args)
+
+	end := time.Now()
+	start := end.Add(-7 * 24 * time.Hour)
+	if *from != "" {
+		start = parseTime("--from", *from)
+	}
+	if *to != "" {
+		end = parseTime("--to", *to)
+	}
+
+	db, err := storage.Open(*driver, *dsn)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer db.Close()
+
+	config := anomaly.Config{
+		Interval:   *interval,
+		Window:     *window,
+		MinHistory: *minHistory,
+		Threshold:  *threshold,
+		MinCount:   *minCount,
+	}
+	anomalies, err := anomaly.Backtest(db, config, start, end)
+	if err != nil {
+		log.Fatalf("Backtest failed: %v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	for _, a := range anomalies {
+		if *asJSON {
+			encoder.Encode(a)
+		} else {
+			fmt.Printf("%s  %-18s  %s\n", a.Timestamp.UTC().Format(time.RFC3339), a.Kind, a.Message)
+		}
+	}
+
+	if *store {
+		anomalyStore, ok := db.(storage.AnomalyStore)
+		if !ok {
+			log.Fatalf("The %s storage driver does not keep anomalies", *driver)
+		}
+		for _, a := range anomalies {
+			if err := anomalyStore.StoreAnomaly(a); err != nil {
+				log.Fatalf("Failed to store anomalies: %v", err)
+			}
+		}
+	}
+	log.Printf("Found %d anomalies between %s and %s",
+		len(anomalies), start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339))
+}
+
+// parseTime accepts an RFC 3339 timestamp or a UTC date
+func parseTime(name, value string) time.Time {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		log.Fatalf("Invalid %s time: %s", name, value)
+	}
+	return t
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/archive"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+const usage = `Usage:
+  archive export [flags]   move connections older than a cutoff into the archive
+  archive import [flags]   load archived connections back into a database
+
+Run "archive <command> -h" for the command's flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "export":
+		runExport(os.Args[2:])
+	case "import":
+		runImport(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+// storageFlags registers the flags selecting the database
+func storageFlags(fs *flag.FlagSet) (driver, dsn *string) {
+	driver = fs.String("storage-driver", "sqlite", "Storage backend: sqlite or postgres")
+	dsn = fs.String("dsn", "network.db", "Database path or connection string")
+	return driver, dsn
+}
+
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	driver, dsn := storageFlags(fs)
+	dir := fs.String("dir", "archive", "Archive directory")
+	olderThan := fs.Duration("older-than", 30*24*time.Hour, "Archive connections older than this")
+	before := fs.String("before", "", "Archive connections before this date (YYYY-MM-DD, UTC); overrides --older-than")
+	fs.Parse(args)
+
+	cutoff := time.Now().Add(-*olderThan)
+	if *before != "" {
+		t, err := time.Parse("2006-01-02", *before)
+		if err != nil {
+			log.Fatalf("Invalid --before date: %v", err)
+		}
+		cutoff = t
+	}
+
+	store, err := storage.Open(*driver, *dsn)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer store.Close()
+
+	pruner, ok := store.(storage.Pruner)
+	if !ok {
+		log.Fatalf("The %s storage driver does not support archiving", *driver)
+	}
+
+	run, err := archive.Export(pruner, *dir, cutoff)
+	if err != nil {
+		log.Fatalf("Export failed: %v", err)
+	}
+	log.Printf("Archived %d connections before %s to %s (%d deleted)",
+		run.Rows, cutoff.UTC().Format(time.RFC3339), *dir, run.Deleted)
+}
+
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	driver, dsn := storageFlags(fs)
+	dir := fs.String("dir", "archive", "Archive directory")
+	from := fs.String("from", "", "First day to import (YYYY-MM-DD)")
+	to := fs.String("to", "", "Last day to import (YYYY-MM-DD)")
+	env := fs.String("env", "", "Only import this environment")
+	fs.Parse(args)
+
+	store, err := storage.Open(*driver, *dsn)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer store.Close()
+
+	result, err := archive.Import(store, *dir, archive.ImportFilter{From: *from, To: *to, Environment: *env})
+	if err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+	log.Printf("Imported %d connections from %d files (%d already present)",
+		result.Imported, result.Files, result.Skipped)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -12,9 +13,16 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/karthik-minnikanti/cinnamon/internal/capture"
+	"github.com/karthik-minnikanti/cinnamon/internal/certs"
+	"github.com/karthik-minnikanti/cinnamon/internal/container"
+	"github.com/karthik-minnikanti/cinnamon/internal/fingerprint"
+	"github.com/karthik-minnikanti/cinnamon/internal/flows"
+	"github.com/karthik-minnikanti/cinnamon/internal/httpmetrics"
 	"github.com/karthik-minnikanti/cinnamon/internal/models"
 	"github.com/karthik-minnikanti/cinnamon/internal/monitor"
 	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+	"github.com/karthik-minnikanti/cinnamon/internal/synthetic"
 )
 
 var (
@@ -25,6 +33,24 @@ var (
 	deploymentID = flag.String("deployment", "", "Deployment ID")
 	environment  = flag.String("env", "production", "Environment")
 	region       = flag.String("region", "", "Region")
+	sniffIface   = flag.String("sniff-iface", "", "Interface to passively fingerprint protocols on (AF_PACKET, requires CAP_NET_RAW)")
+	sniffPcap    = flag.String("sniff-pcap", "", "Pcap file to fingerprint protocols from instead of a live interface")
+	probe        = flag.Bool("probe", false, "Actively probe unclassified destinations for server greetings")
+	sourceType   = flag.String("source", "netstat", "Connection source: netstat, procfs or capture")
+	captureIface = flag.String("capture-iface", "", "Interface for the capture source (empty for all interfaces)")
+	capturePcap  = flag.String("capture-pcap", "", "Replay a pcap file through the capture source instead of a live interface")
+	trackDNS     = flag.Bool("track-dns", false, "Observe DNS lookups to attach destination hostnames and report EDNSFAILURE")
+	procRoot     = flag.String("proc-root", "/proc", "Host /proc mount read by the procfs source")
+	runtimeSock  = flag.String("container-socket", container.DefaultSocket, "Container runtime API socket used to name containers (empty to disable)")
+	listenEvery  = flag.Duration("listener-interval", time.Minute, "Interval between reports of listening sockets (0 to disable)")
+	retryWindow  = flag.Duration("retry-window", monitor.DefaultRetryWindow, "How long after a failed attempt a new attempt to the same endpoint counts as a retry")
+	poolEvery    = flag.Duration("pool-interval", 15*time.Second, "Interval between database and cache connection pool samples (0 to disable)")
+	checksFile   = flag.String("checks", "", "JSON file of synthetic checks to run and report as connections")
+	reportCerts  = flag.Bool("certificates", true, "Report TLS certificate chains seen by synthetic checks and the capture source")
+	httpMetrics  = flag.Bool("http-metrics", true, "Measure plaintext HTTP requests seen by the capture source")
+	httpProxy    = flag.String("http-proxy", "", "Address to serve a forward HTTP proxy on, measuring the requests sent through it (empty to disable)")
+	httpEvery    = flag.Duration("http-interval", httpmetrics.DefaultInterval, "Interval HTTP requests are counted over before they are reported")
+	aggregateBy  = flag.Duration("aggregate", 0, "Report flow summaries per process and destination counted over this interval instead of every connection (0 to send every connection)")
 )
 
 func main() {
@@ -37,17 +63,153 @@ func main() {
 	}
 
 	// Initialize network monitor
-	monitor := monitor.NewNetworkMonitor(storage)
+	netMonitor := monitor.NewNetworkMonitor(storage)
+	netMonitor.SetRetryWindow(*retryWindow)
 
 	// Create a channel to receive connection events
 	connChan := make(chan *models.Connection, 100)
-	monitor.SetConnectionChannel(connChan)
+	netMonitor.SetConnectionChannel(connChan)
+
+	// Select the connection source
+	var flowSource *capture.FlowSource
+	var listenerSource monitor.ListenerSource
+	var socketSource monitor.SocketSource
+	switch *sourceType {
+	case "netstat":
+		netstatSource := monitor.NewNetstatSource(*interval)
+		listenerSource = netstatSource
+		socketSource = netstatSource
+		netMonitor.SetSource(netstatSource)
+	case "procfs":
+		procSource := monitor.NewProcfsSource(*procRoot, *interval)
+		if *runtimeSock != "" {
+			if _, err := os.Stat(*runtimeSock); err == nil {
+				procSource.SetRuntime(container.NewRuntime(*runtimeSock))
+			} else {
+				log.Printf("Container runtime socket unavailable, tagging containers by ID only: %v", err)
+			}
+		}
+		listenerSource = procSource
+		socketSource = procSource
+		netMonitor.SetSource(procSource)
+	case "capture":
+		packets, err := openCapture(*captureIface, *capturePcap)
+		if err != nil {
+			log.Fatalf("Failed to open capture: %v", err)
+		}
+		flowSource = capture.NewFlowSource(packets, capture.DefaultFlowTrackerConfig())
+		netMonitor.SetSource(flowSource)
+	default:
+		log.Fatalf("Unknown connection source: %s", *sourceType)
+	}
+
+	// Optional DNS tracking, sharing the capture when there is one
+	if *trackDNS {
+		dnsTracker := capture.NewDNSTracker(capture.DefaultDNSTrackerConfig())
+		if flowSource != nil {
+			flowSource.TrackDNS(dnsTracker)
+		} else {
+			packets, err := openCapture(*captureIface, *capturePcap)
+			if err != nil {
+				log.Fatalf("Failed to open capture for DNS tracking: %v", err)
+			}
+			netMonitor.AddSource(capture.NewDNSSource(packets, dnsTracker))
+		}
+		netMonitor.SetResolver(dnsTracker)
+	}
+
+	// Optional protocol fingerprinting beyond port numbers
+	if flowSource != nil && *sniffIface == "" && *sniffPcap == "" {
+		// Fingerprint the packets the capture source is already reading
+		sniffer := fingerprint.NewSniffer(nil)
+		flowSource.AddTap(sniffer.Observe)
+		netMonitor.AddClassifier(sniffer)
+	} else if *sniffIface != "" || *sniffPcap != "" {
+		sniffer, err := newSniffer()
+		if err != nil {
+			log.Fatalf("Failed to start protocol sniffer: %v", err)
+		}
+		defer sniffer.Close()
+		netMonitor.AddClassifier(sniffer)
+
+		go func() {
+			if err := sniffer.Run(); err != nil {
+				log.Printf("Protocol sniffer stopped: %v", err)
+			}
+		}()
+	}
+	if *probe {
+		netMonitor.AddClassifier(fingerprint.NewProber(500 * time.Millisecond))
+	}
+
+	// Certificate chains from TLS checks and handshakes on the capture
+	certChan := make(chan *models.CertificateObservation, 100)
+	sendCertificate := func(obs *models.CertificateObservation) {
+		select {
+		case certChan <- obs:
+		default:
+			log.Printf("Certificate channel full, dropping chain for %s:%d", obs.DestIP, obs.DestPort)
+		}
+	}
+	if *reportCerts {
+		if flowSource != nil {
+			flowSource.AddTap(certs.NewTap(sendCertificate).Observe)
+		}
+		go reportCertificates(certChan)
+	}
+
+	// HTTP request metrics from the capture and the forward proxy
+	if (*httpMetrics && flowSource != nil) || *httpProxy != "" {
+		requests := httpmetrics.NewAggregator(*httpEvery)
+		if *httpMetrics && flowSource != nil {
+			tap := httpmetrics.NewTap(func(req *models.HTTPRequest) { requests.Add(req, "capture") })
+			flowSource.AddTap(tap.Observe)
+		}
+		if *httpProxy != "" {
+			proxy := httpmetrics.NewProxy(func(req *models.HTTPRequest) { requests.Add(req, "proxy") })
+			go func() {
+				log.Printf("Serving HTTP proxy on %s", *httpProxy)
+				if err := http.ListenAndServe(*httpProxy, proxy); err != nil {
+					log.Fatalf("HTTP proxy error: %v", err)
+				}
+			}()
+		}
+		go reportHTTPMetrics(requests, *httpEvery)
+	}
+
+	// Synthetic checks
+	if *checksFile != "" {
+		checks, err := synthetic.LoadChecksFile(*checksFile)
+		if err != nil {
+			log.Fatalf("Failed to load checks: %v", err)
+		}
+		runner := synthetic.NewRunner(checks)
+		if *reportCerts {
+			runner.OnCertificate(sendCertificate)
+		}
+		netMonitor.AddSource(runner)
+	}
 
 	// Start monitoring
-	go monitor.Start()
+	go netMonitor.Start()
 
 	// Start sending data to server
-	go sendDataToServer(connChan)
+	if *aggregateBy > 0 {
+		go reportFlows(connChan, *aggregateBy)
+	} else {
+		go sendDataToServer(connChan)
+	}
+
+	// Report listening sockets when the source can list them
+	if listenerSource != nil && *listenEvery > 0 {
+		go reportListeners(listenerSource, *listenEvery)
+	}
+
+	// Sample database and cache connection pools when the source can list
+	// sockets
+	if socketSource != nil && *poolEvery > 0 {
+		go reportPools(monitor.NewPoolSampler(socketSource, *poolEvery), *poolEvery)
+	}
 
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
@@ -55,7 +217,23 @@ func main() {
 	<-sigChan
 
 	log.Println("Shutting down collector...")
-	monitor.Stop()
+	netMonitor.Stop()
+}
+
+func newSniffer() (*fingerprint.Sniffer, error) {
+	source, err := openCapture(*sniffIface, *sniffPcap)
+	if err != nil {
+		return nil, err
+	}
+	return fingerprint.NewSniffer(source), nil
+}
+
+// openCapture opens a pcap file when one is given, otherwise a live interface
+func openCapture(iface, pcapPath string) (capture.Source, error) {
+	if pcapPath != "" {
+		return capture.OpenPcapFile(pcapPath)
+	}
+	return capture.OpenInterface(iface)
 }
 
 func sendDataToServer(connChan <-chan *models.Connection) {
@@ -68,10 +246,12 @@ func sendDataToServer(connChan <-chan *models.Connection) {
 		select {
 		case conn := <-connChan:
 			// Create a connection key without timestamp and random component
-			connKey := fmt.Sprintf("%s:%d-%s:%d", conn.SourceIP, conn.SourcePort, conn.DestIP, conn.DestPort)
+			connKey := connectionKey(conn)
 
-			// Check if we've seen this connection recently (within last 5 minutes)
-			if lastSeen, exists := recentConnections[connKey]; exists {
+			// Check if we've seen this connection recently (within last 5 minutes).
+			// Failures are always reported, as are records from the capture
+			// source, which reports each flow or part of one only once.
+			if lastSeen, exists := recentConnections[connKey]; exists && conn.Error == "" && !hasTag(conn, "capture") {
 				if time.Since(lastSeen) < 5*time.Minute {
 					continue // Skip if we've seen this connection recently
 				}
@@ -80,20 +260,30 @@ func sendDataToServer(connChan <-chan *models.Connection) {
 			// Update the last seen time
 			recentConnections[connKey] = time.Now()
 
-			// Add metadata
-			conn.ServiceName = *serviceName
+			// Add metadata. Unset flags leave the fields empty so that
+			// server-side enrichment, such as Kubernetes, can fill them.
 			conn.Host = *host
-			conn.DeploymentID = *deploymentID
-			conn.Environment = *environment
-			conn.Region = *region
+			if *serviceName != "" {
+				conn.ServiceName = *serviceName
+			}
+			if *deploymentID != "" {
+				conn.DeploymentID = *deploymentID
+			}
+			if *environment != "" {
+				conn.Environment = *environment
+			}
+			if *region != "" {
+				conn.Region = *region
+			}
 
 			// Add tags
-			conn.Tags = append(conn.Tags,
-				"network-monitor",
-				*environment,
-				*region,
-				string(conn.ServiceType),
-			)
+			conn.Tags = append(conn.Tags, "network-monitor")
+			for _, tag := range []string{*environment, *region} {
+				if tag != "" {
+					conn.Tags = append(conn.Tags, tag)
+				}
+			}
+			conn.Tags = append(conn.Tags, string(conn.ServiceType))
 
 			// Add service-specific tags
 			if conn.ServiceType == models.ServiceTypeDatabase {
@@ -102,13 +292,14 @@ func sendDataToServer(connChan <-chan *models.Connection) {
 				conn.Tags = append(conn.Tags, string(conn.MessageQueueType))
 			}
 
-			// Add metadata
-			conn.Metadata = map[string]interface{}{
-				"collector_version": "1.0.0",
-				"os":                "darwin",
-				"start_time":        time.Now().Format(time.RFC3339),
-				"service_type":      conn.ServiceType,
+			// Add metadata, keeping anything the monitor already recorded
+			if conn.Metadata == nil {
+				conn.Metadata = make(map[string]interface{})
 			}
+			conn.Metadata["collector_version"] = "1.0.0"
+			conn.Metadata["os"] = "darwin"
+			conn.Metadata["start_time"] = time.Now().Format(time.RFC3339)
+			conn.Metadata["service_type"] = conn.ServiceType
 
 			// Add service-specific metadata
 			if conn.ServiceType == models.ServiceTypeDatabase {
@@ -146,3 +337,199 @@ func sendDataToServer(connChan <-chan *models.Connection) {
 		}
 	}
 }
+
+// connectionKey identifies a connection for deduplication. Sockets in
+// different network namespaces can share a 5-tuple, so the namespace, or
+// failing that the container, is part of the key.
+func connectionKey(conn *models.Connection) string {
+	scope := conn.ContainerID
+	if ns, ok := conn.Metadata["netns"]; ok {
+		scope = fmt.Sprint(ns)
+	}
+	return fmt.Sprintf("%s/%s:%d-%s:%d", scope, conn.SourceIP, conn.SourcePort, conn.DestIP, conn.DestPort)
+}
+
+// hasTag reports whether a connection carries a tag
+func hasTag(conn *models.Connection, tag string) bool {
+	for _, t := range conn.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// reportFlows rolls connections up into flow summaries and sends those
+// counted over each interval to the server in place of the connections
+func reportFlows(connChan <-chan *models.Connection, every time.Duration) {
+	hostname := *host
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	summaries := flows.NewAggregator(every)
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case conn := <-connChan:
+			summaries.Add(conn)
+
+		case now := <-ticker.C:
+			done := summaries.Flush(now)
+			if len(done) == 0 {
+				continue
+			}
+			for _, f := range done {
+				f.Host = hostname
+				f.Environment = *environment
+				f.ServiceName = *serviceName
+				f.DeploymentID = *deploymentID
+				f.Region = *region
+			}
+			if err := postJSON("/api/flows", done); err != nil {
+				log.Printf("Error sending flow summaries to server: %v", err)
+			}
+		}
+	}
+}
+
+// reportListeners sends a snapshot of the host's listening sockets to the
+// server at every interval
+func reportListeners(source monitor.ListenerSource, every time.Duration) {
+	hostname := *host
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		listeners, err := source.Listeners()
+		if err != nil {
+			log.Printf("Error listing listening sockets: %v", err)
+		} else {
+			snapshot := models.ListenerSnapshot{
+				Host:        hostname,
+				Environment: *environment,
+				ServiceName: *serviceName,
+				Timestamp:   time.Now(),
+				Listeners:   listeners,
+			}
+			if err := postJSON("/api/listeners", &snapshot); err != nil {
+				log.Printf("Error sending listening sockets to server: %v", err)
+			}
+		}
+		<-ticker.C
+	}
+}
+
+// reportPools sends the host's database and cache connection pools to the
+// server at every interval
+func reportPools(sampler *monitor.PoolSampler, every time.Duration) {
+	hostname := *host
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		samples, err := sampler.Sample(time.Now())
+		if err != nil {
+			log.Printf("Error sampling connection pools: %v", err)
+		} else if len(samples) > 0 {
+			for i := range samples {
+				samples[i].Host = hostname
+				samples[i].Environment = *environment
+				samples[i].ServiceName = *serviceName
+			}
+			if err := postJSON("/api/pools/samples", samples); err != nil {
+				log.Printf("Error sending connection pools to server: %v", err)
+			}
+		}
+		<-ticker.C
+	}
+}
+
+// reportHTTPMetrics sends the HTTP requests counted over each interval to
+// the server
+func reportHTTPMetrics(requests *httpmetrics.Aggregator, every time.Duration) {
+	hostname := *host
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		metrics := requests.Flush(now)
+		if len(metrics) == 0 {
+			continue
+		}
+		for _, m := range metrics {
+			m.Host = hostname
+			m.Environment = *environment
+			m.ServiceName = *serviceName
+		}
+		if err := postJSON("/api/http/metrics", metrics); err != nil {
+			log.Printf("Error sending HTTP metrics to server: %v", err)
+		}
+	}
+}
+
+// certificateResend is how often a chain still being presented by the same
+// endpoint is sent again, keeping its last seen time current
+const certificateResend = 10 * time.Minute
+
+// reportCertificates sends certificate chains to the server, skipping
+// chains already sent for an endpoint within certificateResend
+func reportCertificates(observations <-chan *models.CertificateObservation) {
+	hostname := *host
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+
+	sent := make(map[string]time.Time)
+	for obs := range observations {
+		key := fmt.Sprintf("%s:%d/%s/%x", obs.DestIP, obs.DestPort, obs.ServerName, sha256.Sum256(obs.Chain[0]))
+		if last, ok := sent[key]; ok && obs.Timestamp.Sub(last) < certificateResend {
+			continue
+		}
+		for k, last := range sent {
+			if obs.Timestamp.Sub(last) >= certificateResend {
+				delete(sent, k)
+			}
+		}
+
+		obs.Host = hostname
+		obs.Environment = *environment
+		obs.ServiceName = *serviceName
+		if err := postJSON("/api/certificates", obs); err != nil {
+			log.Printf("Error sending certificate chain to server: %v", err)
+			continue
+		}
+		sent[key] = obs.Timestamp
+	}
+}
+
+// postJSON posts a value to a server endpoint
+func postJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(*serverURL+path, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("server returned unexpected status: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -3,29 +3,185 @@ package main
 import (
 	"flag"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/karthik-minnikanti/cinnamon/internal/anomaly"
 	"github.com/karthik-minnikanti/cinnamon/internal/api"
+	"github.com/karthik-minnikanti/cinnamon/internal/certs"
+	"github.com/karthik-minnikanti/cinnamon/internal/detect"
+	"github.com/karthik-minnikanti/cinnamon/internal/enrich"
+	"github.com/karthik-minnikanti/cinnamon/internal/queues"
+	"github.com/karthik-minnikanti/cinnamon/internal/security"
 	"github.com/karthik-minnikanti/cinnamon/internal/storage"
 )
 
 var (
 	port   = flag.String("port", "8080", "Server port")
 	dbPath = flag.String("db", "network.db", "Database path")
+	driver = flag.String("storage-driver", "sqlite", "Storage backend: sqlite, postgres or memory")
+	dsn    = flag.String("dsn", "", "Storage connection string (defaults to --db for sqlite, capacity for memory)")
+
+	cacheWindow   = flag.Duration("cache-window", 0, "Keep this much recent data in memory in front of the storage backend (0 disables)")
+	cacheCapacity = flag.Int("cache-capacity", storage.DefaultMemoryCapacity, "Maximum connections held by the cache")
+	geoip         = flag.String("geoip", "", "Comma-separated GeoIP/ASN CSV files used to enrich destinations")
+	rdns          = flag.Bool("rdns", false, "Resolve destination addresses to reverse DNS names")
+
+	k8sSnapshot  = flag.String("k8s-snapshot", "", "JSON pod/service list (kubectl get pods,services -A -o json) used for Kubernetes enrichment")
+	k8sAPI       = flag.String("k8s-api", "", "Kubernetes API server to watch for pod metadata, or \"in-cluster\"")
+	k8sTokenFile = flag.String("k8s-token-file", "", "Bearer token file for the Kubernetes API server")
+	k8sCAFile    = flag.String("k8s-ca-file", "", "CA certificate file for the Kubernetes API server")
+	k8sInsecure  = flag.Bool("k8s-insecure", false, "Skip TLS verification of the Kubernetes API server")
+
+	queueClusters = flag.String("queue-clusters", "", "JSON file describing Kafka and RabbitMQ clusters, their bootstrap addresses and brokers")
+
+	listenerAlertEnvs = flag.String("listener-alert-envs", "production", "Comma-separated environments whose new listening sockets raise security events")
+
+	anomalyInterval  = flag.Duration("anomaly-interval", 0, "Roll connections up over this interval and detect anomalies (0 disables)")
+	anomalyWindow    = flag.Int("anomaly-window", anomaly.DefaultConfig.Window, "Number of intervals in an anomaly baseline")
+	anomalyThreshold = flag.Float64("anomaly-threshold", anomaly.DefaultConfig.Threshold, "Robust z-score at which a deviation is reported")
+	anomalyWebhook   = flag.String("anomaly-webhook", "", "URL to POST each detected anomaly to as JSON")
+
+	certExpiryAlert = flag.Duration("cert-expiry-alert", 30*24*time.Hour, "Report certificates expiring within this long as cert_expiry anomalies (0 disables)")
+
+	detectPatterns     = flag.Bool("detect", true, "Detect port scans, SYN floods and retry storms in ingested connections")
+	portScanWindow     = flag.Duration("port-scan-window", detect.DefaultConfig.PortScanWindow, "Window in which one source touching many ports on a host is a port scan")
+	portScanPorts      = flag.Int("port-scan-ports", detect.DefaultConfig.PortScanPorts, "Distinct ports within the window that make a port scan")
+	synFloodWindow     = flag.Duration("syn-flood-window", detect.DefaultConfig.SynFloodWindow, "Window in which half-open sockets to one endpoint are counted")
+	synFloodSockets    = flag.Int("syn-flood-sockets", detect.DefaultConfig.SynFloodSockets, "Half-open sockets within the window that make a SYN flood")
+	retryStormWindow   = flag.Duration("retry-storm-window", detect.DefaultConfig.RetryStormWindow, "Window in which failed attempts to one destination are counted")
+	retryStormFailures = flag.Int("retry-storm-failures", detect.DefaultConfig.RetryStormFailures, "Failed attempts within the window that make a retry storm")
 )
 
 func main() {
 	flag.Parse()
 
 	// Initialize storage
-	store, err := storage.NewSQLiteStorage(*dbPath)
+	if *dsn == "" && *driver != "memory" {
+		if *driver != "sqlite" {
+			log.Fatalf("--dsn is required for the %s storage driver", *driver)
+		}
+		*dsn = *dbPath
+	}
+	store, err := storage.Open(*driver, *dsn)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
+	if *cacheWindow > 0 && *driver != "memory" {
+		store = storage.NewCachedStorage(store, *cacheWindow, *cacheCapacity)
+	}
 	defer store.Close()
+	// Optional stores are implemented by the backend behind any cache
+	backend := storage.Backend(store)
 
 	// Initialize server
 	server := api.NewServer(store)
 
+	// Destination enrichment
+	enrichers := enrich.Chain{enrich.ScopeEnricher{}}
+	if *rdns {
+		enrichers = append(enrichers, enrich.NewReverseDNS())
+	}
+	if *geoip != "" {
+		db := enrich.NewGeoIPDatabase()
+		for _, path := range strings.Split(*geoip, ",") {
+			if err := db.LoadFile(strings.TrimSpace(path)); err != nil {
+				log.Fatalf("Failed to load GeoIP database: %v", err)
+			}
+		}
+		enrichers = append(enrichers, db)
+	}
+	if *k8sSnapshot != "" || *k8sAPI != "" {
+		k8s := enrich.NewKubernetesProvider()
+		if *k8sSnapshot != "" {
+			if err := k8s.LoadSnapshotFile(*k8sSnapshot); err != nil {
+				log.Fatalf("Failed to load Kubernetes snapshot: %v", err)
+			}
+		}
+		if *k8sAPI != "" {
+			config := enrich.KubernetesConfig{
+				APIServer: *k8sAPI,
+				TokenFile: *k8sTokenFile,
+				CAFile:    *k8sCAFile,
+				Insecure:  *k8sInsecure,
+			}
+			if *k8sAPI == "in-cluster" {
+				if config, err = enrich.InClusterConfig(); err != nil {
+					log.Fatalf("Failed to configure Kubernetes client: %v", err)
+				}
+			}
+			if err := k8s.Watch(config); err != nil {
+				log.Fatalf("Failed to watch Kubernetes API: %v", err)
+			}
+			defer k8s.Stop()
+		}
+		enrichers = append(enrichers, k8s)
+	}
+
+	// Message queue clusters
+	topology, _ := queues.NewTopology(nil)
+	if *queueClusters != "" {
+		if topology, err = queues.LoadTopologyFile(*queueClusters); err != nil {
+			log.Fatalf("Failed to load queue clusters: %v", err)
+		}
+	}
+	enrichers = append(enrichers, topology)
+	server.SetQueueTopology(topology)
+	server.SetEnricher(enrichers)
+
+	// Egress policies and new destination detection
+	if securityStore, ok := backend.(storage.SecurityStore); ok {
+		guard, err := security.NewGuard(securityStore)
+		if err != nil {
+			log.Fatalf("Failed to initialize egress policies: %v", err)
+		}
+		guard.SetListenerEnvironments(splitList(*listenerAlertEnvs))
+		server.SetGuard(guard)
+	}
+
+	var notifiers []anomaly.Notifier
+	if *anomalyWebhook != "" {
+		notifiers = append(notifiers, anomaly.NewWebhook(*anomalyWebhook))
+	}
+
+	// Port scan, SYN flood and retry storm detection
+	if *detectPatterns {
+		config := detect.Config{
+			PortScanWindow:     *portScanWindow,
+			PortScanPorts:      *portScanPorts,
+			SynFloodWindow:     *synFloodWindow,
+			SynFloodSockets:    *synFloodSockets,
+			RetryStormWindow:   *retryStormWindow,
+			RetryStormFailures: *retryStormFailures,
+		}
+		securityStore, _ := backend.(storage.SecurityStore)
+		anomalyStore, _ := backend.(storage.AnomalyStore)
+		if securityStore != nil || anomalyStore != nil {
+			server.AddObserver(detect.NewEngine(config, securityStore, anomalyStore, notifiers...))
+		}
+	}
+
+	// Certificate inventory and expiry alerts
+	if certificateStore, ok := backend.(storage.CertificateStore); ok {
+		anomalyStore, _ := backend.(storage.AnomalyStore)
+		server.SetCertificateInventory(certs.NewInventory(certificateStore, anomalyStore, *certExpiryAlert, notifiers...))
+	}
+
+	// Anomaly detection
+	if *anomalyInterval > 0 {
+		config := anomaly.DefaultConfig
+		config.Interval = *anomalyInterval
+		config.Window = *anomalyWindow
+		config.Threshold = *anomalyThreshold
+		monitor := anomaly.NewMonitor(store, config, notifiers...)
+		if err := monitor.WarmUp(time.Now()); err != nil {
+			log.Fatalf("Failed to learn anomaly baselines: %v", err)
+		}
+		stop := make(chan struct{})
+		defer close(stop)
+		go monitor.Run(stop)
+	}
+
 	// Start server
 	addr := ":" + *port
 	log.Printf("Starting server on %s", addr)
@@ -33,3 +189,14 @@ func main() {
 		log.Fatalf("Server error: %v", err)
 	}
 }
+
+// splitList splits a comma-separated flag, dropping empty items
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,277 @@
+// Package aggregate groups connections by arbitrary dimensions and computes
+// metrics per group, e.g. p95 latency per service and destination port. It
+// streams through Storage.IterateConnections, so it works on every backend.
+package aggregate
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// Dimensions connections can be grouped by. A connection is counted once in
+// the group of each of its tags, and under "" when it has none.
+var Dimensions = []string{
+	"service_name", "host", "environment", "region", "dest_ip", "dest_port",
+	"error", "service_type", "deployment_id", "direction", "tag",
+}
+
+// Metrics that can be computed per group
+var Metrics = []string{
+	"count", "error_count", "error_rate", "avg_latency", "p95_latency",
+	"sum_bytes", "sum_bytes_sent", "sum_bytes_received",
+}
+
+// Limits on the number of groups returned
+const (
+	DefaultLimit = 10
+	MaxLimit     = 1000
+)
+
+// Request describes an aggregation
+type Request struct {
+	GroupBy []string
+	Metrics []string
+	// OrderBy is the metric groups are ranked by, descending; it defaults to
+	// the first metric
+	OrderBy string
+	// Limit is the number of top groups returned
+	Limit  int
+	Filter storage.ConnectionFilter
+}
+
+// Group is one combination of dimension values
+type Group struct {
+	Key     map[string]string  `json:"key"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+// Result holds the top groups
+type Result struct {
+	GroupBy []string `json:"group_by"`
+	Metrics []string `json:"metrics"`
+	OrderBy string   `json:"order_by"`
+	Groups  []Group  `json:"groups"`
+	// TotalGroups counts every group, including those beyond the limit
+	TotalGroups int `json:"total_groups"`
+}
+
+// Validate fills defaults and checks dimension and metric names
+func (r *Request) Validate() error {
+	if r.GroupBy == nil {
+		r.GroupBy = []string{}
+	}
+	for _, d := range r.GroupBy {
+		if !contains(Dimensions, d) {
+			return fmt.Errorf("unknown dimension %q (known: %s)", d, strings.Join(Dimensions, ", "))
+		}
+	}
+	if len(r.Metrics) == 0 {
+		r.Metrics = []string{"count"}
+	}
+	for _, m := range r.Metrics {
+		if !contains(Metrics, m) {
+			return fmt.Errorf("unknown metric %q (known: %s)", m, strings.Join(Metrics, ", "))
+		}
+	}
+	if r.OrderBy == "" {
+		r.OrderBy = r.Metrics[0]
+	} else if !contains(r.Metrics, r.OrderBy) {
+		return fmt.Errorf("order_by %q must be one of the requested metrics", r.OrderBy)
+	}
+	if r.Limit <= 0 {
+		r.Limit = DefaultLimit
+	}
+	if r.Limit > MaxLimit {
+		r.Limit = MaxLimit
+	}
+	return nil
+}
+
+// accumulator collects the raw values of one group
+type accumulator struct {
+	key           []string
+	count         int64
+	errors        int64
+	latencySum    float64
+	latencies     []float64 // only kept when p95 is requested
+	bytesSent     int64
+	bytesReceived int64
+}
+
+// Run aggregates the connections matching the request's filter
+func Run(store storage.Storage, req Request) (*Result, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	keepLatencies := contains(req.Metrics, "p95_latency")
+
+	groups := make(map[string]*accumulator)
+	err := store.IterateConnections(req.Filter, func(conn *models.Connection) error {
+		for _, key := range keys(conn, req.GroupBy) {
+			id := strings.Join(key, "\x00")
+			acc, ok := groups[id]
+			if !ok {
+				acc = &accumulator{key: key}
+				groups[id] = acc
+			}
+			acc.count++
+			if conn.Error != "" {
+				acc.errors++
+			}
+			acc.latencySum += conn.Latency
+			if keepLatencies {
+				acc.latencies = append(acc.latencies, conn.Latency)
+			}
+			acc.bytesSent += conn.BytesSent
+			acc.bytesReceived += conn.BytesReceived
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		GroupBy:     req.GroupBy,
+		Metrics:     req.Metrics,
+		OrderBy:     req.OrderBy,
+		Groups:      make([]Group, 0, len(groups)),
+		TotalGroups: len(groups),
+	}
+	for _, acc := range groups {
+		g := Group{Key: make(map[string]string, len(req.GroupBy)), Metrics: make(map[string]float64, len(req.Metrics))}
+		for i, d := range req.GroupBy {
+			g.Key[d] = acc.key[i]
+		}
+		for _, m := range req.Metrics {
+			g.Metrics[m] = acc.metric(m)
+		}
+		result.Groups = append(result.Groups, g)
+	}
+
+	sort.Slice(result.Groups, func(i, j int) bool {
+		a, b := result.Groups[i], result.Groups[j]
+		if a.Metrics[req.OrderBy] != b.Metrics[req.OrderBy] {
+			return a.Metrics[req.OrderBy] > b.Metrics[req.OrderBy]
+		}
+		// Ties are broken by key so results are stable
+		for _, d := range req.GroupBy {
+			if a.Key[d] != b.Key[d] {
+				return a.Key[d] < b.Key[d]
+			}
+		}
+		return false
+	})
+	if len(result.Groups) > req.Limit {
+		result.Groups = result.Groups[:req.Limit]
+	}
+	return result, nil
+}
+
+func (a *accumulator) metric(name string) float64 {
+	switch name {
+	case "count":
+		return float64(a.count)
+	case "error_count":
+		return float64(a.errors)
+	case "error_rate":
+		return float64(a.errors) / float64(a.count)
+	case "avg_latency":
+		return a.latencySum / float64(a.count)
+	case "p95_latency":
+		return percentile(a.latencies, 0.95)
+	case "sum_bytes":
+		return float64(a.bytesSent + a.bytesReceived)
+	case "sum_bytes_sent":
+		return float64(a.bytesSent)
+	case "sum_bytes_received":
+		return float64(a.bytesReceived)
+	}
+	return 0
+}
+
+// percentile returns the nearest-rank percentile p of values, sorting them
+// in place
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	rank := int(math.Ceil(p*float64(len(values)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return values[rank]
+}
+
+// keys returns the group keys of a connection: one, or one per tag when
+// grouping by tag
+func keys(conn *models.Connection, dimensions []string) [][]string {
+	key := make([]string, len(dimensions))
+	tagIndex := -1
+	for i, d := range dimensions {
+		if d == "tag" {
+			tagIndex = i
+			continue
+		}
+		key[i] = value(conn, d)
+	}
+	if tagIndex < 0 || len(conn.Tags) == 0 {
+		return [][]string{key}
+	}
+
+	// Duplicate tags are counted once
+	seen := make(map[string]bool, len(conn.Tags))
+	var out [][]string
+	for _, tag := range conn.Tags {
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		k := append([]string(nil), key...)
+		k[tagIndex] = tag
+		out = append(out, k)
+	}
+	return out
+}
+
+func value(conn *models.Connection, dimension string) string {
+	switch dimension {
+	case "service_name":
+		return conn.ServiceName
+	case "host":
+		return conn.Host
+	case "environment":
+		return conn.Environment
+	case "region":
+		return conn.Region
+	case "dest_ip":
+		return conn.DestIP
+	case "dest_port":
+		return strconv.Itoa(conn.DestPort)
+	case "error":
+		return conn.Error
+	case "service_type":
+		return string(conn.ServiceType)
+	case "deployment_id":
+		return conn.DeploymentID
+	case "direction":
+		return string(conn.Direction)
+	}
+	return ""
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package aggregate
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+func TestValidate(t *testing.T) {
+	req := Request{}
+	if err := req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	want := Request{GroupBy: []string{}, Metrics: []string{"count"}, OrderBy: "count", Limit: DefaultLimit}
+	if !reflect.DeepEqual(req, want) {
+		t.Errorf("defaults = %+v, want %+v", req, want)
+	}
+	req = Request{Limit: 5000}
+	if req.Validate(); req.Limit != MaxLimit {
+		t.Errorf("Limit = %d, want it capped at %d", req.Limit, MaxLimit)
+	}
+
+	for _, tc := range []struct {
+		req Request
+		err string
+	}{
+		{Request{GroupBy: []string{"service_name", "pod"}}, `unknown dimension "pod"`},
+		{Request{Metrics: []string{"count", "p99_latency"}}, `unknown metric "p99_latency"`},
+		{Request{Metrics: []string{"count"}, OrderBy: "error_rate"}, `order_by "error_rate" must be one of the requested metrics`},
+	} {
+		if err := tc.req.Validate(); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Validate(%+v) = %v, want %q", tc.req, err, tc.err)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	hundred := make([]float64, 100)
+	for i := range hundred {
+		hundred[len(hundred)-1-i] = float64(i + 1)
+	}
+	for _, tc := range []struct {
+		values []float64
+		p      float64
+		want   float64
+	}{
+		{nil, 0.95, 0},
+		{[]float64{7}, 0.95, 7},
+		{hundred, 0.95, 95},
+		{hundred, 0.5, 50},
+		{[]float64{3, 1, 2}, 0.95, 3},
+		{[]float64{3, 1, 2}, 0, 1},
+	} {
+		if got := percentile(append([]float64(nil), tc.values...), tc.p); got != tc.want {
+			t.Errorf("percentile(%v, %v) = %v, want %v", tc.values, tc.p, got, tc.want)
+		}
+	}
+}
+
+func describe(result *Result) []string {
+	lines := []string{}
+	for _, g := range result.Groups {
+		var parts []string
+		for _, d := range result.GroupBy {
+			parts = append(parts, d+"="+g.Key[d])
+		}
+		for _, m := range result.Metrics {
+			parts = append(parts, fmt.Sprintf("%s=%g", m, g.Metrics[m]))
+		}
+		lines = append(lines, strings.Join(parts, " "))
+	}
+	return lines
+}
+
+func TestRun(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	store := storage.NewMemoryStorage(100)
+	id := 0
+	add := func(service string, port int, latency float64, errorCode string, tags ...string) {
+		id++
+		err := store.StoreConnection(&models.Connection{
+			ID:            fmt.Sprint("c", id),
+			Timestamp:     base.Add(time.Duration(id) * time.Second),
+			ServiceName:   service,
+			DestIP:        "10.0.0.5",
+			DestPort:      port,
+			Latency:       latency,
+			Error:         errorCode,
+			BytesSent:     100,
+			BytesReceived: 50,
+			Tags:          tags,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i <= 20; i++ {
+		errorCode := ""
+		if i%5 == 0 {
+			errorCode = "ETIMEDOUT"
+		}
+		// A repeated tag counts the connection once
+		add("checkout", 5432, float64(i), errorCode, "db", "critical", "db")
+	}
+	for i := 0; i < 5; i++ {
+		add("checkout", 6379, 2, "", "cache")
+	}
+	for i := 0; i < 10; i++ {
+		errorCode := ""
+		if i == 0 {
+			errorCode = "ECONNRESET"
+		}
+		add("billing", 5432, 100, errorCode)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		req   Request
+		want  []string
+		total int
+	}{
+		{
+			"top groups by p95",
+			Request{GroupBy: []string{"service_name", "dest_port"}, Metrics: []string{"count", "p95_latency", "error_rate"}, OrderBy: "p95_latency", Limit: 2},
+			[]string{
+				"service_name=billing dest_port=5432 count=10 p95_latency=100 error_rate=0.1",
+				"service_name=checkout dest_port=5432 count=20 p95_latency=19 error_rate=0.2",
+			},
+			3,
+		},
+		{
+			"tags, ties broken by key",
+			Request{GroupBy: []string{"tag"}, Metrics: []string{"count", "sum_bytes"}},
+			[]string{
+				"tag=critical count=20 sum_bytes=3000",
+				"tag=db count=20 sum_bytes=3000",
+				"tag= count=10 sum_bytes=1500",
+				"tag=cache count=5 sum_bytes=750",
+			},
+			4,
+		},
+		{
+			"everything in one group",
+			Request{Metrics: []string{"count", "error_count", "avg_latency", "sum_bytes_sent", "sum_bytes_received"}, Filter: storage.ConnectionFilter{Service: "checkout"}},
+			[]string{"count=25 error_count=4 avg_latency=8.8 sum_bytes_sent=2500 sum_bytes_received=1250"},
+			1,
+		},
+		{
+			"by error",
+			Request{GroupBy: []string{"dest_port", "error"}},
+			[]string{
+				"dest_port=5432 error= count=25",
+				"dest_port=6379 error= count=5",
+				"dest_port=5432 error=ETIMEDOUT count=4",
+				"dest_port=5432 error=ECONNRESET count=1",
+			},
+			4,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Run(store, tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := describe(result)
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") || result.TotalGroups != tc.total {
+				t.Errorf("groups (of %d):\n%s\nwant (of %d):\n%s", result.TotalGroups, strings.Join(got, "\n"), tc.total, strings.Join(tc.want, "\n"))
+			}
+		})
+	}
+
+	if _, err := Run(store, Request{GroupBy: []string{"pod"}}); err == nil {
+		t.Error("Run accepted an unknown dimension")
+	}
+}
@@ -0,0 +1,187 @@
+package anomaly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// replayChunk is the span of connections read from storage at a time
+const replayChunk = time.Hour
+
+// Replay feeds the stored connections in [start, end) to d in time order,
+// closing every interval that ends by end, and passes each anomaly to fn
+func Replay(store storage.Storage, d *Detector, start, end time.Time, fn func(*models.Anomaly) error) error {
+	emit := func(anomalies []*models.Anomaly) error {
+		for _, a := range anomalies {
+			if err := fn(a); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	chunk := replayChunk
+	if chunk < d.config.Interval {
+		chunk = d.config.Interval
+	}
+	for from := start; from.Before(end); from = from.Add(chunk) {
+		to := from.Add(chunk)
+		if to.After(end) {
+			to = end
+		}
+
+		// IterateConnections is newest first and its End is inclusive
+		var conns []*models.Connection
+		filter := storage.ConnectionFilter{Start: from, End: to.Add(-time.Nanosecond)}
+		err := store.IterateConnections(filter, func(conn *models.Connection) error {
+			conns = append(conns, conn)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read connections: %v", err)
+		}
+		for i := len(conns) - 1; i >= 0; i-- {
+			if err := emit(d.Observe(conns[i])); err != nil {
+				return err
+			}
+		}
+	}
+	return emit(d.Advance(end))
+}
+
+// Backtest runs a fresh detector over the stored connections in
+// [start, end) and returns the anomalies it would have raised
+func Backtest(store storage.Storage, config Config, start, end time.Time) ([]*models.Anomaly, error) {
+	anomalies := []*models.Anomaly{}
+	err := Replay(store, NewDetector(config), start, end, func(a *models.Anomaly) error {
+		anomalies = append(anomalies, a)
+		return nil
+	})
+	return anomalies, err
+}
+
+// Notifier is told about each new anomaly
+type Notifier interface {
+	Notify(a *models.Anomaly) error
+}
+
+// Webhook posts each anomaly as JSON to a URL
+type Webhook struct {
+	URL    string
+	client *http.Client
+}
+
+// NewWebhook creates a webhook notifier
+func NewWebhook(url string) *Webhook {
+	return &Webhook{URL: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (w *Webhook) Notify(a *models.Anomaly) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post anomaly: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Monitor runs a detector against live data, storing and announcing the
+// anomalies it finds
+type Monitor struct {
+	store     storage.Storage
+	detector  *Detector
+	notifiers []Notifier
+	// Delay holds each interval open this long after it ends so that
+	// connections reported late are still counted
+	Delay time.Duration
+	next  time.Time // start of the connections not yet read
+}
+
+// NewMonitor creates a monitor. store must implement storage.AnomalyStore
+// for anomalies to be kept.
+func NewMonitor(store storage.Storage, config Config, notifiers ...Notifier) *Monitor {
+	d := NewDetector(config)
+	return &Monitor{store: store, detector: d, notifiers: notifiers, Delay: d.config.Interval}
+}
+
+// WarmUp learns baselines from the last window of stored connections
+// without reporting anything
+func (m *Monitor) WarmUp(now time.Time) error {
+	cfg := m.detector.config
+	end := m.closedUntil(now)
+	start := end.Add(-time.Duration(cfg.Window) * cfg.Interval)
+	err := Replay(m.store, m.detector, start, end, func(*models.Anomaly) error { return nil })
+	if err != nil {
+		return err
+	}
+	m.next = end
+	return nil
+}
+
+// Check reads the connections of every interval closed since the last
+// check and handles the anomalies found in them
+func (m *Monitor) Check(now time.Time) error {
+	end := m.closedUntil(now)
+	if m.next.IsZero() {
+		m.next = end
+	}
+	if !end.After(m.next) {
+		return nil
+	}
+	err := Replay(m.store, m.detector, m.next, end, m.handle)
+	if err != nil {
+		return err
+	}
+	m.next = end
+	return nil
+}
+
+// Run checks once per interval until stop is closed
+func (m *Monitor) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(m.detector.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if err := m.Check(now); err != nil {
+				log.Printf("Anomaly detection failed: %v", err)
+			}
+		}
+	}
+}
+
+// closedUntil is the end of the last interval that can no longer change
+func (m *Monitor) closedUntil(now time.Time) time.Time {
+	return now.Add(-m.Delay).Truncate(m.detector.config.Interval)
+}
+
+func (m *Monitor) handle(a *models.Anomaly) error {
+	log.Printf("Anomaly: %s", a.Message)
+	if store, ok := storage.Backend(m.store).(storage.AnomalyStore); ok {
+		if err := store.StoreAnomaly(a); err != nil {
+			log.Printf("Failed to store anomaly: %v", err)
+		}
+	}
+	for _, n := range m.notifiers {
+		if err := n.Notify(a); err != nil {
+			log.Printf("Failed to send anomaly notification: %v", err)
+		}
+	}
+	return nil
+}
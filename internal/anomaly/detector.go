@@ -0,0 +1,375 @@
+// Package anomaly learns per-service and per-edge baselines from rolled-up
+// connections and reports spikes, drops, error bursts, new error types and
+// latency regressions.
+//
+// Connections are rolled up into fixed intervals. Each series, a service or
+// a service's edge to one destination, keeps a trailing window of rollups
+// and scores the newest against it with a robust z-score: the distance from
+// the window's median in units of its scaled median absolute deviation.
+// The median and MAD ignore the outliers they are meant to catch, so one
+// incident does not hide the next.
+package anomaly
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// Config tunes a Detector. Zero fields take the defaults.
+type Config struct {
+	// Interval is the rollup size
+	Interval time.Duration
+	// Window is the number of rollups in a baseline
+	Window int
+	// MinHistory is the number of rollups a series needs before it is scored
+	MinHistory int
+	// Threshold is the robust z-score that counts as anomalous
+	Threshold float64
+	// MinCount is the smallest absolute change in connections or errors
+	// that is reported, and the number of connections an interval needs for
+	// its latency to be scored
+	MinCount int
+}
+
+// DefaultConfig uses 5 minute rollups and a 24 hour baseline
+var DefaultConfig = Config{
+	Interval:   5 * time.Minute,
+	Window:     288,
+	MinHistory: 12,
+	Threshold:  4,
+	MinCount:   10,
+}
+
+func (c Config) withDefaults() Config {
+	if c.Interval <= 0 {
+		c.Interval = DefaultConfig.Interval
+	}
+	if c.Window <= 0 {
+		c.Window = DefaultConfig.Window
+	}
+	if c.MinHistory <= 0 {
+		c.MinHistory = DefaultConfig.MinHistory
+	}
+	if c.MinHistory > c.Window {
+		c.MinHistory = c.Window
+	}
+	if c.Threshold <= 0 {
+		c.Threshold = DefaultConfig.Threshold
+	}
+	if c.MinCount <= 0 {
+		c.MinCount = DefaultConfig.MinCount
+	}
+	return c
+}
+
+// seriesKey identifies a series; Destination is empty for a whole service
+type seriesKey struct {
+	Service     string
+	Destination string
+}
+
+// rollup aggregates one interval of a series
+type rollup struct {
+	count      int
+	errors     int
+	latencies  []float64
+	errorTypes map[string]bool
+}
+
+// series is the history of one service or edge
+type series struct {
+	counts  []float64
+	errors  []float64
+	p95s    []float64 // only intervals with enough connections
+	idle    int       // consecutive empty intervals
+	scored  int       // intervals seen
+	known   map[string]bool
+	ongoing map[models.AnomalyKind]bool // reported and not yet recovered
+}
+
+// Detector consumes connections in time order. It is not safe for
+// concurrent use.
+type Detector struct {
+	config  Config
+	series  map[seriesKey]*series
+	open    map[seriesKey]*rollup
+	current time.Time // start of the open interval; zero before any data
+}
+
+// NewDetector creates a detector
+func NewDetector(config Config) *Detector {
+	return &Detector{
+		config: config.withDefaults(),
+		series: make(map[seriesKey]*series),
+		open:   make(map[seriesKey]*rollup),
+	}
+}
+
+// Config returns the detector's effective configuration
+func (d *Detector) Config() Config {
+	return d.config
+}
+
+// Observe adds a connection to its interval, first closing any earlier
+// intervals. Connections older than the open interval are ignored.
+func (d *Detector) Observe(conn *models.Connection) []*models.Anomaly {
+	if conn.ServiceName == "" {
+		return nil
+	}
+	start := conn.Timestamp.Truncate(d.config.Interval)
+	var anomalies []*models.Anomaly
+	if d.current.IsZero() {
+		d.current = start
+	} else if start.After(d.current) {
+		anomalies = d.Advance(start)
+	} else if start.Before(d.current) {
+		return nil
+	}
+
+	for _, key := range []seriesKey{{Service: conn.ServiceName}, {Service: conn.ServiceName, Destination: destination(conn)}} {
+		r := d.open[key]
+		if r == nil {
+			r = &rollup{errorTypes: make(map[string]bool)}
+			d.open[key] = r
+		}
+		r.count++
+		if conn.Error != "" {
+			r.errors++
+			r.errorTypes[conn.Error] = true
+		}
+		r.latencies = append(r.latencies, conn.Latency)
+	}
+	return anomalies
+}
+
+// Advance closes every interval that ends at or before t and scores it
+func (d *Detector) Advance(t time.Time) []*models.Anomaly {
+	if d.current.IsZero() {
+		d.current = t.Truncate(d.config.Interval)
+		return nil
+	}
+
+	var anomalies []*models.Anomaly
+	for !d.current.Add(d.config.Interval).After(t) {
+		anomalies = append(anomalies, d.close()...)
+		d.current = d.current.Add(d.config.Interval)
+
+		// Skip stretches with no data at all; they would only age every
+		// series without scoring anything
+		if len(d.series) == 0 {
+			d.current = t.Truncate(d.config.Interval)
+			break
+		}
+	}
+	return anomalies
+}
+
+// close scores the open interval of every known series and appends it to
+// their history
+func (d *Detector) close() []*models.Anomaly {
+	var anomalies []*models.Anomaly
+	for key := range d.open {
+		if d.series[key] == nil {
+			d.series[key] = &series{known: make(map[string]bool), ongoing: make(map[models.AnomalyKind]bool)}
+		}
+	}
+
+	// Deterministic order keeps backtests reproducible
+	keys := make([]seriesKey, 0, len(d.series))
+	for key := range d.series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Service != keys[j].Service {
+			return keys[i].Service < keys[j].Service
+		}
+		return keys[i].Destination < keys[j].Destination
+	})
+
+	for _, key := range keys {
+		s := d.series[key]
+		r := d.open[key]
+		if r == nil {
+			r = &rollup{}
+		}
+		anomalies = append(anomalies, d.score(key, s, r)...)
+		s.record(r, d.config)
+
+		// Forget series idle for a whole window
+		if s.idle >= d.config.Window {
+			delete(d.series, key)
+		}
+	}
+	d.open = make(map[seriesKey]*rollup)
+	return anomalies
+}
+
+func (s *series) record(r *rollup, config Config) {
+	push := func(values []float64, v float64) []float64 {
+		values = append(values, v)
+		if len(values) > config.Window {
+			values = values[len(values)-config.Window:]
+		}
+		return values
+	}
+	s.counts = push(s.counts, float64(r.count))
+	s.errors = push(s.errors, float64(r.errors))
+	if r.count >= config.MinCount {
+		s.p95s = push(s.p95s, p95(r.latencies))
+	}
+	for t := range r.errorTypes {
+		s.known[t] = true
+	}
+	if r.count == 0 {
+		s.idle++
+	} else {
+		s.idle = 0
+	}
+	s.scored++
+}
+
+// score compares an interval with its series' baseline
+func (d *Detector) score(key seriesKey, s *series, r *rollup) []*models.Anomaly {
+	if s.scored < d.config.MinHistory {
+		return nil
+	}
+	cfg := d.config
+	var anomalies []*models.Anomaly
+	flag := func(kind models.AnomalyKind, anomalous bool, a *models.Anomaly) {
+		if !anomalous {
+			s.ongoing[kind] = false
+			return
+		}
+		if s.ongoing[kind] {
+			return
+		}
+		s.ongoing[kind] = true
+		anomalies = append(anomalies, d.event(key, kind, a))
+	}
+
+	// Volume; counts are roughly Poisson, so the scale is at least sqrt(median)
+	count := float64(r.count)
+	median, z := robustZ(s.counts, count, math.Sqrt)
+	flag(models.AnomalySpike, z >= cfg.Threshold && count-median >= float64(cfg.MinCount), &models.Anomaly{
+		Metric: "connections", Value: count, Baseline: median, Score: z,
+		Message: fmt.Sprintf("%.0f connections against a baseline of %.0f", count, median),
+	})
+	flag(models.AnomalyDrop, z <= -cfg.Threshold && median-count >= float64(cfg.MinCount), &models.Anomaly{
+		Metric: "connections", Value: count, Baseline: median, Score: z,
+		Message: fmt.Sprintf("%.0f connections against a baseline of %.0f", count, median),
+	})
+
+	// Errors
+	errors := float64(r.errors)
+	median, z = robustZ(s.errors, errors, math.Sqrt)
+	flag(models.AnomalyErrorSpike, z >= cfg.Threshold && errors-median >= float64(cfg.MinCount), &models.Anomaly{
+		Metric: "errors", Value: errors, Baseline: median, Score: z,
+		Message: fmt.Sprintf("%.0f errors against a baseline of %.0f", errors, median),
+	})
+
+	// New error types are reported every time they first appear
+	newTypes := make([]string, 0, len(r.errorTypes))
+	for t := range r.errorTypes {
+		if !s.known[t] {
+			newTypes = append(newTypes, t)
+		}
+	}
+	sort.Strings(newTypes)
+	for _, t := range newTypes {
+		anomalies = append(anomalies, d.event(key, models.AnomalyNewError, &models.Anomaly{
+			Metric:  "error:" + t,
+			Value:   1,
+			Message: fmt.Sprintf("first %s error in the baseline window", t),
+		}))
+	}
+
+	// Latency; a regression must also be 20% above the median so stable
+	// low-latency series do not flag jitter
+	if r.count >= cfg.MinCount && len(s.p95s) >= cfg.MinHistory {
+		latency := p95(r.latencies)
+		median, z = robustZ(s.p95s, latency, func(m float64) float64 { return math.Max(m*0.05, 1) })
+		flag(models.AnomalyLatencyRegression, z >= cfg.Threshold && latency >= median*1.2, &models.Anomaly{
+			Metric: "p95_latency_ms", Value: latency, Baseline: median, Score: z,
+			Message: fmt.Sprintf("p95 latency %.1fms against a baseline of %.1fms", latency, median),
+		})
+	}
+	return anomalies
+}
+
+// event fills in the identity of an anomaly. IDs are derived from the
+// series, kind, metric and interval, so replays produce the same IDs.
+func (d *Detector) event(key seriesKey, kind models.AnomalyKind, a *models.Anomaly) *models.Anomaly {
+	a.Timestamp = d.current
+	a.Kind = kind
+	a.ServiceName = key.Service
+	a.Destination = key.Destination
+	if key.Destination != "" {
+		a.Message = key.Service + " -> " + key.Destination + ": " + a.Message
+	} else {
+		a.Message = key.Service + ": " + a.Message
+	}
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%s|%s|%d", kind, key.Service, key.Destination, a.Metric, d.current.Unix())))
+	a.ID = hex.EncodeToString(sum[:8])
+	return a
+}
+
+// robustZ scores v against history, returning the median and z-score. The
+// scale is the MAD scaled to match a normal standard deviation, but never
+// less than floor(median) or 1.
+func robustZ(history []float64, v float64, floor func(median float64) float64) (float64, float64) {
+	median := median(history)
+	deviations := make([]float64, len(history))
+	for i, h := range history {
+		deviations[i] = math.Abs(h - median)
+	}
+	scale := math.Max(1.4826*medianInPlace(deviations), math.Max(floor(median), 1))
+	return median, (v - median) / scale
+}
+
+func median(values []float64) float64 {
+	return medianInPlace(append([]float64(nil), values...))
+}
+
+func medianInPlace(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
+
+// p95 returns the nearest-rank 95th percentile, sorting values in place
+func p95(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Float64s(values)
+	rank := int(math.Ceil(0.95*float64(len(values)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return values[rank]
+}
+
+// destination names an edge's far end
+func destination(conn *models.Connection) string {
+	host := conn.DestHostname
+	if host == "" {
+		host = conn.DestK8sService
+	}
+	if host == "" {
+		host = conn.DestIP
+	}
+	return host + ":" + strconv.Itoa(conn.DestPort)
+}
@@ -0,0 +1,177 @@
+package anomaly
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+var (
+	base       = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	testConfig = Config{Interval: 5 * time.Minute, Window: 48, MinHistory: 12, Threshold: 4, MinCount: 10}
+)
+
+// interval describes the traffic checkout sends to one destination in one
+// interval
+type interval struct {
+	count   int
+	latency float64 // mean; samples are normal with a 10% deviation
+	errors  int     // ECONNRESET, plus timeouts
+	timeout int     // ETIMEDOUT
+}
+
+// traffic generates four hours of checkout traffic to orders-db and a cache
+// with one incident of each kind against orders-db
+func traffic(seed int64) []*models.Connection {
+	rng := rand.New(rand.NewSource(seed))
+	var conns []*models.Connection
+	add := func(i int, host string, port int, iv interval) {
+		start := base.Add(time.Duration(i) * testConfig.Interval)
+		for n := 0; n < iv.count; n++ {
+			conn := &models.Connection{
+				ID:           fmt.Sprintf("%s-%d-%d", host, i, n),
+				Timestamp:    start.Add(time.Duration(rng.Int63n(int64(testConfig.Interval)))),
+				ServiceName:  "checkout",
+				DestHostname: host,
+				DestPort:     port,
+				Latency:      iv.latency * (1 + 0.1*rng.NormFloat64()),
+			}
+			switch {
+			case n < iv.timeout:
+				conn.Error = string(models.ErrConnTimeout)
+			case n < iv.timeout+iv.errors:
+				conn.Error = string(models.ErrConnReset)
+			}
+			conns = append(conns, conn)
+		}
+	}
+
+	for i := 0; i < 48; i++ {
+		db := interval{count: 45 + rng.Intn(11), latency: 20, errors: rng.Intn(3)}
+		if i == 0 {
+			db.errors = 1 // resets are part of the baseline
+		}
+		switch i {
+		case 20:
+			db.count = 150
+		case 28:
+			db.count = 5
+		case 36:
+			db.timeout = 3
+		case 42:
+			db.latency = 60
+		}
+		add(i, "orders-db", 5432, db)
+		add(i, "cache", 6379, interval{count: 27 + rng.Intn(7), latency: 5})
+	}
+	return conns
+}
+
+func describe(anomalies []*models.Anomaly) string {
+	lines := []string{}
+	for _, a := range anomalies {
+		i := int(a.Timestamp.Sub(base) / testConfig.Interval)
+		lines = append(lines, fmt.Sprintf("%d %s %s %s", i, a.Kind, a.ServiceName, a.Destination))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestBacktest(t *testing.T) {
+	want := strings.Join([]string{
+		"20 spike checkout ",
+		"20 spike checkout orders-db:5432",
+		"28 drop checkout ",
+		"28 drop checkout orders-db:5432",
+		"36 new_error checkout ",
+		"36 new_error checkout orders-db:5432",
+		"42 latency_regression checkout ",
+		"42 latency_regression checkout orders-db:5432",
+	}, "\n")
+
+	for _, seed := range []int64{1, 2, 3} {
+		t.Run(fmt.Sprint("seed ", seed), func(t *testing.T) {
+			store := storage.NewMemoryStorage(10000)
+			conns := traffic(seed)
+			for _, conn := range conns {
+				if err := store.StoreConnection(conn); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			end := base.Add(48 * testConfig.Interval)
+			anomalies, err := Backtest(store, testConfig, base, end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describe(anomalies); got != want {
+				t.Fatalf("anomalies:\n%s\nwant:\n%s", got, want)
+			}
+
+			// Feeding the same connections straight to a detector, in time
+			// order, raises the same anomalies with the same IDs
+			sort.SliceStable(conns, func(i, j int) bool { return conns[i].Timestamp.Before(conns[j].Timestamp) })
+			d := NewDetector(testConfig)
+			var direct []*models.Anomaly
+			for _, conn := range conns {
+				direct = append(direct, d.Observe(conn)...)
+			}
+			direct = append(direct, d.Advance(end)...)
+			for i := range anomalies {
+				if i >= len(direct) || direct[i].ID != anomalies[i].ID {
+					t.Fatalf("direct run:\n%s\nwant the backtest's anomalies", describe(direct))
+				}
+			}
+			if len(direct) != len(anomalies) {
+				t.Fatalf("direct run:\n%s\nwant the backtest's anomalies", describe(direct))
+			}
+		})
+	}
+}
+
+func TestDetectorIntervals(t *testing.T) {
+	d := NewDetector(Config{Interval: time.Minute, Window: 4, MinHistory: 2, MinCount: 1})
+	observe := func(minute int, errorCode string) []*models.Anomaly {
+		return d.Observe(&models.Connection{
+			Timestamp:   base.Add(time.Duration(minute)*time.Minute + time.Second),
+			ServiceName: "api",
+			DestIP:      "10.0.0.1",
+			DestPort:    80,
+			Error:       errorCode,
+		})
+	}
+
+	for minute := 0; minute < 3; minute++ {
+		if a := observe(minute, ""); len(a) != 0 {
+			t.Fatalf("minute %d: unexpected anomalies:\n%s", minute, describe(a))
+		}
+	}
+	// Connections older than the open interval are dropped
+	if a := observe(1, "ECONNREFUSED"); len(a) != 0 {
+		t.Fatalf("late connection raised:\n%s", describe(a))
+	}
+	if got := d.open[seriesKey{Service: "api"}].errors; got != 0 {
+		t.Errorf("late connection counted: %d errors", got)
+	}
+
+	// Advance only closes intervals that have ended
+	if a := d.Advance(base.Add(3*time.Minute - time.Second)); len(a) != 0 || !d.current.Equal(base.Add(2*time.Minute)) {
+		t.Fatalf("Advance closed an open interval: current %v", d.current)
+	}
+	observe(2, "ECONNREFUSED")
+	a := d.Advance(base.Add(3 * time.Minute))
+	if len(a) != 2 || a[0].Kind != models.AnomalyNewError || a[0].Metric != "error:ECONNREFUSED" {
+		t.Fatalf("anomalies:\n%s", describe(a))
+	}
+
+	// Series idle for a whole window are forgotten
+	d.Advance(base.Add(8 * time.Minute))
+	if len(d.series) != 0 {
+		t.Errorf("%d series kept after a window of silence", len(d.series))
+	}
+}
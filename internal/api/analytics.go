@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/aggregate"
+	"github.com/karthik-minnikanti/cinnamon/internal/compare"
+)
+
+// handleAggregate groups the connections in a time range, last 24 hours by
+// default, and returns the top groups by a metric
+func (s *Server) handleAggregate(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseConnectionFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter.Start, filter.End, err = parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	req := aggregate.Request{
+		GroupBy: splitList(q["group_by"]),
+		Metrics: splitList(q["metrics"]),
+		OrderBy: q.Get("order_by"),
+		Filter:  filter,
+	}
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid limit: %s", limit), http.StatusBadRequest)
+			return
+		}
+		req.Limit = n
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := aggregate.Run(s.storage, req)
+	if err != nil {
+		log.Printf("Error aggregating connections: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Printf("Error encoding aggregate: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleCompareDeployments contrasts two deployments of a service
+func (s *Server) handleCompareDeployments(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	req := compare.Request{
+		Service:   q.Get("service"),
+		Baseline:  q.Get("baseline"),
+		Candidate: q.Get("candidate"),
+	}
+	if req.Baseline == "" || req.Candidate == "" {
+		http.Error(w, "baseline and candidate are required", http.StatusBadRequest)
+		return
+	}
+	var err error
+	req.Start, req.End, err = parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := compare.Deployments(s.storage, req)
+	if err != nil {
+		log.Printf("Error comparing deployments: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.Printf("Error encoding deployment comparison: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
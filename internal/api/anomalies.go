@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// handleAnomalies lists detected anomalies, newest first
+func (s *Server) handleAnomalies(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.backend.(storage.AnomalyStore)
+	if !ok {
+		http.Error(w, "anomalies are not supported by this storage backend", http.StatusNotImplemented)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := storage.AnomalyFilter{
+		Service: q.Get("service"),
+		Kind:    models.AnomalyKind(q.Get("kind")),
+	}
+	var err error
+	filter.Start, filter.End, err = parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("invalid limit: %s", limit), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	anomalies, err := store.GetAnomalies(filter)
+	if err != nil {
+		log.Printf("Error getting anomalies: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(anomalies); err != nil {
+		log.Printf("Error encoding anomalies: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
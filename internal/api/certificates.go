@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/certs"
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// certificateStore returns the storage as a CertificateStore, answering 501
+// when the backend does not keep certificates
+func (s *Server) certificateStore(w http.ResponseWriter) (storage.CertificateStore, bool) {
+	store, ok := s.backend.(storage.CertificateStore)
+	if !ok {
+		http.Error(w, "certificates are not supported by this storage backend", http.StatusNotImplemented)
+	}
+	return store, ok
+}
+
+// handleCertificates lists the certificates servers presented, soonest to
+// expire first, or records a chain a collector observed
+func (s *Server) handleCertificates(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.certificateStore(w)
+	if !ok {
+		return
+	}
+	if r.Method == "POST" {
+		s.recordCertificates(w, r, store)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := storage.CertificateFilter{
+		IncludeCA:   q.Get("include_ca") == "true",
+		Host:        q.Get("host"),
+		Environment: q.Get("environment"),
+		Search:      q.Get("search"),
+	}
+	if within := q.Get("expiring_within"); within != "" {
+		d, err := parseDays(within)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid expiring_within: %s", within), http.StatusBadRequest)
+			return
+		}
+		filter.ExpiresBefore = time.Now().Add(d)
+	}
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("invalid limit: %s", limit), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	certificates, err := store.GetCertificates(filter)
+	if err != nil {
+		log.Printf("Error getting certificates: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(certificates); err != nil {
+		log.Printf("Error encoding certificates: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) recordCertificates(w http.ResponseWriter, r *http.Request, store storage.CertificateStore) {
+	var obs models.CertificateObservation
+	if err := json.NewDecoder(r.Body).Decode(&obs); err != nil {
+		log.Printf("Error decoding certificate chain: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if obs.Host == "" {
+		http.Error(w, "host is required", http.StatusBadRequest)
+		return
+	}
+	if len(obs.Chain) == 0 {
+		http.Error(w, "chain is required", http.StatusBadRequest)
+		return
+	}
+	if obs.Timestamp.IsZero() {
+		obs.Timestamp = time.Now()
+	}
+
+	inventory := s.inventory
+	if inventory == nil {
+		inventory = certs.NewInventory(store, nil, 0)
+	}
+	if _, err := certs.Parse(obs.Chain, obs.Timestamp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := inventory.Record(&obs); err != nil {
+		log.Printf("Error storing certificates: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// parseDays parses a duration such as "720h", or a bare number of days
+func parseDays(v string) (time.Duration, error) {
+	if days, err := strconv.Atoi(v); err == nil {
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(v)
+}
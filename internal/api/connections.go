@@ -0,0 +1,209 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/karthik-minnikanti/cinnamon/internal/export"
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/query"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		s.getConnections(w, r)
+	case "POST":
+		s.createConnection(w, r)
+	}
+}
+
+func (s *Server) getConnections(w http.ResponseWriter, r *http.Request) {
+	// Get filter parameters
+	filter, err := parseConnectionFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get connections with filters
+	connections, err := s.storage.GetConnections(filter)
+	if err != nil {
+		log.Printf("Error getting connections: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Create response object
+	response := struct {
+		Connections []*models.Connection `json:"connections"`
+	}{
+		Connections: connections,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding connections: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// parseConnectionFilter reads the connection filter query parameters
+func parseConnectionFilter(r *http.Request) (storage.ConnectionFilter, error) {
+	q := r.URL.Query()
+	filter := storage.ConnectionFilter{
+		Service:     q.Get("service"),
+		Error:       q.Get("error"),
+		Environment: q.Get("environment"),
+		Search:      q.Get("search"),
+		DestCountry: q.Get("dest_country"),
+		DestOrg:     q.Get("dest_org"),
+		DestScope:   q.Get("dest_scope"),
+		Namespace:   q.Get("k8s_namespace"),
+		Deployment:  q.Get("k8s_deployment"),
+		Pod:         q.Get("k8s_pod"),
+		Node:        q.Get("k8s_node"),
+		Container:   q.Get("container"),
+		Image:       q.Get("container_image"),
+		Tags:        q["tag"],
+		Live:        q.Get("live") == "true",
+	}
+
+	// metadata.<key>=value filters on a metadata value
+	for param, values := range q {
+		if key := strings.TrimPrefix(param, "metadata."); key != param && key != "" && len(values) > 0 {
+			if filter.Metadata == nil {
+				filter.Metadata = make(map[string]string)
+			}
+			filter.Metadata[key] = values[0]
+		}
+	}
+
+	if asn := q.Get("dest_asn"); asn != "" {
+		n, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(asn), "AS"))
+		if err != nil {
+			return filter, fmt.Errorf("invalid dest_asn: %s", asn)
+		}
+		filter.DestASN = n
+	}
+
+	for param, t := range map[string]*time.Time{"start": &filter.Start, "end": &filter.End} {
+		if v := q.Get(param); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s: %s", param, v)
+			}
+			*t = parsed
+		}
+	}
+
+	node, err := query.Parse(q.Get("q"))
+	if err != nil {
+		return filter, fmt.Errorf("invalid query: %v", err)
+	}
+	filter.Query = node
+
+	return filter, nil
+}
+
+// handleExport streams every connection matching the filters in the
+// requested format, without the row cap of /api/connections
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	contentType, ext, ok := export.ContentType(format)
+	if !ok {
+		http.Error(w, fmt.Sprintf("unsupported format: %s", format), http.StatusBadRequest)
+		return
+	}
+
+	filter, err := parseConnectionFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="connections-%s.%s"`, time.Now().UTC().Format("20060102T150405Z"), ext))
+
+	writer, err := export.NewWriter(format, w)
+	if err != nil {
+		log.Printf("Error creating %s writer: %v", format, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// The status is sent with the first row, so later failures can only
+	// truncate the download
+	rows := 0
+	err = s.storage.IterateConnections(filter, func(conn *models.Connection) error {
+		rows++
+		return writer.Write(conn)
+	})
+	if err != nil {
+		log.Printf("Error exporting connections after %d rows: %v", rows, err)
+		return
+	}
+	if err := writer.Close(); err != nil {
+		log.Printf("Error finishing %s export: %v", format, err)
+	}
+}
+
+func (s *Server) createConnection(w http.ResponseWriter, r *http.Request) {
+	var conn models.Connection
+	if err := json.NewDecoder(r.Body).Decode(&conn); err != nil {
+		log.Printf("Error decoding connection: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Set timestamp if not provided
+	if conn.Timestamp.IsZero() {
+		conn.Timestamp = time.Now()
+	}
+
+	// Add server-side context before storing
+	if s.enricher != nil {
+		s.enricher.Enrich(&conn)
+	}
+
+	if err := s.storage.StoreConnection(&conn); err != nil {
+		log.Printf("Error storing connection: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	for _, o := range s.observers {
+		o.Observe(&conn)
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) handleConnectionDetails(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	conn, err := s.storage.GetConnectionByID(id)
+	if err != nil {
+		log.Printf("Error getting connection details: %v", err)
+		http.Error(w, "Connection not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(conn); err != nil {
+		log.Printf("Error encoding connection details: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
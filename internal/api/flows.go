@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/flows"
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// flowStore returns the storage as a FlowStore, answering 501 when the
+// backend does not keep flow summaries
+func (s *Server) flowStore(w http.ResponseWriter) (storage.FlowStore, bool) {
+	store, ok := s.backend.(storage.FlowStore)
+	if !ok {
+		http.Error(w, "flow summaries are not supported by this storage backend", http.StatusNotImplemented)
+	}
+	return store, ok
+}
+
+// handleFlows lists the traffic from each service to each destination out
+// of collector flow summaries, or records a collector's summaries
+func (s *Server) handleFlows(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.flowStore(w)
+	if !ok {
+		return
+	}
+	if r.Method == "POST" {
+		s.recordFlows(w, r, store)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := storage.FlowFilter{
+		Service:     q.Get("service"),
+		Environment: q.Get("environment"),
+		Host:        q.Get("host"),
+	}
+	var err error
+	filter.Start, filter.End, err = parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	summaries, err := store.GetFlowSummaries(filter)
+	if err != nil {
+		log.Printf("Error getting flow summaries: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(flows.Edges(summaries)); err != nil {
+		log.Printf("Error encoding flows: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) recordFlows(w http.ResponseWriter, r *http.Request, store storage.FlowStore) {
+	var summaries []*models.FlowSummary
+	if err := json.NewDecoder(r.Body).Decode(&summaries); err != nil {
+		log.Printf("Error decoding flow summaries: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	for _, f := range summaries {
+		if f == nil || f.Host == "" {
+			http.Error(w, "host is required", http.StatusBadRequest)
+			return
+		}
+		if len(f.LatencyBuckets) != len(models.FlowLatencyBounds)+1 {
+			http.Error(w, fmt.Sprintf("latency_buckets must have %d buckets", len(models.FlowLatencyBounds)+1), http.StatusBadRequest)
+			return
+		}
+		if f.Timestamp.IsZero() {
+			f.Timestamp = now
+		}
+	}
+
+	if err := store.StoreFlowSummaries(summaries); err != nil {
+		log.Printf("Error storing flow summaries: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
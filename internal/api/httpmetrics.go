@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/httpmetrics"
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// httpMetricStore returns the storage as an HTTPMetricStore, answering 501
+// when the backend does not keep HTTP metrics
+func (s *Server) httpMetricStore(w http.ResponseWriter) (storage.HTTPMetricStore, bool) {
+	store, ok := s.backend.(storage.HTTPMetricStore)
+	if !ok {
+		http.Error(w, "http metrics are not supported by this storage backend", http.StatusNotImplemented)
+	}
+	return store, ok
+}
+
+// handleHTTPEndpoints summarizes the rate, errors and duration of requests
+// per endpoint over time
+func (s *Server) handleHTTPEndpoints(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.httpMetricStore(w)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	filter := storage.HTTPMetricFilter{
+		Service:     q.Get("service"),
+		Environment: q.Get("environment"),
+		Host:        q.Get("host"),
+		Method:      q.Get("method"),
+		Route:       q.Get("route"),
+	}
+	var err error
+	filter.Start, filter.End, err = parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bucket := httpmetrics.DefaultBucket
+	if b := q.Get("bucket"); b != "" {
+		bucket, err = time.ParseDuration(b)
+		if err != nil || bucket <= 0 {
+			http.Error(w, fmt.Sprintf("invalid bucket: %s", b), http.StatusBadRequest)
+			return
+		}
+	}
+
+	metrics, err := store.GetHTTPMetrics(filter)
+	if err != nil {
+		log.Printf("Error getting http metrics: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(httpmetrics.Summarize(metrics, bucket)); err != nil {
+		log.Printf("Error encoding http endpoints: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleHTTPMetrics records a collector's HTTP request metrics
+func (s *Server) handleHTTPMetrics(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.httpMetricStore(w)
+	if !ok {
+		return
+	}
+
+	var metrics []*models.HTTPMetric
+	if err := json.NewDecoder(r.Body).Decode(&metrics); err != nil {
+		log.Printf("Error decoding http metrics: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	for _, m := range metrics {
+		if m == nil || m.Host == "" {
+			http.Error(w, "host is required", http.StatusBadRequest)
+			return
+		}
+		if len(m.LatencyBuckets) != len(models.HTTPLatencyBounds)+1 {
+			http.Error(w, fmt.Sprintf("latency_buckets must have %d buckets", len(models.HTTPLatencyBounds)+1), http.StatusBadRequest)
+			return
+		}
+		if m.Timestamp.IsZero() {
+			m.Timestamp = now
+		}
+	}
+
+	if err := store.StoreHTTPMetrics(metrics); err != nil {
+		log.Printf("Error storing http metrics: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// listenerStore returns the storage as a ListenerStore, answering 501 when
+// the backend does not keep listeners
+func (s *Server) listenerStore(w http.ResponseWriter) (storage.ListenerStore, bool) {
+	store, ok := s.backend.(storage.ListenerStore)
+	if !ok {
+		http.Error(w, "listeners are not supported by this storage backend", http.StatusNotImplemented)
+	}
+	return store, ok
+}
+
+// handleListeners lists the sockets listening on each host, or records a
+// collector's snapshot of one host
+func (s *Server) handleListeners(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.listenerStore(w)
+	if !ok {
+		return
+	}
+	if r.Method == "POST" {
+		s.updateListeners(w, r, store)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := storage.ListenerFilter{
+		Host:          q.Get("host"),
+		Environment:   q.Get("environment"),
+		IncludeClosed: q.Get("include_closed") == "true",
+	}
+	listeners, err := store.GetListeners(filter)
+	if err != nil {
+		log.Printf("Error getting listeners: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(listeners); err != nil {
+		log.Printf("Error encoding listeners: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) updateListeners(w http.ResponseWriter, r *http.Request, store storage.ListenerStore) {
+	var snapshot models.ListenerSnapshot
+	if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+		log.Printf("Error decoding listener snapshot: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if snapshot.Host == "" {
+		http.Error(w, "host is required", http.StatusBadRequest)
+		return
+	}
+	if snapshot.Timestamp.IsZero() {
+		snapshot.Timestamp = time.Now()
+	}
+
+	changes, known, err := store.UpdateListeners(&snapshot)
+	if err != nil {
+		log.Printf("Error storing listeners: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if s.guard != nil {
+		s.guard.ObserveListeners(&snapshot, changes, known)
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// handleListenerChanges lists listeners opening and closing, newest first
+func (s *Server) handleListenerChanges(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.listenerStore(w)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	filter := storage.ListenerFilter{
+		Host:        q.Get("host"),
+		Environment: q.Get("environment"),
+	}
+	var err error
+	filter.Start, filter.End, err = parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("invalid limit: %s", limit), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	changes, err := store.GetListenerChanges(filter)
+	if err != nil {
+		log.Printf("Error getting listener changes: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(changes); err != nil {
+		log.Printf("Error encoding listener changes: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/pools"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// poolStore returns the storage as a PoolStore, answering 501 when the
+// backend does not keep pool samples
+func (s *Server) poolStore(w http.ResponseWriter) (storage.PoolStore, bool) {
+	store, ok := s.backend.(storage.PoolStore)
+	if !ok {
+		http.Error(w, "connection pools are not supported by this storage backend", http.StatusNotImplemented)
+	}
+	return store, ok
+}
+
+// handlePools summarizes database and cache connection pools with their
+// usage over time
+func (s *Server) handlePools(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.poolStore(w)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	filter := storage.PoolFilter{
+		Service:     q.Get("service"),
+		Environment: q.Get("environment"),
+		Host:        q.Get("host"),
+	}
+	var err error
+	filter.Start, filter.End, err = parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	bucket := pools.DefaultBucket
+	if b := q.Get("bucket"); b != "" {
+		bucket, err = time.ParseDuration(b)
+		if err != nil || bucket <= 0 {
+			http.Error(w, fmt.Sprintf("invalid bucket: %s", b), http.StatusBadRequest)
+			return
+		}
+	}
+
+	samples, err := store.GetPoolSamples(filter)
+	if err != nil {
+		log.Printf("Error getting pool samples: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(pools.Summarize(samples, bucket)); err != nil {
+		log.Printf("Error encoding pools: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handlePoolSamples records a collector's pool samples
+func (s *Server) handlePoolSamples(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.poolStore(w)
+	if !ok {
+		return
+	}
+
+	var samples []*models.PoolSample
+	if err := json.NewDecoder(r.Body).Decode(&samples); err != nil {
+		log.Printf("Error decoding pool samples: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	for _, p := range samples {
+		if p == nil || p.Host == "" {
+			http.Error(w, "host is required", http.StatusBadRequest)
+			return
+		}
+		if p.Timestamp.IsZero() {
+			p.Timestamp = now
+		}
+	}
+
+	if err := store.StorePoolSamples(samples); err != nil {
+		log.Printf("Error storing pool samples: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/retries"
+)
+
+// retrySequences finds the retry sequences among the connections matching
+// the request's filters, writing an error response if it fails
+func (s *Server) retrySequences(w http.ResponseWriter, r *http.Request) ([]*models.RetrySequence, bool) {
+	filter, err := parseConnectionFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	filter.Start, filter.End, err = parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	sequences, err := retries.Analyze(s.storage, filter, retries.DefaultConfig)
+	if err != nil {
+		log.Printf("Error analyzing retries: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return sequences, true
+}
+
+// handleRetries summarizes retry sequences per service with each service's
+// worst offenders
+func (s *Server) handleRetries(w http.ResponseWriter, r *http.Request) {
+	worst := 5
+	if n := r.URL.Query().Get("worst"); n != "" {
+		v, err := strconv.Atoi(n)
+		if err != nil || v <= 0 {
+			http.Error(w, fmt.Sprintf("invalid worst: %s", n), http.StatusBadRequest)
+			return
+		}
+		worst = v
+	}
+
+	sequences, ok := s.retrySequences(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(retries.Summarize(sequences, worst)); err != nil {
+		log.Printf("Error encoding retries: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleRetrySequences lists retry sequences, most retries first
+func (s *Server) handleRetrySequences(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 100
+	if n := q.Get("limit"); n != "" {
+		v, err := strconv.Atoi(n)
+		if err != nil || v <= 0 {
+			http.Error(w, fmt.Sprintf("invalid limit: %s", n), http.StatusBadRequest)
+			return
+		}
+		limit = v
+	}
+
+	sequences, ok := s.retrySequences(w, r)
+	if !ok {
+		return
+	}
+
+	matched := []*models.RetrySequence{}
+	for _, seq := range sequences {
+		if d := q.Get("destination"); d != "" && seq.Destination != d {
+			continue
+		}
+		if o := q.Get("outcome"); o != "" && string(seq.Outcome) != o {
+			continue
+		}
+		if len(matched) == limit {
+			break
+		}
+		matched = append(matched, seq)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(matched); err != nil {
+		log.Printf("Error encoding retry sequences: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
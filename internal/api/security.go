@@ -0,0 +1,182 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/security"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// securityStore returns the storage as a SecurityStore, answering 501 when
+// the backend does not keep security data
+func (s *Server) securityStore(w http.ResponseWriter) (storage.SecurityStore, bool) {
+	store, ok := s.backend.(storage.SecurityStore)
+	if !ok {
+		http.Error(w, "security events are not supported by this storage backend", http.StatusNotImplemented)
+	}
+	return store, ok
+}
+
+// handleSecurityEvents lists policy violations and new destinations, newest
+// first
+func (s *Server) handleSecurityEvents(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.securityStore(w)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	filter := storage.SecurityEventFilter{
+		Service:     q.Get("service"),
+		Environment: q.Get("environment"),
+		Kind:        models.SecurityEventKind(q.Get("kind")),
+	}
+	var err error
+	filter.Start, filter.End, err = parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("invalid limit: %s", limit), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	events, err := store.GetSecurityEvents(filter)
+	if err != nil {
+		log.Printf("Error getting security events: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		log.Printf("Error encoding security events: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handlePolicies lists the egress policies in effect, or saves a new
+// version of one
+func (s *Server) handlePolicies(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		s.savePolicy(w, r)
+		return
+	}
+
+	store, ok := s.securityStore(w)
+	if !ok {
+		return
+	}
+	policies, err := store.GetEgressPolicies()
+	if err != nil {
+		log.Printf("Error getting egress policies: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(policies); err != nil {
+		log.Printf("Error encoding egress policies: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) savePolicy(w http.ResponseWriter, r *http.Request) {
+	if s.guard == nil {
+		http.Error(w, "egress policies are not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	var policy models.EgressPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if policy.Mode == "" {
+		policy.Mode = models.PolicyEnforce
+	}
+	if err := security.Validate(&policy); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.guard.SavePolicy(&policy); err != nil {
+		log.Printf("Error saving egress policy: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(policy); err != nil {
+		log.Printf("Error encoding egress policy: %v", err)
+	}
+}
+
+// handlePolicyHistory lists every version of a service's policy, newest
+// first
+func (s *Server) handlePolicyHistory(w http.ResponseWriter, r *http.Request) {
+	store, ok := s.securityStore(w)
+	if !ok {
+		return
+	}
+	service := r.URL.Query().Get("service")
+	if service == "" {
+		http.Error(w, "service is required", http.StatusBadRequest)
+		return
+	}
+
+	policies, err := store.GetEgressPolicyHistory(service, r.URL.Query().Get("environment"))
+	if err != nil {
+		log.Printf("Error getting egress policy history: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(policies); err != nil {
+		log.Printf("Error encoding egress policy history: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleProposePolicy proposes an allowlist from a service's observed
+// traffic, defaulting to the last 24 hours
+func (s *Server) handleProposePolicy(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("service") == "" {
+		http.Error(w, "service is required", http.StatusBadRequest)
+		return
+	}
+	start, end, err := parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	policy, err := security.Propose(s.storage, q.Get("service"), q.Get("environment"), start, end)
+	if err != nil {
+		log.Printf("Error proposing egress policy: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(policy); err != nil {
+		log.Printf("Error encoding egress policy: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
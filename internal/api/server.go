@@ -1,25 +1,46 @@
+// Package api serves the REST API collectors report to and the dashboard
+// reads from. Handlers are grouped by area, one file each; server.go holds
+// the routes and the helpers they share.
 package api
 
 import (
-	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/karthik-minnikanti/cinnamon/internal/certs"
+	"github.com/karthik-minnikanti/cinnamon/internal/enrich"
 	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/queues"
+	"github.com/karthik-minnikanti/cinnamon/internal/security"
 	"github.com/karthik-minnikanti/cinnamon/internal/storage"
 )
 
 type Server struct {
-	router  *mux.Router
-	storage storage.Storage
+	router    *mux.Router
+	storage   storage.Storage
+	backend   storage.Storage // storage without its cache, for optional stores
+	enricher  enrich.Enricher
+	guard     *security.Guard
+	observers []Observer
+	topology  *queues.Topology
+	queues    *queues.Cache
+	inventory *certs.Inventory
 }
 
-func NewServer(storage storage.Storage) *Server {
+// Observer is told about every connection stored through the API
+type Observer interface {
+	Observe(conn *models.Connection)
+}
+
+func NewServer(store storage.Storage) *Server {
 	s := &Server{
 		router:  mux.NewRouter(),
-		storage: storage,
+		storage: store,
+		backend: storage.Backend(store),
+		queues:  queues.NewCache(time.Minute),
 	}
 	s.setupRoutes()
 	return s
@@ -28,164 +49,93 @@ func NewServer(storage storage.Storage) *Server {
 func (s *Server) setupRoutes() {
 	s.router.HandleFunc("/api/connections", s.handleConnections).Methods("GET", "POST")
 	s.router.HandleFunc("/api/connections/stats", s.handleStats).Methods("GET")
+	s.router.HandleFunc("/api/connections/export", s.handleExport).Methods("GET")
 	s.router.HandleFunc("/api/connections/{id}", s.handleConnectionDetails).Methods("GET")
 	s.router.HandleFunc("/api/services", s.handleServices).Methods("GET")
 	s.router.HandleFunc("/api/errors", s.handleErrors).Methods("GET")
 	s.router.HandleFunc("/api/environments", s.handleEnvironments).Methods("GET")
+	s.router.HandleFunc("/api/query/aggregate", s.handleAggregate).Methods("GET")
+	s.router.HandleFunc("/api/deployments/compare", s.handleCompareDeployments).Methods("GET")
+	s.router.HandleFunc("/api/topology", s.handleTopology).Methods("GET")
+	s.router.HandleFunc("/api/anomalies", s.handleAnomalies).Methods("GET")
+	s.router.HandleFunc("/api/retries", s.handleRetries).Methods("GET")
+	s.router.HandleFunc("/api/retries/sequences", s.handleRetrySequences).Methods("GET")
+	s.router.HandleFunc("/api/security/events", s.handleSecurityEvents).Methods("GET")
+	s.router.HandleFunc("/api/security/policies", s.handlePolicies).Methods("GET", "POST")
+	s.router.HandleFunc("/api/security/policies/history", s.handlePolicyHistory).Methods("GET")
+	s.router.HandleFunc("/api/security/policies/propose", s.handleProposePolicy).Methods("GET")
+	s.router.HandleFunc("/api/listeners", s.handleListeners).Methods("GET", "POST")
+	s.router.HandleFunc("/api/listeners/changes", s.handleListenerChanges).Methods("GET")
+	s.router.HandleFunc("/api/pools", s.handlePools).Methods("GET")
+	s.router.HandleFunc("/api/pools/samples", s.handlePoolSamples).Methods("POST")
+	s.router.HandleFunc("/api/certificates", s.handleCertificates).Methods("GET", "POST")
+	s.router.HandleFunc("/api/http/endpoints", s.handleHTTPEndpoints).Methods("GET")
+	s.router.HandleFunc("/api/http/metrics", s.handleHTTPMetrics).Methods("POST")
+	s.router.HandleFunc("/api/flows", s.handleFlows).Methods("GET", "POST")
 
 	// Serve static files
 	s.router.PathPrefix("/").Handler(http.FileServer(http.Dir("static")))
 }
 
-func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case "GET":
-		s.getConnections(w, r)
-	case "POST":
-		s.createConnection(w, r)
-	}
+// SetEnricher sets the enrichment applied to incoming connections
+func (s *Server) SetEnricher(e enrich.Enricher) {
+	s.enricher = e
 }
 
-func (s *Server) getConnections(w http.ResponseWriter, r *http.Request) {
-	// Get filter parameters
-	service := r.URL.Query().Get("service")
-	errorType := r.URL.Query().Get("error")
-	environment := r.URL.Query().Get("environment")
-	search := r.URL.Query().Get("search")
-
-	// Get connections with filters
-	connections, err := s.storage.GetConnections(service, errorType, environment, search)
-	if err != nil {
-		log.Printf("Error getting connections: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	// Create response object
-	response := struct {
-		Connections []*models.Connection `json:"connections"`
-	}{
-		Connections: connections,
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		log.Printf("Error encoding connections: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
+// AddObserver registers an observer of stored connections
+func (s *Server) AddObserver(o Observer) {
+	s.observers = append(s.observers, o)
 }
 
-func (s *Server) createConnection(w http.ResponseWriter, r *http.Request) {
-	var conn models.Connection
-	if err := json.NewDecoder(r.Body).Decode(&conn); err != nil {
-		log.Printf("Error decoding connection: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	// Set timestamp if not provided
-	if conn.Timestamp.IsZero() {
-		conn.Timestamp = time.Now()
-	}
-
-	if err := s.storage.StoreConnection(&conn); err != nil {
-		log.Printf("Error storing connection: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusCreated)
-}
-
-func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
-	// Get time range
-	startTime := time.Now().Add(-24 * time.Hour) // Default to last 24 hours
-	endTime := time.Now()
-
-	// Get statistics
-	stats, err := s.storage.GetStats(startTime, endTime)
-	if err != nil {
-		log.Printf("Error getting stats: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(stats); err != nil {
-		log.Printf("Error encoding stats: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
+// SetQueueTopology sets the Kafka and RabbitMQ clusters queue stats map
+// connections onto
+func (s *Server) SetQueueTopology(t *queues.Topology) {
+	s.topology = t
 }
 
-func (s *Server) handleConnectionDetails(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	conn, err := s.storage.GetConnectionByID(id)
-	if err != nil {
-		log.Printf("Error getting connection details: %v", err)
-		http.Error(w, "Connection not found", http.StatusNotFound)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(conn); err != nil {
-		log.Printf("Error encoding connection details: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
+// SetCertificateInventory records certificate chains through inv, which
+// alerts on certificates nearing expiry
+func (s *Server) SetCertificateInventory(inv *certs.Inventory) {
+	s.inventory = inv
 }
 
-func (s *Server) handleServices(w http.ResponseWriter, r *http.Request) {
-	services, err := s.storage.GetServices()
-	if err != nil {
-		log.Printf("Error getting services: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(services); err != nil {
-		log.Printf("Error encoding services: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
+// SetGuard evaluates stored connections against egress policies and lets
+// the API change them
+func (s *Server) SetGuard(g *security.Guard) {
+	s.guard = g
+	s.AddObserver(g)
 }
 
-func (s *Server) handleErrors(w http.ResponseWriter, r *http.Request) {
-	errors, err := s.storage.GetErrors()
-	if err != nil {
-		log.Printf("Error getting errors: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(errors); err != nil {
-		log.Printf("Error encoding errors: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
+func (s *Server) Start(addr string) error {
+	return http.ListenAndServe(addr, s.router)
 }
 
-func (s *Server) handleEnvironments(w http.ResponseWriter, r *http.Request) {
-	environments, err := s.storage.GetEnvironments()
-	if err != nil {
-		log.Printf("Error getting environments: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(environments); err != nil {
-		log.Printf("Error encoding environments: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
+// parseTimeRange reads the RFC 3339 start and end parameters, defaulting to
+// the last 24 hours
+func parseTimeRange(r *http.Request) (time.Time, time.Time, error) {
+	end := time.Now()
+	start := end.Add(-24 * time.Hour)
+	for param, t := range map[string]*time.Time{"start": &start, "end": &end} {
+		if v := r.URL.Query().Get(param); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return start, end, fmt.Errorf("invalid %s: %s", param, v)
+			}
+			*t = parsed
+		}
+	}
+	return start, end, nil
 }
 
-func (s *Server) Start(addr string) error {
-	return http.ListenAndServe(addr, s.router)
+// splitList flattens repeated and comma-separated query parameter values
+func splitList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
 }
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// TestCachedStorageOptionalStores checks that the endpoints backed by
+// optional stores keep working when the backend sits behind a cache
+func TestCachedStorageOptionalStores(t *testing.T) {
+	backend, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "cinnamon.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewCachedStorage(backend, time.Hour, 1000)
+	defer store.Close()
+
+	srv := httptest.NewServer(NewServer(store).router)
+	defer srv.Close()
+
+	posts := []struct{ path, body string }{
+		{"/api/listeners", `{"host":"h1","listeners":[{"protocol":"tcp","address":"0.0.0.0","port":8080}]}`},
+		{"/api/pools/samples", `[{"host":"h1","process":"app","dest_ip":"10.0.0.5","dest_port":5432,"open":3}]`},
+		{"/api/http/metrics", `[{"host":"h1","dest_ip":"10.0.0.6","dest_port":80,"method":"GET","route":"/","requests":1,"latency_buckets":[1,0,0,0,0,0,0,0,0,0,0,0]}]`},
+		{"/api/flows", `[{"host":"h1","dest_ip":"10.0.0.5","dest_port":5432,"connections":1,"latency_buckets":[0,0,0,0,0,0,0,0,0,0,0,0,0,0,0]}]`},
+	}
+	for _, p := range posts {
+		resp, err := http.Post(srv.URL+p.path, "application/json", strings.NewReader(p.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+			t.Errorf("POST %s: status %d", p.path, resp.StatusCode)
+		}
+	}
+
+	for _, path := range []string{
+		"/api/anomalies",
+		"/api/security/events",
+		"/api/security/policies",
+		"/api/listeners",
+		"/api/listeners/changes",
+		"/api/pools",
+		"/api/certificates",
+		"/api/http/endpoints",
+		"/api/flows",
+	} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: status %d", path, resp.StatusCode)
+		}
+	}
+}
+
+// countingBackend counts the connection reads that reach it
+type countingBackend struct {
+	*storage.MemoryStorage
+	reads int
+}
+
+func (b *countingBackend) GetConnections(filter storage.ConnectionFilter) ([]*models.Connection, error) {
+	b.reads++
+	return b.MemoryStorage.GetConnections(filter)
+}
+
+func (b *countingBackend) IterateConnections(filter storage.ConnectionFilter, fn func(*models.Connection) error) error {
+	b.reads++
+	return b.MemoryStorage.IterateConnections(filter, fn)
+}
+
+func (b *countingBackend) GetStats(start, end time.Time, filter storage.ConnectionFilter) (*models.ConnectionStats, error) {
+	b.reads++
+	return b.MemoryStorage.GetStats(start, end, filter)
+}
+
+// TestLiveDashboardUsesCache checks that the dashboard's polling requests
+// are answered by the cache alone
+func TestLiveDashboardUsesCache(t *testing.T) {
+	backend := &countingBackend{MemoryStorage: storage.NewMemoryStorage(0)}
+	store := storage.NewCachedStorage(backend, time.Hour, 1000)
+	for i, queue := range []models.MessageQueueType{models.MessageQueueTypeKafka, ""} {
+		conn := &models.Connection{
+			ID:               fmt.Sprintf("live-%d", i),
+			Timestamp:        time.Now(),
+			ServiceName:      "checkout",
+			DestIP:           "10.0.0.9",
+			DestPort:         9092,
+			ServiceType:      models.ServiceTypeAPI,
+			MessageQueueType: queue,
+		}
+		if queue != "" {
+			conn.ServiceType = models.ServiceTypeMessageQueue
+		}
+		if err := store.StoreConnection(conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv := httptest.NewServer(NewServer(store).router)
+	defer srv.Close()
+
+	for _, path := range []string{
+		"/api/connections/stats?live=true",
+		"/api/connections?live=true",
+		"/api/connections?live=true&q=service:checkout",
+	} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: status %d", path, resp.StatusCode)
+		}
+		if !strings.Contains(string(body), "live-") && !strings.Contains(string(body), `"total_connections":2`) {
+			t.Errorf("GET %s: cache did not answer: %s", path, body)
+		}
+	}
+	if backend.reads != 0 {
+		t.Errorf("live requests read connections from the backend %d times", backend.reads)
+	}
+}
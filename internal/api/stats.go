@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/flows"
+	"github.com/karthik-minnikanti/cinnamon/internal/httpmetrics"
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	// Get time range
+	startTime := time.Now().Add(-24 * time.Hour) // Default to last 24 hours
+	endTime := time.Now()
+
+	filter, err := parseConnectionFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !filter.Start.IsZero() {
+		startTime = filter.Start
+	}
+	if !filter.End.IsZero() {
+		endTime = filter.End
+	}
+	// Live stats cover what the cache holds, so flow summaries and queue
+	// analysis below count the same range
+	if since, ok := storage.Covered(s.storage); ok && filter.Live && since.After(startTime) {
+		startTime = since
+	}
+
+	// Get statistics
+	stats, err := s.storage.GetStats(startTime, endTime, filter)
+	if err != nil {
+		log.Printf("Error getting stats: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if len(stats.QueueStats) > 0 {
+		stats.QueueDetails = make(map[models.MessageQueueType]*models.QueueStats, len(stats.QueueStats))
+		for queueType, n := range stats.QueueStats {
+			stats.QueueDetails[queueType] = &models.QueueStats{Connections: n}
+		}
+		if err := s.queues.Analyze(s.storage, startTime, endTime, filter, s.topology, stats.QueueDetails); err != nil {
+			log.Printf("Error analyzing queue connections: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	// Collectors reporting flow summaries count alongside those reporting
+	// every connection
+	if store, ok := s.backend.(storage.FlowStore); ok {
+		if flowFilter, ok := storage.FlowFilterFor(filter); ok {
+			flowFilter.Start, flowFilter.End = startTime, endTime
+			summaries, err := store.GetFlowSummaries(flowFilter)
+			if err != nil {
+				log.Printf("Error getting flow summaries: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			flows.MergeStats(stats, summaries)
+		}
+	}
+	// 5xx responses count toward the error trends
+	if store, ok := s.backend.(storage.HTTPMetricStore); ok {
+		metrics, err := store.GetHTTPMetrics(storage.HTTPMetricFilter{
+			Service:     filter.Service,
+			Environment: filter.Environment,
+			Start:       startTime,
+			End:         endTime,
+		})
+		if err != nil {
+			log.Printf("Error getting http metrics: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		stats.ErrorTrends = append(stats.ErrorTrends, httpmetrics.ErrorTrends(metrics, time.Hour)...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Printf("Error encoding stats: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) handleServices(w http.ResponseWriter, r *http.Request) {
+	services, err := s.storage.GetServices()
+	if err != nil {
+		log.Printf("Error getting services: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(services); err != nil {
+		log.Printf("Error encoding services: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) handleErrors(w http.ResponseWriter, r *http.Request) {
+	errors, err := s.storage.GetErrors()
+	if err != nil {
+		log.Printf("Error getting errors: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(errors); err != nil {
+		log.Printf("Error encoding errors: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func (s *Server) handleEnvironments(w http.ResponseWriter, r *http.Request) {
+	environments, err := s.storage.GetEnvironments()
+	if err != nil {
+		log.Printf("Error getting environments: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(environments); err != nil {
+		log.Printf("Error encoding environments: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
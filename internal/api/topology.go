@@ -0,0 +1,37 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/topology"
+)
+
+// handleTopology returns the workloads seen in the connections matching the
+// filters and the traffic between them, over the last 24 hours by default
+func (s *Server) handleTopology(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseConnectionFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.Start.IsZero() {
+		filter.Start = time.Now().Add(-24 * time.Hour)
+	}
+
+	graph, err := topology.Build(s.storage, filter)
+	if err != nil {
+		log.Printf("Error building topology: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(graph); err != nil {
+		log.Printf("Error encoding topology: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+}
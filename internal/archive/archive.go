@@ -0,0 +1,400 @@
+// Package archive moves connections that have aged out of retention into
+// compressed files for audits, and loads them back for investigations.
+//
+// An archive directory is laid out by day and environment:
+//
+//	manifest.json
+//	2026-10-01/production/connections-20261019T020000Z.ndjson.gz
+//	2026-10-01/staging/connections-20261019T020000Z.ndjson.gz
+//
+// Each file holds one JSON connection per line, as served by the API. The
+// manifest records every file with its row count, time range and SHA-256.
+//
+// Imported connections carry the run they came from in metadata.archive_run.
+// A later export deletes them again once they are past the cutoff, without
+// writing them to the archive a second time.
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// ManifestFile is the manifest's name inside an archive directory
+const ManifestFile = "manifest.json"
+
+// unknownEnvironment names the partition of connections without one
+const unknownEnvironment = "_unknown"
+
+// runKey is the metadata key marking a connection loaded from an archive
+const runKey = "archive_run"
+
+// Manifest describes the contents of an archive directory
+type Manifest struct {
+	Runs  []Run  `json:"runs"`
+	Files []File `json:"files"`
+}
+
+// Run records one export
+type Run struct {
+	ID        string    `json:"id"`
+	Cutoff    time.Time `json:"cutoff"`
+	CreatedAt time.Time `json:"created_at"`
+	Rows      int64     `json:"rows"`
+	Deleted   int64     `json:"deleted"`
+}
+
+// File records one archived partition file
+type File struct {
+	Path         string    `json:"path"` // relative to the archive directory
+	Run          string    `json:"run"`
+	Day          string    `json:"day"` // YYYY-MM-DD, UTC
+	Environment  string    `json:"environment"`
+	Rows         int64     `json:"rows"`
+	MinTimestamp time.Time `json:"min_timestamp"`
+	MaxTimestamp time.Time `json:"max_timestamp"`
+	SHA256       string    `json:"sha256"`
+}
+
+// ReadManifest loads an archive's manifest; a missing one is empty
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Manifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %v", err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %v", err)
+	}
+	return &manifest, nil
+}
+
+// writeManifest replaces the manifest atomically
+func writeManifest(dir string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %v", err)
+	}
+
+	tmp := filepath.Join(dir, ManifestFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, ManifestFile)); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	return nil
+}
+
+// partitionWriter streams one day/environment file
+type partitionWriter struct {
+	file   *os.File
+	digest hash.Hash
+	buf    *bufio.Writer
+	gz     *gzip.Writer
+	enc    *json.Encoder
+	entry  File
+}
+
+func newPartitionWriter(dir string, entry File) (*partitionWriter, error) {
+	path := filepath.Join(dir, filepath.FromSlash(entry.Path))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create partition directory: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive file: %v", err)
+	}
+
+	digest := sha256.New()
+	buf := bufio.NewWriter(io.MultiWriter(f, digest))
+	gz := gzip.NewWriter(buf)
+	return &partitionWriter{
+		file:   f,
+		digest: digest,
+		buf:    buf,
+		gz:     gz,
+		enc:    json.NewEncoder(gz),
+		entry:  entry,
+	}, nil
+}
+
+func (w *partitionWriter) write(conn *models.Connection) error {
+	if err := w.enc.Encode(conn); err != nil {
+		return fmt.Errorf("failed to write %s: %v", w.entry.Path, err)
+	}
+	if w.entry.Rows == 0 || conn.Timestamp.Before(w.entry.MinTimestamp) {
+		w.entry.MinTimestamp = conn.Timestamp
+	}
+	if conn.Timestamp.After(w.entry.MaxTimestamp) {
+		w.entry.MaxTimestamp = conn.Timestamp
+	}
+	w.entry.Rows++
+	return nil
+}
+
+// close flushes the file to disk and returns its manifest entry
+func (w *partitionWriter) close() (File, error) {
+	defer w.file.Close()
+
+	if err := w.gz.Close(); err != nil {
+		return File{}, fmt.Errorf("failed to finish %s: %v", w.entry.Path, err)
+	}
+	if err := w.buf.Flush(); err != nil {
+		return File{}, fmt.Errorf("failed to finish %s: %v", w.entry.Path, err)
+	}
+	if err := w.file.Sync(); err != nil {
+		return File{}, fmt.Errorf("failed to sync %s: %v", w.entry.Path, err)
+	}
+
+	w.entry.SHA256 = hex.EncodeToString(w.digest.Sum(nil))
+	return w.entry, nil
+}
+
+// Export archives every connection older than cutoff into dir, records the
+// files in the manifest and then deletes the archived rows from the store.
+// Rows are only deleted once their files and the manifest are on disk.
+func Export(store storage.Pruner, dir string, cutoff time.Time) (*Run, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %v", err)
+	}
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &Run{
+		ID:        time.Now().UTC().Format("20060102T150405Z"),
+		Cutoff:    cutoff,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	// A failed export removes the files it started, so that a retry does
+	// not find partial files the manifest never mentions
+	writers := make(map[string]*partitionWriter)
+	var paths []string
+	abort := func() {
+		for _, w := range writers {
+			w.gz.Close()
+			w.file.Close()
+		}
+		for _, path := range paths {
+			os.Remove(path)
+		}
+	}
+
+	var ids []string
+	err = store.ConnectionsBefore(cutoff, func(conn *models.Connection) error {
+		// Already archived; only its row needs to go
+		if _, ok := conn.Metadata[runKey]; ok {
+			ids = append(ids, conn.ID)
+			return nil
+		}
+
+		day := conn.Timestamp.UTC().Format("2006-01-02")
+		env := conn.Environment
+		if env == "" {
+			env = unknownEnvironment
+		}
+
+		key := day + "/" + env
+		w, ok := writers[key]
+		if !ok {
+			var err error
+			w, err = newPartitionWriter(dir, File{
+				Path:        day + "/" + url.PathEscape(env) + "/connections-" + run.ID + ".ndjson.gz",
+				Run:         run.ID,
+				Day:         day,
+				Environment: conn.Environment,
+			})
+			if err != nil {
+				return err
+			}
+			writers[key] = w
+			paths = append(paths, w.file.Name())
+		}
+
+		if err := w.write(conn); err != nil {
+			return err
+		}
+		ids = append(ids, conn.ID)
+		return nil
+	})
+	if err != nil {
+		abort()
+		return nil, err
+	}
+
+	// Finish the files in a stable order so manifests diff cleanly
+	keys := make([]string, 0, len(writers))
+	for key := range writers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		entry, err := writers[key].close()
+		delete(writers, key)
+		if err != nil {
+			abort()
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, entry)
+		run.Rows += entry.Rows
+	}
+
+	if len(ids) == 0 {
+		return run, nil
+	}
+	if run.Rows > 0 {
+		manifest.Runs = append(manifest.Runs, *run)
+		if err := writeManifest(dir, manifest); err != nil {
+			abort()
+			return nil, err
+		}
+	}
+
+	deleted, err := store.DeleteConnections(ids)
+	if err != nil {
+		return nil, fmt.Errorf("archived %d rows but failed to delete them: %v", run.Rows, err)
+	}
+	run.Deleted = deleted
+	if run.Rows == 0 {
+		return run, nil
+	}
+
+	// Record the deletion count now that it is known
+	manifest.Runs[len(manifest.Runs)-1].Deleted = deleted
+	if err := writeManifest(dir, manifest); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// ImportFilter selects the archived files to load. Empty fields match all.
+type ImportFilter struct {
+	From        string // first day, YYYY-MM-DD
+	To          string // last day, YYYY-MM-DD
+	Environment string
+}
+
+func (f ImportFilter) matches(file File) bool {
+	if f.From != "" && file.Day < f.From {
+		return false
+	}
+	if f.To != "" && file.Day > f.To {
+		return false
+	}
+	if f.Environment != "" && file.Environment != f.Environment {
+		return false
+	}
+	return true
+}
+
+// ImportResult summarizes an import
+type ImportResult struct {
+	Files    int
+	Imported int64
+	Skipped  int64 // already present in the store
+}
+
+// Import loads archived connections back into a store, marking each with
+// the run that archived it. Each file's checksum is verified before its rows
+// are read; connections whose ID is already stored are skipped, so an
+// archive can be imported more than once.
+func Import(store storage.Storage, dir string, filter ImportFilter) (*ImportResult, error) {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{}
+	for _, file := range manifest.Files {
+		if !filter.matches(file) {
+			continue
+		}
+		if err := importFile(store, dir, file, result); err != nil {
+			return result, err
+		}
+		result.Files++
+	}
+	return result, nil
+}
+
+func importFile(store storage.Storage, dir string, file File, result *ImportResult) error {
+	path := filepath.Join(dir, filepath.FromSlash(file.Path))
+	if err := verify(path, file.SHA256); err != nil {
+		return err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", file.Path, err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", file.Path, err)
+	}
+	defer gz.Close()
+
+	decoder := json.NewDecoder(gz)
+	for {
+		var conn models.Connection
+		if err := decoder.Decode(&conn); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to decode %s: %v", file.Path, err)
+		}
+
+		if _, err := store.GetConnectionByID(conn.ID); err == nil {
+			result.Skipped++
+			continue
+		}
+		if conn.Metadata == nil {
+			conn.Metadata = make(map[string]interface{})
+		}
+		conn.Metadata[runKey] = file.Run
+		if err := store.StoreConnection(&conn); err != nil {
+			return fmt.Errorf("failed to import %s: %v", conn.ID, err)
+		}
+		result.Imported++
+	}
+}
+
+// verify checks a file against its recorded SHA-256
+func verify(path, want string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	defer f.Close()
+
+	digest := sha256.New()
+	if _, err := io.Copy(digest, f); err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if got := hex.EncodeToString(digest.Sum(nil)); got != want {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", path, got, want)
+	}
+	return nil
+}
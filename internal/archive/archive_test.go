@@ -0,0 +1,140 @@
+package archive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "cinnamon.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	var pruner storage.Pruner = store
+
+	day1 := time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+	for _, conn := range []*models.Connection{
+		{ID: "old-1", Timestamp: day1, Environment: "production"},
+		{ID: "old-2", Timestamp: day1.Add(time.Hour), Environment: "production"},
+		{ID: "old-3", Timestamp: day2, Environment: "staging"},
+		{ID: "new", Timestamp: time.Now(), Environment: "production"},
+	} {
+		if err := store.StoreConnection(conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := t.TempDir()
+	cutoff := day2.Add(time.Hour)
+	run, err := Export(pruner, dir, cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Rows != 3 || run.Deleted != 3 {
+		t.Fatalf("export: rows %d, deleted %d, want 3 and 3", run.Rows, run.Deleted)
+	}
+
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Runs) != 1 || len(manifest.Files) != 2 {
+		t.Fatalf("manifest: %d runs, %d files, want 1 and 2", len(manifest.Runs), len(manifest.Files))
+	}
+	var rows int64
+	for _, file := range manifest.Files {
+		if err := verify(filepath.Join(dir, filepath.FromSlash(file.Path)), file.SHA256); err != nil {
+			t.Error(err)
+		}
+		rows += file.Rows
+	}
+	if rows != 3 {
+		t.Errorf("manifest rows = %d, want 3", rows)
+	}
+	if _, err := store.GetConnectionByID("old-1"); err == nil {
+		t.Error("old-1 still stored after export")
+	}
+	if _, err := store.GetConnectionByID("new"); err != nil {
+		t.Errorf("new was deleted: %v", err)
+	}
+
+	result, err := Import(store, dir, ImportFilter{Environment: "production"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Files != 1 || result.Imported != 2 {
+		t.Fatalf("import: %d files, %d rows, want 1 and 2", result.Files, result.Imported)
+	}
+	conn, err := store.GetConnectionByID("old-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.Metadata[runKey] != run.ID {
+		t.Errorf("archive_run = %v, want %s", conn.Metadata[runKey], run.ID)
+	}
+	if result, _ := Import(store, dir, ImportFilter{Environment: "production"}); result.Skipped != 2 {
+		t.Errorf("second import skipped %d rows, want 2", result.Skipped)
+	}
+
+	// Imported rows are pruned again without a second copy in the archive
+	run, err = Export(pruner, dir, cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Rows != 0 || run.Deleted != 2 {
+		t.Errorf("re-export: rows %d, deleted %d, want 0 and 2", run.Rows, run.Deleted)
+	}
+	manifest, _ = ReadManifest(dir)
+	if len(manifest.Runs) != 1 || len(manifest.Files) != 2 {
+		t.Errorf("re-export changed the manifest: %d runs, %d files", len(manifest.Runs), len(manifest.Files))
+	}
+}
+
+// failingPruner yields some connections and then fails
+type failingPruner struct {
+	conns []*models.Connection
+}
+
+func (p failingPruner) ConnectionsBefore(cutoff time.Time, fn func(*models.Connection) error) error {
+	for _, conn := range p.conns {
+		if err := fn(conn); err != nil {
+			return err
+		}
+	}
+	return errors.New("connection lost")
+}
+
+func (p failingPruner) DeleteConnections(ids []string) (int64, error) {
+	return 0, errors.New("must not delete after a failed export")
+}
+
+func TestExportFailureRemovesPartialFiles(t *testing.T) {
+	dir := t.TempDir()
+	at := time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC)
+	store := failingPruner{conns: []*models.Connection{
+		{ID: "a", Timestamp: at, Environment: "production"},
+		{ID: "b", Timestamp: at.Add(24 * time.Hour), Environment: "staging"},
+	}}
+
+	if _, err := Export(store, dir, at.Add(48*time.Hour)); err == nil {
+		t.Fatal("export succeeded")
+	}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && (strings.HasSuffix(path, ".ndjson.gz") || info.Name() == ManifestFile) {
+			t.Errorf("left behind %s", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
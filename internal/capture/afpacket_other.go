@@ -0,0 +1,26 @@
+//go:build !linux
+
+package capture
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// AFPacketSource is only available on Linux
+type AFPacketSource struct{}
+
+// OpenInterface is not supported outside Linux; use a pcap file instead
+func OpenInterface(name string) (*AFPacketSource, error) {
+	return nil, fmt.Errorf("live capture is not supported on %s", runtime.GOOS)
+}
+
+// ReadPacket always fails on this platform
+func (s *AFPacketSource) ReadPacket() (*Packet, error) {
+	return nil, fmt.Errorf("live capture is not supported on %s", runtime.GOOS)
+}
+
+// Close is a no-op on this platform
+func (s *AFPacketSource) Close() error {
+	return nil
+}
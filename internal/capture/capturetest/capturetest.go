@@ -0,0 +1,231 @@
+// Package capturetest writes pcap files of TCP and UDP traffic, so packet
+// decoding, flow tracking and fingerprinting can be tested offline against
+// fixed captures.
+package capturetest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/capture"
+)
+
+// Writer writes packets as Ethernet frames to a classic pcap file
+type Writer struct {
+	w      io.Writer
+	closer io.Closer
+}
+
+// Create creates a pcap file at path
+func Create(path string) (*Writer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w.closer = f
+	return w, nil
+}
+
+// NewWriter writes the pcap global header to w
+func NewWriter(w io.Writer) (*Writer, error) {
+	var header [24]byte
+	binary.LittleEndian.PutUint32(header[0:4], 0xa1b23c4d) // nanosecond timestamps
+	binary.LittleEndian.PutUint16(header[4:6], 2)
+	binary.LittleEndian.PutUint16(header[6:8], 4)
+	binary.LittleEndian.PutUint32(header[16:20], 65535)
+	binary.LittleEndian.PutUint32(header[20:24], capture.LinkTypeEthernet)
+	if _, err := w.Write(header[:]); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w}, nil
+}
+
+// Close closes the file when the writer was created from a path
+func (w *Writer) Close() error {
+	if w.closer != nil {
+		return w.closer.Close()
+	}
+	return nil
+}
+
+// WritePacket encodes an IPv4 TCP or UDP packet
+func (w *Writer) WritePacket(pkt *capture.Packet) error {
+	src, dst := net.ParseIP(pkt.SrcIP).To4(), net.ParseIP(pkt.DstIP).To4()
+	if src == nil || dst == nil {
+		return fmt.Errorf("not an IPv4 packet: %s > %s", pkt.SrcIP, pkt.DstIP)
+	}
+
+	var transport []byte
+	var proto byte
+	switch pkt.Protocol {
+	case "TCP":
+		proto = 6
+		transport = make([]byte, 20+len(pkt.Payload))
+		binary.BigEndian.PutUint16(transport[0:2], uint16(pkt.SrcPort))
+		binary.BigEndian.PutUint16(transport[2:4], uint16(pkt.DstPort))
+		binary.BigEndian.PutUint32(transport[4:8], pkt.Seq)
+		binary.BigEndian.PutUint32(transport[8:12], pkt.Ack)
+		transport[12] = 5 << 4
+		transport[13] = pkt.Flags
+		binary.BigEndian.PutUint16(transport[14:16], 65535)
+		copy(transport[20:], pkt.Payload)
+		binary.BigEndian.PutUint16(transport[16:18], checksum(pseudoHeader(src, dst, proto, len(transport)), transport))
+	case "UDP":
+		proto = 17
+		transport = make([]byte, 8+len(pkt.Payload))
+		binary.BigEndian.PutUint16(transport[0:2], uint16(pkt.SrcPort))
+		binary.BigEndian.PutUint16(transport[2:4], uint16(pkt.DstPort))
+		binary.BigEndian.PutUint16(transport[4:6], uint16(len(transport)))
+		copy(transport[8:], pkt.Payload)
+		binary.BigEndian.PutUint16(transport[6:8], checksum(pseudoHeader(src, dst, proto, len(transport)), transport))
+	default:
+		return fmt.Errorf("unsupported protocol: %s", pkt.Protocol)
+	}
+
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(20+len(transport)))
+	ip[8] = 64
+	ip[9] = proto
+	copy(ip[12:16], src)
+	copy(ip[16:20], dst)
+	binary.BigEndian.PutUint16(ip[10:12], checksum(nil, ip))
+
+	frame := make([]byte, 14, 14+len(ip)+len(transport))
+	copy(frame[0:6], []byte{0x02, 0, 0, 0, 0, 0x02})
+	copy(frame[6:12], []byte{0x02, 0, 0, 0, 0, 0x01})
+	binary.BigEndian.PutUint16(frame[12:14], 0x0800)
+	frame = append(append(frame, ip...), transport...)
+
+	var record [16]byte
+	binary.LittleEndian.PutUint32(record[0:4], uint32(pkt.Timestamp.Unix()))
+	binary.LittleEndian.PutUint32(record[4:8], uint32(pkt.Timestamp.Nanosecond()))
+	binary.LittleEndian.PutUint32(record[8:12], uint32(len(frame)))
+	binary.LittleEndian.PutUint32(record[12:16], uint32(len(frame)))
+	if _, err := w.w.Write(record[:]); err != nil {
+		return err
+	}
+	_, err := w.w.Write(frame)
+	return err
+}
+
+func pseudoHeader(src, dst net.IP, proto byte, length int) []byte {
+	h := make([]byte, 12)
+	copy(h[0:4], src)
+	copy(h[4:8], dst)
+	h[9] = proto
+	binary.BigEndian.PutUint16(h[10:12], uint16(length))
+	return h
+}
+
+// checksum is the Internet checksum of prefix followed by data
+func checksum(prefix, data []byte) uint16 {
+	var sum uint32
+	for _, b := range [][]byte{prefix, data} {
+		for i := 0; i+1 < len(b); i += 2 {
+			sum += uint32(binary.BigEndian.Uint16(b[i:]))
+		}
+		if len(b)%2 == 1 {
+			sum += uint32(b[len(b)-1]) << 8
+		}
+	}
+	for sum > 0xffff {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// Conn writes the segments of one TCP connection, keeping each side's
+// sequence numbers
+type Conn struct {
+	w                  *Writer
+	at                 time.Time
+	clientIP, serverIP string
+	clientPort         int
+	serverPort         int
+	clientSeq          uint32
+	serverSeq          uint32
+}
+
+// Conn starts a connection from client to server at the given time
+func (w *Writer) Conn(at time.Time, clientIP string, clientPort int, serverIP string, serverPort int) *Conn {
+	return &Conn{
+		w:          w,
+		at:         at,
+		clientIP:   clientIP,
+		clientPort: clientPort,
+		serverIP:   serverIP,
+		serverPort: serverPort,
+		clientSeq:  1000,
+		serverSeq:  5000,
+	}
+}
+
+// Segment writes a segment sent after a delay, from the client or from the
+// server. SYN and FIN take up a sequence number as the payload does.
+func (c *Conn) Segment(fromClient bool, after time.Duration, flags uint8, payload []byte) error {
+	c.at = c.at.Add(after)
+	pkt := &capture.Packet{
+		Timestamp: c.at,
+		Protocol:  "TCP",
+		Flags:     flags,
+		Payload:   payload,
+	}
+	seq, ack := &c.serverSeq, c.clientSeq
+	pkt.SrcIP, pkt.SrcPort, pkt.DstIP, pkt.DstPort = c.serverIP, c.serverPort, c.clientIP, c.clientPort
+	if fromClient {
+		seq, ack = &c.clientSeq, c.serverSeq
+		pkt.SrcIP, pkt.SrcPort, pkt.DstIP, pkt.DstPort = c.clientIP, c.clientPort, c.serverIP, c.serverPort
+	}
+	pkt.Seq = *seq
+	if flags&capture.FlagACK != 0 {
+		pkt.Ack = ack
+	}
+	*seq += uint32(len(payload))
+	if flags&(capture.FlagSYN|capture.FlagFIN) != 0 {
+		*seq++
+	}
+	return c.w.WritePacket(pkt)
+}
+
+// Handshake writes a three-way handshake whose SYN-ACK arrives rtt after
+// the SYN
+func (c *Conn) Handshake(rtt time.Duration) error {
+	if err := c.Segment(true, 0, capture.FlagSYN, nil); err != nil {
+		return err
+	}
+	if err := c.Segment(false, rtt, capture.FlagSYN|capture.FlagACK, nil); err != nil {
+		return err
+	}
+	return c.Segment(true, 0, capture.FlagACK, nil)
+}
+
+// Send writes data from the client
+func (c *Conn) Send(after time.Duration, data []byte) error {
+	return c.Segment(true, after, capture.FlagPSH|capture.FlagACK, data)
+}
+
+// Reply writes data from the server
+func (c *Conn) Reply(after time.Duration, data []byte) error {
+	return c.Segment(false, after, capture.FlagPSH|capture.FlagACK, data)
+}
+
+// Close writes a FIN from each side and the final ACK
+func (c *Conn) Close(after time.Duration) error {
+	if err := c.Segment(true, after, capture.FlagFIN|capture.FlagACK, nil); err != nil {
+		return err
+	}
+	if err := c.Segment(false, 0, capture.FlagFIN|capture.FlagACK, nil); err != nil {
+		return err
+	}
+	return c.Segment(true, 0, capture.FlagACK, nil)
+}
@@ -0,0 +1,348 @@
+package capture
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// DNS response codes
+const (
+	dnsRcodeNoError  = 0
+	dnsRcodeServFail = 2
+	dnsRcodeNXDomain = 3
+	dnsRcodeRefused  = 5
+)
+
+var dnsRcodeNames = map[int]string{
+	dnsRcodeNoError:  "NOERROR",
+	1:                "FORMERR",
+	dnsRcodeServFail: "SERVFAIL",
+	dnsRcodeNXDomain: "NXDOMAIN",
+	4:                "NOTIMP",
+	dnsRcodeRefused:  "REFUSED",
+}
+
+// DNSMessage is the subset of a DNS message the tracker needs
+type DNSMessage struct {
+	ID       uint16
+	Response bool
+	Rcode    int
+	Question string
+	QType    uint16
+	// Addresses holds the A/AAAA answers
+	Addresses []string
+	// TTL is the smallest TTL among the address answers
+	TTL uint32
+}
+
+// ParseDNS decodes a DNS message carried over UDP
+func ParseDNS(b []byte) (*DNSMessage, error) {
+	if len(b) < 12 {
+		return nil, fmt.Errorf("short DNS header")
+	}
+
+	msg := &DNSMessage{
+		ID:       binary.BigEndian.Uint16(b[0:2]),
+		Response: b[2]&0x80 != 0,
+		Rcode:    int(b[3] & 0x0f),
+	}
+	qdCount := int(binary.BigEndian.Uint16(b[4:6]))
+	anCount := int(binary.BigEndian.Uint16(b[6:8]))
+
+	off := 12
+	for i := 0; i < qdCount; i++ {
+		name, next, err := readDNSName(b, off)
+		if err != nil {
+			return nil, err
+		}
+		if next+4 > len(b) {
+			return nil, fmt.Errorf("short DNS question")
+		}
+		if i == 0 {
+			msg.Question = name
+			msg.QType = binary.BigEndian.Uint16(b[next : next+2])
+		}
+		off = next + 4
+	}
+
+	for i := 0; i < anCount; i++ {
+		_, next, err := readDNSName(b, off)
+		if err != nil {
+			return msg, nil
+		}
+		if next+10 > len(b) {
+			return msg, nil
+		}
+		rrType := binary.BigEndian.Uint16(b[next : next+2])
+		ttl := binary.BigEndian.Uint32(b[next+4 : next+8])
+		rdLen := int(binary.BigEndian.Uint16(b[next+8 : next+10]))
+		rdata := next + 10
+		if rdata+rdLen > len(b) {
+			return msg, nil
+		}
+
+		switch {
+		case rrType == 1 && rdLen == 4, rrType == 28 && rdLen == 16:
+			msg.Addresses = append(msg.Addresses, net.IP(b[rdata:rdata+rdLen]).String())
+			if msg.TTL == 0 || ttl < msg.TTL {
+				msg.TTL = ttl
+			}
+		}
+		off = rdata + rdLen
+	}
+
+	return msg, nil
+}
+
+// readDNSName reads a possibly compressed name starting at off, returning the
+// name and the offset just past it in the original position
+func readDNSName(b []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; jumps < 32; {
+		if off >= len(b) {
+			return "", 0, fmt.Errorf("DNS name out of range")
+		}
+		l := int(b[off])
+		switch {
+		case l == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, "."), next, nil
+		case l&0xc0 == 0xc0:
+			if off+2 > len(b) {
+				return "", 0, fmt.Errorf("DNS pointer out of range")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(b[off:off+2]) & 0x3fff)
+			jumps++
+		default:
+			if off+1+l > len(b) {
+				return "", 0, fmt.Errorf("DNS label out of range")
+			}
+			labels = append(labels, string(b[off+1:off+1+l]))
+			off += 1 + l
+		}
+	}
+	return "", 0, fmt.Errorf("too many DNS compression pointers")
+}
+
+// DNSTrackerConfig controls query matching and name retention
+type DNSTrackerConfig struct {
+	// QueryTimeout is how long a query may go unanswered before it is
+	// reported as a failure
+	QueryTimeout time.Duration
+	// MinNameTTL keeps resolved names at least this long, since connections
+	// are often observed well after the lookup
+	MinNameTTL time.Duration
+	// MaxEntries bounds both pending queries and remembered names
+	MaxEntries int
+}
+
+// DefaultDNSTrackerConfig returns the defaults used by the collector
+func DefaultDNSTrackerConfig() DNSTrackerConfig {
+	return DNSTrackerConfig{
+		QueryTimeout: 5 * time.Second,
+		MinNameTTL:   10 * time.Minute,
+		MaxEntries:   65536,
+	}
+}
+
+type dnsQuery struct {
+	client, server string
+	clientPort     int
+	name           string
+	sentAt         time.Time
+}
+
+type dnsName struct {
+	hostname string
+	latency  float64
+	expires  time.Time
+}
+
+// DNSTracker matches DNS queries with their responses to learn which hostname
+// each address was resolved from, and reports failed or unanswered lookups as
+// EDNSFAILURE connections.
+type DNSTracker struct {
+	config DNSTrackerConfig
+
+	mu        sync.Mutex
+	pending   map[string]*dnsQuery
+	names     map[string]dnsName
+	clock     time.Time
+	lastSweep time.Time
+}
+
+// NewDNSTracker creates an empty tracker
+func NewDNSTracker(config DNSTrackerConfig) *DNSTracker {
+	return &DNSTracker{
+		config:  config,
+		pending: make(map[string]*dnsQuery),
+		names:   make(map[string]dnsName),
+	}
+}
+
+// Observe processes one packet, passing lookup failures to emit. emit is
+// called without the tracker's lock held, so it may call Hostname.
+func (t *DNSTracker) Observe(pkt *Packet, emit func(*models.Connection)) {
+	t.mu.Lock()
+	failures := t.observe(pkt)
+	t.mu.Unlock()
+
+	for _, conn := range failures {
+		emit(conn)
+	}
+}
+
+// observe records one packet and returns the failures it settled; the
+// caller holds t.mu
+func (t *DNSTracker) observe(pkt *Packet) []*models.Connection {
+	if pkt.Timestamp.After(t.clock) {
+		t.clock = pkt.Timestamp
+	}
+	var failures []*models.Connection
+	if t.clock.Sub(t.lastSweep) >= time.Second {
+		failures = t.expire()
+	}
+
+	if pkt.Protocol != "UDP" || (pkt.SrcPort != 53 && pkt.DstPort != 53) {
+		return failures
+	}
+	msg, err := ParseDNS(pkt.Payload)
+	if err != nil || msg.Question == "" {
+		return failures
+	}
+
+	if !msg.Response {
+		key := fmt.Sprintf("%s:%d-%s-%d", pkt.SrcIP, pkt.SrcPort, pkt.DstIP, msg.ID)
+		if _, ok := t.pending[key]; !ok && len(t.pending) < t.config.MaxEntries {
+			t.pending[key] = &dnsQuery{
+				client:     pkt.SrcIP,
+				clientPort: pkt.SrcPort,
+				server:     pkt.DstIP,
+				name:       msg.Question,
+				sentAt:     pkt.Timestamp,
+			}
+		}
+		return failures
+	}
+
+	key := fmt.Sprintf("%s:%d-%s-%d", pkt.DstIP, pkt.DstPort, pkt.SrcIP, msg.ID)
+	query, ok := t.pending[key]
+	if !ok {
+		return failures
+	}
+	delete(t.pending, key)
+
+	latency := float64(pkt.Timestamp.Sub(query.sentAt)) / float64(time.Millisecond)
+
+	switch msg.Rcode {
+	case dnsRcodeNoError:
+		ttl := time.Duration(msg.TTL) * time.Second
+		if ttl < t.config.MinNameTTL {
+			ttl = t.config.MinNameTTL
+		}
+		for _, addr := range msg.Addresses {
+			if len(t.names) >= t.config.MaxEntries {
+				break
+			}
+			t.names[addr] = dnsName{
+				hostname: query.name,
+				latency:  latency,
+				expires:  pkt.Timestamp.Add(ttl),
+			}
+		}
+	default:
+		rcode, ok := dnsRcodeNames[msg.Rcode]
+		if !ok {
+			rcode = fmt.Sprintf("RCODE%d", msg.Rcode)
+		}
+		failures = append(failures, query.failure(rcode, latency))
+	}
+	return failures
+}
+
+// Flush reports queries that have waited out the timeout as of the last
+// packet seen. Expiry is driven by packet time, so replays match live runs.
+func (t *DNSTracker) Flush(emit func(*models.Connection)) {
+	t.mu.Lock()
+	failures := t.expire()
+	t.mu.Unlock()
+
+	for _, conn := range failures {
+		emit(conn)
+	}
+}
+
+// expire drops stale names and returns the queries that timed out, oldest
+// first; the caller holds t.mu
+func (t *DNSTracker) expire() []*models.Connection {
+	t.lastSweep = t.clock
+	var failures []*models.Connection
+	for key, query := range t.pending {
+		if t.clock.Sub(query.sentAt) >= t.config.QueryTimeout {
+			delete(t.pending, key)
+			timeout := float64(t.config.QueryTimeout) / float64(time.Millisecond)
+			failures = append(failures, query.failure("TIMEOUT", timeout))
+		}
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		if !failures[i].Timestamp.Equal(failures[j].Timestamp) {
+			return failures[i].Timestamp.Before(failures[j].Timestamp)
+		}
+		return failures[i].ID < failures[j].ID
+	})
+	for addr, name := range t.names {
+		if t.clock.After(name.expires) {
+			delete(t.names, addr)
+		}
+	}
+	return failures
+}
+
+// Hostname returns the name an address was most recently resolved from, and
+// how long that resolution took
+func (t *DNSTracker) Hostname(ip string) (string, float64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	name, ok := t.names[ip]
+	return name.hostname, name.latency, ok
+}
+
+func (q *dnsQuery) failure(rcode string, latency float64) *models.Connection {
+	return &models.Connection{
+		ID: fmt.Sprintf("%s:%d-%s:%d-%d-dns", q.client, q.clientPort,
+			q.server, 53, q.sentAt.UnixNano()),
+		Timestamp:        q.sentAt,
+		SourceIP:         q.client,
+		SourcePort:       q.clientPort,
+		DestIP:           q.server,
+		DestPort:         53,
+		Protocol:         "UDP",
+		AppProtocol:      "dns",
+		ServiceType:      models.ServiceTypeOther,
+		DatabaseType:     models.DatabaseTypeOther,
+		MessageQueueType: models.MessageQueueTypeOther,
+		DestHostname:     q.name,
+		Latency:          latency,
+		DNSLatency:       latency,
+		Error:            string(models.ErrDNSFailure),
+		Tags:             []string{"udp", "network-monitor", "dns"},
+		Metadata: map[string]interface{}{
+			"dns_rcode": rcode,
+			"dns_query": q.name,
+		},
+	}
+}
@@ -0,0 +1,64 @@
+package capture
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// dnsQueryPayload builds a query for an A record
+func dnsQueryPayload(id uint16, name string) []byte {
+	msg := make([]byte, 12)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], 0x0100) // recursion desired
+	binary.BigEndian.PutUint16(msg[4:], 1)
+	for _, label := range strings.Split(name, ".") {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	return append(msg, 0, 0, 1, 0, 1)
+}
+
+// TestDNSTrackerEmitUnlocked checks that emit may call back into the
+// tracker, as the monitor does when it enriches the failures it receives
+func TestDNSTrackerEmitUnlocked(t *testing.T) {
+	tracker := NewDNSTracker(DefaultDNSTrackerConfig())
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	var failures []*models.Connection
+	emit := func(conn *models.Connection) {
+		tracker.Hostname(conn.DestIP)
+		failures = append(failures, conn)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tracker.Observe(&Packet{
+			Timestamp: start,
+			Protocol:  "UDP",
+			SrcIP:     "10.2.0.10",
+			SrcPort:   50000,
+			DstIP:     "10.2.0.53",
+			DstPort:   53,
+			Payload:   dnsQueryPayload(7, "db.internal.example"),
+		}, emit)
+		// Any later packet past the timeout expires the query
+		tracker.Observe(&Packet{Timestamp: start.Add(10 * time.Second), Protocol: "TCP"}, emit)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("emit deadlocked on the tracker's lock")
+	}
+	if len(failures) != 1 || failures[0].Metadata["dns_rcode"] != "TIMEOUT" {
+		t.Fatalf("got %+v, want one TIMEOUT failure", failures)
+	}
+	if failures[0].DestHostname != "db.internal.example" {
+		t.Errorf("DestHostname = %q", failures[0].DestHostname)
+	}
+}
@@ -0,0 +1,312 @@
+package capture
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// FlowTrackerConfig controls how TCP flows are reassembled and reported
+type FlowTrackerConfig struct {
+	// SynTimeout is how long an unanswered SYN waits before the attempt is
+	// reported as ETIMEDOUT
+	SynTimeout time.Duration
+	// IdleTimeout expires established flows that stop sending packets
+	IdleTimeout time.Duration
+	// ReportInterval reports long-lived flows in parts, each carrying the
+	// bytes sent since the previous part; zero reports flows only when they
+	// end
+	ReportInterval time.Duration
+	// MaxFlows bounds memory use; new flows beyond it are ignored
+	MaxFlows int
+}
+
+// DefaultFlowTrackerConfig mirrors the Linux default of five SYN retransmits
+func DefaultFlowTrackerConfig() FlowTrackerConfig {
+	return FlowTrackerConfig{
+		SynTimeout:     30 * time.Second,
+		IdleTimeout:    5 * time.Minute,
+		ReportInterval: time.Minute,
+		MaxFlows:       65536,
+	}
+}
+
+type flowState int
+
+const (
+	flowSynSent flowState = iota
+	flowEstablished
+)
+
+type flowSide struct {
+	ip      string
+	port    int
+	nextSeq uint32
+	seqSet  bool
+	bytes   int64
+	fin     bool
+}
+
+type tcpFlow struct {
+	client, server flowSide
+	state          flowState
+	firstSeen      time.Time
+	lastSeen       time.Time
+	lastReport     time.Time
+	reported       bool  // an earlier part of the flow was reported
+	sentReported   int64 // bytes covered by earlier parts
+	recvReported   int64
+	synCount       int
+	synAckAt       time.Time
+}
+
+// FlowTracker reassembles TCP flows from packets and reports each one as a
+// connection carrying handshake latency, byte counts and failures. All timing
+// uses packet timestamps, so replaying a pcap file yields the same records as
+// the live capture did.
+type FlowTracker struct {
+	config    FlowTrackerConfig
+	flows     map[string]*tcpFlow
+	clock     time.Time
+	lastSweep time.Time
+	emit      func(*models.Connection)
+}
+
+// NewFlowTracker creates a tracker passing finished flows to emit
+func NewFlowTracker(config FlowTrackerConfig, emit func(*models.Connection)) *FlowTracker {
+	return &FlowTracker{
+		config: config,
+		flows:  make(map[string]*tcpFlow),
+		emit:   emit,
+	}
+}
+
+// Observe processes one packet
+func (t *FlowTracker) Observe(pkt *Packet) {
+	if pkt.Protocol != "TCP" {
+		return
+	}
+	if pkt.Timestamp.After(t.clock) {
+		t.clock = pkt.Timestamp
+	}
+
+	key := flowKey(pkt.SrcIP, pkt.SrcPort, pkt.DstIP, pkt.DstPort)
+	flow, ok := t.flows[key]
+	if !ok {
+		// A bare segment without a SYN is the tail of a flow already
+		// reported, such as the last ACK of a close; joining mid-stream
+		// waits for data
+		if pkt.HasFlag(FlagRST) || !pkt.HasFlag(FlagSYN) && len(pkt.Payload) == 0 ||
+			len(t.flows) >= t.config.MaxFlows {
+			return
+		}
+		flow = newFlow(pkt)
+		t.flows[key] = flow
+	}
+	flow.lastSeen = pkt.Timestamp
+
+	fromClient := pkt.SrcIP == flow.client.ip && pkt.SrcPort == flow.client.port
+
+	switch {
+	case pkt.HasFlag(FlagSYN) && !pkt.HasFlag(FlagACK):
+		if fromClient && flow.state == flowSynSent {
+			flow.synCount++
+			flow.client.nextSeq, flow.client.seqSet = pkt.Seq+1, true
+		}
+	case pkt.HasFlag(FlagSYN | FlagACK):
+		if !fromClient && flow.synAckAt.IsZero() {
+			flow.synAckAt = pkt.Timestamp
+			flow.state = flowEstablished
+			flow.server.nextSeq, flow.server.seqSet = pkt.Seq+1, true
+		}
+	case pkt.HasFlag(FlagRST):
+		t.finishReset(key, flow, fromClient, pkt.Timestamp)
+		return
+	default:
+		if flow.state == flowSynSent {
+			if fromClient {
+				// ACKs or data before we saw the SYN/ACK; wait for the server
+				break
+			}
+			// The server is talking, so the SYN/ACK was not captured
+			flow.state = flowEstablished
+		}
+		side := &flow.server
+		if fromClient {
+			side = &flow.client
+		}
+		side.count(pkt.Seq, len(pkt.Payload))
+		if pkt.HasFlag(FlagFIN) {
+			side.fin = true
+		}
+	}
+
+	if flow.client.fin && flow.server.fin {
+		t.finish(key, flow, "", pkt.Timestamp)
+	} else if t.config.ReportInterval > 0 && flow.state == flowEstablished &&
+		pkt.Timestamp.Sub(flow.lastReport) >= t.config.ReportInterval {
+		flow.lastReport = pkt.Timestamp
+		t.emit(flow.connection("", pkt.Timestamp))
+	}
+
+	if t.clock.Sub(t.lastSweep) >= time.Second {
+		t.sweep()
+		t.lastSweep = t.clock
+	}
+}
+
+// Flush reports every flow still being tracked, treating the end of the
+// capture as "now". Unanswered SYNs are reported as timeouts only if they
+// were retransmitted or waited out the full timeout.
+func (t *FlowTracker) Flush() {
+	for _, key := range t.sortedKeys() {
+		flow := t.flows[key]
+		if flow.state == flowSynSent {
+			if flow.synCount > 1 || t.clock.Sub(flow.firstSeen) >= t.config.SynTimeout {
+				t.finish(key, flow, string(models.ErrConnTimeout), t.clock)
+			} else {
+				delete(t.flows, key)
+			}
+			continue
+		}
+		t.finish(key, flow, "", flow.lastSeen)
+	}
+}
+
+func (t *FlowTracker) sweep() {
+	for _, key := range t.sortedKeys() {
+		flow := t.flows[key]
+		switch {
+		case flow.state == flowSynSent && t.clock.Sub(flow.firstSeen) >= t.config.SynTimeout:
+			t.finish(key, flow, string(models.ErrConnTimeout), t.clock)
+		case flow.state == flowEstablished && t.clock.Sub(flow.lastSeen) >= t.config.IdleTimeout:
+			t.finish(key, flow, "", flow.lastSeen)
+		}
+	}
+}
+
+// finishReset classifies a RST: refused if it answers a SYN, reset otherwise
+func (t *FlowTracker) finishReset(key string, flow *tcpFlow, fromClient bool, at time.Time) {
+	switch {
+	case flow.state == flowSynSent && !fromClient:
+		t.finish(key, flow, string(models.ErrConnRefused), at)
+	case flow.state == flowSynSent:
+		// Client gave up on its own attempt; nothing useful to report
+		delete(t.flows, key)
+	case flow.client.fin || flow.server.fin:
+		// Aborting an already closing flow is a normal teardown
+		t.finish(key, flow, "", at)
+	default:
+		t.finish(key, flow, string(models.ErrConnReset), at)
+	}
+}
+
+// sortedKeys returns flow keys in a stable order so that replays emit
+// records in the same sequence
+func (t *FlowTracker) sortedKeys() []string {
+	keys := make([]string, 0, len(t.flows))
+	for key := range t.flows {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (t *FlowTracker) finish(key string, flow *tcpFlow, errType string, at time.Time) {
+	delete(t.flows, key)
+	t.emit(flow.connection(errType, at))
+}
+
+func newFlow(pkt *Packet) *tcpFlow {
+	flow := &tcpFlow{
+		firstSeen:  pkt.Timestamp,
+		lastReport: pkt.Timestamp,
+	}
+
+	client := flowSide{ip: pkt.SrcIP, port: pkt.SrcPort}
+	server := flowSide{ip: pkt.DstIP, port: pkt.DstPort}
+
+	switch {
+	case pkt.HasFlag(FlagSYN) && !pkt.HasFlag(FlagACK):
+		// Counted when the SYN itself is processed
+	case pkt.HasFlag(FlagSYN | FlagACK):
+		// Missed the SYN; the SYN/ACK comes from the server
+		client, server = server, client
+	default:
+		// Joined mid-stream: assume the ephemeral (higher) port is the client
+		if pkt.SrcPort < pkt.DstPort {
+			client, server = server, client
+		}
+		flow.state = flowEstablished
+	}
+
+	flow.client, flow.server = client, server
+	return flow
+}
+
+// count adds the payload bytes not already counted, skipping retransmissions
+func (s *flowSide) count(seq uint32, n int) {
+	if n == 0 {
+		return
+	}
+	end := seq + uint32(n)
+	if !s.seqSet {
+		s.nextSeq, s.seqSet = end, true
+		s.bytes += int64(n)
+		return
+	}
+	if int32(end-s.nextSeq) <= 0 {
+		return
+	}
+	start := seq
+	if int32(s.nextSeq-seq) > 0 {
+		start = s.nextSeq
+	}
+	s.bytes += int64(end - start)
+	s.nextSeq = end
+}
+
+func (f *tcpFlow) connection(errType string, at time.Time) *models.Connection {
+	conn := &models.Connection{
+		ID: fmt.Sprintf("%s:%d-%s:%d-%d-%d", f.client.ip, f.client.port,
+			f.server.ip, f.server.port, f.firstSeen.UnixNano(), at.UnixNano()),
+		Timestamp:        f.firstSeen,
+		SourceIP:         f.client.ip,
+		SourcePort:       f.client.port,
+		DestIP:           f.server.ip,
+		DestPort:         f.server.port,
+		Protocol:         "TCP",
+		ServiceType:      models.ServiceTypeOther,
+		DatabaseType:     models.DatabaseTypeOther,
+		MessageQueueType: models.MessageQueueTypeOther,
+		BytesSent:        f.client.bytes - f.sentReported,
+		BytesReceived:    f.server.bytes - f.recvReported,
+		Duration:         float64(at.Sub(f.firstSeen)) / float64(time.Millisecond),
+		Error:            errType,
+		Tags:             []string{"tcp", "network-monitor", "capture"},
+	}
+	// The handshake belongs to the first part only, so that summing or
+	// averaging over parts counts it once
+	if !f.reported {
+		if f.synCount > 1 {
+			conn.RetryCount = f.synCount - 1
+		}
+		if !f.synAckAt.IsZero() && f.synCount > 0 {
+			conn.Latency = float64(f.synAckAt.Sub(f.firstSeen)) / float64(time.Millisecond)
+		}
+	}
+	f.reported = true
+	f.sentReported, f.recvReported = f.client.bytes, f.server.bytes
+	return conn
+}
+
+func flowKey(srcIP string, srcPort int, dstIP string, dstPort int) string {
+	a := fmt.Sprintf("%s:%d", srcIP, srcPort)
+	b := fmt.Sprintf("%s:%d", dstIP, dstPort)
+	if a < b {
+		return a + "-" + b
+	}
+	return b + "-" + a
+}
@@ -0,0 +1,86 @@
+package capture
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+//go:generate go run testdata/gen.go
+
+func replayFlows(t *testing.T) []*models.Connection {
+	t.Helper()
+	source, err := OpenPcapFile("testdata/flows.pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conns []*models.Connection
+	err = NewFlowSource(source, DefaultFlowTrackerConfig()).Run(make(chan struct{}), func(conn *models.Connection) {
+		conns = append(conns, conn)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conns
+}
+
+func TestFlowFixtures(t *testing.T) {
+	conns := replayFlows(t)
+
+	byPort := make(map[int][]*models.Connection)
+	for _, conn := range conns {
+		byPort[conn.DestPort] = append(byPort[conn.DestPort], conn)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		port       int
+		err        models.ConnectionError
+		latency    float64
+		retries    int
+		sent, recv int64
+		parts      int
+	}{
+		{"clean", 5432, "", 2, 0, 160, 300, 1},
+		{"refused", 6379, models.ErrConnRefused, 0, 0, 0, 0, 1},
+		{"reset", 443, models.ErrConnReset, 1, 0, 50, 0, 1},
+		{"timeout", 9092, models.ErrConnTimeout, 0, 3, 0, 0, 1},
+		{"long-lived", 8080, "", 3, 0, 350, 400, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			parts := byPort[tc.port]
+			if len(parts) != tc.parts {
+				t.Fatalf("got %d records, want %d", len(parts), tc.parts)
+			}
+			var sent, recv int64
+			for i, conn := range parts {
+				sent += conn.BytesSent
+				recv += conn.BytesReceived
+				if i > 0 && (conn.Latency != 0 || conn.RetryCount != 0) {
+					t.Errorf("part %d repeats the handshake: latency %v, retries %d", i, conn.Latency, conn.RetryCount)
+				}
+			}
+			last, first := parts[len(parts)-1], parts[0]
+			if last.Error != string(tc.err) {
+				t.Errorf("Error = %q, want %q", last.Error, tc.err)
+			}
+			if first.Latency != tc.latency {
+				t.Errorf("Latency = %v, want %v", first.Latency, tc.latency)
+			}
+			if first.RetryCount != tc.retries {
+				t.Errorf("RetryCount = %d, want %d", first.RetryCount, tc.retries)
+			}
+			if sent != tc.sent || recv != tc.recv {
+				t.Errorf("bytes = %d/%d, want %d/%d", sent, recv, tc.sent, tc.recv)
+			}
+		})
+	}
+}
+
+func TestFlowReplayIsDeterministic(t *testing.T) {
+	first, second := replayFlows(t), replayFlows(t)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("replays differ:\n%+v\n%+v", first, second)
+	}
+}
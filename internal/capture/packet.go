@@ -0,0 +1,200 @@
+// Package capture reads raw packets from pcap files or live AF_PACKET sockets
+// and decodes them into the transport-level view the collector needs.
+package capture
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Link types understood by the decoder (see https://www.tcpdump.org/linktypes.html)
+const (
+	LinkTypeNull     uint32 = 0
+	LinkTypeEthernet uint32 = 1
+	LinkTypeRaw      uint32 = 101
+	LinkTypeLinuxSLL uint32 = 113
+)
+
+// TCP header flags
+const (
+	FlagFIN uint8 = 0x01
+	FlagSYN uint8 = 0x02
+	FlagRST uint8 = 0x04
+	FlagPSH uint8 = 0x08
+	FlagACK uint8 = 0x10
+)
+
+// ErrNotTransport is returned for frames that do not carry TCP or UDP
+var ErrNotTransport = errors.New("packet does not carry TCP or UDP")
+
+// Packet is a decoded TCP or UDP segment
+type Packet struct {
+	Timestamp time.Time
+	SrcIP     string
+	SrcPort   int
+	DstIP     string
+	DstPort   int
+	Protocol  string // "TCP" or "UDP"
+	Flags     uint8
+	Seq       uint32
+	Ack       uint32
+	Payload   []byte
+}
+
+// HasFlag reports whether all of the given TCP flags are set
+func (p *Packet) HasFlag(flags uint8) bool {
+	return p.Flags&flags == flags
+}
+
+// Source produces decoded packets until it is exhausted or closed.
+// ReadPacket returns io.EOF when no more packets are available.
+type Source interface {
+	ReadPacket() (*Packet, error)
+	Close() error
+}
+
+// Decode parses a captured frame of the given link type
+func Decode(linkType uint32, data []byte, ts time.Time) (*Packet, error) {
+	switch linkType {
+	case LinkTypeEthernet:
+		return decodeEthernet(data, ts)
+	case LinkTypeRaw:
+		return decodeIP(data, ts)
+	case LinkTypeLinuxSLL:
+		if len(data) < 16 {
+			return nil, fmt.Errorf("short SLL header")
+		}
+		return decodeEtherType(binary.BigEndian.Uint16(data[14:16]), data[16:], ts)
+	case LinkTypeNull:
+		// BSD loopback: 4-byte address family in host byte order
+		if len(data) < 4 {
+			return nil, fmt.Errorf("short loopback header")
+		}
+		return decodeIP(data[4:], ts)
+	default:
+		return nil, fmt.Errorf("unsupported link type: %d", linkType)
+	}
+}
+
+func decodeEthernet(data []byte, ts time.Time) (*Packet, error) {
+	if len(data) < 14 {
+		return nil, fmt.Errorf("short ethernet header")
+	}
+	etherType := binary.BigEndian.Uint16(data[12:14])
+	data = data[14:]
+
+	// Strip 802.1Q / 802.1ad VLAN tags
+	for etherType == 0x8100 || etherType == 0x88a8 {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("short VLAN header")
+		}
+		etherType = binary.BigEndian.Uint16(data[2:4])
+		data = data[4:]
+	}
+
+	return decodeEtherType(etherType, data, ts)
+}
+
+func decodeEtherType(etherType uint16, data []byte, ts time.Time) (*Packet, error) {
+	switch etherType {
+	case 0x0800, 0x86dd:
+		return decodeIP(data, ts)
+	default:
+		return nil, ErrNotTransport
+	}
+}
+
+func decodeIP(data []byte, ts time.Time) (*Packet, error) {
+	if len(data) < 1 {
+		return nil, fmt.Errorf("empty IP packet")
+	}
+
+	var src, dst net.IP
+	var proto uint8
+	var payload []byte
+
+	switch data[0] >> 4 {
+	case 4:
+		if len(data) < 20 {
+			return nil, fmt.Errorf("short IPv4 header")
+		}
+		ihl := int(data[0]&0x0f) * 4
+		total := int(binary.BigEndian.Uint16(data[2:4]))
+		if ihl < 20 || len(data) < ihl {
+			return nil, fmt.Errorf("invalid IPv4 header length")
+		}
+		// Non-first fragments carry no transport header
+		if binary.BigEndian.Uint16(data[6:8])&0x1fff != 0 {
+			return nil, ErrNotTransport
+		}
+		if total >= ihl && total < len(data) {
+			data = data[:total]
+		}
+		proto = data[9]
+		src = net.IP(data[12:16])
+		dst = net.IP(data[16:20])
+		payload = data[ihl:]
+	case 6:
+		if len(data) < 40 {
+			return nil, fmt.Errorf("short IPv6 header")
+		}
+		proto = data[6]
+		src = net.IP(data[8:24])
+		dst = net.IP(data[24:40])
+		payload = data[40:]
+
+		// Walk the common extension headers
+		for proto == 0 || proto == 43 || proto == 60 {
+			if len(payload) < 8 {
+				return nil, fmt.Errorf("short IPv6 extension header")
+			}
+			extLen := (int(payload[1]) + 1) * 8
+			if len(payload) < extLen {
+				return nil, fmt.Errorf("short IPv6 extension header")
+			}
+			proto = payload[0]
+			payload = payload[extLen:]
+		}
+	default:
+		return nil, fmt.Errorf("unknown IP version: %d", data[0]>>4)
+	}
+
+	pkt := &Packet{
+		Timestamp: ts,
+		SrcIP:     src.String(),
+		DstIP:     dst.String(),
+	}
+
+	switch proto {
+	case 6:
+		if len(payload) < 20 {
+			return nil, fmt.Errorf("short TCP header")
+		}
+		offset := int(payload[12]>>4) * 4
+		if offset < 20 || len(payload) < offset {
+			return nil, fmt.Errorf("invalid TCP data offset")
+		}
+		pkt.Protocol = "TCP"
+		pkt.SrcPort = int(binary.BigEndian.Uint16(payload[0:2]))
+		pkt.DstPort = int(binary.BigEndian.Uint16(payload[2:4]))
+		pkt.Seq = binary.BigEndian.Uint32(payload[4:8])
+		pkt.Ack = binary.BigEndian.Uint32(payload[8:12])
+		pkt.Flags = payload[13]
+		pkt.Payload = payload[offset:]
+	case 17:
+		if len(payload) < 8 {
+			return nil, fmt.Errorf("short UDP header")
+		}
+		pkt.Protocol = "UDP"
+		pkt.SrcPort = int(binary.BigEndian.Uint16(payload[0:2]))
+		pkt.DstPort = int(binary.BigEndian.Uint16(payload[2:4]))
+		pkt.Payload = payload[8:]
+	default:
+		return nil, ErrNotTransport
+	}
+
+	return pkt, nil
+}
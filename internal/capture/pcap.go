@@ -0,0 +1,127 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	pcapMagicMicros = 0xa1b2c3d4
+	pcapMagicNanos  = 0xa1b23c4d
+	pcapngMagic     = 0x0a0d0d0a
+)
+
+// PcapReader reads packets from a classic libpcap capture file.
+// Frames that do not decode to TCP or UDP are skipped.
+type PcapReader struct {
+	r        *bufio.Reader
+	closer   io.Closer
+	order    binary.ByteOrder
+	nanos    bool
+	linkType uint32
+	header   [16]byte
+}
+
+// OpenPcapFile opens a pcap file for reading
+func OpenPcapFile(path string) (*PcapReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pcap file: %v", err)
+	}
+
+	reader, err := NewPcapReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	reader.closer = f
+	return reader, nil
+}
+
+// NewPcapReader reads the global header from r and returns a reader positioned
+// at the first packet record
+func NewPcapReader(r io.Reader) (*PcapReader, error) {
+	br := bufio.NewReader(r)
+
+	var header [24]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, fmt.Errorf("failed to read pcap header: %v", err)
+	}
+
+	reader := &PcapReader{r: br}
+	switch magic := binary.LittleEndian.Uint32(header[0:4]); magic {
+	case pcapMagicMicros:
+		reader.order = binary.LittleEndian
+	case pcapMagicNanos:
+		reader.order = binary.LittleEndian
+		reader.nanos = true
+	default:
+		switch binary.BigEndian.Uint32(header[0:4]) {
+		case pcapMagicMicros:
+			reader.order = binary.BigEndian
+		case pcapMagicNanos:
+			reader.order = binary.BigEndian
+			reader.nanos = true
+		case pcapngMagic:
+			return nil, fmt.Errorf("pcapng files are not supported, convert with: editcap -F pcap in.pcapng out.pcap")
+		default:
+			return nil, fmt.Errorf("not a pcap file (magic %#x)", magic)
+		}
+	}
+
+	reader.linkType = reader.order.Uint32(header[20:24]) & 0x0fffffff
+	return reader, nil
+}
+
+// LinkType returns the link-layer header type of the capture
+func (p *PcapReader) LinkType() uint32 {
+	return p.linkType
+}
+
+// ReadPacket returns the next TCP or UDP packet in the file
+func (p *PcapReader) ReadPacket() (*Packet, error) {
+	for {
+		if _, err := io.ReadFull(p.r, p.header[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+
+		sec := int64(p.order.Uint32(p.header[0:4]))
+		frac := int64(p.order.Uint32(p.header[4:8]))
+		capLen := p.order.Uint32(p.header[8:12])
+		if capLen > 1<<18 {
+			return nil, fmt.Errorf("invalid pcap record length: %d", capLen)
+		}
+
+		data := make([]byte, capLen)
+		if _, err := io.ReadFull(p.r, data); err != nil {
+			return nil, io.EOF
+		}
+
+		if !p.nanos {
+			frac *= 1000
+		}
+		ts := time.Unix(sec, frac)
+
+		pkt, err := Decode(p.linkType, data, ts)
+		if err != nil {
+			// Skip frames we cannot decode rather than aborting the whole capture
+			continue
+		}
+		return pkt, nil
+	}
+}
+
+// Close closes the underlying file when the reader was opened from a path
+func (p *PcapReader) Close() error {
+	if p.closer != nil {
+		return p.closer.Close()
+	}
+	return nil
+}
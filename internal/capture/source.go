@@ -0,0 +1,126 @@
+package capture
+
+import (
+	"io"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// FlowSource turns captured packets into connection records. It satisfies the
+// monitor's ConnectionSource interface.
+type FlowSource struct {
+	source Source
+	config FlowTrackerConfig
+	taps   []func(*Packet)
+	dns    *DNSTracker
+}
+
+// NewFlowSource creates a connection source reading from a packet source
+func NewFlowSource(source Source, config FlowTrackerConfig) *FlowSource {
+	return &FlowSource{source: source, config: config}
+}
+
+// AddTap registers a function that sees every packet before flow tracking,
+// so other analyzers can share the same capture
+func (s *FlowSource) AddTap(tap func(*Packet)) {
+	s.taps = append(s.taps, tap)
+}
+
+// TrackDNS feeds DNS traffic to the tracker and emits its lookup failures
+// alongside the TCP flows
+func (s *FlowSource) TrackDNS(tracker *DNSTracker) {
+	s.dns = tracker
+}
+
+// Offline reports whether packets come from a capture file rather than a
+// live interface
+func (s *FlowSource) Offline() bool {
+	_, ok := s.source.(*PcapReader)
+	return ok
+}
+
+// Run tracks flows until stop is closed or the packet source is exhausted.
+// Flows still open at that point are flushed.
+func (s *FlowSource) Run(stop <-chan struct{}, emit func(*models.Connection)) error {
+	tracker := NewFlowTracker(s.config, emit)
+
+	// Closing the packet source unblocks ReadPacket when asked to stop
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			s.source.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		pkt, err := s.source.ReadPacket()
+		if err != nil {
+			tracker.Flush()
+			if s.dns != nil {
+				s.dns.Flush(emit)
+			}
+			select {
+			case <-stop:
+				return nil
+			default:
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		for _, tap := range s.taps {
+			tap(pkt)
+		}
+		tracker.Observe(pkt)
+		if s.dns != nil {
+			s.dns.Observe(pkt, emit)
+		}
+	}
+}
+
+// DNSSource reports DNS lookup failures from a packet source on its own, for
+// use alongside a non-capture connection source
+type DNSSource struct {
+	source  Source
+	tracker *DNSTracker
+}
+
+// NewDNSSource creates a source feeding packets to the DNS tracker
+func NewDNSSource(source Source, tracker *DNSTracker) *DNSSource {
+	return &DNSSource{source: source, tracker: tracker}
+}
+
+// Run observes DNS traffic until stop is closed or the packets run out
+func (s *DNSSource) Run(stop <-chan struct{}, emit func(*models.Connection)) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			s.source.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		pkt, err := s.source.ReadPacket()
+		if err != nil {
+			s.tracker.Flush(emit)
+			select {
+			case <-stop:
+				return nil
+			default:
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		s.tracker.Observe(pkt, emit)
+	}
+}
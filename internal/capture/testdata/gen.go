@@ -0,0 +1,78 @@
+//go:build ignore
+
+// gen writes flows.pcap for flows_test.go: a clean connection, a refused
+// one, one whose SYNs go unanswered, one reset mid-stream and a long-lived
+// one, one after another. Run it from the package directory with go
+// generate.
+package main
+
+import (
+	"bytes"
+	"log"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/capture"
+	"github.com/karthik-minnikanti/cinnamon/internal/capture/capturetest"
+)
+
+var base = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func main() {
+	w, err := capturetest.Create("testdata/flows.pcap")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Clean: 2ms handshake, 160 bytes up and 300 down, then FIN from both
+	c := w.Conn(base, "10.2.0.10", 41000, "10.2.0.20", 5432)
+	must(c.Handshake(2 * time.Millisecond))
+	must(c.Send(time.Millisecond, bytes.Repeat([]byte("q"), 120)))
+	must(c.Reply(time.Millisecond, bytes.Repeat([]byte("r"), 300)))
+	must(c.Send(time.Millisecond, bytes.Repeat([]byte("q"), 40)))
+	must(c.Close(time.Millisecond))
+
+	// Refused: the SYN is answered with a RST
+	c = w.Conn(base.Add(time.Second), "10.2.0.10", 41001, "10.2.0.21", 6379)
+	must(c.Segment(true, 0, capture.FlagSYN, nil))
+	must(c.Segment(false, 500*time.Microsecond, capture.FlagRST|capture.FlagACK, nil))
+
+	// Reset: the server aborts after the first request
+	c = w.Conn(base.Add(2*time.Second), "10.2.0.10", 41002, "10.2.0.23", 443)
+	must(c.Handshake(time.Millisecond))
+	must(c.Send(time.Millisecond, bytes.Repeat([]byte("q"), 50)))
+	must(c.Segment(false, time.Millisecond, capture.FlagRST|capture.FlagACK, nil))
+
+	// Timeout: the SYN is retransmitted with backoff and never answered;
+	// retransmits reuse the first SYN's sequence number
+	at := base.Add(3 * time.Second)
+	for _, after := range []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second} {
+		at = at.Add(after)
+		must(w.WritePacket(&capture.Packet{
+			Timestamp: at,
+			Protocol:  "TCP",
+			SrcIP:     "10.2.0.10",
+			SrcPort:   41003,
+			DstIP:     "10.2.0.22",
+			DstPort:   9092,
+			Flags:     capture.FlagSYN,
+			Seq:       1000,
+		}))
+	}
+
+	// Long-lived: data spread over more than two report intervals
+	c = w.Conn(base.Add(11*time.Second), "10.2.0.10", 41004, "10.2.0.24", 8080)
+	must(c.Handshake(3 * time.Millisecond))
+	must(c.Send(time.Millisecond, bytes.Repeat([]byte("a"), 100)))
+	must(c.Send(70*time.Second, bytes.Repeat([]byte("b"), 200)))
+	must(c.Reply(time.Second, bytes.Repeat([]byte("c"), 400)))
+	must(c.Send(70*time.Second, bytes.Repeat([]byte("d"), 50)))
+	must(c.Close(time.Millisecond))
+
+	must(w.Close())
+}
+
+func must(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,192 @@
+// Package certs keeps an inventory of the TLS certificates servers present
+// to monitored services, gathered from the collector's TLS checks and from
+// handshakes on a packet capture, and reports certificates nearing expiry.
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/anomaly"
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// Parse decodes a chain of DER certificates, leaf first, as first seen at
+// the given time
+func Parse(chain [][]byte, seen time.Time) ([]*models.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("certificate chain is empty")
+	}
+	certs := make([]*models.Certificate, len(chain))
+	for i, der := range chain {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("certificate %d: %v", i+1, err)
+		}
+		sum := sha256.Sum256(der)
+		certs[i] = &models.Certificate{
+			Fingerprint:  hex.EncodeToString(sum[:]),
+			Subject:      name(cert.Subject),
+			SANs:         sans(cert),
+			Issuer:       name(cert.Issuer),
+			SerialNumber: cert.SerialNumber.String(),
+			NotBefore:    cert.NotBefore.UTC(),
+			NotAfter:     cert.NotAfter.UTC(),
+			KeyType:      keyType(cert),
+			IsCA:         cert.IsCA,
+			FirstSeen:    seen,
+			LastSeen:     seen,
+		}
+		if i > 0 {
+			certs[i-1].IssuerFingerprint = certs[i].Fingerprint
+		}
+	}
+	return certs, nil
+}
+
+// name prefers the common name, falling back to the full distinguished name
+func name(n pkix.Name) string {
+	if n.CommonName != "" {
+		return n.CommonName
+	}
+	return n.String()
+}
+
+func sans(cert *x509.Certificate) []string {
+	names := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	return append(names, cert.EmailAddresses...)
+}
+
+func keyType(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return "RSA-" + strconv.Itoa(key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
+
+// Inventory records the chains collectors observe and raises a cert_expiry
+// anomaly, at most once a day per certificate, for any certificate in a
+// chain that expires within the alert window
+type Inventory struct {
+	store       storage.CertificateStore
+	anomalies   storage.AnomalyStore
+	notifiers   []anomaly.Notifier
+	alertWithin time.Duration
+
+	mu      sync.Mutex
+	alerted map[string]time.Time // fingerprint to the day last reported
+}
+
+// NewInventory creates an inventory. anomalies may be nil, and an
+// alertWithin of zero turns expiry alerts off.
+func NewInventory(store storage.CertificateStore, anomalies storage.AnomalyStore, alertWithin time.Duration, notifiers ...anomaly.Notifier) *Inventory {
+	return &Inventory{
+		store:       store,
+		anomalies:   anomalies,
+		notifiers:   notifiers,
+		alertWithin: alertWithin,
+		alerted:     make(map[string]time.Time),
+	}
+}
+
+// Record stores an observation's chain and alerts on expiring certificates
+func (inv *Inventory) Record(obs *models.CertificateObservation) error {
+	chain, err := Parse(obs.Chain, obs.Timestamp)
+	if err != nil {
+		return err
+	}
+	endpoint := models.CertificateEndpoint{
+		DestIP:      obs.DestIP,
+		DestPort:    obs.DestPort,
+		ServerName:  obs.ServerName,
+		Host:        obs.Host,
+		Environment: obs.Environment,
+		ServiceName: obs.ServiceName,
+		Source:      obs.Source,
+		FirstSeen:   obs.Timestamp,
+		LastSeen:    obs.Timestamp,
+	}
+	if err := inv.store.RecordCertificates(chain, endpoint); err != nil {
+		return err
+	}
+
+	if inv.alertWithin > 0 {
+		for _, c := range chain {
+			if c.NotAfter.Sub(obs.Timestamp) < inv.alertWithin {
+				inv.alert(c, obs)
+			}
+		}
+	}
+	return nil
+}
+
+func (inv *Inventory) alert(c *models.Certificate, obs *models.CertificateObservation) {
+	day := obs.Timestamp.UTC().Truncate(24 * time.Hour)
+	inv.mu.Lock()
+	if inv.alerted[c.Fingerprint].Equal(day) {
+		inv.mu.Unlock()
+		return
+	}
+	inv.alerted[c.Fingerprint] = day
+	inv.mu.Unlock()
+
+	dest := obs.ServerName
+	if dest == "" {
+		dest = net.JoinHostPort(obs.DestIP, strconv.Itoa(obs.DestPort))
+	}
+	days := math.Floor(c.NotAfter.Sub(obs.Timestamp).Hours() / 24)
+	message := fmt.Sprintf("certificate %q presented by %s expires in %.0f days, on %s",
+		c.Subject, dest, days, c.NotAfter.Format("2006-01-02"))
+	if days < 0 {
+		message = fmt.Sprintf("certificate %q presented by %s expired %.0f days ago, on %s",
+			c.Subject, dest, -days, c.NotAfter.Format("2006-01-02"))
+	}
+
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%d", models.AnomalyCertExpiry, c.Fingerprint, day.Unix())))
+	a := &models.Anomaly{
+		ID:          hex.EncodeToString(sum[:8]),
+		Timestamp:   obs.Timestamp,
+		Kind:        models.AnomalyCertExpiry,
+		ServiceName: obs.ServiceName,
+		Destination: dest,
+		Metric:      "days_left",
+		Value:       days,
+		Baseline:    math.Floor(inv.alertWithin.Hours() / 24),
+		Message:     message,
+	}
+	if inv.anomalies != nil {
+		if err := inv.anomalies.StoreAnomaly(a); err != nil {
+			log.Printf("Error storing certificate expiry: %v", err)
+		}
+	}
+	for _, n := range inv.notifiers {
+		if err := n.Notify(a); err != nil {
+			log.Printf("Error sending certificate expiry: %v", err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package certs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/capture"
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+//go:generate go run testdata/gen.go
+
+// base is when the fixtures were captured
+var base = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func readDER(t *testing.T, names ...string) [][]byte {
+	t.Helper()
+	var chain [][]byte
+	for _, name := range names {
+		der, err := os.ReadFile("testdata/" + name + ".der")
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, der)
+	}
+	return chain
+}
+
+func TestParse(t *testing.T) {
+	certs, err := Parse(readDER(t, "db", "root"), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, root := certs[0], certs[1]
+	for _, tc := range []struct {
+		field     string
+		got, want interface{}
+	}{
+		{"db subject", db.Subject, "db.internal.example"},
+		{"db SANs", db.SANs, []string{"db.internal.example", "*.db.internal.example", "10.4.0.20",
+			"spiffe://cluster.local/ns/db/sa/postgres", "dba@example.com"}},
+		{"db issuer", db.Issuer, "Cinnamon Test Root"},
+		{"db serial", db.SerialNumber, "1001"},
+		{"db key", db.KeyType, "RSA-2048"},
+		{"db expiry", db.NotAfter, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"db is CA", db.IsCA, false},
+		{"db issuer fingerprint", db.IssuerFingerprint, root.Fingerprint},
+		{"db seen", db.FirstSeen, base},
+		{"root SANs", root.SANs, []string{}},
+		{"root key", root.KeyType, "ECDSA-P-256"},
+		{"root is CA", root.IsCA, true},
+		{"root issuer fingerprint", root.IssuerFingerprint, ""},
+	} {
+		if !reflect.DeepEqual(tc.got, tc.want) {
+			t.Errorf("%s = %v, want %v", tc.field, tc.got, tc.want)
+		}
+	}
+	if len(db.Fingerprint) != 64 || db.Fingerprint == root.Fingerprint {
+		t.Errorf("fingerprints %q, %q, want distinct SHA-256 hex", db.Fingerprint, root.Fingerprint)
+	}
+
+	cache, err := Parse(readDER(t, "cache"), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without a common name the subject is the full name
+	if cache[0].Subject != "OU=cache,O=Cinnamon" || cache[0].KeyType != "Ed25519" {
+		t.Errorf("cache = %s %s", cache[0].Subject, cache[0].KeyType)
+	}
+
+	if _, err := Parse(nil, base); err == nil {
+		t.Error("Parse accepted an empty chain")
+	}
+	chain := readDER(t, "db", "root")
+	chain[1] = chain[1][:100]
+	if _, err := Parse(chain, base); err == nil || !strings.HasPrefix(err.Error(), "certificate 2:") {
+		t.Errorf("Parse of a truncated certificate = %v", err)
+	}
+}
+
+// replay feeds the fixture capture to a tap and returns what it emits
+func replay(t *testing.T) []*models.CertificateObservation {
+	t.Helper()
+	source, err := capture.OpenPcapFile("testdata/handshakes.pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	var observed []*models.CertificateObservation
+	tap := NewTap(func(obs *models.CertificateObservation) { observed = append(observed, obs) })
+	for {
+		pkt, err := source.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		tap.Observe(pkt)
+	}
+	if len(tap.handshakes) != 0 {
+		t.Errorf("%d handshakes left after every connection closed", len(tap.handshakes))
+	}
+	return observed
+}
+
+func TestTapFixtures(t *testing.T) {
+	observed := replay(t)
+
+	// The TLS 1.3 handshake and the HTTP request yield nothing
+	var got []string
+	for _, obs := range observed {
+		got = append(got, fmt.Sprintf("%s:%d %q %s chain=%d", obs.DestIP, obs.DestPort, obs.ServerName, obs.Source, len(obs.Chain)))
+	}
+	want := []string{
+		`10.4.0.20:5433 "db.internal.example" capture chain=2`,
+		`10.4.0.21:6380 "" capture chain=2`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("observations:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// The db server's flight arrived out of order and is reassembled whole
+	for i, names := range [][]string{{"db", "root"}, {"cache", "root"}} {
+		if want := readDER(t, names...); !reflect.DeepEqual(observed[i].Chain, want) {
+			t.Errorf("%s chain differs from the certificates served", names[0])
+		}
+	}
+}
+
+func TestServerCertificates(t *testing.T) {
+	chain := readDER(t, "db", "root")
+	var list []byte
+	for _, der := range chain {
+		list = append(list, byte(len(der)>>16), byte(len(der)>>8), byte(len(der)))
+		list = append(list, der...)
+	}
+	body := append([]byte{byte(len(list) >> 16), byte(len(list) >> 8), byte(len(list))}, list...)
+	message := append([]byte{handshakeCertificate, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...)
+	serverHello := []byte{2, 0, 0, 2, 3, 3}
+	record := func(kind byte, payload []byte) []byte {
+		return append([]byte{kind, 3, 3, byte(len(payload) >> 8), byte(len(payload))}, payload...)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		stream []byte
+		chain  int
+		done   bool
+	}{
+		{"server hello only", record(recordHandshake, serverHello), 0, false},
+		{"certificate", record(recordHandshake, append(append([]byte(nil), serverHello...), message...)), 2, true},
+		// A message may span records
+		{"certificate across records", append(record(recordHandshake, message[:300]), record(recordHandshake, message[300:])...), 2, true},
+		{"certificate cut short", record(recordHandshake, message)[:500], 0, false},
+		{"server hello done", record(recordHandshake, append(append([]byte(nil), serverHello...), handshakeServerHelloDone, 0, 0, 0)), 0, true},
+		{"change cipher spec", append(record(recordHandshake, serverHello), record(recordChangeCipherSpec, []byte{1})...), 0, true},
+		{"not TLS", []byte("HTTP/1.1 200 OK\r\n\r\n"), 0, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, done := serverCertificates(tc.stream)
+			if len(got) != tc.chain || done != tc.done {
+				t.Fatalf("serverCertificates = %d certificates, done %v, want %d, %v", len(got), done, tc.chain, tc.done)
+			}
+			if tc.chain > 0 && !bytes.Equal(got[0], chain[0]) {
+				t.Error("leaf differs from the certificate sent")
+			}
+		})
+	}
+}
+
+// recorder is a notifier that keeps what it is sent
+type recorder struct {
+	anomalies []*models.Anomaly
+}
+
+func (r *recorder) Notify(a *models.Anomaly) error {
+	r.anomalies = append(r.anomalies, a)
+	return nil
+}
+
+func TestInventory(t *testing.T) {
+	store := storage.NewMemoryStorage(10)
+	notifier := &recorder{}
+	inv := NewInventory(store, store, 30*24*time.Hour, notifier)
+
+	record := func(at time.Time, obs *models.CertificateObservation) {
+		t.Helper()
+		copied := *obs
+		copied.Timestamp, copied.Host, copied.ServiceName = at, "web-1", "checkout"
+		if err := inv.Record(&copied); err != nil {
+			t.Fatal(err)
+		}
+	}
+	observed := replay(t)
+	for _, obs := range observed {
+		record(base, obs)
+	}
+	// Seen again the same day and the next
+	record(base.Add(time.Hour), observed[0])
+	record(base.Add(24*time.Hour), observed[0])
+
+	var got []string
+	for _, a := range notifier.anomalies {
+		got = append(got, fmt.Sprintf("%s %s %s days_left=%g: %s", a.Timestamp.Format("01-02 15:04"), a.Kind, a.Destination, a.Value, a.Message))
+	}
+	want := []string{
+		`03-01 12:00 cert_expiry db.internal.example days_left=13: certificate "db.internal.example" presented by db.internal.example expires in 13 days, on 2024-03-15`,
+		`03-01 12:00 cert_expiry 10.4.0.21:6380 days_left=-3: certificate "OU=cache,O=Cinnamon" presented by 10.4.0.21:6380 expired 3 days ago, on 2024-02-28`,
+		`03-02 12:00 cert_expiry db.internal.example days_left=12: certificate "db.internal.example" presented by db.internal.example expires in 12 days, on 2024-03-15`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("alerts:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	stored, err := store.GetAnomalies(storage.AnomalyFilter{Kind: models.AnomalyCertExpiry})
+	if err != nil || len(stored) != 3 {
+		t.Errorf("stored %d alerts, %v, want 3", len(stored), err)
+	}
+
+	// The root is kept with the chains but is not listed on its own
+	certs, err := store.GetCertificates(storage.CertificateFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 || certs[0].KeyType != "Ed25519" || certs[1].Subject != "db.internal.example" || len(certs[1].Endpoints) != 1 {
+		t.Errorf("certificates = %+v", certs)
+	}
+}
@@ -0,0 +1,216 @@
+package certs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/capture"
+	"github.com/karthik-minnikanti/cinnamon/internal/fingerprint"
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+const (
+	// handshakeBytes bounds how much of a server's handshake is reassembled
+	// looking for its certificates
+	handshakeBytes = 64 * 1024
+	// handshakeTTL bounds how long an unfinished handshake is remembered
+	handshakeTTL = time.Minute
+)
+
+type handshake struct {
+	serverName string
+	serverIP   string
+	serverPort int
+	// next is the sequence number of the first server byte not yet in
+	// stream, taken from the ClientHello's acknowledgement or else the
+	// first server segment
+	next     uint32
+	started  bool
+	stream   []byte
+	pending  map[uint32][]byte
+	lastSeen time.Time
+}
+
+// Tap recovers server certificate chains from TLS handshakes on a packet
+// capture. Only TLS 1.2 and earlier send certificates in the clear; TLS 1.3
+// handshakes are skipped.
+type Tap struct {
+	emit func(*models.CertificateObservation)
+
+	mu         sync.Mutex
+	handshakes map[string]*handshake
+	lastSweep  time.Time
+}
+
+// NewTap creates a tap passing each recovered chain to emit
+func NewTap(emit func(*models.CertificateObservation)) *Tap {
+	return &Tap{emit: emit, handshakes: make(map[string]*handshake)}
+}
+
+// Observe feeds a single packet to the tap
+func (t *Tap) Observe(pkt *capture.Packet) {
+	if pkt.Protocol != "TCP" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if pkt.Timestamp.Sub(t.lastSweep) > handshakeTTL {
+		for key, hs := range t.handshakes {
+			if pkt.Timestamp.Sub(hs.lastSeen) > handshakeTTL {
+				delete(t.handshakes, key)
+			}
+		}
+		t.lastSweep = pkt.Timestamp
+	}
+
+	toServer := fmt.Sprintf("%s:%d-%s:%d", pkt.SrcIP, pkt.SrcPort, pkt.DstIP, pkt.DstPort)
+	toClient := fmt.Sprintf("%s:%d-%s:%d", pkt.DstIP, pkt.DstPort, pkt.SrcIP, pkt.SrcPort)
+
+	if hs, ok := t.handshakes[toServer]; ok {
+		// The client gave up or is done with the handshake
+		if pkt.HasFlag(capture.FlagRST) || pkt.HasFlag(capture.FlagFIN) {
+			delete(t.handshakes, toServer)
+		}
+		hs.lastSeen = pkt.Timestamp
+		return
+	}
+
+	hs, ok := t.handshakes[toClient]
+	if !ok {
+		if len(pkt.Payload) == 0 {
+			return
+		}
+		result := fingerprint.Identify(pkt.Payload, nil)
+		if result.Protocol != fingerprint.ProtocolTLS {
+			return
+		}
+		t.handshakes[toServer] = &handshake{
+			serverName: result.ServerName,
+			serverIP:   pkt.DstIP,
+			serverPort: pkt.DstPort,
+			next:       pkt.Ack,
+			started:    pkt.HasFlag(capture.FlagACK),
+			pending:    make(map[uint32][]byte),
+			lastSeen:   pkt.Timestamp,
+		}
+		return
+	}
+
+	hs.lastSeen = pkt.Timestamp
+	if pkt.HasFlag(capture.FlagRST) || pkt.HasFlag(capture.FlagFIN) {
+		delete(t.handshakes, toClient)
+		return
+	}
+	if len(pkt.Payload) == 0 {
+		return
+	}
+	if !hs.started {
+		hs.next, hs.started = pkt.Seq, true
+	}
+	hs.pending[pkt.Seq] = append([]byte(nil), pkt.Payload...)
+
+	// Append whatever is now in order
+	for {
+		segment, ok := hs.pending[hs.next]
+		if !ok {
+			break
+		}
+		delete(hs.pending, hs.next)
+		hs.stream = append(hs.stream, segment...)
+		hs.next += uint32(len(segment))
+	}
+
+	chain, done := serverCertificates(hs.stream)
+	if !done && len(hs.stream) < handshakeBytes && len(hs.pending) < 64 {
+		return
+	}
+	delete(t.handshakes, toClient)
+	if len(chain) > 0 {
+		t.emit(&models.CertificateObservation{
+			Timestamp:  pkt.Timestamp,
+			DestIP:     hs.serverIP,
+			DestPort:   hs.serverPort,
+			ServerName: hs.serverName,
+			Source:     "capture",
+			Chain:      chain,
+		})
+	}
+}
+
+// TLS record and handshake message types
+const (
+	recordChangeCipherSpec = 20
+	recordAlert            = 21
+	recordHandshake        = 22
+	recordApplicationData  = 23
+
+	handshakeCertificate     = 11
+	handshakeServerHelloDone = 14
+)
+
+// serverCertificates reads the server's side of a TLS handshake, returning
+// the certificate chain once it has been sent. done is set when the stream
+// holds the chain or shows that it will never be sent in the clear.
+func serverCertificates(stream []byte) (chain [][]byte, done bool) {
+	var messages []byte
+	for len(stream) >= 5 {
+		length := int(binary.BigEndian.Uint16(stream[3:5]))
+		switch stream[0] {
+		case recordHandshake:
+		case recordChangeCipherSpec, recordAlert, recordApplicationData:
+			// Everything after is encrypted, as is all of TLS 1.3's handshake
+			return nil, true
+		default:
+			return nil, true
+		}
+		if len(stream) < 5+length {
+			break
+		}
+		messages = append(messages, stream[5:5+length]...)
+		stream = stream[5+length:]
+	}
+
+	for len(messages) >= 4 {
+		kind := messages[0]
+		length := int(messages[1])<<16 | int(messages[2])<<8 | int(messages[3])
+		if len(messages) < 4+length {
+			return nil, false
+		}
+		body := messages[4 : 4+length]
+		messages = messages[4+length:]
+
+		switch kind {
+		case handshakeCertificate:
+			return parseCertificateMessage(body), true
+		case handshakeServerHelloDone:
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+// parseCertificateMessage splits a TLS 1.2 Certificate message into DER
+// certificates
+func parseCertificateMessage(body []byte) [][]byte {
+	if len(body) < 3 {
+		return nil
+	}
+	list := body[3:]
+	if total := int(body[0])<<16 | int(body[1])<<8 | int(body[2]); total < len(list) {
+		list = list[:total]
+	}
+	var chain [][]byte
+	for len(list) >= 3 {
+		length := int(list[0])<<16 | int(list[1])<<8 | int(list[2])
+		if len(list) < 3+length {
+			break
+		}
+		chain = append(chain, list[3:3+length])
+		list = list[3+length:]
+	}
+	return chain
+}
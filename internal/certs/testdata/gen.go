@@ -0,0 +1,219 @@
+//go:build ignore
+
+// gen writes the fixtures for certs_test.go: a test root CA and two leaf
+// certificates as DER, and handshakes.pcap with real crypto/tls handshakes
+// made with them. Run it from the package directory with go generate.
+//
+// The capture holds, one after another:
+//   - a TLS 1.2 handshake with db.internal.example whose server flight
+//     arrives in three segments, the last two swapped
+//   - a TLS 1.2 handshake without SNI with a cache presenting an Ed25519
+//     certificate, its flight in one segment
+//   - a TLS 1.3 handshake, whose certificates are encrypted
+//   - a plain HTTP request
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"log"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/capture"
+	"github.com/karthik-minnikanti/cinnamon/internal/capture/capturetest"
+)
+
+var base = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func main() {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	must(err)
+	root := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Cinnamon Test Root", Organization: []string{"Cinnamon"}},
+		NotBefore:             time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2034, 1, 1, 0, 0, 0, 0, time.UTC),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER := sign(root, root, &rootKey.PublicKey, rootKey)
+
+	dbKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	must(err)
+	spiffe, _ := url.Parse("spiffe://cluster.local/ns/db/sa/postgres")
+	dbDER := sign(&x509.Certificate{
+		SerialNumber:   big.NewInt(1001),
+		Subject:        pkix.Name{CommonName: "db.internal.example"},
+		DNSNames:       []string{"db.internal.example", "*.db.internal.example"},
+		IPAddresses:    []net.IP{net.ParseIP("10.4.0.20")},
+		URIs:           []*url.URL{spiffe},
+		EmailAddresses: []string{"dba@example.com"},
+		NotBefore:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:       time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC),
+		KeyUsage:       x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, root, &dbKey.PublicKey, rootKey)
+
+	cachePub, cacheKey, err := ed25519.GenerateKey(rand.Reader)
+	must(err)
+	// Subject without a common name
+	cacheDER := sign(&x509.Certificate{
+		SerialNumber: big.NewInt(1002),
+		Subject:      pkix.Name{Organization: []string{"Cinnamon"}, OrganizationalUnit: []string{"cache"}},
+		DNSNames:     []string{"cache.internal.example"},
+		NotBefore:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2024, 2, 28, 0, 0, 0, 0, time.UTC),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, root, cachePub, rootKey)
+
+	for name, der := range map[string][]byte{"root": rootDER, "db": dbDER, "cache": cacheDER} {
+		must(os.WriteFile("testdata/"+name+".der", der, 0o644))
+	}
+
+	db := tls.Certificate{Certificate: [][]byte{dbDER, rootDER}, PrivateKey: dbKey}
+	cache := tls.Certificate{Certificate: [][]byte{cacheDER, rootDER}, PrivateKey: cacheKey}
+
+	w, err := capturetest.Create("testdata/handshakes.pcap")
+	must(err)
+
+	hello, flight := handshake(db, "db.internal.example", tls.VersionTLS12)
+	writeReordered(w, base, "10.4.0.10", 42000, "10.4.0.20", 5433, hello, flight)
+
+	hello, flight = handshake(cache, "", tls.VersionTLS12)
+	c := w.Conn(base.Add(time.Second), "10.4.0.10", 42001, "10.4.0.21", 6380)
+	must(c.Handshake(time.Millisecond))
+	must(c.Send(time.Millisecond, hello))
+	must(c.Reply(time.Millisecond, flight))
+	must(c.Close(time.Millisecond))
+
+	hello, flight = handshake(db, "api.internal.example", tls.VersionTLS13)
+	c = w.Conn(base.Add(2*time.Second), "10.4.0.10", 42002, "10.4.0.22", 8443)
+	must(c.Handshake(time.Millisecond))
+	must(c.Send(time.Millisecond, hello))
+	must(c.Reply(time.Millisecond, flight))
+	must(c.Close(time.Millisecond))
+
+	c = w.Conn(base.Add(3*time.Second), "10.4.0.10", 42003, "10.4.0.23", 8080)
+	must(c.Handshake(time.Millisecond))
+	must(c.Send(time.Millisecond, []byte("GET / HTTP/1.1\r\nHost: 10.4.0.23:8080\r\n\r\n")))
+	must(c.Reply(time.Millisecond, []byte("HTTP/1.1 204 No Content\r\n\r\n")))
+	must(c.Close(time.Millisecond))
+
+	must(w.Close())
+}
+
+func sign(template, parent *x509.Certificate, pub crypto.PublicKey, key crypto.Signer) []byte {
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, key)
+	must(err)
+	return der
+}
+
+// recorder keeps what one side of a connection writes
+type recorder struct {
+	net.Conn
+	mu     *sync.Mutex
+	writes *[][]byte
+	client bool
+	// flight collects the server's writes until the client's second
+	// write: its reply to the ClientHello
+	flight *bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.mu.Lock()
+	if r.client {
+		*r.writes = append(*r.writes, append([]byte(nil), b...))
+	} else if len(*r.writes) < 2 {
+		r.flight.Write(b)
+	}
+	r.mu.Unlock()
+	return r.Conn.Write(b)
+}
+
+// handshake runs a TLS handshake over a pipe and returns the ClientHello
+// and the server's reply to it
+func handshake(cert tls.Certificate, serverName string, version uint16) ([]byte, []byte) {
+	clientConn, serverConn := net.Pipe()
+	var mu sync.Mutex
+	var clientWrites [][]byte
+	var flight bytes.Buffer
+
+	client := tls.Client(&recorder{Conn: clientConn, mu: &mu, writes: &clientWrites, client: true},
+		&tls.Config{ServerName: serverName, InsecureSkipVerify: true, MinVersion: version, MaxVersion: version})
+	server := tls.Server(&recorder{Conn: serverConn, mu: &mu, writes: &clientWrites, flight: &flight},
+		&tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: version, MaxVersion: version})
+
+	done := make(chan error, 1)
+	go func() { done <- server.Handshake() }()
+	must(client.Handshake())
+	must(<-done)
+	client.Close()
+	server.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	return clientWrites[0], flight.Bytes()
+}
+
+// writeReordered writes a connection whose server replies to hello with
+// flight in three segments, sending the third before the second
+func writeReordered(w *capturetest.Writer, at time.Time, clientIP string, clientPort int, serverIP string, serverPort int, hello, flight []byte) {
+	var clientSeq, serverSeq uint32 = 1000, 5000
+	packet := func(fromClient bool, after time.Duration, seq uint32, flags uint8, payload []byte) {
+		at = at.Add(after)
+		pkt := &capture.Packet{Timestamp: at, Protocol: "TCP", Flags: flags, Seq: seq, Payload: payload,
+			SrcIP: serverIP, SrcPort: serverPort, DstIP: clientIP, DstPort: clientPort, Ack: clientSeq}
+		if fromClient {
+			pkt.SrcIP, pkt.SrcPort, pkt.DstIP, pkt.DstPort, pkt.Ack = clientIP, clientPort, serverIP, serverPort, serverSeq
+		}
+		if flags&capture.FlagACK == 0 {
+			pkt.Ack = 0
+		}
+		must(w.WritePacket(pkt))
+	}
+
+	packet(true, 0, clientSeq, capture.FlagSYN, nil)
+	clientSeq++
+	packet(false, time.Millisecond, serverSeq, capture.FlagSYN|capture.FlagACK, nil)
+	serverSeq++
+	packet(true, 0, clientSeq, capture.FlagACK, nil)
+	packet(true, time.Millisecond, clientSeq, capture.FlagPSH|capture.FlagACK, hello)
+	clientSeq += uint32(len(hello))
+
+	third := len(flight) / 3
+	for _, offset := range []int{0, 2 * third, third} {
+		end := offset + third
+		if offset == 2*third {
+			end = len(flight)
+		}
+		packet(false, time.Millisecond, serverSeq+uint32(offset), capture.FlagPSH|capture.FlagACK, flight[offset:end])
+	}
+	serverSeq += uint32(len(flight))
+
+	packet(true, time.Millisecond, clientSeq, capture.FlagFIN|capture.FlagACK, nil)
+	clientSeq++
+	packet(false, 0, serverSeq, capture.FlagFIN|capture.FlagACK, nil)
+	serverSeq++
+	packet(true, 0, clientSeq, capture.FlagACK, nil)
+}
+
+func must(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,363 @@
+// Package compare contrasts the connections of two deployments of a
+// service, flagging differences that are statistically significant, so a
+// canary can be judged against the version it replaces.
+package compare
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/query"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// Significance is the p-value below which a difference is flagged
+const Significance = 0.05
+
+// MinConnections is the sample size each side needs before a verdict
+const MinConnections = 30
+
+// Verdicts
+const (
+	VerdictPass             = "pass"
+	VerdictFail             = "fail"
+	VerdictInsufficientData = "insufficient_data"
+)
+
+// Request selects the deployments to compare
+type Request struct {
+	Service   string
+	Baseline  string
+	Candidate string
+	Start     time.Time
+	End       time.Time
+}
+
+// Latency summarizes a latency distribution in milliseconds
+type Latency struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+}
+
+// Summary describes one deployment's connections
+type Summary struct {
+	DeploymentID string           `json:"deployment_id"`
+	Connections  int64            `json:"connections"`
+	Errors       int64            `json:"errors"`
+	ErrorRate    float64          `json:"error_rate"`
+	ErrorCounts  map[string]int64 `json:"error_counts"`
+	Latency      Latency          `json:"latency"`
+}
+
+// RateDiff compares a proportion between the deployments with a
+// two-proportion z-test
+type RateDiff struct {
+	Error       string  `json:"error,omitempty"`
+	Baseline    float64 `json:"baseline"`
+	Candidate   float64 `json:"candidate"`
+	Delta       float64 `json:"delta"`
+	PValue      float64 `json:"p_value"`
+	Significant bool    `json:"significant"`
+}
+
+// LatencyDiff compares latency distributions with a Mann-Whitney U test
+type LatencyDiff struct {
+	P95Delta    float64 `json:"p95_delta"`
+	PValue      float64 `json:"p_value"`
+	Significant bool    `json:"significant"`
+	// Slower is set when candidate latencies tend to be higher
+	Slower bool `json:"slower"`
+}
+
+// Dependency is a destination with its connection count
+type Dependency struct {
+	Destination string `json:"destination"`
+	Connections int64  `json:"connections"`
+}
+
+// Report is the result of a comparison
+type Report struct {
+	Service             string       `json:"service"`
+	Start               time.Time    `json:"start"`
+	End                 time.Time    `json:"end"`
+	Baseline            Summary      `json:"baseline"`
+	Candidate           Summary      `json:"candidate"`
+	ErrorRate           RateDiff     `json:"error_rate"`
+	ErrorTypes          []RateDiff   `json:"error_types"`
+	Latency             LatencyDiff  `json:"latency"`
+	NewDependencies     []Dependency `json:"new_dependencies"`
+	RemovedDependencies []Dependency `json:"removed_dependencies"`
+	Verdict             string       `json:"verdict"`
+	Reasons             []string     `json:"reasons"`
+}
+
+// sample collects one deployment's connections
+type sample struct {
+	summary      Summary
+	latencies    []float64
+	dependencies map[string]int64
+}
+
+// Deployments compares the baseline and candidate deployments of a service
+func Deployments(store storage.Storage, req Request) (*Report, error) {
+	if req.Baseline == "" || req.Candidate == "" {
+		return nil, fmt.Errorf("baseline and candidate deployments are required")
+	}
+
+	baseline, err := collect(store, req, req.Baseline)
+	if err != nil {
+		return nil, err
+	}
+	candidate, err := collect(store, req, req.Candidate)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Service:             req.Service,
+		Start:               req.Start,
+		End:                 req.End,
+		Baseline:            baseline.summary,
+		Candidate:           candidate.summary,
+		ErrorRate:           rateDiff("", baseline.summary.Errors, baseline.summary.Connections, candidate.summary.Errors, candidate.summary.Connections),
+		ErrorTypes:          []RateDiff{},
+		NewDependencies:     difference(candidate.dependencies, baseline.dependencies),
+		RemovedDependencies: difference(baseline.dependencies, candidate.dependencies),
+		Reasons:             []string{},
+	}
+
+	// Error types seen on either side
+	types := make(map[string]bool)
+	for t := range baseline.summary.ErrorCounts {
+		types[t] = true
+	}
+	for t := range candidate.summary.ErrorCounts {
+		types[t] = true
+	}
+	for t := range types {
+		report.ErrorTypes = append(report.ErrorTypes, rateDiff(t,
+			baseline.summary.ErrorCounts[t], baseline.summary.Connections,
+			candidate.summary.ErrorCounts[t], candidate.summary.Connections))
+	}
+	sort.Slice(report.ErrorTypes, func(i, j int) bool {
+		a, b := report.ErrorTypes[i], report.ErrorTypes[j]
+		if a.Delta != b.Delta {
+			return a.Delta > b.Delta
+		}
+		return a.Error < b.Error
+	})
+
+	p, slower := mannWhitney(baseline.latencies, candidate.latencies)
+	report.Latency = LatencyDiff{
+		P95Delta:    candidate.summary.Latency.P95 - baseline.summary.Latency.P95,
+		PValue:      p,
+		Significant: p < Significance,
+		Slower:      slower,
+	}
+
+	report.judge()
+	return report, nil
+}
+
+// judge sets the verdict: the candidate fails when its error rate, any error
+// type or its latency is significantly worse than the baseline
+func (r *Report) judge() {
+	if r.Baseline.Connections < MinConnections || r.Candidate.Connections < MinConnections {
+		r.Verdict = VerdictInsufficientData
+		r.Reasons = append(r.Reasons, fmt.Sprintf("each deployment needs at least %d connections (baseline %d, candidate %d)",
+			MinConnections, r.Baseline.Connections, r.Candidate.Connections))
+		return
+	}
+
+	if r.ErrorRate.Significant && r.ErrorRate.Delta > 0 {
+		r.Reasons = append(r.Reasons, fmt.Sprintf("error rate rose from %.2f%% to %.2f%%", r.ErrorRate.Baseline*100, r.ErrorRate.Candidate*100))
+	}
+	for _, t := range r.ErrorTypes {
+		if t.Significant && t.Delta > 0 {
+			r.Reasons = append(r.Reasons, fmt.Sprintf("%s rate rose from %.2f%% to %.2f%%", t.Error, t.Baseline*100, t.Candidate*100))
+		}
+	}
+	if r.Latency.Significant && r.Latency.Slower {
+		r.Reasons = append(r.Reasons, fmt.Sprintf("latency is higher (p95 %.1fms vs %.1fms)", r.Candidate.Latency.P95, r.Baseline.Latency.P95))
+	}
+
+	r.Verdict = VerdictPass
+	if len(r.Reasons) > 0 {
+		r.Verdict = VerdictFail
+	}
+}
+
+func collect(store storage.Storage, req Request, deployment string) (*sample, error) {
+	filter := storage.ConnectionFilter{
+		Service: req.Service,
+		Start:   req.Start,
+		End:     req.End,
+		Query:   query.Compare{Field: "deployment_id", Kind: query.KindString, Op: "=", Value: deployment},
+	}
+
+	s := &sample{
+		summary:      Summary{DeploymentID: deployment, ErrorCounts: make(map[string]int64)},
+		dependencies: make(map[string]int64),
+	}
+	var latencySum float64
+	err := store.IterateConnections(filter, func(conn *models.Connection) error {
+		s.summary.Connections++
+		if conn.Error != "" {
+			s.summary.Errors++
+			s.summary.ErrorCounts[conn.Error]++
+		}
+		latencySum += conn.Latency
+		s.latencies = append(s.latencies, conn.Latency)
+		s.dependencies[destination(conn)]++
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deployment %s: %v", deployment, err)
+	}
+
+	if n := s.summary.Connections; n > 0 {
+		s.summary.ErrorRate = float64(s.summary.Errors) / float64(n)
+		sort.Float64s(s.latencies)
+		s.summary.Latency = Latency{
+			Mean: latencySum / float64(n),
+			P50:  percentile(s.latencies, 0.50),
+			P95:  percentile(s.latencies, 0.95),
+			P99:  percentile(s.latencies, 0.99),
+		}
+	}
+	return s, nil
+}
+
+// destination names what a connection depends on: the best known name of
+// its destination, and the port
+func destination(conn *models.Connection) string {
+	host := conn.DestHostname
+	if host == "" {
+		host = conn.DestK8sService
+	}
+	if host == "" {
+		host = conn.DestIP
+	}
+	return host + ":" + strconv.Itoa(conn.DestPort)
+}
+
+// difference returns the dependencies in a but not in b, busiest first
+func difference(a, b map[string]int64) []Dependency {
+	deps := []Dependency{}
+	for dest, n := range a {
+		if _, ok := b[dest]; !ok {
+			deps = append(deps, Dependency{Destination: dest, Connections: n})
+		}
+	}
+	sort.Slice(deps, func(i, j int) bool {
+		if deps[i].Connections != deps[j].Connections {
+			return deps[i].Connections > deps[j].Connections
+		}
+		return deps[i].Destination < deps[j].Destination
+	})
+	return deps
+}
+
+// percentile returns the nearest-rank percentile p of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// rateDiff runs a two-proportion z-test on x1/n1 against x2/n2
+func rateDiff(name string, x1, n1, x2, n2 int64) RateDiff {
+	d := RateDiff{Error: name, PValue: 1}
+	if n1 > 0 {
+		d.Baseline = float64(x1) / float64(n1)
+	}
+	if n2 > 0 {
+		d.Candidate = float64(x2) / float64(n2)
+	}
+	d.Delta = d.Candidate - d.Baseline
+	if n1 == 0 || n2 == 0 {
+		return d
+	}
+
+	pooled := float64(x1+x2) / float64(n1+n2)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/float64(n1) + 1/float64(n2)))
+	if se == 0 {
+		return d
+	}
+	d.PValue = twoSided(d.Delta / se)
+	d.Significant = d.PValue < Significance
+	return d
+}
+
+// mannWhitney tests whether two samples come from the same distribution,
+// using the normal approximation with a tie correction. It returns the
+// two-sided p-value and whether b tends to be larger than a.
+func mannWhitney(a, b []float64) (float64, bool) {
+	n1, n2 := float64(len(a)), float64(len(b))
+	if n1 == 0 || n2 == 0 {
+		return 1, false
+	}
+
+	type value struct {
+		v    float64
+		inA  bool
+		rank float64
+	}
+	values := make([]value, 0, len(a)+len(b))
+	for _, v := range a {
+		values = append(values, value{v: v, inA: true})
+	}
+	for _, v := range b {
+		values = append(values, value{v: v})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].v < values[j].v })
+
+	// Average ranks over ties, accumulating the tie correction term
+	var ties float64
+	for i := 0; i < len(values); {
+		j := i
+		for j < len(values) && values[j].v == values[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			values[k].rank = rank
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+
+	var rankSumA float64
+	for _, v := range values {
+		if v.inA {
+			rankSumA += v.rank
+		}
+	}
+	u := rankSumA - n1*(n1+1)/2
+	mean := n1 * n2 / 2
+	n := n1 + n2
+	variance := n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1)))
+	if variance <= 0 {
+		return 1, false
+	}
+	z := (u - mean) / math.Sqrt(variance)
+	// A small U means a's values rank low, so b tends to be larger
+	return twoSided(z), z < 0
+}
+
+// twoSided is the two-sided p-value of a standard normal z score
+func twoSided(z float64) float64 {
+	return math.Erfc(math.Abs(z) / math.Sqrt2)
+}
@@ -0,0 +1,144 @@
+package compare
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+func near(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+func TestRateDiff(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		x1, n1, x2, n2 int64
+		delta, p       float64
+		significant    bool
+	}{
+		// z = 0.02 / sqrt(0.02 * 0.98 * 2/1000) = 3.1944; z² = 10.204 is the
+		// chi-squared of prop.test(c(10, 30), c(1000, 1000), correct = FALSE)
+		{"rise", 10, 1000, 30, 1000, 0.02, 0.0014013, true},
+		// z = 0.015 / sqrt(0.0325 * 0.9675 * 2/200) = 0.8459
+		{"noise", 5, 200, 8, 200, 0.015, 0.397603, false},
+		{"fall", 30, 1000, 10, 1000, -0.02, 0.0014013, true},
+		{"no errors", 0, 500, 0, 500, 0, 1, false},
+		{"empty candidate", 3, 100, 0, 0, -0.03, 1, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := rateDiff("ETIMEDOUT", tc.x1, tc.n1, tc.x2, tc.n2)
+			if d.Error != "ETIMEDOUT" || !near(d.Delta, tc.delta, 1e-12) || !near(d.PValue, tc.p, 1e-6) || d.Significant != tc.significant {
+				t.Errorf("rateDiff = %+v, want delta %v, p %v, significant %v", d, tc.delta, tc.p, tc.significant)
+			}
+		})
+	}
+}
+
+func TestMannWhitney(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		a, b   []float64
+		p      float64
+		slower bool
+	}{
+		// U = 3.5 (a's 3 ties one b value, a's 4 beats one and ties two).
+		// Tie groups of 2, 4, 3 and 2 give sum(t³-t) = 96, so
+		// var = 7*6/12 * (14 - 96/156) = 46.846 and z = (3.5-21)/6.8444 = -2.5568
+		{"ties", []float64{1, 2, 2, 3, 3, 3, 4}, []float64{3, 4, 4, 5, 5, 6}, 0.0105632, true},
+		{"ties reversed", []float64{3, 4, 4, 5, 5, 6}, []float64{1, 2, 2, 3, 3, 3, 4}, 0.0105632, false},
+		// U = 3: z = (3-4.5)/sqrt(3*3*7/12) = -0.6547
+		{"no ties", []float64{1, 3, 5}, []float64{2, 4, 6}, 0.512691, true},
+		{"all tied", []float64{10, 10, 10, 10}, []float64{10, 10, 10}, 1, false},
+		{"empty", nil, []float64{1, 2}, 1, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, slower := mannWhitney(tc.a, tc.b)
+			if !near(p, tc.p, 1e-6) || slower != tc.slower {
+				t.Errorf("mannWhitney = %v, %v, want %v, %v", p, slower, tc.p, tc.slower)
+			}
+		})
+	}
+}
+
+func TestDeployments(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	store := storage.NewMemoryStorage(1000)
+	add := func(deployment string, i int, host string, port int, latency float64, errorCode string) {
+		err := store.StoreConnection(&models.Connection{
+			ID:           fmt.Sprintf("%s-%d", deployment, i),
+			Timestamp:    base.Add(time.Duration(i) * time.Second),
+			ServiceName:  "checkout",
+			DeploymentID: deployment,
+			DestHostname: host,
+			DestPort:     port,
+			Latency:      latency,
+			Error:        errorCode,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Another service's v2 stays out of the comparison
+	err := store.StoreConnection(&models.Connection{ID: "other", Timestamp: base, ServiceName: "billing", DeploymentID: "v2", DestIP: "10.0.0.99", DestPort: 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		add("v1", i, "orders-db", 5432, float64(10+i%10), "")
+		if i%4 == 0 {
+			add("v1", 1000+i, "cache", 6379, 1, "")
+		}
+
+		errorCode := ""
+		if i%5 == 0 {
+			errorCode = string(models.ErrConnTimeout)
+		}
+		add("v2", i, "orders-db", 5432, float64(15+i%10), errorCode)
+		if i%10 == 0 {
+			add("v2", 1000+i, "payments-api", 443, 40, "")
+		}
+	}
+
+	report, err := Deployments(store, Request{Service: "checkout", Baseline: "v1", Candidate: "v2", Start: base.Add(-time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Baseline.Connections != 125 || report.Candidate.Connections != 110 || report.Candidate.Errors != 20 {
+		t.Errorf("summaries = %+v, %+v", report.Baseline, report.Candidate)
+	}
+	if want := []Dependency{{"payments-api:443", 10}}; !reflect.DeepEqual(report.NewDependencies, want) {
+		t.Errorf("NewDependencies = %+v, want %+v", report.NewDependencies, want)
+	}
+	if want := []Dependency{{"cache:6379", 25}}; !reflect.DeepEqual(report.RemovedDependencies, want) {
+		t.Errorf("RemovedDependencies = %+v, want %+v", report.RemovedDependencies, want)
+	}
+	if len(report.ErrorTypes) != 1 || report.ErrorTypes[0].Error != "ETIMEDOUT" || !report.ErrorTypes[0].Significant {
+		t.Errorf("ErrorTypes = %+v", report.ErrorTypes)
+	}
+	if !report.Latency.Significant || !report.Latency.Slower {
+		t.Errorf("Latency = %+v, want significantly slower", report.Latency)
+	}
+	if report.Verdict != VerdictFail || len(report.Reasons) != 3 {
+		t.Errorf("Verdict = %s, reasons %q", report.Verdict, report.Reasons)
+	}
+
+	// A deployment with too few connections gets no verdict either way
+	report, err = Deployments(store, Request{Service: "checkout", Baseline: "v1", Candidate: "v3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Verdict != VerdictInsufficientData || len(report.NewDependencies) != 0 || len(report.RemovedDependencies) != 2 {
+		t.Errorf("missing candidate: verdict %s, new %v, removed %v", report.Verdict, report.NewDependencies, report.RemovedDependencies)
+	}
+
+	if _, err := Deployments(store, Request{Service: "checkout", Baseline: "v1"}); err == nil {
+		t.Error("Deployments accepted a request without a candidate")
+	}
+}
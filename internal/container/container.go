@@ -0,0 +1,145 @@
+// Package container attributes processes to the containers they run in. The
+// container ID comes from the process's cgroup path under /proc, and the
+// container's name and image from the runtime's Docker Engine compatible API.
+package container
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSocket is where Docker, and runtimes emulating its API, listen
+const DefaultSocket = "/var/run/docker.sock"
+
+// containerIDPattern matches the 64 hex digit IDs that Docker, containerd,
+// CRI-O and Podman embed in cgroup paths, e.g.
+//
+//	0::/system.slice/docker-<id>.scope
+//	12:pids:/docker/<id>
+//	0::/kubepods.slice/.../cri-containerd-<id>.scope
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// Info describes a running container
+type Info struct {
+	ID    string
+	Name  string
+	Image string
+}
+
+// IDFromCgroup returns the container ID in a /proc/<pid>/cgroup file, or an
+// empty string for processes outside any container
+func IDFromCgroup(r io.Reader) string {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// hierarchy-ID:controllers:path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if ids := containerIDPattern.FindAllString(parts[2], -1); len(ids) > 0 {
+			return ids[len(ids)-1]
+		}
+	}
+	return ""
+}
+
+// IDForPID returns the container ID of a process under the given proc root
+func IDForPID(procRoot string, pid int) string {
+	f, err := os.Open(fmt.Sprintf("%s/%d/cgroup", procRoot, pid))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	return IDFromCgroup(f)
+}
+
+type cachedInfo struct {
+	info    Info
+	ok      bool
+	expires time.Time
+}
+
+// Runtime looks up container names and images through the Docker Engine API
+// on a unix socket. Podman and other runtimes serving the same
+// /containers/<id>/json endpoint work as well.
+type Runtime struct {
+	client *http.Client
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cachedInfo
+}
+
+// NewRuntime creates a client for the runtime listening on socketPath
+func NewRuntime(socketPath string) *Runtime {
+	dialer := &net.Dialer{Timeout: time.Second}
+	return &Runtime{
+		client: &http.Client{
+			Timeout: 2 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+		ttl:   time.Minute,
+		cache: make(map[string]cachedInfo),
+	}
+}
+
+// Inspect returns the name and image of a container. Results, including
+// failures, are cached briefly so polling sources do not hammer the socket.
+func (r *Runtime) Inspect(id string) (Info, bool) {
+	r.mu.Lock()
+	cached, found := r.cache[id]
+	r.mu.Unlock()
+	if found && time.Now().Before(cached.expires) {
+		return cached.info, cached.ok
+	}
+
+	info, err := r.inspect(id)
+	r.mu.Lock()
+	r.cache[id] = cachedInfo{info: info, ok: err == nil, expires: time.Now().Add(r.ttl)}
+	r.mu.Unlock()
+	return info, err == nil
+}
+
+func (r *Runtime) inspect(id string) (Info, error) {
+	resp, err := r.client.Get("http://runtime/containers/" + url.PathEscape(id) + "/json")
+	if err != nil {
+		return Info{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Info{}, fmt.Errorf("runtime returned %s", resp.Status)
+	}
+
+	var body struct {
+		ID     string `json:"Id"`
+		Name   string `json:"Name"`
+		Config struct {
+			Image string `json:"Image"`
+		} `json:"Config"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Info{}, fmt.Errorf("failed to decode container: %v", err)
+	}
+
+	return Info{
+		ID:    body.ID,
+		Name:  strings.TrimPrefix(body.Name, "/"),
+		Image: body.Config.Image,
+	}, nil
+}
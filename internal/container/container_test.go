@@ -0,0 +1,136 @@
+package container
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	dockerID     = "3f0c8b2e9a7d4c1f6b5e8a2d0c9f7e6b4a3d2c1b0e9f8a7d6c5b4a3e2d1c0f9e"
+	containerdID = "9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d9c8b7a6f5e4d3c2b1a0f9e8d"
+)
+
+func TestIDFromCgroup(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		cgroup string
+		want   string
+	}{
+		{"v2 host process", "0::/init.scope\n", ""},
+		{"v2 systemd service", "0::/system.slice/ssh.service\n", ""},
+		{"v2 docker", "0::/system.slice/docker-" + dockerID + ".scope\n", dockerID},
+		{"v2 podman", "0::/machine.slice/libpod-" + dockerID + ".scope/container\n", dockerID},
+		{
+			"v2 kubernetes containerd",
+			"0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod0a1b2c3d_4e5f.slice/cri-containerd-" + containerdID + ".scope\n",
+			containerdID,
+		},
+		{
+			"v1 docker",
+			"12:pids:/docker/" + dockerID + "\n" +
+				"11:memory:/docker/" + dockerID + "\n" +
+				"1:name=systemd:/docker/" + dockerID + "\n" +
+				"0::/\n",
+			dockerID,
+		},
+		{
+			// Docker-in-Docker nests the inner container under the outer one
+			"v1 nested",
+			"12:pids:/docker/" + dockerID + "/docker/" + containerdID + "\n",
+			containerdID,
+		},
+		{
+			"v1 host process",
+			"12:pids:/user.slice/user-1000.slice\n11:memory:/user.slice\n0::/user.slice\n",
+			"",
+		},
+		{"malformed", "not a cgroup line\n" + dockerID + "\n", ""},
+		{"uppercase hex", "0::/docker/" + strings.ToUpper(dockerID) + "\n", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IDFromCgroup(strings.NewReader(tc.cgroup)); got != tc.want {
+				t.Errorf("IDFromCgroup = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIDForPID(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "42"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cgroup := "0::/system.slice/docker-" + dockerID + ".scope\n"
+	if err := os.WriteFile(filepath.Join(root, "42", "cgroup"), []byte(cgroup), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := IDForPID(root, 42); got != dockerID {
+		t.Errorf("IDForPID(42) = %q, want %q", got, dockerID)
+	}
+	if got := IDForPID(root, 43); got != "" {
+		t.Errorf("IDForPID(43) = %q for a missing process", got)
+	}
+}
+
+// fakeRuntime serves the Docker Engine inspect endpoint on a unix socket,
+// knowing only dockerID, and counts the requests it receives
+func fakeRuntime(t *testing.T) (string, *int32) {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+
+	var requests int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path != "/containers/"+dockerID+"/json" {
+			http.Error(w, `{"message":"No such container"}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Id":     dockerID,
+			"Name":   "/checkout",
+			"Config": map[string]string{"Image": "registry.local/checkout:1.4.2"},
+		})
+	}))
+	srv.Listener.Close()
+	srv.Listener = l
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return socket, &requests
+}
+
+func TestRuntimeInspect(t *testing.T) {
+	socket, requests := fakeRuntime(t)
+	r := NewRuntime(socket)
+
+	want := Info{ID: dockerID, Name: "checkout", Image: "registry.local/checkout:1.4.2"}
+	for i := 0; i < 2; i++ {
+		info, ok := r.Inspect(dockerID)
+		if !ok || info != want {
+			t.Fatalf("Inspect = %+v, %v, want %+v", info, ok, want)
+		}
+	}
+	if _, ok := r.Inspect(containerdID); ok {
+		t.Error("Inspect found an unknown container")
+	}
+	r.Inspect(containerdID)
+	if n := atomic.LoadInt32(requests); n != 2 {
+		t.Errorf("runtime received %d requests, want 2 with lookups and failures cached", n)
+	}
+
+	if _, ok := NewRuntime(filepath.Join(t.TempDir(), "missing.sock")).Inspect(dockerID); ok {
+		t.Error("Inspect succeeded without a runtime")
+	}
+}
@@ -0,0 +1,250 @@
+// Package detect recognises attack and failure patterns in the stream of
+// ingested connections: port scans, SYN floods and retry storms.
+//
+// Each detector keeps a sliding window of recent connections keyed by the
+// pattern it looks for, and reports once per window when the window
+// crosses its threshold. Windows are measured in connection timestamps, so
+// replayed traffic is judged by when it happened rather than when it
+// arrived.
+package detect
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/anomaly"
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// Config sets the window and threshold of each detector. Zero fields take
+// the defaults.
+type Config struct {
+	// PortScanWindow and PortScanPorts report a source that touches
+	// PortScanPorts distinct ports on one host within the window
+	PortScanWindow time.Duration
+	PortScanPorts  int
+	// SynFloodWindow and SynFloodSockets report SynFloodSockets half-open
+	// (SYN_RECV) sockets to one endpoint within the window
+	SynFloodWindow  time.Duration
+	SynFloodSockets int
+	// RetryStormWindow and RetryStormFailures report RetryStormFailures
+	// failed attempts by a service to one destination within the window,
+	// counting retries as attempts
+	RetryStormWindow   time.Duration
+	RetryStormFailures int
+}
+
+// DefaultConfig is tuned to stay quiet for ordinary service traffic
+var DefaultConfig = Config{
+	PortScanWindow:     time.Minute,
+	PortScanPorts:      20,
+	SynFloodWindow:     10 * time.Second,
+	SynFloodSockets:    100,
+	RetryStormWindow:   time.Minute,
+	RetryStormFailures: 50,
+}
+
+func (c Config) withDefaults() Config {
+	if c.PortScanWindow <= 0 {
+		c.PortScanWindow = DefaultConfig.PortScanWindow
+	}
+	if c.PortScanPorts <= 0 {
+		c.PortScanPorts = DefaultConfig.PortScanPorts
+	}
+	if c.SynFloodWindow <= 0 {
+		c.SynFloodWindow = DefaultConfig.SynFloodWindow
+	}
+	if c.SynFloodSockets <= 0 {
+		c.SynFloodSockets = DefaultConfig.SynFloodSockets
+	}
+	if c.RetryStormWindow <= 0 {
+		c.RetryStormWindow = DefaultConfig.RetryStormWindow
+	}
+	if c.RetryStormFailures <= 0 {
+		c.RetryStormFailures = DefaultConfig.RetryStormFailures
+	}
+	return c
+}
+
+// Engine runs the detectors over ingested connections. Port scans and SYN
+// floods are stored as security events, retry storms as anomalies; either
+// store may be nil to skip those detectors.
+type Engine struct {
+	config    Config
+	security  storage.SecurityStore
+	anomalies storage.AnomalyStore
+	notifiers []anomaly.Notifier
+
+	mu        sync.Mutex
+	scans     *windows
+	floods    *windows
+	storms    *windows
+	lastSweep time.Time
+}
+
+// NewEngine creates an engine storing events in the given stores and
+// passing retry storms to notifiers
+func NewEngine(config Config, security storage.SecurityStore, anomalies storage.AnomalyStore, notifiers ...anomaly.Notifier) *Engine {
+	config = config.withDefaults()
+	return &Engine{
+		config:    config,
+		security:  security,
+		anomalies: anomalies,
+		notifiers: notifiers,
+		scans:     newWindows(config.PortScanWindow),
+		floods:    newWindows(config.SynFloodWindow),
+		storms:    newWindows(config.RetryStormWindow),
+	}
+}
+
+// Detect runs the detectors over one connection and returns the events it
+// completes
+func (e *Engine) Detect(conn *models.Connection) ([]*models.SecurityEvent, []*models.Anomaly) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var events []*models.SecurityEvent
+	var anomalies []*models.Anomaly
+	if e.security != nil {
+		if ev := e.portScan(conn); ev != nil {
+			events = append(events, ev)
+		}
+		if ev := e.synFlood(conn); ev != nil {
+			events = append(events, ev)
+		}
+	}
+	if e.anomalies != nil {
+		if a := e.retryStorm(conn); a != nil {
+			anomalies = append(anomalies, a)
+		}
+	}
+
+	// Drop idle keys at most once a second
+	if conn.Timestamp.Sub(e.lastSweep) >= time.Second {
+		e.scans.sweep(conn.Timestamp)
+		e.floods.sweep(conn.Timestamp)
+		e.storms.sweep(conn.Timestamp)
+		e.lastSweep = conn.Timestamp
+	}
+	return events, anomalies
+}
+
+// Observe detects patterns in a connection and stores and notifies the
+// events it completes
+func (e *Engine) Observe(conn *models.Connection) {
+	events, anomalies := e.Detect(conn)
+	for _, ev := range events {
+		if err := e.security.StoreSecurityEvent(ev); err != nil {
+			log.Printf("Error storing security event: %v", err)
+		}
+	}
+	for _, a := range anomalies {
+		if err := e.anomalies.StoreAnomaly(a); err != nil {
+			log.Printf("Error storing anomaly: %v", err)
+		}
+		for _, n := range e.notifiers {
+			if err := n.Notify(a); err != nil {
+				log.Printf("Error sending anomaly notification: %v", err)
+			}
+		}
+	}
+}
+
+// portScan counts the distinct ports one source touches on one host
+func (e *Engine) portScan(conn *models.Connection) *models.SecurityEvent {
+	if conn.SourceIP == "" || conn.DestIP == "" || conn.SourceIP == conn.DestIP {
+		return nil
+	}
+	key := conn.SourceIP + "|" + conn.DestIP
+	w := e.scans.add(key, strconv.Itoa(conn.DestPort), conn.Timestamp, 1)
+	if w.distinct() < e.config.PortScanPorts || !w.report(conn.Timestamp) {
+		return nil
+	}
+
+	ev := e.event(models.SecurityPortScan, conn, key, w.start, conn.DestIP,
+		fmt.Sprintf("%s connected to %d ports on %s within %s", conn.SourceIP, w.distinct(), conn.DestIP, e.config.PortScanWindow))
+	ev.DestPort = 0
+	return ev
+}
+
+// synFlood counts the half-open sockets to one endpoint
+func (e *Engine) synFlood(conn *models.Connection) *models.SecurityEvent {
+	if conn.TCPState != "SYN_RECV" {
+		return nil
+	}
+	endpoint := conn.DestIP + ":" + strconv.Itoa(conn.DestPort)
+	w := e.floods.add(endpoint, conn.SourceIP+":"+strconv.Itoa(conn.SourcePort), conn.Timestamp, 1)
+	if w.distinct() < e.config.SynFloodSockets || !w.report(conn.Timestamp) {
+		return nil
+	}
+
+	return e.event(models.SecuritySynFlood, conn, endpoint, w.start, endpoint,
+		fmt.Sprintf("%d half-open connections to %s within %s", w.distinct(), endpoint, e.config.SynFloodWindow))
+}
+
+// retryStorm counts the failed attempts by a service to one destination
+func (e *Engine) retryStorm(conn *models.Connection) *models.Anomaly {
+	failures := conn.RetryCount
+	if conn.Error != "" {
+		failures++
+	}
+	if failures == 0 || conn.ServiceName == "" {
+		return nil
+	}
+	dest := destination(conn)
+	key := conn.ServiceName + "|" + dest
+	w := e.storms.add(key, "", conn.Timestamp, failures)
+	if w.total < e.config.RetryStormFailures || !w.report(conn.Timestamp) {
+		return nil
+	}
+
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%d", models.AnomalyRetryStorm, key, w.start.UnixNano())))
+	return &models.Anomaly{
+		ID:          hex.EncodeToString(sum[:8]),
+		Timestamp:   w.start,
+		Kind:        models.AnomalyRetryStorm,
+		ServiceName: conn.ServiceName,
+		Destination: dest,
+		Metric:      "failed_attempts",
+		Value:       float64(w.total),
+		Baseline:    float64(e.config.RetryStormFailures),
+		Message: fmt.Sprintf("%s failed %d connection attempts to %s within %s",
+			conn.ServiceName, w.total, dest, e.config.RetryStormWindow),
+	}
+}
+
+// event builds a security event whose ID is derived from its kind, key and
+// the start of its window, so repeats share an ID
+func (e *Engine) event(kind models.SecurityEventKind, conn *models.Connection, key string, start time.Time, dest, message string) *models.SecurityEvent {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%d", kind, key, start.UnixNano())))
+	return &models.SecurityEvent{
+		ID:           hex.EncodeToString(sum[:8]),
+		Timestamp:    conn.Timestamp,
+		Kind:         kind,
+		ServiceName:  conn.ServiceName,
+		Environment:  conn.Environment,
+		Host:         conn.Host,
+		Destination:  dest,
+		DestIP:       conn.DestIP,
+		DestPort:     conn.DestPort,
+		ConnectionID: conn.ID,
+		Message:      message,
+	}
+}
+
+func destination(conn *models.Connection) string {
+	host := conn.DestHostname
+	if host == "" {
+		host = conn.DestK8sService
+	}
+	if host == "" {
+		host = conn.DestIP
+	}
+	return host + ":" + strconv.Itoa(conn.DestPort)
+}
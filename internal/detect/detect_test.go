@@ -0,0 +1,201 @@
+package detect
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+var (
+	base       = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	testConfig = Config{
+		PortScanWindow:     time.Minute,
+		PortScanPorts:      5,
+		SynFloodWindow:     10 * time.Second,
+		SynFloodSockets:    3,
+		RetryStormWindow:   time.Minute,
+		RetryStormFailures: 10,
+	}
+)
+
+// at is a connection at a number of seconds after base
+func at(seconds int, conn models.Connection) *models.Connection {
+	conn.Timestamp = base.Add(time.Duration(seconds) * time.Second)
+	return &conn
+}
+
+// ingest runs a stream through an engine and describes what it reports, one
+// line per event with the second of the connection that completed it
+func ingest(e *Engine, stream []*models.Connection) ([]string, []*models.SecurityEvent, []*models.Anomaly) {
+	lines := []string{}
+	var allEvents []*models.SecurityEvent
+	var allAnomalies []*models.Anomaly
+	for _, conn := range stream {
+		events, anomalies := e.Detect(conn)
+		second := int(conn.Timestamp.Sub(base) / time.Second)
+		for _, ev := range events {
+			lines = append(lines, fmt.Sprintf("%d %s %s: %s", second, ev.Kind, ev.Destination, ev.Message))
+		}
+		for _, a := range anomalies {
+			lines = append(lines, fmt.Sprintf("%d %s %s: %s", second, a.Kind, a.Destination, a.Message))
+		}
+		allEvents = append(allEvents, events...)
+		allAnomalies = append(allAnomalies, anomalies...)
+	}
+	return lines, allEvents, allAnomalies
+}
+
+func check(t *testing.T, got, want []string) {
+	t.Helper()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("reported:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPortScan(t *testing.T) {
+	store := storage.NewMemoryStorage(10)
+	e := NewEngine(testConfig, store, nil)
+	probe := func(second int, src string, port int) *models.Connection {
+		return at(second, models.Connection{SourceIP: src, DestIP: "10.0.0.10", DestPort: port})
+	}
+
+	var stream []*models.Connection
+	// Four ports, one of them twice, stay below the threshold; the fifth
+	// distinct port completes the scan
+	for i, port := range []int{22, 23, 23, 80, 443, 3306} {
+		stream = append(stream, probe(i, "10.0.0.66", port))
+	}
+	// A scan that carries on is reported once per window...
+	for port := 8000; port < 8010; port++ {
+		stream = append(stream, probe(10+port-8000, "10.0.0.66", port))
+	}
+	// ...and again once the window since the report has passed, counting
+	// only the ports still in the window
+	stream = append(stream, probe(70, "10.0.0.66", 9000))
+	// A source touching as many ports slowly is not scanning
+	for i := 0; i < 6; i++ {
+		stream = append(stream, probe(100+i*20, "10.0.0.77", 1000+i))
+	}
+	// Nor is a host talking to itself
+	for port := 1; port <= 6; port++ {
+		stream = append(stream, at(300, models.Connection{SourceIP: "10.0.0.10", DestIP: "10.0.0.10", DestPort: port}))
+	}
+
+	got, events, _ := ingest(e, stream)
+	check(t, got, []string{
+		"5 port_scan 10.0.0.10: 10.0.0.66 connected to 5 ports on 10.0.0.10 within 1m0s",
+		"70 port_scan 10.0.0.10: 10.0.0.66 connected to 11 ports on 10.0.0.10 within 1m0s",
+	})
+	if len(events) == 2 && (events[0].DestPort != 0 || events[0].ID == events[1].ID) {
+		t.Errorf("events = %+v, %+v; want no port and distinct IDs", events[0], events[1])
+	}
+}
+
+func TestSynFlood(t *testing.T) {
+	e := NewEngine(testConfig, storage.NewMemoryStorage(10), nil)
+	half := func(second int, src string, port int) *models.Connection {
+		return at(second, models.Connection{SourceIP: src, SourcePort: port, DestIP: "10.0.0.10", DestPort: 80, TCPState: "SYN_RECV"})
+	}
+	stream := []*models.Connection{
+		half(0, "198.51.100.1", 40000),
+		// The same socket polled twice counts once
+		half(1, "198.51.100.1", 40000),
+		// Established connections are not half-open
+		at(1, models.Connection{SourceIP: "198.51.100.5", SourcePort: 40000, DestIP: "10.0.0.10", DestPort: 80, TCPState: "ESTABLISHED"}),
+		half(2, "198.51.100.2", 40000),
+		// Another endpoint has its own window
+		at(2, models.Connection{SourceIP: "198.51.100.3", SourcePort: 40000, DestIP: "10.0.0.10", DestPort: 443, TCPState: "SYN_RECV"}),
+		half(3, "198.51.100.3", 40000),
+		half(4, "198.51.100.4", 40000),
+		// The first sockets have left the window
+		half(20, "198.51.100.5", 40000),
+		half(21, "198.51.100.6", 40000),
+	}
+	got, _, _ := ingest(e, stream)
+	check(t, got, []string{
+		"3 syn_flood 10.0.0.10:80: 3 half-open connections to 10.0.0.10:80 within 10s",
+	})
+}
+
+func TestRetryStorm(t *testing.T) {
+	e := NewEngine(testConfig, nil, storage.NewMemoryStorage(10))
+	attempt := func(second int, service string, retries int, errorCode string) *models.Connection {
+		return at(second, models.Connection{ServiceName: service, DestIP: "10.0.0.5", DestHostname: "orders-db", DestPort: 5432,
+			RetryCount: retries, Error: errorCode})
+	}
+	stream := []*models.Connection{
+		// Retries and the final failure both count
+		attempt(0, "checkout", 3, "ETIMEDOUT"),
+		attempt(1, "checkout", 0, ""),
+		attempt(5, "checkout", 2, ""),
+		attempt(6, "checkout", 0, "ECONNREFUSED"),
+		// Failures without a service are not attributed
+		attempt(7, "", 9, "ETIMEDOUT"),
+		attempt(8, "checkout", 1, "ECONNREFUSED"),
+		attempt(9, "checkout", 3, "ETIMEDOUT"),
+	}
+	got, _, anomalies := ingest(e, stream)
+	check(t, got, []string{
+		"9 retry_storm orders-db:5432: checkout failed 13 connection attempts to orders-db:5432 within 1m0s",
+	})
+	if len(anomalies) == 1 {
+		a := anomalies[0]
+		if !a.Timestamp.Equal(base) || a.Value != 13 || a.Baseline != 10 || a.Metric != "failed_attempts" {
+			t.Errorf("anomaly = %+v, want the window's start and its failures", a)
+		}
+	}
+
+	// Port scans and SYN floods need a security store
+	scan := make([]*models.Connection, 0, 10)
+	for port := 1; port <= 10; port++ {
+		scan = append(scan, at(20, models.Connection{SourceIP: "10.0.0.66", DestIP: "10.0.0.10", DestPort: port, TCPState: "SYN_RECV"}))
+	}
+	if got, _, _ := ingest(e, scan); len(got) != 0 {
+		t.Errorf("engine without a security store reported:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+// recorder is a notifier that keeps what it is sent
+type recorder struct {
+	anomalies []*models.Anomaly
+}
+
+func (r *recorder) Notify(a *models.Anomaly) error {
+	r.anomalies = append(r.anomalies, a)
+	return nil
+}
+
+func TestObserve(t *testing.T) {
+	store := storage.NewMemoryStorage(100)
+	notifier := &recorder{}
+	e := NewEngine(testConfig, store, store, notifier)
+	for port := 1; port <= 5; port++ {
+		e.Observe(at(port, models.Connection{SourceIP: "10.0.0.66", DestIP: "10.0.0.10", DestPort: port}))
+		e.Observe(at(port, models.Connection{ServiceName: "checkout", DestIP: "10.0.0.5", DestPort: 5432, RetryCount: 2, Error: "ECONNREFUSED"}))
+	}
+
+	events, err := store.GetSecurityEvents(storage.SecurityEventFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Kind != models.SecurityPortScan {
+		t.Errorf("stored events = %+v", events)
+	}
+	anomalies, err := store.GetAnomalies(storage.AnomalyFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anomalies) != 1 || anomalies[0].Kind != models.AnomalyRetryStorm || len(notifier.anomalies) != 1 {
+		t.Errorf("stored anomalies = %+v, notified %+v", anomalies, notifier.anomalies)
+	}
+
+	// Keys idle for a window are swept
+	e.Observe(at(200, models.Connection{SourceIP: "10.0.0.1", DestIP: "10.0.0.2", DestPort: 80}))
+	if len(e.scans.keys) != 1 || len(e.storms.keys) != 0 {
+		t.Errorf("%d scan keys and %d storm keys after a quiet window, want 1 and 0", len(e.scans.keys), len(e.storms.keys))
+	}
+}
@@ -0,0 +1,97 @@
+package detect
+
+import (
+	"time"
+)
+
+// windows holds a sliding window of observations for each key
+type windows struct {
+	span time.Duration
+	keys map[string]*window
+}
+
+func newWindows(span time.Duration) *windows {
+	return &windows{span: span, keys: make(map[string]*window)}
+}
+
+// observation is one connection counted by a window. Member names what the
+// detector counts distinct values of, such as ports; n is what it sums.
+type observation struct {
+	at     time.Time
+	member string
+	n      int
+}
+
+// window is the observations of one key within the span before the latest
+type window struct {
+	span         time.Duration
+	observations []observation
+	members      map[string]int
+	total        int
+	// start is the time of the oldest observation in the window
+	start    time.Time
+	reported time.Time
+}
+
+// add records an observation and returns the key's window
+func (ws *windows) add(key, member string, at time.Time, n int) *window {
+	w, ok := ws.keys[key]
+	if !ok {
+		w = &window{span: ws.span, members: make(map[string]int)}
+		ws.keys[key] = w
+	}
+	w.prune(at)
+
+	w.observations = append(w.observations, observation{at: at, member: member, n: n})
+	if member != "" {
+		w.members[member]++
+	}
+	w.total += n
+	w.start = w.observations[0].at
+	return w
+}
+
+// sweep drops keys with nothing in their window and nothing recently
+// reported
+func (ws *windows) sweep(now time.Time) {
+	cutoff := now.Add(-ws.span)
+	for key, w := range ws.keys {
+		last := w.observations[len(w.observations)-1].at
+		if last.Before(cutoff) && w.reported.Before(cutoff) {
+			delete(ws.keys, key)
+		}
+	}
+}
+
+// prune drops observations older than the span before now
+func (w *window) prune(now time.Time) {
+	cutoff := now.Add(-w.span)
+	i := 0
+	for i < len(w.observations) && w.observations[i].at.Before(cutoff) {
+		o := w.observations[i]
+		if o.member != "" {
+			if w.members[o.member]--; w.members[o.member] == 0 {
+				delete(w.members, o.member)
+			}
+		}
+		w.total -= o.n
+		i++
+	}
+	w.observations = w.observations[i:]
+}
+
+// distinct is the number of distinct members in the window
+func (w *window) distinct() int {
+	return len(w.members)
+}
+
+// report reports whether a pattern completed at the given time should be
+// reported: once per span, so a sustained pattern is not reported for every
+// connection
+func (w *window) report(at time.Time) bool {
+	if !w.reported.IsZero() && at.Sub(w.reported) < w.span {
+		return false
+	}
+	w.reported = at
+	return true
+}
@@ -0,0 +1,22 @@
+// Package enrich adds context to connections on the server before they are
+// stored: address scope, reverse DNS names and GeoIP/ASN attributes.
+package enrich
+
+import (
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// Enricher adds derived fields to a connection in place
+type Enricher interface {
+	Enrich(conn *models.Connection)
+}
+
+// Chain runs enrichers in order
+type Chain []Enricher
+
+// Enrich applies every enricher in the chain
+func (c Chain) Enrich(conn *models.Connection) {
+	for _, e := range c {
+		e.Enrich(conn)
+	}
+}
@@ -0,0 +1,192 @@
+package enrich
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// GeoRecord holds the attributes known for a network
+type GeoRecord struct {
+	Country string
+	ASN     int
+	Org     string
+}
+
+type geoRange struct {
+	start, end net.IP // 16-byte form
+	record     GeoRecord
+}
+
+// GeoIPDatabase answers ASN, organization and country lookups from CSV files
+// keyed by CIDR network. It reads MaxMind GeoLite2 CSV exports such as
+// GeoLite2-ASN-Blocks-IPv4.csv as well as simpler hand-maintained files.
+// Columns are matched by header name:
+//
+//	network                                       (required, CIDR)
+//	country, country_iso_code                     (ISO 3166 code)
+//	asn, autonomous_system_number
+//	org, organization, autonomous_system_organization
+//
+// Several files may be loaded; attributes for the same address are merged.
+type GeoIPDatabase struct {
+	ranges [][]geoRange // one sorted table per loaded file
+}
+
+// NewGeoIPDatabase creates an empty database
+func NewGeoIPDatabase() *GeoIPDatabase {
+	return &GeoIPDatabase{}
+}
+
+// LoadFile adds a CSV file to the database
+func (db *GeoIPDatabase) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open GeoIP database: %v", err)
+	}
+	defer f.Close()
+
+	if err := db.Load(f); err != nil {
+		return fmt.Errorf("failed to load %s: %v", path, err)
+	}
+	return nil
+}
+
+// Load adds CSV data to the database
+func (db *GeoIPDatabase) Load(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read header: %v", err)
+	}
+
+	networkCol, countryCol, asnCol, orgCol := -1, -1, -1, -1
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "network", "cidr":
+			networkCol = i
+		case "country", "country_iso_code", "country_code":
+			countryCol = i
+		case "asn", "autonomous_system_number":
+			asnCol = i
+		case "org", "organization", "autonomous_system_organization":
+			orgCol = i
+		}
+	}
+	if networkCol < 0 {
+		return fmt.Errorf("missing network column")
+	}
+
+	field := func(rec []string, col int) string {
+		if col < 0 || col >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[col])
+	}
+
+	var ranges []geoRange
+	for line := 2; ; line++ {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+
+		_, network, err := net.ParseCIDR(field(rec, networkCol))
+		if err != nil {
+			return fmt.Errorf("line %d: invalid network: %v", line, err)
+		}
+
+		record := GeoRecord{
+			Country: strings.ToUpper(field(rec, countryCol)),
+			Org:     field(rec, orgCol),
+		}
+		if asn := strings.TrimPrefix(strings.ToUpper(field(rec, asnCol)), "AS"); asn != "" {
+			record.ASN, err = strconv.Atoi(asn)
+			if err != nil {
+				return fmt.Errorf("line %d: invalid ASN: %v", line, err)
+			}
+		}
+
+		start := network.IP.To16()
+		end := make(net.IP, net.IPv6len)
+		mask := network.Mask
+		if len(mask) == net.IPv4len {
+			mask = append(net.CIDRMask(96, 128)[:12:12], mask...)
+		}
+		for i := range end {
+			end[i] = start[i] | ^mask[i]
+		}
+		ranges = append(ranges, geoRange{start: start, end: end, record: record})
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return bytes.Compare(ranges[i].start, ranges[j].start) < 0
+	})
+	db.ranges = append(db.ranges, ranges)
+	return nil
+}
+
+// Lookup returns the merged attributes for an address
+func (db *GeoIPDatabase) Lookup(addr string) (GeoRecord, bool) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return GeoRecord{}, false
+	}
+	ip = ip.To16()
+
+	var result GeoRecord
+	found := false
+	for _, table := range db.ranges {
+		// Last range starting at or before the address
+		i := sort.Search(len(table), func(i int) bool {
+			return bytes.Compare(table[i].start, ip) > 0
+		}) - 1
+		if i < 0 || bytes.Compare(ip, table[i].end) > 0 {
+			continue
+		}
+
+		rec := table[i].record
+		found = true
+		if result.Country == "" {
+			result.Country = rec.Country
+		}
+		if result.ASN == 0 {
+			result.ASN = rec.ASN
+		}
+		if result.Org == "" {
+			result.Org = rec.Org
+		}
+	}
+	return result, found
+}
+
+// Enrich sets the destination's country, ASN and organization
+func (db *GeoIPDatabase) Enrich(conn *models.Connection) {
+	rec, ok := db.Lookup(conn.DestIP)
+	if !ok {
+		return
+	}
+	if conn.DestCountry == "" {
+		conn.DestCountry = rec.Country
+	}
+	if conn.DestASN == 0 {
+		conn.DestASN = rec.ASN
+	}
+	if conn.DestOrg == "" {
+		conn.DestOrg = rec.Org
+	}
+}
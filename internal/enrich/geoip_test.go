@@ -0,0 +1,109 @@
+package enrich
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// asnCSV is laid out as a GeoLite2 ASN export
+const asnCSV = `network,autonomous_system_number,autonomous_system_organization
+1.1.1.0/24,13335,CLOUDFLARENET
+8.8.8.0/24,15169,GOOGLE
+52.0.0.0/11,16509,AMAZON-02
+2606:4700::/32,13335,CLOUDFLARENET
+`
+
+// countryCSV is hand-maintained, with its columns in another order, some
+// entries with an organization, and one network without a country
+const countryCSV = `Country, CIDR ,org,asn
+us,8.8.8.0/24,Google LLC,AS15169
+au,1.1.1.0/24,,
+de,52.28.0.0/16,,
+,203.0.113.0/24,Example Docs,
+`
+
+func TestGeoIPLookup(t *testing.T) {
+	db := NewGeoIPDatabase()
+	for _, data := range []string{asnCSV, countryCSV} {
+		if err := db.Load(strings.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		addr string
+		want string
+	}{
+		// Attributes are merged across files, the first loaded winning
+		{"8.8.8.8", "US 15169 GOOGLE"},
+		{"1.1.1.1", "AU 13335 CLOUDFLARENET"},
+		// A range's first and last addresses, and just past them
+		{"1.1.1.0", "AU 13335 CLOUDFLARENET"},
+		{"1.1.1.255", "AU 13335 CLOUDFLARENET"},
+		{"1.1.0.255", "not found"},
+		{"1.1.2.0", "not found"},
+		// Only the ASN file covers all of Amazon's /11
+		{"52.31.255.255", " 16509 AMAZON-02"},
+		{"52.32.0.0", "not found"},
+		{"203.0.113.7", " 0 Example Docs"},
+		{"2606:4700:4700::1111", " 13335 CLOUDFLARENET"},
+		{"::ffff:8.8.4.4", "not found"},
+		{"::ffff:8.8.8.4", "US 15169 GOOGLE"},
+		{"2001:db8::1", "not found"},
+		{"10.0.0.1", "not found"},
+		{"not-an-ip", "not found"},
+	} {
+		got := "not found"
+		if rec, ok := db.Lookup(tc.addr); ok {
+			got = fmt.Sprintf("%s %d %s", rec.Country, rec.ASN, rec.Org)
+		}
+		if got != tc.want {
+			t.Errorf("Lookup(%s) = %q, want %q", tc.addr, got, tc.want)
+		}
+	}
+
+	// Values already set on the connection are kept
+	conn := &models.Connection{DestIP: "8.8.8.8", DestOrg: "Google Public DNS"}
+	db.Enrich(conn)
+	if conn.DestCountry != "US" || conn.DestASN != 15169 || conn.DestOrg != "Google Public DNS" {
+		t.Errorf("enriched %s %d %s", conn.DestCountry, conn.DestASN, conn.DestOrg)
+	}
+	conn = &models.Connection{DestIP: "10.0.0.1"}
+	db.Enrich(conn)
+	if conn.DestCountry != "" || conn.DestASN != 0 || conn.DestOrg != "" {
+		t.Errorf("enriched an unknown address: %+v", conn)
+	}
+}
+
+func TestGeoIPLoadErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, data, err string
+	}{
+		{"empty", "", "failed to read header"},
+		{"no network column", "country,asn\nUS,15169\n", "missing network column"},
+		{"invalid network", "network,asn\n8.8.8.0/24,15169\n8.8.8.8,15169\n", "line 3: invalid network"},
+		{"invalid ASN", "network,asn\n8.8.8.0/24,GOOGLE\n", "line 2: invalid ASN"},
+		{"unterminated quote", "network,org\n8.8.8.0/24,\"Google\n", "line 2:"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := NewGeoIPDatabase()
+			err := db.Load(strings.NewReader(tc.data))
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("Load = %v, want %q", err, tc.err)
+			}
+			// Nothing is kept from a file that fails to load
+			if len(db.ranges) != 0 {
+				t.Errorf("%d tables loaded", len(db.ranges))
+			}
+		})
+	}
+
+	err := NewGeoIPDatabase().LoadFile(filepath.Join(t.TempDir(), "GeoLite2-ASN-Blocks-IPv4.csv"))
+	if err == nil || !strings.HasPrefix(err.Error(), "failed to open GeoIP database") {
+		t.Errorf("LoadFile of a missing file = %v", err)
+	}
+}
@@ -0,0 +1,519 @@
+package enrich
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// In-cluster service account locations
+const (
+	serviceAccountToken = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	serviceAccountCA    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// KubernetesConfig describes how to reach the Kubernetes API server
+type KubernetesConfig struct {
+	APIServer string // e.g. https://kubernetes.default.svc
+	TokenFile string
+	CAFile    string
+	Insecure  bool
+}
+
+// InClusterConfig returns the configuration for running inside a pod
+func InClusterConfig() (KubernetesConfig, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return KubernetesConfig{}, fmt.Errorf("not running inside a Kubernetes cluster")
+	}
+	return KubernetesConfig{
+		APIServer: "https://" + host + ":" + port,
+		TokenFile: serviceAccountToken,
+		CAFile:    serviceAccountCA,
+	}, nil
+}
+
+// PodInfo is the Kubernetes identity of an address
+type PodInfo struct {
+	Namespace  string
+	Pod        string
+	Deployment string
+	ReplicaSet string
+	Service    string
+	Node       string
+	Labels     map[string]string
+}
+
+type k8sObjectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	Labels          map[string]string `json:"labels"`
+	ResourceVersion string            `json:"resourceVersion"`
+	OwnerReferences []struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	} `json:"ownerReferences"`
+}
+
+type k8sPod struct {
+	Kind     string        `json:"kind"`
+	Metadata k8sObjectMeta `json:"metadata"`
+	Spec     struct {
+		NodeName    string `json:"nodeName"`
+		HostNetwork bool   `json:"hostNetwork"`
+	} `json:"spec"`
+	Status struct {
+		Phase  string `json:"phase"`
+		PodIP  string `json:"podIP"`
+		PodIPs []struct {
+			IP string `json:"ip"`
+		} `json:"podIPs"`
+	} `json:"status"`
+}
+
+type k8sService struct {
+	Kind     string        `json:"kind"`
+	Metadata k8sObjectMeta `json:"metadata"`
+	Spec     struct {
+		Selector   map[string]string `json:"selector"`
+		ClusterIP  string            `json:"clusterIP"`
+		ClusterIPs []string          `json:"clusterIPs"`
+	} `json:"spec"`
+}
+
+// KubernetesProvider maps pod and service IPs to Kubernetes metadata. State
+// comes either from a static snapshot (kubectl get pods,services -A -o json)
+// or from a live list/watch against the API server.
+type KubernetesProvider struct {
+	config KubernetesConfig
+	client *http.Client
+	token  string
+
+	mu       sync.RWMutex
+	pods     map[string]k8sPod     // namespace/name
+	services map[string]k8sService // namespace/name
+	dirty    bool
+	byIP     map[string]PodInfo
+
+	cancel context.CancelFunc
+}
+
+// NewKubernetesProvider creates an empty provider
+func NewKubernetesProvider() *KubernetesProvider {
+	return &KubernetesProvider{
+		pods:     make(map[string]k8sPod),
+		services: make(map[string]k8sService),
+		byIP:     make(map[string]PodInfo),
+	}
+}
+
+// LoadSnapshot replaces the provider's state with the objects in a JSON list,
+// as produced by `kubectl get pods,services -A -o json`
+func (k *KubernetesProvider) LoadSnapshot(r io.Reader) error {
+	var list struct {
+		Items []json.RawMessage `json:"items"`
+	}
+	if err := json.NewDecoder(r).Decode(&list); err != nil {
+		return fmt.Errorf("failed to decode snapshot: %v", err)
+	}
+
+	pods := make(map[string]k8sPod)
+	services := make(map[string]k8sService)
+	for _, raw := range list.Items {
+		var kind struct {
+			Kind string `json:"kind"`
+		}
+		if err := json.Unmarshal(raw, &kind); err != nil {
+			return fmt.Errorf("failed to decode snapshot item: %v", err)
+		}
+		switch kind.Kind {
+		case "Pod":
+			var pod k8sPod
+			if err := json.Unmarshal(raw, &pod); err != nil {
+				return fmt.Errorf("failed to decode pod: %v", err)
+			}
+			pods[objectKey(pod.Metadata)] = pod
+		case "Service":
+			var svc k8sService
+			if err := json.Unmarshal(raw, &svc); err != nil {
+				return fmt.Errorf("failed to decode service: %v", err)
+			}
+			services[objectKey(svc.Metadata)] = svc
+		}
+	}
+
+	k.mu.Lock()
+	k.pods, k.services, k.dirty = pods, services, true
+	k.mu.Unlock()
+	return nil
+}
+
+// LoadSnapshotFile loads a snapshot from disk
+func (k *KubernetesProvider) LoadSnapshotFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open Kubernetes snapshot: %v", err)
+	}
+	defer f.Close()
+	return k.LoadSnapshot(f)
+}
+
+// Watch keeps the provider in sync with the API server until Stop is called.
+// It returns once the initial lists have been loaded.
+func (k *KubernetesProvider) Watch(config KubernetesConfig) error {
+	k.config = config
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.Insecure}
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	k.client = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+
+	if config.TokenFile != "" {
+		token, err := os.ReadFile(config.TokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read token file: %v", err)
+		}
+		k.token = strings.TrimSpace(string(token))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	k.cancel = cancel
+
+	for _, resource := range []string{"pods", "services"} {
+		version, err := k.list(ctx, resource)
+		if err != nil {
+			cancel()
+			return err
+		}
+		go k.watchLoop(ctx, resource, version)
+	}
+	return nil
+}
+
+// Stop ends a running watch
+func (k *KubernetesProvider) Stop() {
+	if k.cancel != nil {
+		k.cancel()
+	}
+}
+
+func (k *KubernetesProvider) watchLoop(ctx context.Context, resource, version string) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		err := k.watch(ctx, resource, version)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Kubernetes %s watch failed: %v", resource, err)
+			time.Sleep(backoff)
+			if backoff < time.Minute {
+				backoff *= 2
+			}
+		} else {
+			backoff = time.Second
+		}
+
+		// Relist to recover from expired resource versions or missed events
+		if version, err = k.list(ctx, resource); err != nil {
+			log.Printf("Kubernetes %s list failed: %v", resource, err)
+		}
+	}
+}
+
+func (k *KubernetesProvider) request(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(k.config.APIServer, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if k.token != "" {
+		req.Header.Set("Authorization", "Bearer "+k.token)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("API server returned %s for %s", resp.Status, path)
+	}
+	return resp, nil
+}
+
+// list loads every object of a resource, returning the list's resource version
+func (k *KubernetesProvider) list(ctx context.Context, resource string) (string, error) {
+	resp, err := k.request(ctx, "/api/v1/"+resource)
+	if err != nil {
+		return "", fmt.Errorf("failed to list %s: %v", resource, err)
+	}
+	defer resp.Body.Close()
+
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []json.RawMessage `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return "", fmt.Errorf("failed to decode %s list: %v", resource, err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	switch resource {
+	case "pods":
+		k.pods = make(map[string]k8sPod)
+	case "services":
+		k.services = make(map[string]k8sService)
+	}
+	for _, raw := range list.Items {
+		k.apply(resource, "ADDED", raw)
+	}
+	return list.Metadata.ResourceVersion, nil
+}
+
+// watch streams change events until the server closes the connection
+func (k *KubernetesProvider) watch(ctx context.Context, resource, version string) error {
+	resp, err := k.request(ctx, "/api/v1/"+resource+"?watch=1&allowWatchBookmarks=true&resourceVersion="+version)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if event.Type == "ERROR" {
+			return fmt.Errorf("watch error: %s", event.Object)
+		}
+
+		k.mu.Lock()
+		k.apply(resource, event.Type, event.Object)
+		k.mu.Unlock()
+	}
+}
+
+// apply records a single object change; the caller holds k.mu
+func (k *KubernetesProvider) apply(resource, eventType string, raw json.RawMessage) {
+	switch resource {
+	case "pods":
+		var pod k8sPod
+		if err := json.Unmarshal(raw, &pod); err != nil {
+			return
+		}
+		if eventType == "DELETED" {
+			delete(k.pods, objectKey(pod.Metadata))
+		} else if eventType == "ADDED" || eventType == "MODIFIED" {
+			k.pods[objectKey(pod.Metadata)] = pod
+		}
+	case "services":
+		var svc k8sService
+		if err := json.Unmarshal(raw, &svc); err != nil {
+			return
+		}
+		if eventType == "DELETED" {
+			delete(k.services, objectKey(svc.Metadata))
+		} else if eventType == "ADDED" || eventType == "MODIFIED" {
+			k.services[objectKey(svc.Metadata)] = svc
+		}
+	default:
+		return
+	}
+	k.dirty = true
+}
+
+// Lookup returns the Kubernetes identity of a pod or service IP
+func (k *KubernetesProvider) Lookup(ip string) (PodInfo, bool) {
+	k.mu.RLock()
+	if !k.dirty {
+		info, ok := k.byIP[ip]
+		k.mu.RUnlock()
+		return info, ok
+	}
+	k.mu.RUnlock()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.dirty {
+		k.rebuild()
+	}
+	info, ok := k.byIP[ip]
+	return info, ok
+}
+
+// rebuild recomputes the IP index; the caller holds k.mu
+func (k *KubernetesProvider) rebuild() {
+	byIP := make(map[string]PodInfo)
+
+	// Services sorted by name so a pod behind several gets a stable one
+	services := make([]k8sService, 0, len(k.services))
+	for _, svc := range k.services {
+		services = append(services, svc)
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return objectKey(services[i].Metadata) < objectKey(services[j].Metadata)
+	})
+
+	for _, svc := range services {
+		ips := svc.Spec.ClusterIPs
+		if len(ips) == 0 && svc.Spec.ClusterIP != "" {
+			ips = []string{svc.Spec.ClusterIP}
+		}
+		for _, ip := range ips {
+			if ip == "None" {
+				continue
+			}
+			byIP[ip] = PodInfo{
+				Namespace: svc.Metadata.Namespace,
+				Service:   svc.Metadata.Name,
+				Labels:    svc.Metadata.Labels,
+			}
+		}
+	}
+
+	// Pods sorted by name too, so that an address briefly shared by two
+	// pods resolves the same way every time
+	pods := make([]k8sPod, 0, len(k.pods))
+	for _, pod := range k.pods {
+		pods = append(pods, pod)
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		return objectKey(pods[i].Metadata) < objectKey(pods[j].Metadata)
+	})
+
+	for _, pod := range pods {
+		if pod.Spec.HostNetwork {
+			// Host-network pods share the node's address
+			continue
+		}
+		if pod.Status.Phase == "Succeeded" || pod.Status.Phase == "Failed" {
+			// Finished pods, such as completed Jobs, keep their IP in
+			// status after it has been handed to another pod
+			continue
+		}
+
+		info := PodInfo{
+			Namespace: pod.Metadata.Namespace,
+			Pod:       pod.Metadata.Name,
+			Node:      pod.Spec.NodeName,
+			Labels:    pod.Metadata.Labels,
+		}
+		for _, owner := range pod.Metadata.OwnerReferences {
+			switch owner.Kind {
+			case "ReplicaSet":
+				info.ReplicaSet = owner.Name
+				info.Deployment = owner.Name
+				if hash := pod.Metadata.Labels["pod-template-hash"]; hash != "" {
+					info.Deployment = strings.TrimSuffix(owner.Name, "-"+hash)
+				}
+			case "StatefulSet", "DaemonSet", "Job":
+				info.Deployment = owner.Name
+			}
+		}
+		for _, svc := range services {
+			if svc.Metadata.Namespace == pod.Metadata.Namespace && selects(svc.Spec.Selector, pod.Metadata.Labels) {
+				info.Service = svc.Metadata.Name
+				break
+			}
+		}
+
+		ips := []string{pod.Status.PodIP}
+		for _, podIP := range pod.Status.PodIPs {
+			ips = append(ips, podIP.IP)
+		}
+		for _, ip := range ips {
+			if ip != "" {
+				byIP[ip] = info
+			}
+		}
+	}
+
+	k.byIP = byIP
+	k.dirty = false
+}
+
+// Enrich tags the connection with the source pod and destination pod or
+// service, and fills identity fields the collector left empty
+func (k *KubernetesProvider) Enrich(conn *models.Connection) {
+	if src, ok := k.Lookup(conn.SourceIP); ok {
+		conn.K8sNamespace = src.Namespace
+		conn.K8sPod = src.Pod
+		conn.K8sDeployment = src.Deployment
+		conn.K8sService = src.Service
+		conn.K8sNode = src.Node
+
+		if conn.ServiceName == "" {
+			conn.ServiceName = firstNonEmpty(src.Service, src.Deployment, src.Pod)
+		}
+		if conn.DeploymentID == "" {
+			conn.DeploymentID = firstNonEmpty(src.Labels["app.kubernetes.io/version"], src.ReplicaSet)
+		}
+		if conn.Environment == "" {
+			conn.Environment = firstNonEmpty(src.Labels["environment"], src.Labels["env"], src.Namespace)
+		}
+	}
+
+	if dst, ok := k.Lookup(conn.DestIP); ok {
+		conn.DestK8sNamespace = dst.Namespace
+		conn.DestK8sPod = dst.Pod
+		conn.DestK8sService = dst.Service
+	}
+}
+
+func selects(selector, labels map[string]string) bool {
+	if len(selector) == 0 {
+		return false
+	}
+	for key, value := range selector {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func objectKey(meta k8sObjectMeta) string {
+	return meta.Namespace + "/" + meta.Name
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
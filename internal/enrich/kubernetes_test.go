@@ -0,0 +1,169 @@
+package enrich
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// pod renders a pod object; owner is "Kind/name" or empty
+func pod(namespace, name, ip, phase, owner string, labels map[string]string) map[string]interface{} {
+	meta := map[string]interface{}{"name": name, "namespace": namespace, "labels": labels}
+	if kind, ownerName, ok := strings.Cut(owner, "/"); ok {
+		meta["ownerReferences"] = []map[string]string{{"kind": kind, "name": ownerName}}
+	}
+	return map[string]interface{}{
+		"kind":     "Pod",
+		"metadata": meta,
+		"spec":     map[string]interface{}{"nodeName": "node-1"},
+		"status":   map[string]interface{}{"phase": phase, "podIP": ip},
+	}
+}
+
+func service(namespace, name, clusterIP string, selector map[string]string) map[string]interface{} {
+	return map[string]interface{}{
+		"kind":     "Service",
+		"metadata": map[string]interface{}{"name": name, "namespace": namespace},
+		"spec":     map[string]interface{}{"clusterIP": clusterIP, "selector": selector},
+	}
+}
+
+var (
+	checkoutLabels = map[string]string{"app": "checkout", "pod-template-hash": "7d9f8c", "environment": "prod-eu"}
+	checkoutPod    = pod("shop", "checkout-7d9f8c-x2x9z", "10.1.0.5", "Running", "ReplicaSet/checkout-7d9f8c", checkoutLabels)
+	// A finished Job pod whose address was reused by checkout; it sorts
+	// after checkout, so it would win if finished pods were indexed
+	jobPod         = pod("shop", "migrate-28a1", "10.1.0.5", "Succeeded", "Job/migrate", nil)
+	ledgerPod      = pod("bank", "ledger-0", "10.1.0.7", "Running", "StatefulSet/ledger", map[string]string{"app": "ledger"})
+	checkoutSvc    = service("shop", "checkout", "10.96.0.10", map[string]string{"app": "checkout"})
+	ledgerSvc      = service("bank", "ledger", "10.96.0.20", map[string]string{"app": "ledger"})
+	checkoutWanted = PodInfo{Namespace: "shop", Pod: "checkout-7d9f8c-x2x9z", Deployment: "checkout", ReplicaSet: "checkout-7d9f8c", Service: "checkout", Node: "node-1"}
+)
+
+func checkLookup(t *testing.T, k *KubernetesProvider, ip string, want PodInfo) {
+	t.Helper()
+	got, ok := k.Lookup(ip)
+	if !ok {
+		t.Fatalf("Lookup(%s) found nothing", ip)
+	}
+	got.Labels = nil
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Lookup(%s) = %+v, want %+v", ip, got, want)
+	}
+}
+
+func TestKubernetesSnapshot(t *testing.T) {
+	snapshot, err := json.Marshal(map[string]interface{}{
+		"items": []interface{}{checkoutPod, jobPod, ledgerPod, checkoutSvc, ledgerSvc},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := NewKubernetesProvider()
+	if err := k.LoadSnapshot(strings.NewReader(string(snapshot))); err != nil {
+		t.Fatal(err)
+	}
+
+	checkLookup(t, k, "10.1.0.5", checkoutWanted)
+	checkLookup(t, k, "10.1.0.7", PodInfo{Namespace: "bank", Pod: "ledger-0", Deployment: "ledger", Service: "ledger", Node: "node-1"})
+	checkLookup(t, k, "10.96.0.20", PodInfo{Namespace: "bank", Service: "ledger"})
+
+	conn := &models.Connection{SourceIP: "10.1.0.5", DestIP: "10.96.0.20", ServiceName: "from-collector"}
+	k.Enrich(conn)
+	if conn.K8sDeployment != "checkout" || conn.K8sNamespace != "shop" || conn.K8sService != "checkout" {
+		t.Errorf("source = %s/%s/%s", conn.K8sNamespace, conn.K8sDeployment, conn.K8sService)
+	}
+	if conn.ServiceName != "from-collector" {
+		t.Errorf("ServiceName = %q, want the collector's value kept", conn.ServiceName)
+	}
+	if conn.DeploymentID != "checkout-7d9f8c" || conn.Environment != "prod-eu" {
+		t.Errorf("DeploymentID = %q, Environment = %q", conn.DeploymentID, conn.Environment)
+	}
+	if conn.DestK8sNamespace != "bank" || conn.DestK8sService != "ledger" {
+		t.Errorf("destination = %s/%s", conn.DestK8sNamespace, conn.DestK8sService)
+	}
+}
+
+// fakeAPIServer serves pod and service lists, then streams the given watch
+// events and holds the watch open
+func fakeAPIServer(t *testing.T, lists map[string][]interface{}, events map[string][]interface{}) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		resource := strings.TrimPrefix(r.URL.Path, "/api/v1/")
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("watch") == "" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"metadata": map[string]string{"resourceVersion": "100"},
+				"items":    lists[resource],
+			})
+			return
+		}
+		if r.URL.Query().Get("resourceVersion") != "100" {
+			t.Errorf("watch %s from version %q", resource, r.URL.Query().Get("resourceVersion"))
+		}
+		enc := json.NewEncoder(w)
+		for _, event := range events[resource] {
+			enc.Encode(event)
+		}
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestKubernetesWatch(t *testing.T) {
+	paymentsPod := pod("shop", "payments-55c6d-abcde", "10.1.0.9", "Running", "ReplicaSet/payments-55c6d",
+		map[string]string{"pod-template-hash": "55c6d"})
+	srv := fakeAPIServer(t,
+		map[string][]interface{}{
+			"pods":     {checkoutPod, jobPod, ledgerPod},
+			"services": {checkoutSvc},
+		},
+		map[string][]interface{}{
+			"pods": {
+				map[string]interface{}{"type": "ADDED", "object": paymentsPod},
+				map[string]interface{}{"type": "DELETED", "object": ledgerPod},
+			},
+		})
+
+	token := t.TempDir() + "/token"
+	if err := os.WriteFile(token, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	k := NewKubernetesProvider()
+	if err := k.Watch(KubernetesConfig{APIServer: srv.URL, TokenFile: token}); err != nil {
+		t.Fatal(err)
+	}
+	defer k.Stop()
+
+	// The list is loaded before Watch returns
+	checkLookup(t, k, "10.1.0.5", checkoutWanted)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, added := k.Lookup("10.1.0.9")
+		_, kept := k.Lookup("10.1.0.7")
+		if added && !kept {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("watch events not applied: payments %v, ledger %v", added, kept)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	checkLookup(t, k, "10.1.0.9", PodInfo{Namespace: "shop", Pod: "payments-55c6d-abcde", Deployment: "payments", ReplicaSet: "payments-55c6d", Node: "node-1"})
+}
@@ -0,0 +1,104 @@
+package enrich
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// ReverseDNS resolves destination addresses to PTR names. Lookups run in the
+// background so ingest never waits on DNS: the first connection to a new
+// address is stored without a name and later ones pick up the cached result.
+type ReverseDNS struct {
+	resolver    *net.Resolver
+	timeout     time.Duration
+	positiveTTL time.Duration
+	negativeTTL time.Duration
+	maxEntries  int
+
+	mu       sync.Mutex
+	cache    map[string]rdnsEntry
+	inFlight map[string]bool
+}
+
+type rdnsEntry struct {
+	name    string
+	expires time.Time
+}
+
+// NewReverseDNS creates a cached reverse resolver using the system resolver
+func NewReverseDNS() *ReverseDNS {
+	return &ReverseDNS{
+		resolver:    net.DefaultResolver,
+		timeout:     2 * time.Second,
+		positiveTTL: time.Hour,
+		negativeTTL: 10 * time.Minute,
+		maxEntries:  100000,
+		cache:       make(map[string]rdnsEntry),
+		inFlight:    make(map[string]bool),
+	}
+}
+
+// Enrich sets DestReverseDNS from the cache, scheduling a lookup on a miss
+func (r *ReverseDNS) Enrich(conn *models.Connection) {
+	if conn.DestIP == "" || conn.DestReverseDNS != "" {
+		return
+	}
+	if name, ok := r.Lookup(conn.DestIP); ok {
+		conn.DestReverseDNS = name
+	}
+}
+
+// Lookup returns a cached PTR name. A miss starts a background lookup.
+func (r *ReverseDNS) Lookup(ip string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry, ok := r.cache[ip]; ok && time.Now().Before(entry.expires) {
+		return entry.name, entry.name != ""
+	}
+
+	if !r.inFlight[ip] && net.ParseIP(ip) != nil {
+		r.inFlight[ip] = true
+		go r.resolve(ip)
+	}
+	return "", false
+}
+
+func (r *ReverseDNS) resolve(ip string) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	names, err := r.resolver.LookupAddr(ctx, ip)
+
+	entry := rdnsEntry{expires: time.Now().Add(r.negativeTTL)}
+	if err == nil && len(names) > 0 {
+		entry.name = strings.TrimSuffix(names[0], ".")
+		entry.expires = time.Now().Add(r.positiveTTL)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.inFlight, ip)
+	if len(r.cache) >= r.maxEntries {
+		r.evictExpired()
+	}
+	if len(r.cache) < r.maxEntries {
+		r.cache[ip] = entry
+	}
+}
+
+// evictExpired drops stale entries; the caller holds r.mu
+func (r *ReverseDNS) evictExpired() {
+	now := time.Now()
+	for ip, entry := range r.cache {
+		if now.After(entry.expires) {
+			delete(r.cache, ip)
+		}
+	}
+}
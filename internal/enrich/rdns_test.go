@@ -0,0 +1,203 @@
+package enrich
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// fakeResolver answers PTR queries from names, keyed by address, and with
+// NXDOMAIN for any other. Queries wait for gate to close when it is set.
+func fakeResolver(names map[string]string, gate chan struct{}) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go serveDNS(server, names, gate)
+			return client, nil
+		},
+	}
+}
+
+// serveDNS answers one query over a stream connection
+func serveDNS(conn net.Conn, names map[string]string, gate chan struct{}) {
+	defer conn.Close()
+	if gate != nil {
+		<-gate
+	}
+	var size uint16
+	if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+		return
+	}
+	query := make([]byte, size)
+	if _, err := io.ReadFull(conn, query); err != nil {
+		return
+	}
+
+	// The question is 4.3.2.1.in-addr.arpa. for 1.2.3.4
+	var labels []string
+	end := 12
+	for query[end] != 0 {
+		labels = append(labels, string(query[end+1:end+1+int(query[end])]))
+		end += 1 + int(query[end])
+	}
+	end += 5 // root label, type and class
+	var addr string
+	if len(labels) == 6 {
+		addr = labels[3] + "." + labels[2] + "." + labels[1] + "." + labels[0]
+	}
+
+	resp := append([]byte{query[0], query[1], 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0}, query[12:end]...)
+	if name, ok := names[addr]; ok {
+		var rdata []byte
+		for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+			rdata = append(append(rdata, byte(len(label))), label...)
+		}
+		rdata = append(rdata, 0)
+		resp[7] = 1
+		// The answer names the question by pointer: PTR, IN, an hour
+		resp = append(resp, 0xc0, 12, 0, 12, 0, 1, 0, 0, 0x0e, 0x10, byte(len(rdata)>>8), byte(len(rdata)))
+		resp = append(resp, rdata...)
+	} else {
+		resp[3] |= 3 // NXDOMAIN
+	}
+	binary.Write(conn, binary.BigEndian, uint16(len(resp)))
+	conn.Write(resp)
+}
+
+// cached waits for a background lookup of ip to finish
+func cached(t *testing.T, r *ReverseDNS, ip string) rdnsEntry {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		r.mu.Lock()
+		entry, ok := r.cache[ip]
+		pending := r.inFlight[ip]
+		r.mu.Unlock()
+		if ok && !pending {
+			return entry
+		}
+	}
+	t.Fatalf("%s was not resolved", ip)
+	return rdnsEntry{}
+}
+
+func TestReverseDNSResolve(t *testing.T) {
+	r := NewReverseDNS()
+	r.resolver = fakeResolver(map[string]string{"10.6.0.5": "db-1.internal.example."}, nil)
+
+	for _, tc := range []struct {
+		ip   string
+		name string
+		ttl  time.Duration
+	}{
+		// The trailing dot is dropped
+		{"10.6.0.5", "db-1.internal.example", time.Hour},
+		// Failures are remembered for less time
+		{"10.6.0.6", "", 10 * time.Minute},
+	} {
+		start := time.Now()
+		if name, ok := r.Lookup(tc.ip); ok || name != "" {
+			t.Errorf("first Lookup(%s) = %q, %v, want a miss", tc.ip, name, ok)
+		}
+		entry := cached(t, r, tc.ip)
+		if entry.name != tc.name || entry.expires.Before(start.Add(tc.ttl)) || entry.expires.After(time.Now().Add(tc.ttl)) {
+			t.Errorf("%s cached as %q until %s, want %q for %s", tc.ip, entry.name, entry.expires.Sub(start), tc.name, tc.ttl)
+		}
+		if name, ok := r.Lookup(tc.ip); name != tc.name || ok != (tc.name != "") {
+			t.Errorf("Lookup(%s) = %q, %v, want %q", tc.ip, name, ok, tc.name)
+		}
+	}
+
+	conn := &models.Connection{DestIP: "10.6.0.5"}
+	r.Enrich(conn)
+	if conn.DestReverseDNS != "db-1.internal.example" {
+		t.Errorf("DestReverseDNS = %q", conn.DestReverseDNS)
+	}
+}
+
+func TestReverseDNSCache(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		name     string
+		ip       string
+		entry    *rdnsEntry
+		inFlight bool
+		want     string
+		wantOK   bool
+		lookup   bool // whether a lookup is started
+	}{
+		{"miss", "10.6.0.5", nil, false, "", false, true},
+		{"fresh", "10.6.0.5", &rdnsEntry{"db-1.internal.example", now.Add(time.Minute)}, false, "db-1.internal.example", true, false},
+		{"fresh failure", "10.6.0.5", &rdnsEntry{"", now.Add(time.Minute)}, false, "", false, false},
+		// Expired names are not served while they are looked up again
+		{"expired", "10.6.0.5", &rdnsEntry{"db-1.internal.example", now.Add(-time.Second)}, false, "", false, true},
+		{"expired failure", "10.6.0.5", &rdnsEntry{"", now.Add(-time.Second)}, false, "", false, true},
+		{"already looking", "10.6.0.5", nil, true, "", false, false},
+		{"not an address", "db.internal", nil, false, "", false, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Lookups wait, so whether one started can be seen
+			gate := make(chan struct{})
+			defer close(gate)
+			r := NewReverseDNS()
+			r.resolver = fakeResolver(nil, gate)
+			if tc.entry != nil {
+				r.cache[tc.ip] = *tc.entry
+			}
+			r.inFlight[tc.ip] = tc.inFlight
+
+			name, ok := r.Lookup(tc.ip)
+			if name != tc.want || ok != tc.wantOK {
+				t.Errorf("Lookup = %q, %v, want %q, %v", name, ok, tc.want, tc.wantOK)
+			}
+			r.mu.Lock()
+			started := r.inFlight[tc.ip] && !tc.inFlight
+			r.mu.Unlock()
+			if started != tc.lookup {
+				t.Errorf("lookup started = %v, want %v", started, tc.lookup)
+			}
+		})
+	}
+}
+
+func TestReverseDNSEviction(t *testing.T) {
+	r := NewReverseDNS()
+	r.resolver = fakeResolver(map[string]string{"10.6.0.7": "cache-1.internal.example"}, nil)
+	r.maxEntries = 2
+
+	// A full cache makes room by dropping expired entries
+	r.cache["10.6.0.5"] = rdnsEntry{"db-1.internal.example", time.Now().Add(-time.Second)}
+	r.cache["10.6.0.6"] = rdnsEntry{"db-2.internal.example", time.Now().Add(time.Hour)}
+	r.Lookup("10.6.0.7")
+	if entry := cached(t, r, "10.6.0.7"); entry.name != "cache-1.internal.example" {
+		t.Errorf("10.6.0.7 cached as %q", entry.name)
+	}
+	if _, ok := r.cache["10.6.0.5"]; ok {
+		t.Error("expired entry kept")
+	}
+
+	// With nothing expired the new result is not kept
+	r.Lookup("10.6.0.8")
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		r.mu.Lock()
+		pending := r.inFlight["10.6.0.8"]
+		_, ok := r.cache["10.6.0.8"]
+		size := len(r.cache)
+		r.mu.Unlock()
+		if !pending {
+			if ok || size != 2 {
+				t.Errorf("cache holds %d entries, 10.6.0.8 among them: %v", size, ok)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("10.6.0.8 was not resolved")
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package enrich
+
+import (
+	"net"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// Address scopes recorded in Connection.DestScope
+const (
+	ScopePublic      = "public"
+	ScopePrivate     = "private"
+	ScopeLoopback    = "loopback"
+	ScopeLinkLocal   = "link_local"
+	ScopeMulticast   = "multicast"
+	ScopeShared      = "shared" // RFC 6598 carrier-grade NAT
+	ScopeUnspecified = "unspecified"
+)
+
+var sharedNet = mustCIDR("100.64.0.0/10")
+
+// ScopeEnricher marks private, loopback and link-local destinations
+type ScopeEnricher struct{}
+
+// Enrich sets DestScope from the destination address
+func (ScopeEnricher) Enrich(conn *models.Connection) {
+	if scope := Scope(conn.DestIP); scope != "" {
+		conn.DestScope = scope
+	}
+}
+
+// Scope classifies an address, returning "" if it does not parse
+func Scope(addr string) string {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return ""
+	}
+
+	switch {
+	case ip.IsUnspecified():
+		return ScopeUnspecified
+	case ip.IsLoopback():
+		return ScopeLoopback
+	case ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast():
+		return ScopeLinkLocal
+	case ip.IsMulticast():
+		return ScopeMulticast
+	case ip.IsPrivate():
+		return ScopePrivate
+	case sharedNet.Contains(ip):
+		return ScopeShared
+	default:
+		return ScopePublic
+	}
+}
+
+func mustCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
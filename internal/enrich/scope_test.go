@@ -0,0 +1,65 @@
+package enrich
+
+import (
+	"testing"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+func TestScope(t *testing.T) {
+	for _, tc := range []struct {
+		addr, want string
+	}{
+		{"10.1.2.3", ScopePrivate},
+		{"172.16.0.1", ScopePrivate},
+		{"172.31.255.255", ScopePrivate},
+		{"192.168.1.10", ScopePrivate},
+		{"fd12:3456::1", ScopePrivate},
+		// IPv4 in its IPv6 form is classified as IPv4
+		{"::ffff:10.0.0.1", ScopePrivate},
+		{"127.0.0.1", ScopeLoopback},
+		{"127.8.9.10", ScopeLoopback},
+		{"::1", ScopeLoopback},
+		{"169.254.169.254", ScopeLinkLocal},
+		{"fe80::1c2a:3bff:fe4d:5e6f", ScopeLinkLocal},
+		{"224.0.0.251", ScopeLinkLocal},
+		{"ff02::fb", ScopeLinkLocal},
+		{"239.255.255.250", ScopeMulticast},
+		{"ff05::1:3", ScopeMulticast},
+		{"100.64.0.1", ScopeShared},
+		{"100.127.255.254", ScopeShared},
+		{"0.0.0.0", ScopeUnspecified},
+		{"::", ScopeUnspecified},
+		// Just outside the private and shared ranges
+		{"172.32.0.1", ScopePublic},
+		{"100.128.0.1", ScopePublic},
+		{"192.169.0.1", ScopePublic},
+		{"8.8.8.8", ScopePublic},
+		{"2606:4700:4700::1111", ScopePublic},
+		{"", ""},
+		{"db.internal", ""},
+		{"10.1.2.3:5432", ""},
+	} {
+		if got := Scope(tc.addr); got != tc.want {
+			t.Errorf("Scope(%q) = %q, want %q", tc.addr, got, tc.want)
+		}
+	}
+}
+
+func TestScopeEnricher(t *testing.T) {
+	for _, tc := range []struct {
+		destIP, scope, want string
+	}{
+		{"10.1.2.3", "", ScopePrivate},
+		{"8.8.8.8", ScopePrivate, ScopePublic},
+		// A scope the address cannot give is kept
+		{"db.internal", ScopePrivate, ScopePrivate},
+		{"", "", ""},
+	} {
+		conn := &models.Connection{DestIP: tc.destIP, DestScope: tc.scope}
+		Chain{ScopeEnricher{}}.Enrich(conn)
+		if conn.DestScope != tc.want {
+			t.Errorf("%q with scope %q: DestScope = %q, want %q", tc.destIP, tc.scope, conn.DestScope, tc.want)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Package export encodes connections for analysts' tools. Writers stream one
+// connection at a time so exports of any size use constant memory.
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/parquet-go/parquet-go"
+)
+
+// Supported formats
+const (
+	FormatCSV     = "csv"
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+)
+
+// Writer encodes a stream of connections
+type Writer interface {
+	Write(conn *models.Connection) error
+	// Close flushes buffered output; it does not close the underlying writer
+	Close() error
+}
+
+// ContentType returns the MIME type and file extension of a format
+func ContentType(format string) (string, string, bool) {
+	switch format {
+	case FormatCSV:
+		return "text/csv", "csv", true
+	case FormatNDJSON:
+		return "application/x-ndjson", "ndjson", true
+	case FormatParquet:
+		return "application/vnd.apache.parquet", "parquet", true
+	}
+	return "", "", false
+}
+
+// NewWriter creates a writer for format
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatNDJSON:
+		buf := bufio.NewWriter(w)
+		return &ndjsonWriter{buf: buf, enc: json.NewEncoder(buf)}, nil
+	case FormatParquet:
+		return &parquetWriter{w: parquet.NewGenericWriter[row](w, parquet.Compression(&parquet.Snappy))}, nil
+	}
+	return nil, fmt.Errorf("unsupported export format: %s", format)
+}
+
+type ndjsonWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(conn *models.Connection) error {
+	return w.enc.Encode(conn)
+}
+
+func (w *ndjsonWriter) Close() error {
+	return w.buf.Flush()
+}
+
+// row is the flat layout of an exported connection. Tags are a list and
+// metadata a JSON object in string form.
+type row struct {
+	ID               string    `parquet:"id"`
+	Timestamp        time.Time `parquet:"timestamp,timestamp(millisecond)"`
+	SourceIP         string    `parquet:"source_ip"`
+	SourcePort       int32     `parquet:"source_port"`
+	DestIP           string    `parquet:"dest_ip"`
+	DestPort         int32     `parquet:"dest_port"`
+	DestHostname     string    `parquet:"dest_hostname"`
+	DestReverseDNS   string    `parquet:"dest_rdns"`
+	DestASN          int32     `parquet:"dest_asn"`
+	DestOrg          string    `parquet:"dest_org"`
+	DestCountry      string    `parquet:"dest_country"`
+	DestScope        string    `parquet:"dest_scope"`
+	DestK8sNamespace string    `parquet:"dest_k8s_namespace"`
+	DestK8sPod       string    `parquet:"dest_k8s_pod"`
+	DestK8sService   string    `parquet:"dest_k8s_service"`
+	Protocol         string    `parquet:"protocol"`
+	AppProtocol      string    `parquet:"app_protocol"`
+	TLSServerName    string    `parquet:"tls_server_name"`
+	Direction        string    `parquet:"direction"`
+	TCPState         string    `parquet:"tcp_state"`
+	ServiceName      string    `parquet:"service_name"`
+	ServiceType      string    `parquet:"service_type"`
+	DatabaseType     string    `parquet:"database_type"`
+	MessageQueueType string    `parquet:"message_queue_type"`
+	Host             string    `parquet:"host"`
+	DeploymentID     string    `parquet:"deployment_id"`
+	Environment      string    `parquet:"environment"`
+	Region           string    `parquet:"region"`
+	K8sNamespace     string    `parquet:"k8s_namespace"`
+	K8sPod           string    `parquet:"k8s_pod"`
+	K8sDeployment    string    `parquet:"k8s_deployment"`
+	K8sService       string    `parquet:"k8s_service"`
+	K8sNode          string    `parquet:"k8s_node"`
+	ContainerID      string    `parquet:"container_id"`
+	ContainerName    string    `parquet:"container_name"`
+	ContainerImage   string    `parquet:"container_image"`
+	Latency          float64   `parquet:"latency_ms"`
+	Duration         float64   `parquet:"duration_ms"`
+	DNSLatency       float64   `parquet:"dns_latency_ms"`
+	BytesSent        int64     `parquet:"bytes_sent"`
+	BytesReceived    int64     `parquet:"bytes_received"`
+	RetryCount       int32     `parquet:"retry_count"`
+	Error            string    `parquet:"error"`
+	Tags             []string  `parquet:"tags,list"`
+	Metadata         string    `parquet:"metadata,json"`
+}
+
+func toRow(conn *models.Connection) (row, error) {
+	metadata, err := json.Marshal(conn.Metadata)
+	if err != nil {
+		return row{}, fmt.Errorf("failed to marshal metadata: %v", err)
+	}
+	return row{
+		ID:               conn.ID,
+		Timestamp:        conn.Timestamp.UTC(),
+		SourceIP:         conn.SourceIP,
+		SourcePort:       int32(conn.SourcePort),
+		DestIP:           conn.DestIP,
+		DestPort:         int32(conn.DestPort),
+		DestHostname:     conn.DestHostname,
+		DestReverseDNS:   conn.DestReverseDNS,
+		DestASN:          int32(conn.DestASN),
+		DestOrg:          conn.DestOrg,
+		DestCountry:      conn.DestCountry,
+		DestScope:        conn.DestScope,
+		DestK8sNamespace: conn.DestK8sNamespace,
+		DestK8sPod:       conn.DestK8sPod,
+		DestK8sService:   conn.DestK8sService,
+		Protocol:         conn.Protocol,
+		AppProtocol:      conn.AppProtocol,
+		TLSServerName:    conn.TLSServerName,
+		Direction:        string(conn.Direction),
+		TCPState:         conn.TCPState,
+		ServiceName:      conn.ServiceName,
+		ServiceType:      string(conn.ServiceType),
+		DatabaseType:     string(conn.DatabaseType),
+		MessageQueueType: string(conn.MessageQueueType),
+		Host:             conn.Host,
+		DeploymentID:     conn.DeploymentID,
+		Environment:      conn.Environment,
+		Region:           conn.Region,
+		K8sNamespace:     conn.K8sNamespace,
+		K8sPod:           conn.K8sPod,
+		K8sDeployment:    conn.K8sDeployment,
+		K8sService:       conn.K8sService,
+		K8sNode:          conn.K8sNode,
+		ContainerID:      conn.ContainerID,
+		ContainerName:    conn.ContainerName,
+		ContainerImage:   conn.ContainerImage,
+		Latency:          conn.Latency,
+		Duration:         conn.Duration,
+		DNSLatency:       conn.DNSLatency,
+		BytesSent:        conn.BytesSent,
+		BytesReceived:    conn.BytesReceived,
+		RetryCount:       int32(conn.RetryCount),
+		Error:            conn.Error,
+		Tags:             conn.Tags,
+		Metadata:         string(metadata),
+	}, nil
+}
+
+// parquetWriter buffers rows into row groups
+type parquetWriter struct {
+	w *parquet.GenericWriter[row]
+}
+
+func (w *parquetWriter) Write(conn *models.Connection) error {
+	r, err := toRow(conn)
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write([]row{r})
+	return err
+}
+
+func (w *parquetWriter) Close() error {
+	return w.w.Close()
+}
+
+// csvColumns are the CSV header, in row order
+var csvColumns = []string{
+	"id", "timestamp", "source_ip", "source_port", "dest_ip", "dest_port", "dest_hostname",
+	"dest_rdns", "dest_asn", "dest_org", "dest_country", "dest_scope", "dest_k8s_namespace", "dest_k8s_pod", "dest_k8s_service",
+	"protocol", "app_protocol", "tls_server_name", "direction", "tcp_state", "service_name", "service_type", "database_type", "message_queue_type",
+	"host", "deployment_id", "environment", "region", "k8s_namespace", "k8s_pod", "k8s_deployment", "k8s_service", "k8s_node",
+	"container_id", "container_name", "container_image", "latency_ms", "duration_ms", "dns_latency_ms",
+	"bytes_sent", "bytes_received", "retry_count", "error", "tags", "metadata",
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvColumns); err != nil {
+		return nil, err
+	}
+	return &csvWriter{w: cw}, nil
+}
+
+func (w *csvWriter) Write(conn *models.Connection) error {
+	r, err := toRow(conn)
+	if err != nil {
+		return err
+	}
+
+	itoa := func(n int32) string { return strconv.Itoa(int(n)) }
+	ftoa := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+	return w.w.Write([]string{
+		r.ID, r.Timestamp.Format(time.RFC3339Nano), r.SourceIP, itoa(r.SourcePort), r.DestIP, itoa(r.DestPort), r.DestHostname,
+		r.DestReverseDNS, itoa(r.DestASN), r.DestOrg, r.DestCountry, r.DestScope, r.DestK8sNamespace, r.DestK8sPod, r.DestK8sService,
+		r.Protocol, r.AppProtocol, r.TLSServerName, r.Direction, r.TCPState, r.ServiceName, r.ServiceType, r.DatabaseType, r.MessageQueueType,
+		r.Host, r.DeploymentID, r.Environment, r.Region, r.K8sNamespace, r.K8sPod, r.K8sDeployment, r.K8sService, r.K8sNode,
+		r.ContainerID, r.ContainerName, r.ContainerImage, ftoa(r.Latency), ftoa(r.Duration), ftoa(r.DNSLatency),
+		strconv.FormatInt(r.BytesSent, 10), strconv.FormatInt(r.BytesReceived, 10), itoa(r.RetryCount), r.Error,
+		strings.Join(r.Tags, ";"), r.Metadata,
+	})
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
@@ -0,0 +1,360 @@
+// Package fingerprint identifies application protocols from the first bytes
+// exchanged on a flow, so services on non-standard ports are still classified.
+package fingerprint
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// Protocol is an application protocol recognised by the fingerprinter
+type Protocol string
+
+const (
+	ProtocolUnknown    Protocol = ""
+	ProtocolPostgreSQL Protocol = "postgresql"
+	ProtocolMySQL      Protocol = "mysql"
+	ProtocolMongoDB    Protocol = "mongodb"
+	ProtocolRedis      Protocol = "redis"
+	ProtocolAMQP       Protocol = "amqp"
+	ProtocolKafka      Protocol = "kafka"
+	ProtocolHTTP1      Protocol = "http/1.1"
+	ProtocolHTTP2      Protocol = "http/2"
+	ProtocolGRPC       Protocol = "grpc"
+	ProtocolTLS        Protocol = "tls"
+)
+
+// Result is the outcome of fingerprinting a flow
+type Result struct {
+	Protocol   Protocol `json:"protocol"`
+	ServerName string   `json:"server_name,omitempty"`
+	ALPN       []string `json:"alpn,omitempty"`
+}
+
+// Known reports whether a protocol was identified
+func (r Result) Known() bool {
+	return r.Protocol != ProtocolUnknown
+}
+
+var (
+	http2Preface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+	amqpHeader   = []byte("AMQP")
+	grpcLiteral  = []byte("application/grpc")
+	// HPACK Huffman encoding of the "application/grpc" prefix, as sent by
+	// most gRPC clients in the content-type header
+	grpcHuffman = []byte{0x1d, 0x75, 0xd0, 0x62, 0x0d, 0x26, 0x3d, 0x4c, 0x4d, 0x65}
+
+	httpMethods = [][]byte{
+		[]byte("GET "), []byte("POST "), []byte("PUT "), []byte("DELETE "),
+		[]byte("HEAD "), []byte("OPTIONS "), []byte("PATCH "), []byte("CONNECT "), []byte("TRACE "),
+	}
+)
+
+// Identify classifies a flow from the first bytes sent by the client and the
+// first bytes sent by the server. Either side may be empty.
+func Identify(client, server []byte) Result {
+	if len(client) > 0 {
+		if r, ok := identifyClient(client, server); ok {
+			return r
+		}
+	}
+	if len(server) > 0 {
+		if r, ok := identifyServer(server); ok {
+			return r
+		}
+	}
+	return Result{}
+}
+
+func identifyClient(client, server []byte) (Result, bool) {
+	switch {
+	case isTLSClientHello(client):
+		r := Result{Protocol: ProtocolTLS}
+		r.ServerName, r.ALPN = parseClientHello(client)
+		return r, true
+	case bytes.HasPrefix(client, http2Preface):
+		if isGRPC(client) || isGRPC(server) {
+			return Result{Protocol: ProtocolGRPC}, true
+		}
+		return Result{Protocol: ProtocolHTTP2}, true
+	case bytes.HasPrefix(client, amqpHeader):
+		return Result{Protocol: ProtocolAMQP}, true
+	case isHTTP1Request(client):
+		return Result{Protocol: ProtocolHTTP1}, true
+	case isPostgresStartup(client):
+		return Result{Protocol: ProtocolPostgreSQL}, true
+	case isMongoMessage(client):
+		return Result{Protocol: ProtocolMongoDB}, true
+	case isKafkaRequest(client):
+		return Result{Protocol: ProtocolKafka}, true
+	case isRedisCommand(client):
+		return Result{Protocol: ProtocolRedis}, true
+	}
+	return Result{}, false
+}
+
+func identifyServer(server []byte) (Result, bool) {
+	switch {
+	case isMySQLGreeting(server):
+		return Result{Protocol: ProtocolMySQL}, true
+	case bytes.HasPrefix(server, []byte("HTTP/1.")):
+		return Result{Protocol: ProtocolHTTP1}, true
+	case bytes.HasPrefix(server, amqpHeader):
+		// Broker rejecting our protocol header replies with its own
+		return Result{Protocol: ProtocolAMQP}, true
+	case isTLSServerHello(server):
+		return Result{Protocol: ProtocolTLS}, true
+	}
+	return Result{}, false
+}
+
+// Apply records the result on a connection. Protocols with a well-defined
+// service type override the port-based guess; bare TLS only fills gaps.
+func (r Result) Apply(conn *models.Connection) {
+	if !r.Known() {
+		return
+	}
+
+	conn.AppProtocol = string(r.Protocol)
+	if r.ServerName != "" {
+		conn.TLSServerName = r.ServerName
+	}
+
+	switch r.Protocol {
+	case ProtocolPostgreSQL:
+		setDatabase(conn, models.DatabaseTypePostgreSQL)
+	case ProtocolMySQL:
+		setDatabase(conn, models.DatabaseTypeMySQL)
+	case ProtocolMongoDB:
+		setDatabase(conn, models.DatabaseTypeMongoDB)
+	case ProtocolRedis:
+		setDatabase(conn, models.DatabaseTypeRedis)
+	case ProtocolAMQP:
+		setQueue(conn, models.MessageQueueTypeRabbitMQ)
+	case ProtocolKafka:
+		setQueue(conn, models.MessageQueueTypeKafka)
+	case ProtocolHTTP1, ProtocolHTTP2, ProtocolGRPC:
+		conn.ServiceType = models.ServiceTypeAPI
+		conn.DatabaseType = models.DatabaseTypeOther
+		conn.MessageQueueType = models.MessageQueueTypeOther
+	case ProtocolTLS:
+		if conn.ServiceType == "" || conn.ServiceType == models.ServiceTypeOther {
+			conn.ServiceType = models.ServiceTypeAPI
+		}
+	}
+}
+
+func setDatabase(conn *models.Connection, dbType models.DatabaseType) {
+	conn.ServiceType = models.ServiceTypeDatabase
+	conn.DatabaseType = dbType
+	conn.MessageQueueType = models.MessageQueueTypeOther
+}
+
+func setQueue(conn *models.Connection, queueType models.MessageQueueType) {
+	conn.ServiceType = models.ServiceTypeMessageQueue
+	conn.DatabaseType = models.DatabaseTypeOther
+	conn.MessageQueueType = queueType
+}
+
+func isHTTP1Request(b []byte) bool {
+	for _, m := range httpMethods {
+		if bytes.HasPrefix(b, m) {
+			line := b
+			if i := bytes.IndexByte(b, '\n'); i >= 0 {
+				line = b[:i]
+			}
+			// Accept truncated first lines, but reject anything that is
+			// clearly not an HTTP request line
+			return bytes.Contains(line, []byte(" HTTP/1.")) || bytes.IndexByte(b, '\n') < 0
+		}
+	}
+	return false
+}
+
+func isGRPC(b []byte) bool {
+	return bytes.Contains(b, grpcLiteral) || bytes.Contains(b, grpcHuffman)
+}
+
+func isPostgresStartup(b []byte) bool {
+	if len(b) < 8 {
+		return false
+	}
+	length := binary.BigEndian.Uint32(b[0:4])
+	code := binary.BigEndian.Uint32(b[4:8])
+	switch code {
+	case 80877103, 80877104, 80877102: // SSLRequest, GSSENCRequest, CancelRequest
+		return length == 8 || length == 16
+	case 196608: // protocol 3.0 StartupMessage
+		return length >= 8 && length < 10000
+	}
+	return false
+}
+
+func isMySQLGreeting(b []byte) bool {
+	// 3-byte length, sequence 0, protocol version 10, NUL-terminated version
+	if len(b) < 6 || b[3] != 0 || b[4] != 0x0a {
+		return false
+	}
+	length := int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+	if length < 20 || length > 1024 {
+		return false
+	}
+	end := bytes.IndexByte(b[5:], 0)
+	return end > 0 && end < 64
+}
+
+func isMongoMessage(b []byte) bool {
+	if len(b) < 16 {
+		return false
+	}
+	length := binary.LittleEndian.Uint32(b[0:4])
+	responseTo := binary.LittleEndian.Uint32(b[8:12])
+	opCode := binary.LittleEndian.Uint32(b[12:16])
+	if length < 16 || length > 48*1024*1024 || responseTo != 0 {
+		return false
+	}
+	switch opCode {
+	case 2004, 2012, 2013: // OP_QUERY, OP_COMPRESSED, OP_MSG
+		return true
+	}
+	return false
+}
+
+func isKafkaRequest(b []byte) bool {
+	// size, api_key, api_version, correlation_id, client_id
+	if len(b) < 14 {
+		return false
+	}
+	size := binary.BigEndian.Uint32(b[0:4])
+	apiKey := binary.BigEndian.Uint16(b[4:6])
+	apiVersion := binary.BigEndian.Uint16(b[6:8])
+	clientIDLen := int(int16(binary.BigEndian.Uint16(b[12:14])))
+	if size < 10 || size > 100*1024*1024 || apiKey > 80 || apiVersion > 20 {
+		return false
+	}
+	if clientIDLen == -1 {
+		return true
+	}
+	if clientIDLen < 0 || clientIDLen > 256 || 14+clientIDLen > int(size)+4 {
+		return false
+	}
+	end := 14 + clientIDLen
+	if end > len(b) {
+		end = len(b)
+	}
+	for _, c := range b[14:end] {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func isRedisCommand(b []byte) bool {
+	if len(b) >= 4 && b[0] == '*' {
+		i := 1
+		for i < len(b) && b[i] >= '0' && b[i] <= '9' {
+			i++
+		}
+		return i > 1 && bytes.HasPrefix(b[i:], []byte("\r\n$"))
+	}
+	for _, cmd := range []string{"PING", "HELLO ", "AUTH "} {
+		if bytes.HasPrefix(bytes.ToUpper(b), []byte(cmd)) && bytes.Contains(b, []byte("\r\n")) {
+			return true
+		}
+	}
+	return false
+}
+
+func isTLSClientHello(b []byte) bool {
+	return len(b) >= 6 && b[0] == 0x16 && b[1] == 0x03 && b[2] <= 0x04 && b[5] == 0x01
+}
+
+func isTLSServerHello(b []byte) bool {
+	return len(b) >= 6 && b[0] == 0x16 && b[1] == 0x03 && b[2] <= 0x04 && b[5] == 0x02
+}
+
+// parseClientHello extracts the SNI host name and ALPN protocols from a TLS
+// ClientHello record. Truncated records yield whatever was parsed so far.
+func parseClientHello(b []byte) (serverName string, alpn []string) {
+	// record header (5) + handshake header (4) + version (2) + random (32)
+	p := b[5:]
+	if len(p) < 38 {
+		return "", nil
+	}
+	p = p[38:]
+
+	// session id
+	if len(p) < 1 || len(p) < 1+int(p[0]) {
+		return "", nil
+	}
+	p = p[1+int(p[0]):]
+
+	// cipher suites
+	if len(p) < 2 {
+		return "", nil
+	}
+	n := int(binary.BigEndian.Uint16(p))
+	if len(p) < 2+n {
+		return "", nil
+	}
+	p = p[2+n:]
+
+	// compression methods
+	if len(p) < 1 || len(p) < 1+int(p[0]) {
+		return "", nil
+	}
+	p = p[1+int(p[0]):]
+
+	// extensions
+	if len(p) < 2 {
+		return "", nil
+	}
+	p = p[2:]
+	for len(p) >= 4 {
+		extType := binary.BigEndian.Uint16(p[0:2])
+		extLen := int(binary.BigEndian.Uint16(p[2:4]))
+		if len(p) < 4+extLen {
+			break
+		}
+		ext := p[4 : 4+extLen]
+		p = p[4+extLen:]
+
+		switch extType {
+		case 0: // server_name
+			if len(ext) < 5 {
+				continue
+			}
+			list := ext[2:]
+			for len(list) >= 3 {
+				nameType := list[0]
+				nameLen := int(binary.BigEndian.Uint16(list[1:3]))
+				if len(list) < 3+nameLen {
+					break
+				}
+				if nameType == 0 {
+					serverName = string(list[3 : 3+nameLen])
+					break
+				}
+				list = list[3+nameLen:]
+			}
+		case 16: // application_layer_protocol_negotiation
+			if len(ext) < 2 {
+				continue
+			}
+			list := ext[2:]
+			for len(list) >= 1 {
+				l := int(list[0])
+				if len(list) < 1+l {
+					break
+				}
+				alpn = append(alpn, string(list[1:1+l]))
+				list = list[1+l:]
+			}
+		}
+	}
+
+	return serverName, alpn
+}
@@ -0,0 +1,73 @@
+package fingerprint
+
+import (
+	"testing"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/capture"
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+//go:generate go run testdata/gen.go
+
+// TestSnifferFixtures replays recorded connections whose servers listen on
+// ports the port table does not know, so only their first bytes classify them
+func TestSnifferFixtures(t *testing.T) {
+	for i, tc := range []struct {
+		file        string
+		serverPort  int
+		protocol    Protocol
+		serviceType models.ServiceType
+		database    models.DatabaseType
+		queue       models.MessageQueueType
+		serverName  string
+	}{
+		{"postgresql", 6543, ProtocolPostgreSQL, models.ServiceTypeDatabase, models.DatabaseTypePostgreSQL, models.MessageQueueTypeOther, ""},
+		{"mysql", 13306, ProtocolMySQL, models.ServiceTypeDatabase, models.DatabaseTypeMySQL, models.MessageQueueTypeOther, ""},
+		{"mongodb", 27018, ProtocolMongoDB, models.ServiceTypeDatabase, models.DatabaseTypeMongoDB, models.MessageQueueTypeOther, ""},
+		{"redis", 6380, ProtocolRedis, models.ServiceTypeDatabase, models.DatabaseTypeRedis, models.MessageQueueTypeOther, ""},
+		{"amqp", 5673, ProtocolAMQP, models.ServiceTypeMessageQueue, models.DatabaseTypeOther, models.MessageQueueTypeRabbitMQ, ""},
+		{"kafka", 19092, ProtocolKafka, models.ServiceTypeMessageQueue, models.DatabaseTypeOther, models.MessageQueueTypeKafka, ""},
+		{"http1", 8081, ProtocolHTTP1, models.ServiceTypeAPI, models.DatabaseTypeOther, models.MessageQueueTypeOther, ""},
+		{"http2", 8082, ProtocolHTTP2, models.ServiceTypeAPI, models.DatabaseTypeOther, models.MessageQueueTypeOther, ""},
+		{"grpc", 50051, ProtocolGRPC, models.ServiceTypeAPI, models.DatabaseTypeOther, models.MessageQueueTypeOther, ""},
+		{"tls", 8443, ProtocolTLS, models.ServiceTypeAPI, "", "", "db.internal.example"},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			source, err := capture.OpenPcapFile("testdata/" + tc.file + ".pcap")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sniffer := NewSniffer(source)
+			defer sniffer.Close()
+			if err := sniffer.Run(); err != nil {
+				t.Fatal(err)
+			}
+
+			conn := &models.Connection{
+				SourceIP:    "10.1.0.10",
+				SourcePort:  40000 + i,
+				DestIP:      "10.1.0.20",
+				DestPort:    tc.serverPort,
+				ServiceType: models.ServiceTypeOther,
+			}
+			if !sniffer.Classify(conn) {
+				t.Fatal("connection was not classified")
+			}
+			if conn.AppProtocol != string(tc.protocol) {
+				t.Errorf("AppProtocol = %q, want %q", conn.AppProtocol, tc.protocol)
+			}
+			if conn.ServiceType != tc.serviceType {
+				t.Errorf("ServiceType = %q, want %q", conn.ServiceType, tc.serviceType)
+			}
+			if conn.DatabaseType != tc.database {
+				t.Errorf("DatabaseType = %q, want %q", conn.DatabaseType, tc.database)
+			}
+			if conn.MessageQueueType != tc.queue {
+				t.Errorf("MessageQueueType = %q, want %q", conn.MessageQueueType, tc.queue)
+			}
+			if conn.TLSServerName != tc.serverName {
+				t.Errorf("TLSServerName = %q, want %q", conn.TLSServerName, tc.serverName)
+			}
+		})
+	}
+}
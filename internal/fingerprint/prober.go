@@ -0,0 +1,174 @@
+package fingerprint
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+const (
+	// probeWorkers dial destinations concurrently, off the monitor loop
+	probeWorkers = 4
+	// probeQueue bounds the destinations waiting for a worker; more are
+	// dropped and queued again when next seen
+	probeQueue = 256
+	// maxProbeEntries bounds the cached results
+	maxProbeEntries = 10000
+	// probeFailureTTL is how long an unreachable destination is left alone
+	probeFailureTTL = time.Minute
+)
+
+// Prober actively identifies server-first protocols (MySQL greetings, AMQP
+// and HTTP servers that answer unprompted) by connecting to the destination
+// and reading what it sends. It never writes to the peer, so probing an
+// unknown service is side-effect free. Results, including failed dials, are
+// cached per endpoint.
+type Prober struct {
+	Timeout time.Duration
+
+	queue chan string
+	stop  chan struct{}
+
+	mu      sync.Mutex
+	cache   map[string]probeEntry
+	pending map[string]bool // queued or being probed
+}
+
+type probeEntry struct {
+	result  Result
+	failed  bool
+	expires time.Time
+}
+
+// NewProber creates a prober with the given dial/read timeout and starts
+// its workers
+func NewProber(timeout time.Duration) *Prober {
+	p := &Prober{
+		Timeout: timeout,
+		queue:   make(chan string, probeQueue),
+		stop:    make(chan struct{}),
+		cache:   make(map[string]probeEntry),
+		pending: make(map[string]bool),
+	}
+	for i := 0; i < probeWorkers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// Close stops the workers
+func (p *Prober) Close() {
+	close(p.stop)
+}
+
+func (p *Prober) work() {
+	for {
+		select {
+		case addr := <-p.queue:
+			p.Probe(addr)
+			p.mu.Lock()
+			delete(p.pending, addr)
+			p.mu.Unlock()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Probe connects to addr and fingerprints the server greeting, if any
+func (p *Prober) Probe(addr string) (Result, error) {
+	p.mu.Lock()
+	entry, ok := p.lookup(addr, time.Now())
+	p.mu.Unlock()
+	if ok {
+		if entry.failed {
+			return Result{}, fmt.Errorf("failed to connect to %s recently", addr)
+		}
+		return entry.result, nil
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, p.Timeout)
+	if err != nil {
+		p.store(addr, probeEntry{failed: true, expires: time.Now().Add(probeFailureTTL)})
+		return Result{}, fmt.Errorf("failed to connect to %s: %v", addr, err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(p.Timeout))
+	buf := make([]byte, sniffBytes)
+	n, _ := conn.Read(buf)
+
+	result := Identify(nil, buf[:n])
+	p.store(addr, probeEntry{result: result, expires: time.Now().Add(flowTTL)})
+	return result, nil
+}
+
+// lookup returns the unexpired entry for addr; the caller holds p.mu
+func (p *Prober) lookup(addr string, now time.Time) (probeEntry, bool) {
+	entry, ok := p.cache[addr]
+	if !ok {
+		return probeEntry{}, false
+	}
+	if !now.Before(entry.expires) {
+		delete(p.cache, addr)
+		return probeEntry{}, false
+	}
+	return entry, true
+}
+
+// store caches an entry. A full cache first drops expired entries, then
+// those closest to expiring.
+func (p *Prober) store(addr string, entry probeEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.cache[addr]; !ok && len(p.cache) >= maxProbeEntries {
+		now := time.Now()
+		for key, e := range p.cache {
+			if !now.Before(e.expires) {
+				delete(p.cache, key)
+			}
+		}
+		for len(p.cache) >= maxProbeEntries {
+			var oldest string
+			for key, e := range p.cache {
+				if oldest == "" || e.expires.Before(p.cache[oldest].expires) {
+					oldest = key
+				}
+			}
+			delete(p.cache, oldest)
+		}
+	}
+	p.cache[addr] = entry
+}
+
+// Classify applies the cached probe result for the connection's destination,
+// reporting whether the protocol was identified. Destinations not probed yet
+// are queued for the workers and classified when next seen. Only
+// destinations the port table could not classify are probed.
+func (p *Prober) Classify(conn *models.Connection) bool {
+	if conn.ServiceType != "" && conn.ServiceType != models.ServiceTypeOther {
+		return false
+	}
+	addr := net.JoinHostPort(conn.DestIP, fmt.Sprint(conn.DestPort))
+
+	p.mu.Lock()
+	entry, ok := p.lookup(addr, time.Now())
+	if !ok && !p.pending[addr] {
+		select {
+		case p.queue <- addr:
+			p.pending[addr] = true
+		default:
+		}
+	}
+	p.mu.Unlock()
+
+	if !ok || entry.failed || !entry.result.Known() {
+		return false
+	}
+	entry.result.Apply(conn)
+	return true
+}
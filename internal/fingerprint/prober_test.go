@@ -0,0 +1,87 @@
+package fingerprint
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+func TestProberClassifiesInBackground(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	greeting := []byte("\x4a\x00\x00\x00\x0a8.0.36\x00\x0b\x00\x00\x00abcdefgh\x00\xff\xff\xff\x02\x00\xff\xdf\x15" +
+		"\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00ijklmnopqrst\x00caching_sha2_password\x00")
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Write(greeting)
+			c.Close()
+		}
+	}()
+
+	p := NewProber(time.Second)
+	defer p.Close()
+	addr := ln.Addr().(*net.TCPAddr)
+	newConn := func() *models.Connection {
+		return &models.Connection{DestIP: "127.0.0.1", DestPort: addr.Port, ServiceType: models.ServiceTypeOther}
+	}
+
+	if p.Classify(newConn()) {
+		t.Fatal("first sighting was classified before the probe ran")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn := newConn()
+		if p.Classify(conn) {
+			if conn.DatabaseType != models.DatabaseTypeMySQL {
+				t.Errorf("DatabaseType = %q, want mysql", conn.DatabaseType)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("destination was never classified")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProberCachesFailures(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	p := NewProber(time.Second)
+	defer p.Close()
+	if _, err := p.Probe(addr); err == nil {
+		t.Fatal("probing a closed port succeeded")
+	}
+	_, err = p.Probe(addr)
+	if err == nil || !strings.Contains(err.Error(), "recently") {
+		t.Fatalf("second probe was not answered from the cache: %v", err)
+	}
+}
+
+func TestProberCacheIsBounded(t *testing.T) {
+	p := NewProber(time.Second)
+	defer p.Close()
+	expires := time.Now().Add(time.Hour)
+	for i := 0; i < maxProbeEntries+10; i++ {
+		p.store(fmt.Sprintf("10.0.0.1:%d", i), probeEntry{expires: expires.Add(time.Duration(i))})
+	}
+	if len(p.cache) != maxProbeEntries {
+		t.Fatalf("cache holds %d entries, want %d", len(p.cache), maxProbeEntries)
+	}
+}
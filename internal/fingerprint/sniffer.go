@@ -0,0 +1,198 @@
+package fingerprint
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/capture"
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+const (
+	// sniffBytes is how much of each direction is buffered before identifying
+	sniffBytes = 512
+	// flowTTL bounds how long idle flows and results are remembered
+	flowTTL = 10 * time.Minute
+)
+
+type sniffFlow struct {
+	client     string // "ip:port" of the side that opened the flow
+	toServer   []byte
+	toClient   []byte
+	lastSeen   time.Time
+	identified bool
+}
+
+// Sniffer passively fingerprints TCP flows read from a capture source and
+// remembers the result for each client/server address pair
+type Sniffer struct {
+	source capture.Source
+
+	mu        sync.Mutex
+	flows     map[string]*sniffFlow
+	results   map[string]sniffResult
+	lastSweep time.Time
+}
+
+type sniffResult struct {
+	Result
+	seen time.Time
+}
+
+// NewSniffer creates a sniffer reading from the given source. The source may
+// be nil when packets are fed through Observe by another reader.
+func NewSniffer(source capture.Source) *Sniffer {
+	return &Sniffer{
+		source:  source,
+		flows:   make(map[string]*sniffFlow),
+		results: make(map[string]sniffResult),
+	}
+}
+
+// Run consumes packets until the source is exhausted or closed
+func (s *Sniffer) Run() error {
+	for {
+		pkt, err := s.source.ReadPacket()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		s.Observe(pkt)
+	}
+}
+
+// Close stops the sniffer by closing its source
+func (s *Sniffer) Close() error {
+	if s.source == nil {
+		return nil
+	}
+	return s.source.Close()
+}
+
+// Observe feeds a single packet to the sniffer
+func (s *Sniffer) Observe(pkt *capture.Packet) {
+	if pkt.Protocol != "TCP" {
+		return
+	}
+
+	src := fmt.Sprintf("%s:%d", pkt.SrcIP, pkt.SrcPort)
+	dst := fmt.Sprintf("%s:%d", pkt.DstIP, pkt.DstPort)
+	key := flowKey(src, dst)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if pkt.Timestamp.Sub(s.lastSweep) > time.Minute {
+		s.expire(pkt.Timestamp)
+		s.lastSweep = pkt.Timestamp
+	}
+
+	flow, ok := s.flows[key]
+	if !ok {
+		if len(pkt.Payload) == 0 && !pkt.HasFlag(capture.FlagSYN) {
+			return
+		}
+		flow = &sniffFlow{client: guessClient(pkt, src, dst)}
+		s.flows[key] = flow
+	}
+	flow.lastSeen = pkt.Timestamp
+
+	if flow.identified || len(pkt.Payload) == 0 {
+		return
+	}
+
+	if src == flow.client {
+		flow.toServer = appendCapped(flow.toServer, pkt.Payload)
+	} else {
+		flow.toClient = appendCapped(flow.toClient, pkt.Payload)
+	}
+
+	result := Identify(flow.toServer, flow.toClient)
+	full := len(flow.toServer) >= sniffBytes || len(flow.toClient) >= sniffBytes
+	if result.Known() || full {
+		flow.identified = true
+		flow.toServer, flow.toClient = nil, nil
+		if result.Known() {
+			server := dst
+			if src != flow.client {
+				server = src
+			}
+			s.results[flow.client+"-"+server] = sniffResult{Result: result, seen: pkt.Timestamp}
+		}
+	}
+}
+
+// Lookup returns the fingerprint recorded for a client/server address pair
+func (s *Sniffer) Lookup(srcIP string, srcPort int, dstIP string, dstPort int) (Result, bool) {
+	key := fmt.Sprintf("%s:%d-%s:%d", srcIP, srcPort, dstIP, dstPort)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.results[key]
+	return r.Result, ok
+}
+
+// Classify applies a recorded fingerprint to the connection, reporting
+// whether one was found
+func (s *Sniffer) Classify(conn *models.Connection) bool {
+	result, ok := s.Lookup(conn.SourceIP, conn.SourcePort, conn.DestIP, conn.DestPort)
+	if !ok {
+		return false
+	}
+	result.Apply(conn)
+	return true
+}
+
+// expire drops idle flows and stale results; the caller holds s.mu
+func (s *Sniffer) expire(now time.Time) {
+	for key, flow := range s.flows {
+		if now.Sub(flow.lastSeen) > flowTTL {
+			delete(s.flows, key)
+		}
+	}
+	for key, r := range s.results {
+		if now.Sub(r.seen) > flowTTL {
+			delete(s.results, key)
+		}
+	}
+}
+
+// flowKey returns a direction-independent key for an address pair
+func flowKey(a, b string) string {
+	if a < b {
+		return a + "-" + b
+	}
+	return b + "-" + a
+}
+
+// guessClient picks the side that opened the flow. A bare SYN identifies the
+// client; otherwise the higher (ephemeral) port is assumed to be the client.
+func guessClient(pkt *capture.Packet, src, dst string) string {
+	if pkt.HasFlag(capture.FlagSYN) {
+		if pkt.HasFlag(capture.FlagACK) {
+			return dst
+		}
+		return src
+	}
+	if pkt.SrcPort >= pkt.DstPort {
+		return src
+	}
+	return dst
+}
+
+func appendCapped(buf, data []byte) []byte {
+	room := sniffBytes - len(buf)
+	if room <= 0 {
+		return buf
+	}
+	if len(data) > room {
+		data = data[:room]
+	}
+	return append(buf, data...)
+}
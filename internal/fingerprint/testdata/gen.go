@@ -0,0 +1,178 @@
+//go:build ignore
+
+// gen writes the pcap fixtures for fingerprint_test.go: one connection per
+// protocol carrying the first bytes its clients and servers send. Run it
+// from the package directory with go generate.
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/capture/capturetest"
+)
+
+var base = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+type fixture struct {
+	name       string
+	serverPort int
+	client     []byte // first bytes from the client, if it speaks first
+	server     []byte // first bytes from the server, if it speaks first
+}
+
+func main() {
+	fixtures := []fixture{
+		{"postgresql", 6543, postgresStartup(), nil},
+		{"mysql", 13306, nil, mysqlGreeting()},
+		{"mongodb", 27018, mongoHello(), nil},
+		{"redis", 6380, []byte("*1\r\n$4\r\nPING\r\n"), nil},
+		{"amqp", 5673, []byte("AMQP\x00\x00\x09\x01"), nil},
+		{"kafka", 19092, kafkaAPIVersions(), nil},
+		{"http1", 8081, []byte("GET /healthz HTTP/1.1\r\nHost: api.internal:8081\r\nUser-Agent: curl/8.5.0\r\nAccept: */*\r\n\r\n"), nil},
+		{"http2", 8082, http2Preface(nil), nil},
+		{"grpc", 50051, http2Preface(grpcHeaders()), nil},
+		{"tls", 8443, tlsClientHello("db.internal.example"), nil},
+	}
+
+	for i, f := range fixtures {
+		w, err := capturetest.Create("testdata/" + f.name + ".pcap")
+		if err != nil {
+			log.Fatal(err)
+		}
+		c := w.Conn(base, "10.1.0.10", 40000+i, "10.1.0.20", f.serverPort)
+		must(c.Handshake(300 * time.Microsecond))
+		if f.server != nil {
+			must(c.Reply(100*time.Microsecond, f.server))
+		}
+		if f.client != nil {
+			must(c.Send(100*time.Microsecond, f.client))
+		}
+		must(c.Close(time.Millisecond))
+		must(w.Close())
+	}
+}
+
+func must(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func postgresStartup() []byte {
+	body := []byte("user\x00app\x00database\x00orders\x00application_name\x00psql\x00\x00")
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b[0:4], uint32(8+len(body)))
+	binary.BigEndian.PutUint32(b[4:8], 196608)
+	return append(b, body...)
+}
+
+func mysqlGreeting() []byte {
+	var p bytes.Buffer
+	p.WriteByte(0x0a)
+	p.WriteString("8.0.36\x00")
+	p.Write([]byte{0x0b, 0, 0, 0})                                  // connection id
+	p.WriteString("abcdefgh\x00")                                   // auth data part 1 and filler
+	p.Write([]byte{0xff, 0xff, 0xff, 0x02, 0x00, 0xff, 0xdf, 0x15}) // capabilities, charset, status
+	p.Write(make([]byte, 10))
+	p.WriteString("ijklmnopqrst\x00")
+	p.WriteString("caching_sha2_password\x00")
+	n := p.Len()
+	return append([]byte{byte(n), byte(n >> 8), byte(n >> 16), 0}, p.Bytes()...)
+}
+
+func mongoHello() []byte {
+	// {hello: 1, $db: "admin"}
+	var doc bytes.Buffer
+	doc.Write([]byte{0x10})
+	doc.WriteString("hello\x00")
+	doc.Write([]byte{1, 0, 0, 0})
+	doc.Write([]byte{0x02})
+	doc.WriteString("$db\x00")
+	doc.Write([]byte{6, 0, 0, 0})
+	doc.WriteString("admin\x00")
+	doc.WriteByte(0)
+	bson := make([]byte, 4, 4+doc.Len())
+	binary.LittleEndian.PutUint32(bson, uint32(4+doc.Len()))
+	bson = append(bson, doc.Bytes()...)
+
+	msg := make([]byte, 16, 16+5+len(bson))
+	msg = append(msg, 0, 0, 0, 0, 0) // flag bits, body section
+	msg = append(msg, bson...)
+	binary.LittleEndian.PutUint32(msg[0:4], uint32(len(msg)))
+	binary.LittleEndian.PutUint32(msg[4:8], 1)
+	binary.LittleEndian.PutUint32(msg[12:16], 2013) // OP_MSG
+	return msg
+}
+
+func kafkaAPIVersions() []byte {
+	clientID := "rdkafka"
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint16(18)) // ApiVersions
+	binary.Write(&b, binary.BigEndian, uint16(3))
+	binary.Write(&b, binary.BigEndian, uint32(1)) // correlation id
+	binary.Write(&b, binary.BigEndian, uint16(len(clientID)))
+	b.WriteString(clientID)
+	b.WriteByte(0) // tagged fields
+	b.Write([]byte{byte(len("librdkafka") + 1)})
+	b.WriteString("librdkafka")
+	b.Write([]byte{byte(len("2.3.0") + 1)})
+	b.WriteString("2.3.0")
+	b.WriteByte(0)
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(b.Len()))
+	return append(size, b.Bytes()...)
+}
+
+// http2Preface is the client connection preface and an empty SETTINGS
+// frame, followed by a HEADERS frame when one is given
+func http2Preface(headers []byte) []byte {
+	b := []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+	b = append(b, 0, 0, 0, 0x04, 0, 0, 0, 0, 0)
+	if headers != nil {
+		n := len(headers)
+		b = append(b, byte(n>>16), byte(n>>8), byte(n), 0x01, 0x04, 0, 0, 0, 1)
+		b = append(b, headers...)
+	}
+	return b
+}
+
+// grpcHeaders is an HPACK block for a unary gRPC call, with every value
+// sent as a literal without indexing
+func grpcHeaders() []byte {
+	b := []byte{0x83, 0x86} // :method POST, :scheme http
+	indexed := func(index byte, value string) {
+		b = append(b, index, byte(len(value)))
+		b = append(b, value...)
+	}
+	indexed(0x04, "/orders.Orders/Get") // :path
+	indexed(0x01, "orders:50051")       // :authority
+	indexed(0x0f, "application/grpc")   // content-type
+	b = append(b, 0x00, byte(len("te")))
+	b = append(b, "te"...)
+	b = append(b, byte(len("trailers")))
+	b = append(b, "trailers"...)
+	return b
+}
+
+// tlsClientHello returns the ClientHello crypto/tls sends for a server name
+func tlsClientHello(serverName string) []byte {
+	client, server := net.Pipe()
+	go tls.Client(client, &tls.Config{ServerName: serverName, NextProtos: []string{"h2", "http/1.1"}}).Handshake()
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(server, header); err != nil {
+		log.Fatal(err)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(header[3:5]))
+	if _, err := io.ReadFull(server, body); err != nil {
+		log.Fatal(err)
+	}
+	server.Close()
+	return append(header, body...)
+}
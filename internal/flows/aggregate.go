@@ -0,0 +1,153 @@
+// Package flows rolls connections up into per-interval flow summaries, one
+// per process and destination, for collectors that report summaries
+// instead of every connection, and reads stats and service edges back out
+// of stored summaries.
+package flows
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// DefaultInterval is how long connections are counted together before a
+// collector reports them
+const DefaultInterval = time.Minute
+
+type flowKey struct {
+	start       time.Time
+	process     string
+	destIP      string
+	destPort    int
+	serviceType models.ServiceType
+}
+
+type flow struct {
+	summary *models.FlowSummary
+	// sockets holds what was last counted for each socket, since sources
+	// report an open socket again on every poll
+	sockets map[string]*socket
+}
+
+type socket struct {
+	sent, received int64
+	err            string
+}
+
+// Aggregator counts connections per process and destination over fixed
+// intervals. It is safe for concurrent use.
+type Aggregator struct {
+	interval time.Duration
+
+	mu    sync.Mutex
+	flows map[flowKey]*flow
+}
+
+// NewAggregator creates an aggregator counting connections over interval
+func NewAggregator(interval time.Duration) *Aggregator {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Aggregator{
+		interval: interval,
+		flows:    make(map[flowKey]*flow),
+	}
+}
+
+// Process names the process a connection came from: the owning process
+// when the source knew it, or else the container
+func Process(conn *models.Connection) string {
+	if name, ok := conn.Metadata["process"].(string); ok && name != "" {
+		return name
+	}
+	return conn.ContainerName
+}
+
+// Add counts a connection. A socket seen again in the same interval is
+// counted once, with its latest byte counters and its first latency.
+func (a *Aggregator) Add(conn *models.Connection) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := flowKey{conn.Timestamp.Truncate(a.interval), Process(conn), conn.DestIP, conn.DestPort, conn.ServiceType}
+	f, ok := a.flows[key]
+	if !ok {
+		f = &flow{
+			summary: &models.FlowSummary{
+				Timestamp:        key.start,
+				Interval:         a.interval.Seconds(),
+				Host:             conn.Host,
+				Environment:      conn.Environment,
+				ServiceName:      conn.ServiceName,
+				DeploymentID:     conn.DeploymentID,
+				Region:           conn.Region,
+				Process:          key.process,
+				DestIP:           conn.DestIP,
+				DestPort:         conn.DestPort,
+				ServiceType:      conn.ServiceType,
+				DatabaseType:     conn.DatabaseType,
+				MessageQueueType: conn.MessageQueueType,
+				LatencyBuckets:   make([]int64, len(models.FlowLatencyBounds)+1),
+			},
+			sockets: make(map[string]*socket),
+		}
+		a.flows[key] = f
+	}
+	sum := f.summary
+
+	// Failed connects may not have a source port to tell them apart
+	id := fmt.Sprintf("%s:%d", conn.SourceIP, conn.SourcePort)
+	if conn.SourcePort == 0 {
+		id = conn.ID
+	}
+	s, seen := f.sockets[id]
+	if !seen {
+		s = &socket{}
+		f.sockets[id] = s
+		sum.Connections++
+		if conn.Latency > 0 {
+			sum.LatencyCount++
+			sum.LatencySum += conn.Latency
+			if conn.Latency > sum.LatencyMax {
+				sum.LatencyMax = conn.Latency
+			}
+			sum.LatencyBuckets[sort.SearchFloat64s(models.FlowLatencyBounds, conn.Latency)]++
+		}
+	}
+
+	if conn.BytesSent > s.sent {
+		sum.BytesSent += conn.BytesSent - s.sent
+		s.sent = conn.BytesSent
+	}
+	if conn.BytesReceived > s.received {
+		sum.BytesReceived += conn.BytesReceived - s.received
+		s.received = conn.BytesReceived
+	}
+	if conn.Error != "" && s.err == "" {
+		s.err = conn.Error
+		if sum.Errors == nil {
+			sum.Errors = make(map[string]int64)
+		}
+		sum.Errors[conn.Error]++
+	}
+}
+
+// Flush removes and returns the summaries of intervals that ended by now,
+// oldest first
+func (a *Aggregator) Flush(now time.Time) []*models.FlowSummary {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var done []*models.FlowSummary
+	for key, f := range a.flows {
+		if !key.start.Add(a.interval).After(now) {
+			done = append(done, f.summary)
+			delete(a.flows, key)
+		}
+	}
+	sort.Slice(done, func(i, j int) bool { return done[i].Timestamp.Before(done[j].Timestamp) })
+	return done
+}
@@ -0,0 +1,180 @@
+package flows
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+type edgeKey struct {
+	service     string
+	environment string
+	process     string
+	destination string
+	serviceType models.ServiceType
+}
+
+type edge struct {
+	summary    *models.FlowEdge
+	latencies  int64
+	latencySum float64
+	latencyMax float64
+	buckets    []int64
+}
+
+// Edges rolls summaries up into one edge per service, process and
+// destination, busiest first
+func Edges(flows []*models.FlowSummary) []*models.FlowEdge {
+	byKey := make(map[edgeKey]*edge)
+	var order []*edge
+	for _, f := range flows {
+		key := edgeKey{f.ServiceName, f.Environment, f.Process, Destination(f), f.ServiceType}
+		e, ok := byKey[key]
+		if !ok {
+			e = &edge{
+				summary: &models.FlowEdge{
+					ServiceName: f.ServiceName,
+					Environment: f.Environment,
+					Process:     f.Process,
+					Destination: key.destination,
+					ServiceType: f.ServiceType,
+				},
+				buckets: make([]int64, len(models.FlowLatencyBounds)+1),
+			}
+			byKey[key] = e
+			order = append(order, e)
+		}
+
+		sum := e.summary
+		if f.Timestamp.After(sum.LastSeen) {
+			sum.LastSeen = f.Timestamp
+		}
+		sum.Connections += f.Connections
+		sum.ErrorCount += f.ErrorCount()
+		sum.BytesSent += f.BytesSent
+		sum.BytesReceived += f.BytesReceived
+		e.latencies += f.LatencyCount
+		e.latencySum += f.LatencySum
+		if f.LatencyMax > e.latencyMax {
+			e.latencyMax = f.LatencyMax
+		}
+		for i := 0; i < len(e.buckets) && i < len(f.LatencyBuckets); i++ {
+			e.buckets[i] += f.LatencyBuckets[i]
+		}
+	}
+
+	edges := make([]*models.FlowEdge, 0, len(order))
+	for _, e := range order {
+		sum := e.summary
+		if sum.Connections > 0 {
+			sum.ErrorRate = float64(sum.ErrorCount) / float64(sum.Connections)
+		}
+		if e.latencies > 0 {
+			sum.AvgLatency = e.latencySum / float64(e.latencies)
+		}
+		sum.P95Latency = Percentile(e.buckets, 0.95, e.latencyMax)
+		edges = append(edges, sum)
+	}
+	sort.SliceStable(edges, func(i, j int) bool { return edges[i].Connections > edges[j].Connections })
+	return edges
+}
+
+// Destination names where a summary's connections went
+func Destination(f *models.FlowSummary) string {
+	return net.JoinHostPort(f.DestIP, strconv.Itoa(f.DestPort))
+}
+
+// Percentile estimates the p-th quantile, 0 to 1, of a latency histogram
+// over models.FlowLatencyBounds, interpolating within the bucket it falls
+// in. The open-ended last bucket reaches to max.
+func Percentile(buckets []int64, p float64, max float64) float64 {
+	var total int64
+	for _, n := range buckets {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := p * float64(total)
+	var seen int64
+	for i, n := range buckets {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = models.FlowLatencyBounds[i-1]
+		}
+		upper := max
+		if i < len(models.FlowLatencyBounds) && models.FlowLatencyBounds[i] < max {
+			upper = models.FlowLatencyBounds[i]
+		}
+		if upper < lower {
+			return lower
+		}
+		return lower + (upper-lower)*(rank-float64(seen))/float64(n)
+	}
+	return max
+}
+
+// MergeStats adds summaries into stats computed from stored connections,
+// so that hosts reporting summaries count alongside those reporting every
+// connection. Failed connections also count toward hourly error trends.
+func MergeStats(stats *models.ConnectionStats, flows []*models.FlowSummary) {
+	if len(flows) == 0 {
+		return
+	}
+
+	// Stored connections contribute their average latency over every
+	// connection; weight it back up before adding summarized latencies
+	latencySum := stats.AvgLatency * float64(stats.TotalConnections)
+	latencies := stats.TotalConnections
+	trends := make(map[time.Time]map[string]int64)
+	for _, f := range flows {
+		stats.TotalConnections += f.Connections
+		stats.TotalBytesSent += f.BytesSent
+		stats.TotalBytesReceived += f.BytesReceived
+		latencySum += f.LatencySum
+		latencies += f.LatencyCount
+
+		errors := f.ErrorCount()
+		// Stored connections without an error are counted under ""
+		if ok := f.Connections - errors; ok > 0 {
+			stats.ErrorCounts[""] += ok
+		}
+		for code, n := range f.Errors {
+			stats.ErrorCounts[code] += n
+			at := f.Timestamp.Truncate(time.Hour)
+			if trends[at] == nil {
+				trends[at] = make(map[string]int64)
+			}
+			trends[at][code] += n
+		}
+
+		n := int(f.Connections)
+		stats.ServiceTypeStats[f.ServiceType] += n
+		switch f.ServiceType {
+		case models.ServiceTypeDatabase:
+			stats.DatabaseStats[f.DatabaseType] += n
+		case models.ServiceTypeMessageQueue:
+			stats.QueueStats[f.MessageQueueType] += n
+		}
+	}
+	if latencies > 0 {
+		stats.AvgLatency = latencySum / float64(latencies)
+	}
+
+	for at, codes := range trends {
+		for code, n := range codes {
+			stats.ErrorTrends = append(stats.ErrorTrends, models.ErrorTrend{Timestamp: at, ErrorType: code, Count: n})
+		}
+	}
+	sort.SliceStable(stats.ErrorTrends, func(i, j int) bool {
+		return stats.ErrorTrends[i].Timestamp.Before(stats.ErrorTrends[j].Timestamp)
+	})
+}
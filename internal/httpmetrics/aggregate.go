@@ -0,0 +1,119 @@
+package httpmetrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// DefaultInterval is how long requests are counted together before a
+// collector reports them
+const DefaultInterval = time.Minute
+
+// maxRoutes bounds the routes tracked per destination; requests to further
+// routes are counted under otherRoute
+const maxRoutes = 200
+
+const otherRoute = "{other}"
+
+type metricKey struct {
+	start     time.Time
+	destIP    string
+	destPort  int
+	authority string
+	method    string
+	route     string
+	source    string
+}
+
+// Aggregator counts requests per destination, method and route over fixed
+// intervals. It is safe for concurrent use.
+type Aggregator struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	metrics map[metricKey]*models.HTTPMetric
+	routes  map[string]map[string]bool // by destination
+}
+
+// NewAggregator creates an aggregator counting requests over interval
+func NewAggregator(interval time.Duration) *Aggregator {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Aggregator{
+		interval: interval,
+		metrics:  make(map[metricKey]*models.HTTPMetric),
+		routes:   make(map[string]map[string]bool),
+	}
+}
+
+// Add counts a request seen by the given source, "capture" or "proxy"
+func (a *Aggregator) Add(req *models.HTTPRequest, source string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	route := Route(req.Path)
+	destination := req.DestIP + "|" + req.Authority
+	routes, ok := a.routes[destination]
+	if !ok {
+		routes = make(map[string]bool)
+		a.routes[destination] = routes
+	}
+	if !routes[route] {
+		if len(routes) >= maxRoutes {
+			route = otherRoute
+		} else {
+			routes[route] = true
+		}
+	}
+
+	key := metricKey{req.Timestamp.Truncate(a.interval), req.DestIP, req.DestPort, req.Authority, req.Method, route, source}
+	m, ok := a.metrics[key]
+	if !ok {
+		m = &models.HTTPMetric{
+			Timestamp:      key.start,
+			Interval:       a.interval.Seconds(),
+			DestIP:         req.DestIP,
+			DestPort:       req.DestPort,
+			Authority:      req.Authority,
+			Method:         req.Method,
+			Route:          route,
+			LatencyBuckets: make([]int64, len(models.HTTPLatencyBounds)+1),
+			Source:         source,
+		}
+		a.metrics[key] = m
+	}
+
+	m.Requests++
+	switch {
+	case req.StatusCode >= 500:
+		m.ServerErrors++
+	case req.StatusCode >= 400:
+		m.ClientErrors++
+	}
+	m.LatencySum += req.Latency
+	if req.Latency > m.LatencyMax {
+		m.LatencyMax = req.Latency
+	}
+	m.LatencyBuckets[sort.SearchFloat64s(models.HTTPLatencyBounds, req.Latency)]++
+}
+
+// Flush removes and returns the metrics of intervals that ended by now,
+// oldest first
+func (a *Aggregator) Flush(now time.Time) []*models.HTTPMetric {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var done []*models.HTTPMetric
+	for key, m := range a.metrics {
+		if !key.start.Add(a.interval).After(now) {
+			done = append(done, m)
+			delete(a.metrics, key)
+		}
+	}
+	sort.Slice(done, func(i, j int) bool { return done[i].Timestamp.Before(done[j].Timestamp) })
+	return done
+}
@@ -0,0 +1,111 @@
+package httpmetrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// aggregate counts the fixture requests over one second intervals
+func aggregate(t *testing.T) []*models.HTTPMetric {
+	t.Helper()
+	a := NewAggregator(time.Second)
+	for _, req := range replay(t) {
+		a.Add(req, "capture")
+	}
+	return a.Flush(base.Add(time.Hour))
+}
+
+func TestAggregator(t *testing.T) {
+	a := NewAggregator(time.Second)
+	for _, req := range replay(t) {
+		a.Add(req, "capture")
+	}
+
+	describe := func(metrics []*models.HTTPMetric) string {
+		var got []string
+		for i, m := range metrics {
+			if i > 0 && m.Timestamp.Before(metrics[i-1].Timestamp) {
+				t.Errorf("%s flushed after %s", m.Timestamp.Sub(base), metrics[i-1].Timestamp.Sub(base))
+			}
+			got = append(got, fmt.Sprintf("%s %s %s %s requests=%d 4xx=%d 5xx=%d sum=%g max=%g buckets=%v %s", m.Timestamp.Sub(base),
+				Destination(m), m.Method, m.Route, m.Requests, m.ClientErrors, m.ServerErrors, m.LatencySum, m.LatencyMax, m.LatencyBuckets[:5], m.Source))
+		}
+		// Metrics of an interval come in no particular order
+		sort.Strings(got)
+		return strings.Join(got, "\n")
+	}
+
+	// Only intervals that ended are flushed
+	got := describe(a.Flush(base.Add(2 * time.Second)))
+	want := strings.Join([]string{
+		"0s api.internal GET /orders/{id} requests=1 4xx=0 5xx=1 sum=36 max=36 buckets=[0 0 0 1 0] capture",
+		"0s api.internal GET /users/{id} requests=1 4xx=0 5xx=0 sum=12 max=12 buckets=[0 0 1 0 0] capture",
+		"0s api.internal POST /orders requests=1 4xx=0 5xx=0 sum=31 max=31 buckets=[0 0 0 1 0] capture",
+		"1s 10.5.0.21:80 DELETE /sessions/current requests=1 4xx=0 5xx=0 sum=3 max=3 buckets=[1 0 0 0 0] capture",
+		"1s 10.5.0.21:80 GET /export requests=1 4xx=0 5xx=1 sum=4 max=4 buckets=[1 0 0 0 0] capture",
+		"1s 10.5.0.21:80 HEAD /files/report.pdf requests=1 4xx=0 5xx=0 sum=2 max=2 buckets=[1 0 0 0 0] capture",
+	}, "\n")
+	if got != want {
+		t.Errorf("first flush:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Both requests for reports share a route, the year being numeric too
+	got = describe(a.Flush(base.Add(time.Hour)))
+	want = strings.Join([]string{
+		"2s payments.example.com:443 CONNECT payments.example.com:443 requests=1 4xx=0 5xx=0 sum=20 max=20 buckets=[0 0 1 0 0] capture",
+		"4s reports.internal GET /reports/{id}/{id} requests=2 4xx=1 5xx=0 sum=11 max=9 buckets=[1 1 0 0 0] capture",
+	}, "\n")
+	if got != want {
+		t.Errorf("second flush:\n%s\nwant:\n%s", got, want)
+	}
+	if rest := a.Flush(base.Add(time.Hour)); len(rest) != 0 {
+		t.Errorf("flushed %d metrics twice", len(rest))
+	}
+}
+
+func TestAggregatorRouteLimit(t *testing.T) {
+	a := NewAggregator(time.Minute)
+	add := func(authority, path, source string) {
+		a.Add(&models.HTTPRequest{Timestamp: base, DestIP: "10.5.0.20", DestPort: 8080, Authority: authority,
+			Method: "GET", Path: path, StatusCode: 200, Latency: 1}, source)
+	}
+	for i := 0; i < maxRoutes+5; i++ {
+		add("api.internal", fmt.Sprintf("/p%d", i), "capture")
+	}
+	// Routes already tracked are still counted on their own, and another
+	// authority on the same address has a limit of its own
+	add("api.internal", "/p0", "capture")
+	add("admin.internal", "/p0", "capture")
+	// The same request through the proxy is counted apart
+	add("api.internal", "/p0", "proxy")
+
+	counts := make(map[string]int64)
+	var routes int
+	for _, m := range a.Flush(base.Add(time.Minute)) {
+		counts[fmt.Sprintf("%s %s %s", m.Authority, m.Route, m.Source)] = m.Requests
+		if m.Authority == "api.internal" && m.Source == "capture" {
+			routes++
+		}
+	}
+	for key, want := range map[string]int64{
+		"api.internal /p0 capture":       2,
+		"api.internal {other} capture":   5,
+		"admin.internal /p0 capture":     1,
+		"api.internal /p0 proxy":         1,
+		"api.internal /p199 capture":     1,
+		"api.internal /p200 capture":     0,
+		"admin.internal {other} capture": 0,
+	} {
+		if counts[key] != want {
+			t.Errorf("%s = %d requests, want %d", key, counts[key], want)
+		}
+	}
+	if routes != maxRoutes+1 {
+		t.Errorf("%d routes for api.internal, want %d and %s", routes, maxRoutes, otherRoute)
+	}
+}
@@ -0,0 +1,161 @@
+package httpmetrics
+
+import (
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// hopHeaders are meaningful only for a single connection and are not
+// forwarded
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// Proxy is a forward HTTP proxy that measures the plaintext requests sent
+// through it. Applications use it by setting HTTP_PROXY. HTTPS requests
+// are tunneled with CONNECT and not measured.
+type Proxy struct {
+	emit      func(*models.HTTPRequest)
+	transport *http.Transport
+	dialer    *net.Dialer
+}
+
+// NewProxy creates a proxy passing each forwarded request to emit
+func NewProxy(emit func(*models.HTTPRequest)) *Proxy {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	return &Proxy{
+		emit:   emit,
+		dialer: dialer,
+		transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "proxy requests need an absolute URL", http.StatusBadRequest)
+		return
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	removeHopHeaders(out.Header)
+	var remote string
+	out = out.WithContext(httptrace.WithClientTrace(out.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) { remote = info.Conn.RemoteAddr().String() },
+	}))
+
+	start := time.Now()
+	resp, err := p.transport.RoundTrip(out)
+	latency := time.Since(start)
+	status := http.StatusBadGateway
+	if err == nil {
+		status = resp.StatusCode
+	}
+	p.record(r, remote, status, start, latency)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	removeHopHeaders(resp.Header)
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// record reports a forwarded request, sent to the remote address when a
+// connection was made
+func (p *Proxy) record(r *http.Request, remote string, status int, start time.Time, latency time.Duration) {
+	req := &models.HTTPRequest{
+		Timestamp:  start,
+		Method:     r.Method,
+		Authority:  r.URL.Host,
+		Path:       r.URL.RequestURI(),
+		StatusCode: status,
+		Latency:    float64(latency) / float64(time.Millisecond),
+	}
+	req.SourceIP, req.SourcePort = splitAddr(r.RemoteAddr)
+	if remote == "" {
+		remote = r.URL.Host
+		if r.URL.Port() == "" {
+			remote = net.JoinHostPort(r.URL.Hostname(), "80")
+		}
+	}
+	req.DestIP, req.DestPort = splitAddr(remote)
+	p.emit(req)
+}
+
+// tunnel relays a CONNECT request's bytes both ways
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := p.dialer.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "tunneling is not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		log.Printf("Error taking over proxy connection: %v", err)
+		return
+	}
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		client.Close()
+		upstream.Close()
+		return
+	}
+
+	go func() {
+		// Bytes the client sent after its request are already buffered
+		io.Copy(upstream, buffered)
+		upstream.Close()
+	}()
+	io.Copy(client, upstream)
+	client.Close()
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, field := range strings.Split(h.Get("Connection"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			h.Del(field)
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+func splitAddr(addr string) (string, int) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, 0
+	}
+	n, _ := strconv.Atoi(port)
+	return host, n
+}
@@ -0,0 +1,147 @@
+package httpmetrics
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+func TestProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "" || r.Header.Get("X-Hop") != "" {
+			t.Errorf("hop-by-hop headers forwarded: %v", r.Header)
+		}
+		w.Header().Set("Keep-Alive", "timeout=5")
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprintf(w, "%s %s", r.Method, r.URL.RequestURI())
+	}))
+	defer upstream.Close()
+	// An address nothing listens on
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := closed.Addr().String()
+	closed.Close()
+
+	var mu sync.Mutex
+	var recorded []*models.HTTPRequest
+	proxy := httptest.NewServer(NewProxy(func(req *models.HTTPRequest) {
+		mu.Lock()
+		recorded = append(recorded, req)
+		mu.Unlock()
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	for _, tc := range []struct {
+		method, url string
+		status      int
+		body        string
+	}{
+		{"GET", upstream.URL + "/users/42?x=1", 200, "GET /users/42?x=1"},
+		{"POST", upstream.URL + "/fail", 503, "POST /fail"},
+		{"GET", "http://" + unreachable + "/users/43", 502, ""},
+	} {
+		req, _ := http.NewRequest(tc.method, tc.url, nil)
+		req.Header.Set("Proxy-Authorization", "Basic dXNlcjpwYXNz")
+		req.Header.Set("Connection", "X-Hop")
+		req.Header.Set("X-Hop", "1")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tc.status || (tc.body != "" && string(body) != tc.body) {
+			t.Errorf("%s %s = %d %q, want %d %q", tc.method, tc.url, resp.StatusCode, body, tc.status, tc.body)
+		}
+		if resp.Header.Get("Keep-Alive") != "" {
+			t.Errorf("%s %s: hop-by-hop Keep-Alive returned to the client", tc.method, tc.url)
+		}
+	}
+
+	// Requests for the proxy itself are refused and not recorded
+	resp, err := http.Get(proxy.URL + "/users/42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("origin-form request = %d, want 400", resp.StatusCode)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var got []string
+	for _, req := range recorded {
+		if req.SourceIP != "127.0.0.1" || req.SourcePort == 0 || req.Latency < 0 || req.Timestamp.IsZero() {
+			t.Errorf("%s %s from %s:%d at %s after %gms", req.Method, req.Path, req.SourceIP, req.SourcePort, req.Timestamp, req.Latency)
+		}
+		got = append(got, fmt.Sprintf("%s %s %s %d %s:%d", req.Method, req.Authority, req.Path, req.StatusCode, req.DestIP, req.DestPort))
+	}
+	host := strings.TrimPrefix(upstream.URL, "http://")
+	_, port, _ := net.SplitHostPort(host)
+	_, closedPort, _ := net.SplitHostPort(unreachable)
+	want := []string{
+		fmt.Sprintf("GET %s /users/42?x=1 200 127.0.0.1:%s", host, port),
+		fmt.Sprintf("POST %s /fail 503 127.0.0.1:%s", host, port),
+		// Without a connection the address is taken from the URL
+		fmt.Sprintf("GET %s /users/43 502 127.0.0.1:%s", unreachable, closedPort),
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("recorded:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestProxyTunnel(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	go func() {
+		conn, err := upstream.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(conn, buf); err == nil {
+			conn.Write([]byte(strings.ToUpper(string(buf))))
+		}
+	}()
+
+	var recorded int
+	proxy := httptest.NewServer(NewProxy(func(*models.HTTPRequest) { recorded++ }))
+	defer proxy.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(proxy.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// Bytes sent right behind the request are relayed too
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\nping", upstream.Addr(), upstream.Addr())
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "HTTP/1.1 200 Connection Established\r\n\r\nPING"; string(reply) != want {
+		t.Errorf("tunnel = %q, want %q", reply, want)
+	}
+	if recorded != 0 {
+		t.Errorf("recorded %d tunneled requests", recorded)
+	}
+}
@@ -0,0 +1,79 @@
+// Package httpmetrics turns the HTTP/1.x requests a collector sees, on a
+// packet capture or through its forward proxy, into RED metrics (rate,
+// errors and duration) per method and route, and summarizes them for the
+// API.
+package httpmetrics
+
+import (
+	"net/url"
+	"strings"
+)
+
+// maxRouteSegments bounds the path segments kept in a route
+const maxRouteSegments = 12
+
+// Route turns a request target into a path template, dropping the query
+// and replacing segments that look like IDs with {id}, so /users/42 and
+// /users/43 share the route /users/{id}
+func Route(target string) string {
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		u, err := url.Parse(target)
+		if err != nil {
+			return "/"
+		}
+		target = u.EscapedPath()
+	}
+	if i := strings.IndexAny(target, "?#"); i >= 0 {
+		target = target[:i]
+	}
+	if !strings.HasPrefix(target, "/") {
+		// "*" for OPTIONS, or a CONNECT authority
+		if target == "" {
+			return "/"
+		}
+		return target
+	}
+
+	segments := strings.Split(target[1:], "/")
+	if len(segments) > maxRouteSegments {
+		segments = append(segments[:maxRouteSegments], "...")
+	}
+	for i, s := range segments {
+		if isID(s) {
+			segments[i] = "{id}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// isID reports whether a path segment looks like an identifier rather than
+// a fixed name: a number, a UUID, a long hex string, or a long token with
+// digits in it
+func isID(s string) bool {
+	if s == "" {
+		return false
+	}
+	var digits, hex, other int
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			digits++
+		case c >= 'a' && c <= 'f', c >= 'A' && c <= 'F':
+			hex++
+		case c == '-' && len(s) == 36:
+			// UUID separators
+		default:
+			other++
+		}
+	}
+	switch {
+	case digits == len(s):
+		return true
+	case other == 0 && digits > 0 && len(s) >= 16:
+		// Hex digests and UUIDs
+		return true
+	case digits > 0 && len(s) >= 20:
+		return true
+	}
+	return false
+}
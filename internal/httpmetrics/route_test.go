@@ -0,0 +1,33 @@
+package httpmetrics
+
+import "testing"
+
+func TestRoute(t *testing.T) {
+	for _, tc := range []struct {
+		target, want string
+	}{
+		{"/", "/"},
+		{"", "/"},
+		{"/users/42", "/users/{id}"},
+		{"/users/42/orders/7?page=2#top", "/users/{id}/orders/{id}"},
+		{"/orders/3f2b6a1c-9d4e-4f7a-8b2c-1a2b3c4d5e6f/items", "/orders/{id}/items"},
+		{"/blobs/sha256/9f86d081884c7d659a2feaa0c55ad015", "/blobs/sha256/{id}"},
+		{"/sessions/tok_4eC39HqLyjWDarjtT1zdp7dc", "/sessions/{id}"},
+		// Names, short codes and long words are kept
+		{"/v2/api/healthz", "/v2/api/healthz"},
+		{"/reports/q3-2024", "/reports/q3-2024"},
+		{"/cafebabe/deadbeef", "/cafebabe/deadbeef"},
+		{"/internationalization", "/internationalization"},
+		// Absolute URLs, as sent to proxies
+		{"http://api.internal:8080/users/42?x=1", "/users/{id}"},
+		{"https://api.internal", "/"},
+		// OPTIONS and CONNECT targets
+		{"*", "*"},
+		{"payments.example.com:443", "payments.example.com:443"},
+		{"/a/b/c/d/e/f/g/h/i/j/k/l/m/n", "/a/b/c/d/e/f/g/h/i/j/k/l/..."},
+	} {
+		if got := Route(tc.target); got != tc.want {
+			t.Errorf("Route(%q) = %q, want %q", tc.target, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package httpmetrics
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// DefaultBucket is the resolution of endpoint time series
+const DefaultBucket = time.Minute
+
+type endpointKey struct {
+	service     string
+	environment string
+	destination string
+	method      string
+	route       string
+}
+
+type endpoint struct {
+	summary    *models.HTTPEndpoint
+	latencySum float64
+	buckets    []int64
+	points     map[time.Time]*point
+}
+
+type point struct {
+	models.HTTPPoint
+	latencySum float64
+	buckets    []int64
+}
+
+// Summarize groups metrics into one summary per endpoint with a series
+// bucketed at the given resolution, busiest endpoints first. Rates are
+// over the span the metrics cover.
+func Summarize(metrics []*models.HTTPMetric, bucket time.Duration) []*models.HTTPEndpoint {
+	if bucket <= 0 {
+		bucket = DefaultBucket
+	}
+
+	byKey := make(map[endpointKey]*endpoint)
+	var order []*endpoint
+	var first, last time.Time
+	for _, m := range metrics {
+		end := m.Timestamp.Add(time.Duration(m.Interval * float64(time.Second)))
+		if first.IsZero() || m.Timestamp.Before(first) {
+			first = m.Timestamp
+		}
+		if end.After(last) {
+			last = end
+		}
+
+		key := endpointKey{m.ServiceName, m.Environment, Destination(m), m.Method, m.Route}
+		e, ok := byKey[key]
+		if !ok {
+			e = &endpoint{
+				summary: &models.HTTPEndpoint{
+					ServiceName: m.ServiceName,
+					Environment: m.Environment,
+					Destination: key.destination,
+					Method:      m.Method,
+					Route:       m.Route,
+				},
+				buckets: make([]int64, len(models.HTTPLatencyBounds)+1),
+				points:  make(map[time.Time]*point),
+			}
+			byKey[key] = e
+			order = append(order, e)
+		}
+		e.add(m, bucket)
+	}
+
+	seconds := last.Sub(first).Seconds()
+	summaries := make([]*models.HTTPEndpoint, 0, len(order))
+	for _, e := range order {
+		summaries = append(summaries, e.finish(seconds))
+	}
+	sort.SliceStable(summaries, func(i, j int) bool { return summaries[i].Requests > summaries[j].Requests })
+	return summaries
+}
+
+// Destination names what a metric's requests were sent to: the Host
+// header when there was one, or else the address
+func Destination(m *models.HTTPMetric) string {
+	if m.Authority != "" {
+		return m.Authority
+	}
+	return net.JoinHostPort(m.DestIP, strconv.Itoa(m.DestPort))
+}
+
+func (e *endpoint) add(m *models.HTTPMetric, bucket time.Duration) {
+	sum := e.summary
+	if m.Timestamp.After(sum.LastSeen) {
+		sum.LastSeen = m.Timestamp
+	}
+	sum.Requests += m.Requests
+	sum.ClientErrors += m.ClientErrors
+	sum.ServerErrors += m.ServerErrors
+	if m.LatencyMax > sum.MaxLatency {
+		sum.MaxLatency = m.LatencyMax
+	}
+	e.latencySum += m.LatencySum
+	addBuckets(e.buckets, m.LatencyBuckets)
+
+	at := m.Timestamp.Truncate(bucket)
+	p, ok := e.points[at]
+	if !ok {
+		p = &point{HTTPPoint: models.HTTPPoint{Timestamp: at}, buckets: make([]int64, len(e.buckets))}
+		e.points[at] = p
+	}
+	p.Requests += m.Requests
+	p.ServerErrors += m.ServerErrors
+	p.latencySum += m.LatencySum
+	addBuckets(p.buckets, m.LatencyBuckets)
+}
+
+func (e *endpoint) finish(seconds float64) *models.HTTPEndpoint {
+	sum := e.summary
+	if seconds > 0 {
+		sum.Rate = float64(sum.Requests) / seconds
+	}
+	if sum.Requests > 0 {
+		sum.ErrorRate = float64(sum.ServerErrors) / float64(sum.Requests)
+		sum.AvgLatency = e.latencySum / float64(sum.Requests)
+	}
+	sum.P50Latency = Percentile(e.buckets, 0.50, sum.MaxLatency)
+	sum.P95Latency = Percentile(e.buckets, 0.95, sum.MaxLatency)
+	sum.P99Latency = Percentile(e.buckets, 0.99, sum.MaxLatency)
+
+	sum.Series = make([]models.HTTPPoint, 0, len(e.points))
+	for _, p := range e.points {
+		if p.Requests > 0 {
+			p.AvgLatency = p.latencySum / float64(p.Requests)
+		}
+		p.P95Latency = Percentile(p.buckets, 0.95, sum.MaxLatency)
+		sum.Series = append(sum.Series, p.HTTPPoint)
+	}
+	sort.Slice(sum.Series, func(i, j int) bool { return sum.Series[i].Timestamp.Before(sum.Series[j].Timestamp) })
+	return sum
+}
+
+func addBuckets(into, from []int64) {
+	for i := 0; i < len(into) && i < len(from); i++ {
+		into[i] += from[i]
+	}
+}
+
+// Percentile estimates the p-th quantile, 0 to 1, of a latency histogram
+// over models.HTTPLatencyBounds, interpolating within the bucket it falls
+// in. The open-ended last bucket reaches to max.
+func Percentile(buckets []int64, p float64, max float64) float64 {
+	var total int64
+	for _, n := range buckets {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := p * float64(total)
+	var seen int64
+	for i, n := range buckets {
+		if n == 0 || float64(seen+n) < rank {
+			seen += n
+			continue
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = models.HTTPLatencyBounds[i-1]
+		}
+		upper := max
+		if i < len(models.HTTPLatencyBounds) && models.HTTPLatencyBounds[i] < max {
+			upper = models.HTTPLatencyBounds[i]
+		}
+		if upper < lower {
+			return lower
+		}
+		return lower + (upper-lower)*(rank-float64(seen))/float64(n)
+	}
+	return max
+}
+
+// ErrorTrends counts 5xx responses per bucket, as EHTTP5XX, over every
+// bucket that saw requests
+func ErrorTrends(metrics []*models.HTTPMetric, bucket time.Duration) []models.ErrorTrend {
+	if bucket <= 0 {
+		bucket = time.Hour
+	}
+	counts := make(map[time.Time]int64)
+	for _, m := range metrics {
+		counts[m.Timestamp.Truncate(bucket)] += m.ServerErrors
+	}
+
+	trends := make([]models.ErrorTrend, 0, len(counts))
+	for at, n := range counts {
+		trends = append(trends, models.ErrorTrend{
+			Timestamp: at,
+			ErrorType: string(models.ErrHTTPServerError),
+			Count:     n,
+		})
+	}
+	sort.Slice(trends, func(i, j int) bool { return trends[i].Timestamp.Before(trends[j].Timestamp) })
+	return trends
+}
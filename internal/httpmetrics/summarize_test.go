@@ -0,0 +1,137 @@
+package httpmetrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+func TestPercentile(t *testing.T) {
+	// Bounds are 5, 10, 25, 50, ...
+	buckets := func(counts ...int64) []int64 {
+		return append(counts, make([]int64, len(models.HTTPLatencyBounds)+1-len(counts))...)
+	}
+	last := make([]int64, len(models.HTTPLatencyBounds)+1)
+	last[len(last)-1] = 4
+	for _, tc := range []struct {
+		buckets []int64
+		p, max  float64
+		want    float64
+	}{
+		{buckets(), 0.5, 0, 0},
+		{buckets(10), 0.5, 4, 2},
+		{buckets(10), 0.9, 4, 3.6},
+		{buckets(10), 0.5, 9, 2.5},
+		{buckets(5, 5), 0.5, 9, 5},
+		{buckets(5, 5), 0.9, 9, 8.2},
+		{buckets(0, 0, 0, 10), 0.5, 50, 37.5},
+		// The last bucket is open-ended
+		{last, 0.5, 20000, 15000},
+	} {
+		if got := Percentile(tc.buckets, tc.p, tc.max); fmt.Sprintf("%.6g", got) != fmt.Sprintf("%.6g", tc.want) {
+			t.Errorf("Percentile(%v, %g, %g) = %g, want %g", tc.buckets, tc.p, tc.max, got, tc.want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	describe := func(e *models.HTTPEndpoint) string {
+		var series []string
+		for _, p := range e.Series {
+			series = append(series, fmt.Sprintf("%s:%d/%d/%.4g/%.4g", p.Timestamp.Sub(base), p.Requests, p.ServerErrors, p.AvgLatency, p.P95Latency))
+		}
+		return fmt.Sprintf("%s %s %s requests=%d rate=%g 4xx=%d 5xx=%d error_rate=%g avg=%.4g p50=%.4g p95=%.4g p99=%.4g max=%g series=%s",
+			e.Destination, e.Method, e.Route, e.Requests, e.Rate, e.ClientErrors, e.ServerErrors, e.ErrorRate,
+			e.AvgLatency, e.P50Latency, e.P95Latency, e.P99Latency, e.MaxLatency, strings.Join(series, ","))
+	}
+
+	endpoints := Summarize(aggregate(t), time.Second)
+	if len(endpoints) == 0 || endpoints[0].Route != "/reports/{id}/{id}" {
+		t.Fatalf("endpoints = %v, want the busiest first", endpoints)
+	}
+	var got []string
+	for _, e := range endpoints {
+		got = append(got, describe(e))
+	}
+	// Endpoints with as many requests come in the order seen
+	sort.Strings(got[1:])
+	// The capture spans five seconds
+	want := []string{
+		"reports.internal GET /reports/{id}/{id} requests=2 rate=0.4 4xx=1 5xx=0 error_rate=0 avg=5.5 p50=5 p95=8.6 p99=8.92 max=9 series=4s:2/0/5.5/8.6",
+		"10.5.0.21:80 DELETE /sessions/current requests=1 rate=0.2 4xx=0 5xx=0 error_rate=0 avg=3 p50=1.5 p95=2.85 p99=2.97 max=3 series=1s:1/0/3/2.85",
+		"10.5.0.21:80 GET /export requests=1 rate=0.2 4xx=0 5xx=1 error_rate=1 avg=4 p50=2 p95=3.8 p99=3.96 max=4 series=1s:1/1/4/3.8",
+		"10.5.0.21:80 HEAD /files/report.pdf requests=1 rate=0.2 4xx=0 5xx=0 error_rate=0 avg=2 p50=1 p95=1.9 p99=1.98 max=2 series=1s:1/0/2/1.9",
+		"api.internal GET /orders/{id} requests=1 rate=0.2 4xx=0 5xx=1 error_rate=1 avg=36 p50=30.5 p95=35.45 p99=35.89 max=36 series=0s:1/1/36/35.45",
+		"api.internal GET /users/{id} requests=1 rate=0.2 4xx=0 5xx=0 error_rate=0 avg=12 p50=11 p95=11.9 p99=11.98 max=12 series=0s:1/0/12/11.9",
+		"api.internal POST /orders requests=1 rate=0.2 4xx=0 5xx=0 error_rate=0 avg=31 p50=28 p95=30.7 p99=30.94 max=31 series=0s:1/0/31/30.7",
+		"payments.example.com:443 CONNECT payments.example.com:443 requests=1 rate=0.2 4xx=0 5xx=0 error_rate=0 avg=20 p50=15 p95=19.5 p99=19.9 max=20 series=2s:1/0/20/19.5",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("endpoints:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSummarizeSeries(t *testing.T) {
+	metric := func(at time.Duration, service string, requests, serverErrors int64, latency float64) *models.HTTPMetric {
+		buckets := make([]int64, len(models.HTTPLatencyBounds)+1)
+		buckets[sort.SearchFloat64s(models.HTTPLatencyBounds, latency)] = requests
+		return &models.HTTPMetric{Timestamp: base.Add(at), Interval: 60, ServiceName: service, DestIP: "10.5.0.20", DestPort: 8080,
+			Method: "GET", Route: "/users/{id}", Requests: requests, ServerErrors: serverErrors,
+			LatencySum: latency * float64(requests), LatencyMax: latency, LatencyBuckets: buckets}
+	}
+	// Two collectors count the same minutes for checkout; billing calls
+	// the same route but is summarized apart
+	endpoints := Summarize([]*models.HTTPMetric{
+		metric(0, "checkout", 30, 0, 8),
+		metric(0, "checkout", 30, 3, 8),
+		metric(time.Minute, "checkout", 60, 0, 40),
+		metric(5*time.Minute, "checkout", 60, 12, 8),
+		metric(time.Minute, "billing", 6, 0, 8),
+	}, 5*time.Minute)
+
+	if len(endpoints) != 2 {
+		t.Fatalf("%d endpoints, want 2", len(endpoints))
+	}
+	checkout := endpoints[0]
+	var series []string
+	for _, p := range checkout.Series {
+		series = append(series, fmt.Sprintf("%s:%d/%d/%g", p.Timestamp.Sub(base), p.Requests, p.ServerErrors, p.AvgLatency))
+	}
+	// Six minutes of metrics
+	got := fmt.Sprintf("%s %s requests=%d rate=%.4g error_rate=%.4g avg=%.4g last=%s series=%s", checkout.ServiceName, checkout.Destination,
+		checkout.Requests, checkout.Rate, checkout.ErrorRate, checkout.AvgLatency, checkout.LastSeen.Sub(base), strings.Join(series, ","))
+	want := "checkout 10.5.0.20:8080 requests=180 rate=0.5 error_rate=0.08333 avg=18.67 last=5m0s series=0s:120/3/24,5m0s:60/12/8"
+	if got != want {
+		t.Errorf("checkout = %s\nwant %s", got, want)
+	}
+	if endpoints[1].ServiceName != "billing" || endpoints[1].Rate != 6.0/360 {
+		t.Errorf("billing = %+v", endpoints[1])
+	}
+}
+
+func TestErrorTrends(t *testing.T) {
+	describe := func(trends []models.ErrorTrend) string {
+		var got []string
+		for _, tr := range trends {
+			got = append(got, fmt.Sprintf("%s %s %d", tr.Timestamp.Sub(base), tr.ErrorType, tr.Count))
+		}
+		return strings.Join(got, ", ")
+	}
+	metrics := aggregate(t)
+
+	// Buckets with requests but no 5xx are kept, as zeros
+	if got, want := describe(ErrorTrends(metrics, time.Second)), "0s EHTTP5XX 1, 1s EHTTP5XX 1, 2s EHTTP5XX 0, 4s EHTTP5XX 0"; got != want {
+		t.Errorf("per second: %s, want %s", got, want)
+	}
+	// The 404 is a client error and is not counted
+	if got, want := describe(ErrorTrends(metrics, 0)), "0s EHTTP5XX 2"; got != want {
+		t.Errorf("per hour: %s, want %s", got, want)
+	}
+	if trends := ErrorTrends(nil, time.Hour); trends == nil || len(trends) != 0 {
+		t.Errorf("ErrorTrends(nil) = %#v, want an empty list", trends)
+	}
+}
@@ -0,0 +1,435 @@
+package httpmetrics
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/capture"
+	"github.com/karthik-minnikanti/cinnamon/internal/fingerprint"
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+const (
+	// maxHeaderBytes bounds a request or response head; flows with longer
+	// ones are no longer followed
+	maxHeaderBytes = 64 * 1024
+	// maxPending bounds the out of order segments held per direction, and
+	// maxInFlight the pipelined requests awaiting a response
+	maxPending  = 64
+	maxInFlight = 64
+	// flowTTL bounds how long idle flows are remembered
+	flowTTL = 5 * time.Minute
+)
+
+// Framing states of a direction of a flow
+const (
+	stateHead = iota
+	stateBody
+	stateChunkSize
+	stateChunkData
+	stateTrailers
+	// stateUntilClose skips everything left, for bodies ended by closing
+	// the connection and for tunnels
+	stateUntilClose
+)
+
+type segment struct {
+	data []byte
+	at   time.Time
+}
+
+// direction reassembles one side of a flow and tracks its message framing
+type direction struct {
+	next    uint32
+	started bool
+	pending map[uint32]segment
+	buf     []byte
+	at      time.Time // when buf[0] arrived
+
+	state     int
+	remaining int64
+}
+
+// push adds a segment, reporting false when too much is out of order to
+// follow the flow any longer
+func (d *direction) push(seq uint32, data []byte, at time.Time) bool {
+	if !d.started {
+		d.next, d.started = seq, true
+	}
+	// Drop what was already received
+	if behind := int32(d.next - seq); behind > 0 {
+		if int(behind) >= len(data) {
+			return true
+		}
+		data, seq = data[behind:], d.next
+	}
+	if seq != d.next {
+		if len(d.pending) >= maxPending {
+			return false
+		}
+		if d.pending == nil {
+			d.pending = make(map[uint32]segment)
+		}
+		d.pending[seq] = segment{append([]byte(nil), data...), at}
+		return true
+	}
+
+	d.append(data, at)
+	// Append held segments that now continue the stream, trimming any
+	// overlap with what has arrived since
+	for len(d.pending) > 0 {
+		found := false
+		for seq, s := range d.pending {
+			behind := int32(d.next - seq)
+			if behind < 0 {
+				continue
+			}
+			delete(d.pending, seq)
+			if int(behind) < len(s.data) {
+				d.append(s.data[behind:], s.at)
+			}
+			found = true
+			break
+		}
+		if !found {
+			break
+		}
+	}
+	return true
+}
+
+func (d *direction) append(data []byte, at time.Time) {
+	if len(d.buf) == 0 {
+		d.at = at
+	}
+	d.buf = append(d.buf, data...)
+	d.next += uint32(len(data))
+}
+
+// consume drops n bytes from the front of the buffer; what is left is
+// taken to have arrived at the given time
+func (d *direction) consume(n int, at time.Time) {
+	d.buf = d.buf[n:]
+	if len(d.buf) == 0 {
+		d.buf = nil
+	}
+	d.at = at
+}
+
+// head takes a complete message head off the buffer, returning false until
+// one has arrived
+func (d *direction) head(at time.Time) (lines []string, start time.Time, ok bool, err error) {
+	end := bytes.Index(d.buf, []byte("\r\n\r\n"))
+	if end < 0 {
+		if len(d.buf) > maxHeaderBytes {
+			return nil, time.Time{}, false, fmt.Errorf("message head longer than %d bytes", maxHeaderBytes)
+		}
+		return nil, time.Time{}, false, nil
+	}
+	lines = strings.Split(string(d.buf[:end]), "\r\n")
+	start = d.at
+	d.consume(end+4, at)
+	return lines, start, true, nil
+}
+
+// body skips message bodies, returning false when it needs more data and
+// true once the next message head may start
+func (d *direction) body(at time.Time) (bool, error) {
+	for {
+		switch d.state {
+		case stateHead:
+			return true, nil
+		case stateUntilClose:
+			d.buf = nil
+			return false, nil
+		case stateBody, stateChunkData:
+			n := int64(len(d.buf))
+			if n > d.remaining {
+				n = d.remaining
+			}
+			d.consume(int(n), at)
+			d.remaining -= n
+			if d.remaining > 0 {
+				return false, nil
+			}
+			if d.state == stateBody {
+				d.state = stateHead
+			} else {
+				d.state = stateChunkSize
+			}
+		case stateChunkSize, stateTrailers:
+			end := bytes.Index(d.buf, []byte("\r\n"))
+			if end < 0 {
+				if len(d.buf) > maxHeaderBytes {
+					return false, fmt.Errorf("chunk line longer than %d bytes", maxHeaderBytes)
+				}
+				return false, nil
+			}
+			line := string(d.buf[:end])
+			d.consume(end+2, at)
+			if d.state == stateTrailers {
+				if line == "" {
+					d.state = stateHead
+				}
+				continue
+			}
+			if i := strings.IndexByte(line, ';'); i >= 0 {
+				line = line[:i]
+			}
+			size, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+			if err != nil || size < 0 {
+				return false, fmt.Errorf("invalid chunk size %q", line)
+			}
+			if size == 0 {
+				d.state = stateTrailers
+			} else {
+				d.state, d.remaining = stateChunkData, size+2 // data and its CRLF
+			}
+		}
+	}
+}
+
+// frame sets how the body after a head is delimited. Without a length or
+// chunking, a body runs to the end of the connection only when untilClose
+// is set; otherwise there is none.
+func (d *direction) frame(headers map[string]string, untilClose bool) error {
+	if strings.Contains(strings.ToLower(headers["transfer-encoding"]), "chunked") {
+		d.state = stateChunkSize
+		return nil
+	}
+	if cl, ok := headers["content-length"]; ok {
+		n, err := strconv.ParseInt(strings.TrimSpace(cl), 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid content length %q", cl)
+		}
+		if n > 0 {
+			d.state, d.remaining = stateBody, n
+		}
+		return nil
+	}
+	if untilClose {
+		d.state = stateUntilClose
+	}
+	return nil
+}
+
+// parseHeaders lowercases header names, keeping the first of repeats
+func parseHeaders(lines []string) map[string]string {
+	headers := make(map[string]string)
+	for _, line := range lines {
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(line[:i]))
+		if _, ok := headers[name]; !ok {
+			headers[name] = strings.TrimSpace(line[i+1:])
+		}
+	}
+	return headers
+}
+
+type inFlight struct {
+	method    string
+	target    string
+	authority string
+	start     time.Time
+}
+
+type httpFlow struct {
+	clientIP   string
+	clientPort int
+	serverIP   string
+	serverPort int
+
+	client, server direction
+	requests       []inFlight // awaiting responses, oldest first
+	lastSeen       time.Time
+	// done is set once the flow can no longer be followed
+	done bool
+}
+
+// Tap reads plaintext HTTP/1.x requests and responses off a packet
+// capture, passing each completed exchange to emit
+type Tap struct {
+	emit func(*models.HTTPRequest)
+
+	mu        sync.Mutex
+	flows     map[string]*httpFlow // by client-server address pair
+	lastSweep time.Time
+}
+
+// NewTap creates a tap passing each request and its response to emit
+func NewTap(emit func(*models.HTTPRequest)) *Tap {
+	return &Tap{emit: emit, flows: make(map[string]*httpFlow)}
+}
+
+// Observe feeds a single packet to the tap
+func (t *Tap) Observe(pkt *capture.Packet) {
+	if pkt.Protocol != "TCP" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if pkt.Timestamp.Sub(t.lastSweep) > time.Minute {
+		for key, f := range t.flows {
+			if pkt.Timestamp.Sub(f.lastSeen) > flowTTL {
+				delete(t.flows, key)
+			}
+		}
+		t.lastSweep = pkt.Timestamp
+	}
+
+	toServer := fmt.Sprintf("%s:%d-%s:%d", pkt.SrcIP, pkt.SrcPort, pkt.DstIP, pkt.DstPort)
+	toClient := fmt.Sprintf("%s:%d-%s:%d", pkt.DstIP, pkt.DstPort, pkt.SrcIP, pkt.SrcPort)
+
+	key, f, fromClient := toServer, t.flows[toServer], true
+	if f == nil {
+		key, f, fromClient = toClient, t.flows[toClient], false
+	}
+	if f == nil {
+		if len(pkt.Payload) == 0 || fingerprint.Identify(pkt.Payload, nil).Protocol != fingerprint.ProtocolHTTP1 {
+			return
+		}
+		key, fromClient = toServer, true
+		f = &httpFlow{
+			clientIP:   pkt.SrcIP,
+			clientPort: pkt.SrcPort,
+			serverIP:   pkt.DstIP,
+			serverPort: pkt.DstPort,
+		}
+		if pkt.HasFlag(capture.FlagACK) {
+			f.server.next, f.server.started = pkt.Ack, true
+		}
+		t.flows[key] = f
+	}
+	f.lastSeen = pkt.Timestamp
+
+	if !f.done && len(pkt.Payload) > 0 {
+		var err error
+		if fromClient {
+			err = f.readClient(pkt)
+		} else {
+			err = f.readServer(pkt, t.emit)
+		}
+		if err != nil {
+			f.done = true
+			f.client, f.server, f.requests = direction{}, direction{}, nil
+		}
+	}
+
+	if pkt.HasFlag(capture.FlagRST) || pkt.HasFlag(capture.FlagFIN) {
+		delete(t.flows, key)
+	}
+}
+
+// readClient reads requests off the client side of the flow
+func (f *httpFlow) readClient(pkt *capture.Packet) error {
+	d := &f.client
+	if !d.push(pkt.Seq, pkt.Payload, pkt.Timestamp) {
+		return fmt.Errorf("too many segments out of order")
+	}
+	for {
+		ready, err := d.body(pkt.Timestamp)
+		if err != nil || !ready {
+			return err
+		}
+		lines, start, ok, err := d.head(pkt.Timestamp)
+		if err != nil || !ok {
+			return err
+		}
+
+		parts := strings.SplitN(lines[0], " ", 3)
+		if len(parts) != 3 || !strings.HasPrefix(parts[2], "HTTP/1.") {
+			return fmt.Errorf("invalid request line %q", lines[0])
+		}
+		if len(f.requests) >= maxInFlight {
+			return fmt.Errorf("more than %d requests awaiting responses", maxInFlight)
+		}
+		headers := parseHeaders(lines[1:])
+		f.requests = append(f.requests, inFlight{
+			method:    parts[0],
+			target:    parts[1],
+			authority: headers["host"],
+			start:     start,
+		})
+		if parts[0] == "CONNECT" {
+			// Whatever follows is tunneled
+			d.state = stateUntilClose
+			continue
+		}
+		if err := d.frame(headers, false); err != nil {
+			return err
+		}
+	}
+}
+
+// readServer reads responses off the server side of the flow, pairing each
+// with the oldest request awaiting one
+func (f *httpFlow) readServer(pkt *capture.Packet, emit func(*models.HTTPRequest)) error {
+	d := &f.server
+	if !d.push(pkt.Seq, pkt.Payload, pkt.Timestamp) {
+		return fmt.Errorf("too many segments out of order")
+	}
+	for {
+		ready, err := d.body(pkt.Timestamp)
+		if err != nil || !ready {
+			return err
+		}
+		lines, start, ok, err := d.head(pkt.Timestamp)
+		if err != nil || !ok {
+			return err
+		}
+
+		if !strings.HasPrefix(lines[0], "HTTP/1.") || len(lines[0]) < 12 {
+			return fmt.Errorf("invalid status line %q", lines[0])
+		}
+		code, err := strconv.Atoi(lines[0][9:12])
+		if err != nil {
+			return fmt.Errorf("invalid status line %q", lines[0])
+		}
+		if code >= 100 && code < 200 && code != 101 {
+			// Interim response; the final one follows
+			continue
+		}
+		if len(f.requests) == 0 {
+			return fmt.Errorf("response without a request")
+		}
+		req := f.requests[0]
+		f.requests = f.requests[1:]
+
+		latency := start.Sub(req.start)
+		if latency < 0 {
+			latency = 0
+		}
+		emit(&models.HTTPRequest{
+			Timestamp:  req.start,
+			SourceIP:   f.clientIP,
+			SourcePort: f.clientPort,
+			DestIP:     f.serverIP,
+			DestPort:   f.serverPort,
+			Method:     req.method,
+			Authority:  req.authority,
+			Path:       req.target,
+			StatusCode: code,
+			Latency:    float64(latency) / float64(time.Millisecond),
+		})
+
+		if code == 101 || (req.method == "CONNECT" && code < 300) {
+			// Upgraded to another protocol or tunneled
+			return fmt.Errorf("no longer HTTP")
+		}
+		if req.method == "HEAD" || code == 204 || code == 304 {
+			continue
+		}
+		if err := d.frame(parseHeaders(lines[1:]), true); err != nil {
+			return err
+		}
+	}
+}
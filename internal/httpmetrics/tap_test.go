@@ -0,0 +1,111 @@
+package httpmetrics
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/capture"
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+//go:generate go run testdata/gen.go
+
+// base is when the fixture capture starts
+var base = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// replay feeds the fixture capture to a tap and returns what it emits
+func replay(t *testing.T) []*models.HTTPRequest {
+	t.Helper()
+	source, err := capture.OpenPcapFile("testdata/http.pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	var requests []*models.HTTPRequest
+	tap := NewTap(func(req *models.HTTPRequest) { requests = append(requests, req) })
+	for {
+		pkt, err := source.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		tap.Observe(pkt)
+	}
+	if len(tap.flows) != 0 {
+		t.Errorf("%d flows left after every connection closed", len(tap.flows))
+	}
+	return requests
+}
+
+func TestTapFixtures(t *testing.T) {
+	var got []string
+	for _, req := range replay(t) {
+		got = append(got, fmt.Sprintf("%s %s:%d-%s:%d %s %q %s %d %gms", req.Timestamp.Sub(base),
+			req.SourceIP, req.SourcePort, req.DestIP, req.DestPort, req.Method, req.Authority, req.Path, req.StatusCode, req.Latency))
+	}
+	want := []string{
+		// The body arrives after the head in a segment of its own
+		`2ms 10.5.0.10:43000-10.5.0.20:8080 GET "api.internal" /users/42?expand=orders 200 12ms`,
+		// Pipelined in one segment: the 100 Continue is passed over, and
+		// the chunked 503 pairs with the second request
+		`115ms 10.5.0.10:43000-10.5.0.20:8080 POST "api.internal" /orders 201 31ms`,
+		`115ms 10.5.0.10:43000-10.5.0.20:8080 GET "api.internal" /orders/3f2b6a1c-9d4e-4f7a-8b2c-1a2b3c4d5e6f 503 36ms`,
+		// The HEAD and 204 responses have no body despite their lengths,
+		// and the 500's body runs to the close
+		`1.002s 10.5.0.10:43001-10.5.0.21:80 HEAD "" /files/report.pdf 200 2ms`,
+		`1.005s 10.5.0.10:43001-10.5.0.21:80 DELETE "" /sessions/current 204 3ms`,
+		`1.009s 10.5.0.10:43001-10.5.0.21:80 GET "" /export 500 4ms`,
+		// Nothing after the tunnel is established is read
+		`2.002s 10.5.0.10:43002-10.5.0.22:3128 CONNECT "payments.example.com:443" payments.example.com:443 200 20ms`,
+		// The head is timed from when it arrived, not its body before it
+		`4.002s 10.5.0.10:43004-10.5.0.24:8080 GET "reports.internal" /reports/2024/03 200 9ms`,
+		`4.013s 10.5.0.10:43004-10.5.0.24:8080 GET "reports.internal" /reports/2024/04 404 2ms`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestTapStopsFollowing(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		server string
+	}{
+		{"response without a request", "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\nHTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"},
+		{"invalid status line", "SSH-2.0-OpenSSH_9.6\r\n\r\n"},
+		{"invalid chunk size", "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n"},
+		{"upgrade", "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n\r\nHTTP/1.1 200 OK\r\n\r\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var emitted int
+			tap := NewTap(func(*models.HTTPRequest) { emitted++ })
+			packet := func(fromClient bool, seq uint32, payload string) {
+				pkt := &capture.Packet{Timestamp: base, Protocol: "TCP", Flags: capture.FlagPSH | capture.FlagACK, Seq: seq, Payload: []byte(payload),
+					SrcIP: "10.5.0.20", SrcPort: 80, DstIP: "10.5.0.10", DstPort: 43000, Ack: 1000}
+				if fromClient {
+					pkt.SrcIP, pkt.SrcPort, pkt.DstIP, pkt.DstPort, pkt.Ack = "10.5.0.10", 43000, "10.5.0.20", 80, 5000
+				}
+				tap.Observe(pkt)
+			}
+			request := "GET / HTTP/1.1\r\nHost: web\r\n\r\n"
+			packet(true, 1000, request)
+			packet(false, 5000, tc.server)
+			// A further request is no longer paired
+			packet(true, 1000+uint32(len(request)), request)
+			packet(false, 5000+uint32(len(tc.server)), "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n")
+
+			if emitted > 1 {
+				t.Errorf("emitted %d requests, want at most the first", emitted)
+			}
+			if f := tap.flows["10.5.0.10:43000-10.5.0.20:80"]; f == nil || !f.done {
+				t.Errorf("flow = %+v, want it kept but no longer followed", f)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+//go:build ignore
+
+// gen writes http.pcap for tap_test.go: HTTP/1.1 exchanges covering
+// keep-alive, pipelining, interim responses, chunked and close-delimited
+// bodies, HEAD, CONNECT and a response arriving out of order. Run it from
+// the package directory with go generate.
+package main
+
+import (
+	"bytes"
+	"log"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/capture"
+	"github.com/karthik-minnikanti/cinnamon/internal/capture/capturetest"
+)
+
+var base = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func main() {
+	w, err := capturetest.Create("testdata/http.pcap")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Keep-alive: a response whose head and body arrive in two segments,
+	// then two pipelined requests, the first answered after a 100 Continue
+	// and the second with a chunked 503
+	c := w.Conn(base, "10.5.0.10", 43000, "10.5.0.20", 8080)
+	must(c.Handshake(time.Millisecond))
+	must(c.Send(time.Millisecond, []byte("GET /users/42?expand=orders HTTP/1.1\r\nHost: api.internal\r\n\r\n")))
+	must(c.Reply(12*time.Millisecond, []byte("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 600\r\n\r\n")))
+	must(c.Reply(time.Millisecond, bytes.Repeat([]byte("x"), 600)))
+	must(c.Send(100*time.Millisecond, []byte("POST /orders HTTP/1.1\r\nHost: api.internal\r\nExpect: 100-continue\r\nContent-Length: 11\r\n\r\n{\"sku\":\"1\"}"+
+		"GET /orders/3f2b6a1c-9d4e-4f7a-8b2c-1a2b3c4d5e6f HTTP/1.1\r\nHost: api.internal\r\n\r\n")))
+	must(c.Reply(time.Millisecond, []byte("HTTP/1.1 100 Continue\r\n\r\n")))
+	must(c.Reply(30*time.Millisecond, []byte("HTTP/1.1 201 Created\r\nContent-Length: 2\r\n\r\nok")))
+	must(c.Reply(5*time.Millisecond, []byte("HTTP/1.1 503 Service Unavailable\r\nTransfer-Encoding: chunked\r\n\r\n4;ext=1\r\nbusy\r\n0\r\nRetry-After: 1\r\n\r\n")))
+	must(c.Close(time.Millisecond))
+
+	// No Host header: HEAD and 204 responses carry no body even with a
+	// length, and the last response runs to the end of the connection
+	c = w.Conn(base.Add(time.Second), "10.5.0.10", 43001, "10.5.0.21", 80)
+	must(c.Handshake(time.Millisecond))
+	must(c.Send(time.Millisecond, []byte("HEAD /files/report.pdf HTTP/1.1\r\n\r\n")))
+	must(c.Reply(2*time.Millisecond, []byte("HTTP/1.1 200 OK\r\nContent-Length: 1048576\r\n\r\n")))
+	must(c.Send(time.Millisecond, []byte("DELETE /sessions/current HTTP/1.1\r\n\r\n")))
+	must(c.Reply(3*time.Millisecond, []byte("HTTP/1.1 204 No Content\r\nContent-Length: 0\r\n\r\n")))
+	must(c.Send(time.Millisecond, []byte("GET /export HTTP/1.1\r\n\r\n")))
+	must(c.Reply(4*time.Millisecond, []byte("HTTP/1.1 500 Internal Server Error\r\n\r\nHTTP/1.1 200 OK\r\n\r\n")))
+	must(c.Close(time.Millisecond))
+
+	// A proxy tunnel: only the CONNECT is HTTP
+	c = w.Conn(base.Add(2*time.Second), "10.5.0.10", 43002, "10.5.0.22", 3128)
+	must(c.Handshake(time.Millisecond))
+	must(c.Send(time.Millisecond, []byte("CONNECT payments.example.com:443 HTTP/1.1\r\nHost: payments.example.com:443\r\n\r\n")))
+	must(c.Reply(20*time.Millisecond, []byte("HTTP/1.1 200 Connection Established\r\n\r\n")))
+	must(c.Send(time.Millisecond, []byte("GET /not-http HTTP/1.1\r\n\r\n")))
+	must(c.Reply(time.Millisecond, []byte("HTTP/1.1 200 OK\r\n\r\n")))
+	must(c.Close(time.Millisecond))
+
+	// Not HTTP
+	c = w.Conn(base.Add(3*time.Second), "10.5.0.10", 43003, "10.5.0.23", 6379)
+	must(c.Handshake(time.Millisecond))
+	must(c.Send(time.Millisecond, []byte("*1\r\n$4\r\nPING\r\n")))
+	must(c.Reply(time.Millisecond, []byte("+PONG\r\n")))
+	must(c.Close(time.Millisecond))
+
+	// The body of the first response arrives before its head and is then
+	// retransmitted; the second request is answered in order
+	at := base.Add(4 * time.Second)
+	c = w.Conn(at, "10.5.0.10", 43004, "10.5.0.24", 8080)
+	must(c.Handshake(time.Millisecond))
+	must(c.Send(time.Millisecond, []byte("GET /reports/2024/03 HTTP/1.1\r\nHost: reports.internal\r\n\r\n")))
+	head, body := []byte("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n"), []byte("march")
+	must(w.WritePacket(&capture.Packet{Timestamp: at.Add(10 * time.Millisecond), Protocol: "TCP", Flags: capture.FlagPSH | capture.FlagACK,
+		SrcIP: "10.5.0.24", SrcPort: 8080, DstIP: "10.5.0.10", DstPort: 43004, Seq: 5001 + uint32(len(head)), Payload: body}))
+	must(c.Reply(9*time.Millisecond, head))
+	must(c.Reply(time.Millisecond, body))
+	must(c.Send(time.Millisecond, []byte("GET /reports/2024/04 HTTP/1.1\r\nHost: reports.internal\r\n\r\n")))
+	must(c.Reply(2*time.Millisecond, []byte("HTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n")))
+	must(c.Close(time.Millisecond))
+
+	must(w.Close())
+}
+
+func must(err error) {
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+)
+
+// AnomalyKind classifies an anomaly
+type AnomalyKind string
+
+const (
+	AnomalySpike             AnomalyKind = "spike"
+	AnomalyDrop              AnomalyKind = "drop"
+	AnomalyErrorSpike        AnomalyKind = "error_spike"
+	AnomalyNewError          AnomalyKind = "new_error"
+	AnomalyLatencyRegression AnomalyKind = "latency_regression"
+	AnomalyRetryStorm        AnomalyKind = "retry_storm"
+	AnomalyCertExpiry        AnomalyKind = "cert_expiry"
+)
+
+// Anomaly is a deviation of a service, or of one of its edges to a
+// destination, from its learned baseline during one rollup interval
+type Anomaly struct {
+	ID          string      `json:"id"`
+	Timestamp   time.Time   `json:"timestamp"` // start of the interval
+	Kind        AnomalyKind `json:"kind"`
+	ServiceName string      `json:"service_name"`
+	Destination string      `json:"destination,omitempty"` // empty for the whole service
+	Metric      string      `json:"metric"`
+	Value       float64     `json:"value"`
+	Baseline    float64     `json:"baseline"`
+	Score       float64     `json:"score"` // robust z-score; 0 for new errors
+	Message     string      `json:"message"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+)
+
+// Certificate is an X.509 certificate a TLS server presented, identified by
+// the SHA-256 fingerprint of its DER encoding
+type Certificate struct {
+	Fingerprint  string    `json:"fingerprint"`
+	Subject      string    `json:"subject"`
+	SANs         []string  `json:"sans"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	KeyType      string    `json:"key_type"` // e.g. RSA-2048, ECDSA-P256, Ed25519
+	IsCA         bool      `json:"is_ca"`
+	// IssuerFingerprint is the certificate presented after this one in a
+	// chain, normally its issuer
+	IssuerFingerprint string    `json:"issuer_fingerprint,omitempty"`
+	FirstSeen         time.Time `json:"first_seen"`
+	LastSeen          time.Time `json:"last_seen"`
+	// DaysLeft is whole days until NotAfter when the certificate was read,
+	// negative once expired
+	DaysLeft  int                   `json:"days_left"`
+	Endpoints []CertificateEndpoint `json:"endpoints"`
+}
+
+// CertificateEndpoint is a server that presented a certificate as its leaf,
+// as seen from one host
+type CertificateEndpoint struct {
+	DestIP      string    `json:"dest_ip"`
+	DestPort    int       `json:"dest_port"`
+	ServerName  string    `json:"server_name,omitempty"`
+	Host        string    `json:"host"`
+	Environment string    `json:"environment,omitempty"`
+	ServiceName string    `json:"service_name,omitempty"`
+	Source      string    `json:"source"` // check or capture
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// CertificateObservation is a certificate chain seen by a collector during
+// a TLS handshake
+type CertificateObservation struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Host        string    `json:"host"`
+	Environment string    `json:"environment,omitempty"`
+	ServiceName string    `json:"service_name,omitempty"`
+	DestIP      string    `json:"dest_ip"`
+	DestPort    int       `json:"dest_port"`
+	ServerName  string    `json:"server_name,omitempty"`
+	Source      string    `json:"source"`
+	// Chain holds the DER certificates, leaf first
+	Chain [][]byte `json:"chain"`
+}
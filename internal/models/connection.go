@@ -16,6 +16,16 @@ const (
 	ErrHostUnreach    ConnectionError = "EHOSTUNREACH"
 	ErrNetworkDown    ConnectionError = "ENETDOWN"
 	ErrNetworkUnreach ConnectionError = "ENETUNREACH"
+
+	// Reported by synthetic checks
+	ErrTLSHandshake ConnectionError = "ETLSHANDSHAKE"
+	ErrCertExpired  ConnectionError = "ECERTEXPIRED"
+	ErrCertExpiring ConnectionError = "ECERTEXPIRING"
+	ErrHTTPStatus   ConnectionError = "EHTTPSTATUS"
+	ErrProtocol     ConnectionError = "EPROTO"
+
+	// HTTP 5xx responses, counted in error trends from HTTP metrics
+	ErrHTTPServerError ConnectionError = "EHTTP5XX"
 )
 
 // ServiceType represents the type of service
@@ -49,6 +59,18 @@ const (
 	MessageQueueTypeOther    MessageQueueType = "other"
 )
 
+// Direction tells which side of a connection the observing host is on.
+// Source is always the side that opened the connection, so for inbound
+// connections Dest is the local listening socket.
+type Direction string
+
+const (
+	DirectionOutbound Direction = "outbound"
+	DirectionInbound  Direction = "inbound"
+	// DirectionLocal connections stay on the host
+	DirectionLocal Direction = "local"
+)
+
 // Connection represents a network connection with extended metadata
 type Connection struct {
 	ID               string                 `json:"id"`
@@ -57,7 +79,20 @@ type Connection struct {
 	SourcePort       int                    `json:"source_port"`
 	DestIP           string                 `json:"dest_ip"`
 	DestPort         int                    `json:"dest_port"`
+	DestHostname     string                 `json:"dest_hostname,omitempty"`
+	DestReverseDNS   string                 `json:"dest_rdns,omitempty"`
+	DestASN          int                    `json:"dest_asn,omitempty"`
+	DestOrg          string                 `json:"dest_org,omitempty"`
+	DestCountry      string                 `json:"dest_country,omitempty"`
+	DestScope        string                 `json:"dest_scope,omitempty"`
+	DestK8sNamespace string                 `json:"dest_k8s_namespace,omitempty"`
+	DestK8sPod       string                 `json:"dest_k8s_pod,omitempty"`
+	DestK8sService   string                 `json:"dest_k8s_service,omitempty"`
 	Protocol         string                 `json:"protocol"`
+	AppProtocol      string                 `json:"app_protocol,omitempty"`
+	TLSServerName    string                 `json:"tls_server_name,omitempty"`
+	Direction        Direction              `json:"direction,omitempty"`
+	TCPState         string                 `json:"tcp_state,omitempty"`
 	ServiceName      string                 `json:"service_name"`
 	ServiceType      ServiceType            `json:"service_type"`
 	DatabaseType     DatabaseType           `json:"database_type,omitempty"`
@@ -66,7 +101,17 @@ type Connection struct {
 	DeploymentID     string                 `json:"deployment_id"`
 	Environment      string                 `json:"environment"`
 	Region           string                 `json:"region"`
+	K8sNamespace     string                 `json:"k8s_namespace,omitempty"`
+	K8sPod           string                 `json:"k8s_pod,omitempty"`
+	K8sDeployment    string                 `json:"k8s_deployment,omitempty"`
+	K8sService       string                 `json:"k8s_service,omitempty"`
+	K8sNode          string                 `json:"k8s_node,omitempty"`
+	ContainerID      string                 `json:"container_id,omitempty"`
+	ContainerName    string                 `json:"container_name,omitempty"`
+	ContainerImage   string                 `json:"container_image,omitempty"`
 	Latency          float64                `json:"latency_ms"`
+	Duration         float64                `json:"duration_ms,omitempty"`
+	DNSLatency       float64                `json:"dns_latency_ms,omitempty"`
 	BytesSent        int64                  `json:"bytes_sent"`
 	BytesReceived    int64                  `json:"bytes_received"`
 	RetryCount       int                    `json:"retry_count"`
@@ -77,16 +122,17 @@ type Connection struct {
 
 // ConnectionStats represents aggregated statistics
 type ConnectionStats struct {
-	TotalConnections   int64                    `json:"total_connections"`
-	ErrorCounts        map[string]int64         `json:"error_counts"`
-	AvgLatency         float64                  `json:"avg_latency"`
-	TotalBytesSent     int64                    `json:"total_bytes_sent"`
-	TotalBytesReceived int64                    `json:"total_bytes_received"`
-	TopServices        []ServiceStats           `json:"top_services"`
-	ErrorTrends        []ErrorTrend             `json:"error_trends"`
-	ServiceTypeStats   map[ServiceType]int      `json:"service_type_stats"`
-	DatabaseStats      map[DatabaseType]int     `json:"database_stats"`
-	QueueStats         map[MessageQueueType]int `json:"queue_stats"`
+	TotalConnections   int64                            `json:"total_connections"`
+	ErrorCounts        map[string]int64                 `json:"error_counts"`
+	AvgLatency         float64                          `json:"avg_latency"`
+	TotalBytesSent     int64                            `json:"total_bytes_sent"`
+	TotalBytesReceived int64                            `json:"total_bytes_received"`
+	TopServices        []ServiceStats                   `json:"top_services"`
+	ErrorTrends        []ErrorTrend                     `json:"error_trends"`
+	ServiceTypeStats   map[ServiceType]int              `json:"service_type_stats"`
+	DatabaseStats      map[DatabaseType]int             `json:"database_stats"`
+	QueueStats         map[MessageQueueType]int         `json:"queue_stats"`
+	QueueDetails       map[MessageQueueType]*QueueStats `json:"queue_details,omitempty"`
 }
 
 // ServiceStats represents statistics for a service
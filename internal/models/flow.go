@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+)
+
+// FlowLatencyBounds are the upper bounds, in milliseconds, of the latency
+// histogram in FlowSummary; a last bucket counts anything slower
+var FlowLatencyBounds = []float64{0.5, 1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// FlowSummary rolls up the connections a collector saw from one process to
+// one destination over an interval, sent instead of every connection when
+// the collector aggregates
+type FlowSummary struct {
+	Timestamp        time.Time        `json:"timestamp"`
+	Interval         float64          `json:"interval_s"`
+	Host             string           `json:"host"`
+	Environment      string           `json:"environment,omitempty"`
+	ServiceName      string           `json:"service_name,omitempty"`
+	DeploymentID     string           `json:"deployment_id,omitempty"`
+	Region           string           `json:"region,omitempty"`
+	Process          string           `json:"process,omitempty"`
+	DestIP           string           `json:"dest_ip"`
+	DestPort         int              `json:"dest_port"`
+	ServiceType      ServiceType      `json:"service_type"`
+	DatabaseType     DatabaseType     `json:"database_type,omitempty"`
+	MessageQueueType MessageQueueType `json:"message_queue_type,omitempty"`
+	// Connections counts the distinct sockets seen in the interval,
+	// including failed attempts
+	Connections int64 `json:"connections"`
+	// Errors counts failed connections by error code
+	Errors        map[string]int64 `json:"errors,omitempty"`
+	BytesSent     int64            `json:"bytes_sent"`
+	BytesReceived int64            `json:"bytes_received"`
+	// LatencyCount connections had a latency, in milliseconds, summed in
+	// LatencySum and counted per FlowLatencyBounds bucket in LatencyBuckets
+	LatencyCount   int64   `json:"latency_count"`
+	LatencySum     float64 `json:"latency_sum_ms"`
+	LatencyMax     float64 `json:"latency_max_ms"`
+	LatencyBuckets []int64 `json:"latency_buckets"`
+}
+
+// ErrorCount is the number of failed connections in the summary
+func (f *FlowSummary) ErrorCount() int64 {
+	var n int64
+	for _, count := range f.Errors {
+		n += count
+	}
+	return n
+}
+
+// FlowEdge is the traffic from a service to one destination over a time
+// range, rolled up from flow summaries
+type FlowEdge struct {
+	ServiceName   string      `json:"service_name"`
+	Environment   string      `json:"environment,omitempty"`
+	Process       string      `json:"process,omitempty"`
+	Destination   string      `json:"destination"`
+	ServiceType   ServiceType `json:"service_type"`
+	LastSeen      time.Time   `json:"last_seen"`
+	Connections   int64       `json:"connections"`
+	ErrorCount    int64       `json:"error_count"`
+	ErrorRate     float64     `json:"error_rate"`
+	BytesSent     int64       `json:"bytes_sent"`
+	BytesReceived int64       `json:"bytes_received"`
+	AvgLatency    float64     `json:"avg_latency"`
+	P95Latency    float64     `json:"p95_latency"`
+}
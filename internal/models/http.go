@@ -0,0 +1,86 @@
+package models
+
+import (
+	"time"
+)
+
+// HTTPLatencyBounds are the upper bounds, in milliseconds, of the latency
+// histogram in HTTPMetric; a last bucket counts anything slower
+var HTTPLatencyBounds = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// HTTPRequest is one request and its response, as seen by a collector
+type HTTPRequest struct {
+	Timestamp  time.Time `json:"timestamp"`
+	SourceIP   string    `json:"source_ip"`
+	SourcePort int       `json:"source_port"`
+	DestIP     string    `json:"dest_ip"`
+	DestPort   int       `json:"dest_port"`
+	Method     string    `json:"method"`
+	// Authority is the Host header or the host of an absolute URL
+	Authority  string `json:"authority,omitempty"`
+	Path       string `json:"path"`
+	StatusCode int    `json:"status_code"`
+	// Latency runs from the start of the request to the start of the
+	// response
+	Latency float64 `json:"latency_ms"`
+}
+
+// HTTPMetric counts the requests a collector saw to one endpoint over an
+// interval: their rate, errors and duration
+type HTTPMetric struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Interval    float64   `json:"interval_s"`
+	Host        string    `json:"host"`
+	Environment string    `json:"environment,omitempty"`
+	ServiceName string    `json:"service_name,omitempty"`
+	DestIP      string    `json:"dest_ip"`
+	DestPort    int       `json:"dest_port"`
+	Authority   string    `json:"authority,omitempty"`
+	Method      string    `json:"method"`
+	// Route is the path with IDs replaced by {id}
+	Route        string `json:"route"`
+	Requests     int64  `json:"requests"`
+	ClientErrors int64  `json:"client_errors"` // 4xx
+	ServerErrors int64  `json:"server_errors"` // 5xx
+	// LatencySum and LatencyMax are in milliseconds; LatencyBuckets counts
+	// requests per HTTPLatencyBounds bucket
+	LatencySum     float64 `json:"latency_sum_ms"`
+	LatencyMax     float64 `json:"latency_max_ms"`
+	LatencyBuckets []int64 `json:"latency_buckets"`
+	// Source is "capture" or "proxy"
+	Source string `json:"source,omitempty"`
+}
+
+// HTTPPoint is an endpoint's traffic over one bucket of time
+type HTTPPoint struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Requests     int64     `json:"requests"`
+	ServerErrors int64     `json:"server_errors"`
+	AvgLatency   float64   `json:"avg_latency"`
+	P95Latency   float64   `json:"p95_latency"`
+}
+
+// HTTPEndpoint summarizes the requests to one method and route of a
+// destination
+type HTTPEndpoint struct {
+	ServiceName  string    `json:"service_name"`
+	Environment  string    `json:"environment,omitempty"`
+	Destination  string    `json:"destination"`
+	Method       string    `json:"method"`
+	Route        string    `json:"route"`
+	LastSeen     time.Time `json:"last_seen"`
+	Requests     int64     `json:"requests"`
+	Rate         float64   `json:"rate"` // requests per second
+	ClientErrors int64     `json:"client_errors"`
+	ServerErrors int64     `json:"server_errors"`
+	// ErrorRate is the share of requests answered with a 5xx
+	ErrorRate float64 `json:"error_rate"`
+	// Latencies in milliseconds; percentiles are estimated from the
+	// histogram
+	AvgLatency float64     `json:"avg_latency"`
+	P50Latency float64     `json:"p50_latency"`
+	P95Latency float64     `json:"p95_latency"`
+	P99Latency float64     `json:"p99_latency"`
+	MaxLatency float64     `json:"max_latency"`
+	Series     []HTTPPoint `json:"series"`
+}
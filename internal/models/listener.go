@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+)
+
+// Listener is a socket accepting connections on a host
+type Listener struct {
+	Host          string     `json:"host"`
+	Environment   string     `json:"environment,omitempty"`
+	ServiceName   string     `json:"service_name,omitempty"`
+	Address       string     `json:"address"` // 0.0.0.0 or :: for every interface
+	Port          int        `json:"port"`
+	Protocol      string     `json:"protocol"`
+	PID           int        `json:"pid,omitempty"`
+	Process       string     `json:"process,omitempty"`
+	ContainerID   string     `json:"container_id,omitempty"`
+	ContainerName string     `json:"container_name,omitempty"`
+	FirstSeen     time.Time  `json:"first_seen"` // when it last started listening
+	LastSeen      time.Time  `json:"last_seen"`
+	ClosedAt      *time.Time `json:"closed_at,omitempty"`
+}
+
+// ListenerSnapshot is every socket listening on a host at one moment, as
+// reported by a collector
+type ListenerSnapshot struct {
+	Host        string     `json:"host"`
+	Environment string     `json:"environment,omitempty"`
+	ServiceName string     `json:"service_name,omitempty"`
+	Timestamp   time.Time  `json:"timestamp"`
+	Listeners   []Listener `json:"listeners"`
+}
+
+// ListenerChangeKind says whether a listener appeared or went away
+type ListenerChangeKind string
+
+const (
+	ListenerOpened ListenerChangeKind = "opened"
+	ListenerClosed ListenerChangeKind = "closed"
+)
+
+// ListenerChange records a listener appearing or going away between two
+// snapshots of a host
+type ListenerChange struct {
+	Timestamp     time.Time          `json:"timestamp"`
+	Kind          ListenerChangeKind `json:"kind"`
+	Host          string             `json:"host"`
+	Environment   string             `json:"environment,omitempty"`
+	Address       string             `json:"address"`
+	Port          int                `json:"port"`
+	Protocol      string             `json:"protocol"`
+	Process       string             `json:"process,omitempty"`
+	ContainerName string             `json:"container_name,omitempty"`
+}
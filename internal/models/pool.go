@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+)
+
+// PoolSample counts a process's established connections to one database
+// or cache endpoint at one moment, as reported by a collector
+type PoolSample struct {
+	Timestamp     time.Time    `json:"timestamp"`
+	Host          string       `json:"host"`
+	Environment   string       `json:"environment,omitempty"`
+	ServiceName   string       `json:"service_name,omitempty"`
+	Process       string       `json:"process,omitempty"`
+	ContainerName string       `json:"container_name,omitempty"`
+	DestIP        string       `json:"dest_ip"`
+	DestPort      int          `json:"dest_port"`
+	ServiceType   ServiceType  `json:"service_type"`
+	DatabaseType  DatabaseType `json:"database_type,omitempty"`
+	// Open is every established connection; Active and Idle split those
+	// whose activity is known by whether they carried data recently
+	Open   int `json:"open"`
+	Active int `json:"active"`
+	Idle   int `json:"idle"`
+	// Opened and Closed count connections since the previous sample,
+	// Interval seconds earlier
+	Opened   int     `json:"opened"`
+	Closed   int     `json:"closed"`
+	Interval float64 `json:"interval_s"`
+}
+
+// PoolPoint is a pool's usage over one bucket of time
+type PoolPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Open      int       `json:"open"`   // most open at once
+	Active    int       `json:"active"` // most active at once
+	Idle      int       `json:"idle"`   // idle when the most were open
+	Opened    int       `json:"opened"`
+	Closed    int       `json:"closed"`
+}
+
+// PoolSummary describes a process's pool of connections to one endpoint
+type PoolSummary struct {
+	ServiceName   string       `json:"service_name"`
+	Host          string       `json:"host"`
+	Environment   string       `json:"environment,omitempty"`
+	Process       string       `json:"process,omitempty"`
+	ContainerName string       `json:"container_name,omitempty"`
+	Destination   string       `json:"destination"`
+	ServiceType   ServiceType  `json:"service_type"`
+	DatabaseType  DatabaseType `json:"database_type,omitempty"`
+	LastSeen      time.Time    `json:"last_seen"`
+	Open          int          `json:"open"` // in the latest sample
+	Active        int          `json:"active"`
+	Idle          int          `json:"idle"`
+	PeakOpen      int          `json:"peak_open"`
+	PeakActive    int          `json:"peak_active"`
+	AvgOpen       float64      `json:"avg_open"`
+	// Utilization is the share of open connections active at the peak
+	Utilization float64 `json:"utilization"`
+	// ChurnPerMinute counts connections opened and closed per minute
+	OpenedPerMinute float64     `json:"opened_per_minute"`
+	ClosedPerMinute float64     `json:"closed_per_minute"`
+	Series          []PoolPoint `json:"series"`
+}
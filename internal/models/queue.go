@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+// QueueStats summarizes the connections to one kind of message queue
+type QueueStats struct {
+	Connections int `json:"connections"`
+	// Ports counts connections by the role of the port they reached:
+	// bootstrap or broker for Kafka, amqp, amqps, management, stream or
+	// clustering for RabbitMQ
+	Ports   map[string]int `json:"ports,omitempty"`
+	Brokers []*BrokerStats `json:"brokers,omitempty"`
+	// Clients are the client hosts, those reaching only part of a cluster
+	// first, then those opening the most connections
+	Clients []*QueueClient `json:"clients,omitempty"`
+	// PartialClients counts clients connected to only some of the brokers
+	// of a configured Kafka cluster
+	PartialClients int `json:"partial_clients"`
+}
+
+// BrokerStats describes the connections to one broker or node. Brokers of
+// configured clusters are named by their broker ID, others by address.
+type BrokerStats struct {
+	Cluster       string    `json:"cluster,omitempty"`
+	Broker        string    `json:"broker"`
+	Address       string    `json:"address"`
+	Connections   int       `json:"connections"`
+	Clients       int       `json:"clients"`
+	Errors        int       `json:"errors"`
+	AvgLatency    float64   `json:"avg_latency_ms"`
+	BytesSent     int64     `json:"bytes_sent"`
+	BytesReceived int64     `json:"bytes_received"`
+	LastSeen      time.Time `json:"last_seen"`
+}
+
+// QueueClient describes the connections one client host made to a queue
+// cluster
+type QueueClient struct {
+	Cluster     string `json:"cluster,omitempty"`
+	Host        string `json:"host"`
+	ServiceName string `json:"service_name"`
+	// Connections counts distinct sockets, however often each was reported
+	Connections    int      `json:"connections"`
+	ChurnPerMinute float64  `json:"churn_per_minute"`
+	Brokers        []string `json:"brokers"`
+	// MissingBrokers lists the brokers of a configured Kafka cluster the
+	// client never connected to
+	MissingBrokers []string `json:"missing_brokers,omitempty"`
+}
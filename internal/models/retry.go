@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// RetryOutcome is how a retry sequence ended
+type RetryOutcome string
+
+const (
+	RetrySucceeded RetryOutcome = "succeeded"
+	RetryFailed    RetryOutcome = "failed"  // the client gave up
+	RetryOngoing   RetryOutcome = "ongoing" // still retrying at the end of the range
+)
+
+// RetrySequence is a run of failed or short-lived connections from one
+// client to one destination, each retrying the last
+type RetrySequence struct {
+	ServiceName   string         `json:"service_name"`
+	Host          string         `json:"host,omitempty"`
+	SourceIP      string         `json:"source_ip"`
+	ContainerName string         `json:"container_name,omitempty"`
+	Destination   string         `json:"destination"`
+	Start         time.Time      `json:"start"`
+	End           time.Time      `json:"end"` // start of the last attempt
+	Attempts      int            `json:"attempts"`
+	Retries       int            `json:"retries"`
+	Outcome       RetryOutcome   `json:"outcome"`
+	Errors        map[string]int `json:"errors,omitempty"`
+	LastError     string         `json:"last_error,omitempty"`
+	// Intervals are the pauses between successive attempts
+	Intervals      []float64 `json:"intervals_ms"`
+	MedianInterval float64   `json:"median_interval_ms"`
+	// BackoffFactor is the median ratio of successive intervals, about 2
+	// for exponential backoff and 1 for a fixed delay
+	BackoffFactor float64 `json:"backoff_factor"`
+	Backoff       string  `json:"backoff"` // none, fixed, exponential or unknown
+}
+
+// ServiceRetries summarizes the retry sequences of one service
+type ServiceRetries struct {
+	ServiceName string           `json:"service_name"`
+	Sequences   int              `json:"sequences"`
+	Retries     int              `json:"retries"`
+	Failed      int              `json:"failed"`
+	Ongoing     int              `json:"ongoing"`
+	Worst       []*RetrySequence `json:"worst"`
+}
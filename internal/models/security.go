@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+)
+
+// PolicyMode controls what an egress policy does with violations
+type PolicyMode string
+
+const (
+	// PolicyEnforce raises a security event for every violation
+	PolicyEnforce PolicyMode = "enforce"
+	// PolicyLearning only observes, while traffic is gathered to propose
+	// an allowlist
+	PolicyLearning PolicyMode = "learning"
+)
+
+// EgressRule allows destinations. Every field that is set must match; a
+// rule needs at least one.
+type EgressRule struct {
+	CIDR     string `json:"cidr,omitempty"`
+	Hostname string `json:"hostname,omitempty"` // * matches any run of characters
+	Ports    []int  `json:"ports,omitempty"`    // empty allows every port
+	Comment  string `json:"comment,omitempty"`
+}
+
+// EgressPolicy lists the destinations a service may connect to. Saving a
+// policy creates a new version; the newest version is in effect.
+type EgressPolicy struct {
+	ServiceName string       `json:"service_name"`
+	Environment string       `json:"environment,omitempty"` // empty for every environment
+	Version     int          `json:"version"`
+	Mode        PolicyMode   `json:"mode"`
+	Rules       []EgressRule `json:"rules"`
+	CreatedAt   time.Time    `json:"created_at"`
+	CreatedBy   string       `json:"created_by,omitempty"`
+}
+
+// SecurityEventKind classifies a security event
+type SecurityEventKind string
+
+const (
+	SecurityPolicyViolation SecurityEventKind = "policy_violation"
+	SecurityNewDestination  SecurityEventKind = "new_destination"
+	SecurityNewListener     SecurityEventKind = "new_listener"
+	SecurityPortScan        SecurityEventKind = "port_scan"
+	SecuritySynFlood        SecurityEventKind = "syn_flood"
+)
+
+// SecurityEvent is a connection that broke an egress policy or reached a
+// destination its service had never used, or a new listening socket. For a
+// listener, Destination, DestIP and DestPort describe the listening socket.
+type SecurityEvent struct {
+	ID            string            `json:"id"`
+	Timestamp     time.Time         `json:"timestamp"`
+	Kind          SecurityEventKind `json:"kind"`
+	ServiceName   string            `json:"service_name"`
+	Environment   string            `json:"environment,omitempty"`
+	Host          string            `json:"host,omitempty"`
+	Destination   string            `json:"destination"`
+	DestIP        string            `json:"dest_ip"`
+	DestPort      int               `json:"dest_port"`
+	ConnectionID  string            `json:"connection_id"`
+	PolicyVersion int               `json:"policy_version,omitempty"`
+	Message       string            `json:"message"`
+}
@@ -0,0 +1,58 @@
+package monitor
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// ListenerSource is implemented by connection sources that can also list
+// the sockets listening on the host
+type ListenerSource interface {
+	Listeners() ([]models.Listener, error)
+}
+
+// listenSet holds the local addresses accepting connections
+type listenSet map[string]bool
+
+// wildcard stands for every local address
+const wildcard = "*"
+
+func (l listenSet) add(ip string, port int) {
+	if isWildcard(ip) {
+		ip = wildcard
+	}
+	l[ip+"|"+strconv.Itoa(port)] = true
+}
+
+func (l listenSet) has(ip string, port int) bool {
+	return l[ip+"|"+strconv.Itoa(port)] || l[wildcard+"|"+strconv.Itoa(port)]
+}
+
+func isWildcard(ip string) bool {
+	return ip == wildcard || ip == "0.0.0.0" || ip == "::"
+}
+
+// orient sets the direction of a socket read from the local side, with
+// Source as the local end. Inbound connections are turned around so that
+// Source is the peer that opened the connection and Dest the local
+// listening socket.
+func orient(conn *models.Connection, listening listenSet) {
+	if listening.has(conn.SourceIP, conn.SourcePort) {
+		conn.SourceIP, conn.DestIP = conn.DestIP, conn.SourceIP
+		conn.SourcePort, conn.DestPort = conn.DestPort, conn.SourcePort
+		conn.Direction = models.DirectionInbound
+	} else {
+		conn.Direction = models.DirectionOutbound
+	}
+
+	if isLoopback(conn.SourceIP) || isLoopback(conn.DestIP) || conn.SourceIP == conn.DestIP {
+		conn.Direction = models.DirectionLocal
+	}
+}
+
+func isLoopback(ip string) bool {
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.IsLoopback()
+}
@@ -32,8 +32,10 @@ var servicePorts = map[int]struct {
 	6379:  {models.ServiceTypeDatabase, models.DatabaseTypeRedis, "", "Redis"},
 
 	// Message Queues
-	5672: {models.ServiceTypeMessageQueue, "", models.MessageQueueTypeRabbitMQ, "RabbitMQ"},
-	9092: {models.ServiceTypeMessageQueue, "", models.MessageQueueTypeKafka, "Kafka"},
+	5672:  {models.ServiceTypeMessageQueue, "", models.MessageQueueTypeRabbitMQ, "RabbitMQ"},
+	5671:  {models.ServiceTypeMessageQueue, "", models.MessageQueueTypeRabbitMQ, "RabbitMQ-TLS"},
+	15672: {models.ServiceTypeMessageQueue, "", models.MessageQueueTypeRabbitMQ, "RabbitMQ-Management"},
+	9092:  {models.ServiceTypeMessageQueue, "", models.MessageQueueTypeKafka, "Kafka"},
 
 	// Other common services
 	80:   {models.ServiceTypeAPI, "", "", "HTTP"},
@@ -41,12 +43,36 @@ var servicePorts = map[int]struct {
 	8080: {models.ServiceTypeAPI, "", "", "HTTP-Alt"},
 }
 
+// Classifier refines the port-based service detection of a connection,
+// reporting whether it recognised the protocol
+type Classifier interface {
+	Classify(conn *models.Connection) bool
+}
+
+// ConnectionSource produces connection observations for the monitor
+type ConnectionSource interface {
+	// Run passes each observed connection to emit until stop is closed or
+	// the source is exhausted
+	Run(stop <-chan struct{}, emit func(*models.Connection)) error
+}
+
+// HostnameResolver maps destination addresses to the hostname they were
+// resolved from, along with the resolution latency in milliseconds
+type HostnameResolver interface {
+	Hostname(ip string) (string, float64, bool)
+}
+
 // NetworkMonitor tracks network connections and errors
 type NetworkMonitor struct {
-	storage  storage.Storage
-	stop     chan struct{}
-	wg       sync.WaitGroup
-	connChan chan *models.Connection
+	storage     storage.Storage
+	stop        chan struct{}
+	wg          sync.WaitGroup
+	connChan    chan *models.Connection
+	source      ConnectionSource
+	extra       []ConnectionSource
+	classifiers []Classifier
+	resolver    HostnameResolver
+	retries     *retryTracker
 }
 
 // NewNetworkMonitor creates a new network monitor instance
@@ -54,17 +80,22 @@ func NewNetworkMonitor(storage storage.Storage) *NetworkMonitor {
 	// Initialize random number generator with current time as seed
 	rand.Seed(time.Now().UnixNano())
 
-	return &NetworkMonitor{
+	m := &NetworkMonitor{
 		storage:  storage,
 		stop:     make(chan struct{}),
 		connChan: make(chan *models.Connection, 100),
+		retries:  newRetryTracker(DefaultRetryWindow),
 	}
+	m.source = NewNetstatSource(time.Second)
+	return m
 }
 
 // Start begins monitoring network connections
 func (m *NetworkMonitor) Start() {
-	m.wg.Add(1)
-	go m.monitorConnections()
+	for _, source := range append([]ConnectionSource{m.source}, m.extra...) {
+		m.wg.Add(1)
+		go m.monitorConnections(source)
+	}
 }
 
 // Stop gracefully stops the monitor
@@ -73,114 +104,242 @@ func (m *NetworkMonitor) Stop() {
 	m.wg.Wait()
 }
 
-func (m *NetworkMonitor) monitorConnections() {
+func (m *NetworkMonitor) monitorConnections(source ConnectionSource) {
 	defer m.wg.Done()
 
-	ticker := time.NewTicker(time.Second)
+	emit := func(conn *models.Connection) { m.handleConnection(source, conn) }
+	if err := source.Run(m.stop, emit); err != nil {
+		log.Printf("Connection source stopped: %v", err)
+	}
+}
+
+// handleConnection classifies a connection from any source and forwards it
+func (m *NetworkMonitor) handleConnection(source ConnectionSource, conn *models.Connection) {
+	// Identify service type based on port
+	if serviceInfo, ok := servicePorts[conn.DestPort]; ok {
+		conn.ServiceType = serviceInfo.ServiceType
+		conn.DatabaseType = serviceInfo.DatabaseType
+		conn.MessageQueueType = serviceInfo.MessageQueueType
+		conn.ServiceName = serviceInfo.Name
+	}
+
+	// Let protocol fingerprinting override the port-based guess
+	for _, c := range m.classifiers {
+		if c.Classify(conn) {
+			break
+		}
+	}
+
+	// Attach the hostname the destination was resolved from
+	if m.resolver != nil && conn.DestHostname == "" {
+		if hostname, latency, ok := m.resolver.Hostname(conn.DestIP); ok {
+			conn.DestHostname = hostname
+			conn.DNSLatency = latency
+		}
+	}
+
+	// Count earlier failed attempts to the same endpoint as retries
+	m.retries.observe(conn)
+
+	// Add additional metadata
+	if conn.Metadata == nil {
+		conn.Metadata = make(map[string]interface{})
+	}
+	conn.Metadata["protocol"] = conn.Protocol
+	conn.Metadata["detected_at"] = time.Now().Format(time.RFC3339)
+
+	// Offline replays wait for the consumer so no records are lost
+	if offline, ok := source.(interface{ Offline() bool }); ok && offline.Offline() {
+		select {
+		case m.connChan <- conn:
+		case <-m.stop:
+		}
+		return
+	}
+
+	// Only send to channel, don't store locally
+	select {
+	case m.connChan <- conn:
+	default:
+		log.Println("Connection channel full, dropping connection")
+	}
+}
+
+// NetstatSource polls `netstat -an` for open TCP sockets
+type NetstatSource struct {
+	interval time.Duration
+}
+
+// NewNetstatSource creates a source polling netstat at the given interval
+func NewNetstatSource(interval time.Duration) *NetstatSource {
+	return &NetstatSource{interval: interval}
+}
+
+// Run polls netstat until stop is closed
+func (s *NetstatSource) Run(stop <-chan struct{}, emit func(*models.Connection)) error {
+	ticker := time.NewTicker(s.interval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-m.stop:
-			return
+		case <-stop:
+			return nil
 		case <-ticker.C:
-			m.checkConnections()
+			s.checkConnections(emit)
 		}
 	}
 }
 
-func (m *NetworkMonitor) checkConnections() {
-	cmd := exec.Command("netstat", "-an")
-	output, err := cmd.Output()
+func (s *NetstatSource) checkConnections(emit func(*models.Connection)) {
+	conns, err := netstatSockets()
 	if err != nil {
 		log.Printf("Error running netstat: %v", err)
 		return
 	}
 
+	listening := make(listenSet)
+	for _, conn := range conns {
+		if conn.TCPState == "LISTEN" {
+			listening.add(conn.SourceIP, conn.SourcePort)
+		}
+	}
+
 	// Keep track of connections seen in this check
 	seenConnections := make(map[string]bool)
 
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
-	for scanner.Scan() {
-		line := scanner.Text()
-		if !strings.Contains(line, "tcp") {
+	for _, conn := range conns {
+		if conn.TCPState == "LISTEN" {
 			continue
 		}
+		orient(conn, listening)
 
-		conn := m.parseConnection(line)
-		if conn != nil {
-			// Create a connection key without timestamp and random component
-			connKey := fmt.Sprintf("%s:%d-%s:%d", conn.SourceIP, conn.SourcePort, conn.DestIP, conn.DestPort)
+		// Create a connection key without timestamp and random component
+		connKey := fmt.Sprintf("%s:%d-%s:%d", conn.SourceIP, conn.SourcePort, conn.DestIP, conn.DestPort)
 
-			// Skip if we've already seen this connection in this check
-			if seenConnections[connKey] {
-				continue
-			}
-			seenConnections[connKey] = true
-
-			// Identify service type based on port
-			if serviceInfo, ok := servicePorts[conn.DestPort]; ok {
-				conn.ServiceType = serviceInfo.ServiceType
-				conn.DatabaseType = serviceInfo.DatabaseType
-				conn.MessageQueueType = serviceInfo.MessageQueueType
-				conn.ServiceName = serviceInfo.Name
-			}
+		// Skip if we've already seen this connection in this check
+		if seenConnections[connKey] {
+			continue
+		}
+		seenConnections[connKey] = true
 
-			// Add additional metadata
-			conn.Metadata = map[string]interface{}{
-				"protocol":    "TCP",
-				"detected_at": time.Now().Format(time.RFC3339),
-			}
+		emit(conn)
+	}
+}
 
-			// Only send to channel, don't store locally
-			select {
-			case m.connChan <- conn:
-			default:
-				log.Println("Connection channel full, dropping connection")
-			}
+// Listeners lists the TCP sockets listening on the host. netstat does not
+// report their owning processes without elevated privileges.
+func (s *NetstatSource) Listeners() ([]models.Listener, error) {
+	conns, err := netstatSockets()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run netstat: %v", err)
+	}
+
+	var listeners []models.Listener
+	for _, conn := range conns {
+		if conn.TCPState != "LISTEN" {
+			continue
 		}
+		listeners = append(listeners, models.Listener{
+			Address:  conn.SourceIP,
+			Port:     conn.SourcePort,
+			Protocol: "TCP",
+		})
 	}
+	return listeners, nil
 }
 
-func (m *NetworkMonitor) parseConnection(line string) *models.Connection {
-	fields := strings.Fields(line)
-	if len(fields) < 4 {
-		return nil
+// Sockets lists the established TCP sockets on the host, without their
+// owning processes
+func (s *NetstatSource) Sockets() ([]Socket, error) {
+	conns, err := netstatSockets()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run netstat: %v", err)
 	}
 
-	// Skip header lines and non-TCP lines
-	if !strings.Contains(line, "tcp") {
-		return nil
+	listening := make(listenSet)
+	for _, conn := range conns {
+		if conn.TCPState == "LISTEN" {
+			listening.add(conn.SourceIP, conn.SourcePort)
+		}
 	}
 
-	// Parse local address (format: "192.168.1.36.52066" on macOS)
-	localAddr := fields[3]
-	localParts := strings.Split(localAddr, ".")
-	if len(localParts) < 2 {
-		return nil
+	var sockets []Socket
+	for _, conn := range conns {
+		if conn.TCPState != "ESTABLISHED" {
+			continue
+		}
+		id := tupleKey(conn.SourceIP, conn.SourcePort, conn.DestIP, conn.DestPort)
+		accepted := listening.has(conn.SourceIP, conn.SourcePort)
+		orient(conn, listening)
+		sockets = append(sockets, Socket{
+			ID:         id,
+			SourceIP:   conn.SourceIP,
+			SourcePort: conn.SourcePort,
+			DestIP:     conn.DestIP,
+			DestPort:   conn.DestPort,
+			Accepted:   accepted,
+		})
 	}
+	return sockets, nil
+}
 
-	// Handle IPv4 addresses with dots
-	sourceIP := strings.Join(localParts[:len(localParts)-1], ".")
-	sourcePort, err := strconv.Atoi(localParts[len(localParts)-1])
+// netstatSockets lists the TCP sockets reported by `netstat -an`
+func netstatSockets() ([]*models.Connection, error) {
+	output, err := exec.Command("netstat", "-an").Output()
 	if err != nil {
+		return nil, err
+	}
+
+	var conns []*models.Connection
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		if conn := parseConnection(scanner.Text()); conn != nil {
+			conns = append(conns, conn)
+		}
+	}
+	return conns, scanner.Err()
+}
+
+// netstatStates maps the macOS names of TCP states to the Linux ones
+var netstatStates = map[string]string{
+	"SYN_RCVD":   "SYN_RECV",
+	"FIN_WAIT_1": "FIN_WAIT1",
+	"FIN_WAIT_2": "FIN_WAIT2",
+	"CLOSED":     "CLOSE",
+}
+
+func parseConnection(line string) *models.Connection {
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
 		return nil
 	}
 
-	// Parse remote address (format: "34.139.23.89.9092" on macOS)
-	remoteAddr := fields[4]
-	remoteParts := strings.Split(remoteAddr, ".")
-	if len(remoteParts) < 2 {
+	// Skip header lines and non-TCP lines
+	if !strings.HasPrefix(fields[0], "tcp") {
 		return nil
 	}
 
-	// Handle IPv4 addresses with dots
-	destIP := strings.Join(remoteParts[:len(remoteParts)-1], ".")
-	destPort, err := strconv.Atoi(remoteParts[len(remoteParts)-1])
-	if err != nil {
+	// Local address, "192.168.1.36.52066" on macOS or "192.168.1.36:52066"
+	// on Linux
+	sourceIP, sourcePort, ok := parseNetstatAddr(fields[3], fields[0])
+	if !ok {
 		return nil
 	}
 
+	// Remote address, "*.*" or "0.0.0.0:*" for listening sockets
+	destIP, destPort, ok := parseNetstatAddr(fields[4], fields[0])
+	if !ok {
+		return nil
+	}
+
+	state := ""
+	if len(fields) > 5 {
+		state = fields[5]
+		if normalized, ok := netstatStates[state]; ok {
+			state = normalized
+		}
+	}
+
 	// Create connection object with timestamp-based ID and random component
 	timestamp := time.Now()
 	random := rand.Int63n(1000000) // Add a random number between 0 and 999999
@@ -192,6 +351,7 @@ func (m *NetworkMonitor) parseConnection(line string) *models.Connection {
 		DestIP:           destIP,
 		DestPort:         destPort,
 		Protocol:         "TCP",
+		TCPState:         state,
 		ServiceType:      models.ServiceTypeOther,
 		DatabaseType:     models.DatabaseTypeOther,
 		MessageQueueType: models.MessageQueueTypeOther,
@@ -201,6 +361,31 @@ func (m *NetworkMonitor) parseConnection(line string) *models.Connection {
 	return conn
 }
 
+// parseNetstatAddr splits an address at its last dot (macOS) or colon
+// (Linux). A "*" address is every interface and a "*" port is 0.
+func parseNetstatAddr(addr, proto string) (string, int, bool) {
+	i := strings.LastIndexAny(addr, ".:")
+	if i <= 0 {
+		return "", 0, false
+	}
+
+	ip, portStr := addr[:i], addr[i+1:]
+	if ip == wildcard {
+		ip = "0.0.0.0"
+		if proto == "tcp6" {
+			ip = "::"
+		}
+	}
+	if portStr == wildcard {
+		return ip, 0, true
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, false
+	}
+	return ip, port, true
+}
+
 func getProcessID(localAddr string) (int, error) {
 	var cmd *exec.Cmd
 	switch runtime.GOOS {
@@ -272,3 +457,30 @@ func getProcessInfo(pid int) (string, string, error) {
 func (m *NetworkMonitor) SetConnectionChannel(ch chan *models.Connection) {
 	m.connChan = ch
 }
+
+// AddClassifier registers a classifier consulted, in order, after port-based
+// service detection
+func (m *NetworkMonitor) AddClassifier(c Classifier) {
+	m.classifiers = append(m.classifiers, c)
+}
+
+// SetSource replaces the default netstat source
+func (m *NetworkMonitor) SetSource(source ConnectionSource) {
+	m.source = source
+}
+
+// AddSource runs an additional connection source alongside the main one
+func (m *NetworkMonitor) AddSource(source ConnectionSource) {
+	m.extra = append(m.extra, source)
+}
+
+// SetResolver sets the resolver used to attach destination hostnames
+func (m *NetworkMonitor) SetResolver(resolver HostnameResolver) {
+	m.resolver = resolver
+}
+
+// SetRetryWindow sets how long after a failed attempt a new attempt to the
+// same endpoint counts as a retry
+func (m *NetworkMonitor) SetRetryWindow(window time.Duration) {
+	m.retries = newRetryTracker(window)
+}
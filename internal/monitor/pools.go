@@ -0,0 +1,168 @@
+package monitor
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// Socket is an established TCP socket on the host, oriented like a
+// connection so that Source opened it
+type Socket struct {
+	// ID is the socket's inode, or its addresses when that is unknown
+	ID         string
+	SourceIP   string
+	SourcePort int
+	DestIP     string
+	DestPort   int
+	// Accepted is set when the local end is a listening port, so the
+	// socket is the server side of the connection
+	Accepted      bool
+	PID           int
+	Process       string
+	ContainerID   string
+	ContainerName string
+}
+
+// SocketSource is implemented by connection sources that can list the
+// established sockets on the host
+type SocketSource interface {
+	Sockets() ([]Socket, error)
+}
+
+// tupleKey identifies a socket by its local and remote addresses
+func tupleKey(localIP string, localPort int, remoteIP string, remotePort int) string {
+	return localIP + ":" + strconv.Itoa(localPort) + "-" + remoteIP + ":" + strconv.Itoa(remotePort)
+}
+
+// poolKey identifies a process's connections to one endpoint
+type poolKey struct {
+	containerID string
+	process     string
+	destIP      string
+	destPort    int
+}
+
+// PoolSampler counts the connections each process holds open to databases
+// and caches, telling active from idle ones by how recently they carried
+// data
+type PoolSampler struct {
+	source SocketSource
+	// activeWithin is how recently a connection must have carried data to
+	// count as active
+	activeWithin time.Duration
+
+	previous     map[poolKey]map[string]bool
+	previousInfo map[poolKey]models.PoolSample
+	lastSample   time.Time
+	warned       bool
+}
+
+// NewPoolSampler creates a sampler over the sockets of source.
+// Connections that carried data within activeWithin count as active.
+func NewPoolSampler(source SocketSource, activeWithin time.Duration) *PoolSampler {
+	return &PoolSampler{source: source, activeWithin: activeWithin}
+}
+
+// Sample counts the pools open now. Opened and closed connections are
+// counted against the previous sample, so the first sample only sets the
+// baseline for them. Pools that have closed every connection are reported
+// once more with nothing open.
+func (p *PoolSampler) Sample(now time.Time) ([]models.PoolSample, error) {
+	sockets, err := p.source.Sockets()
+	if err != nil {
+		return nil, err
+	}
+	idle, err := socketActivity()
+	if err != nil && !p.warned {
+		log.Printf("Connection activity unavailable, pools will not split active and idle connections: %v", err)
+		p.warned = true
+	}
+
+	current := make(map[poolKey]map[string]bool)
+	samples := make(map[poolKey]*models.PoolSample)
+	var order []poolKey
+	for _, s := range sockets {
+		info, ok := servicePorts[s.DestPort]
+		if s.Accepted || !ok || (info.ServiceType != models.ServiceTypeDatabase && info.ServiceType != models.ServiceTypeCache) {
+			continue
+		}
+		key := poolKey{s.ContainerID, s.Process, s.DestIP, s.DestPort}
+		sample, ok := samples[key]
+		if !ok {
+			sample = &models.PoolSample{
+				Timestamp:     now,
+				Process:       s.Process,
+				ContainerName: s.ContainerName,
+				DestIP:        s.DestIP,
+				DestPort:      s.DestPort,
+				ServiceType:   info.ServiceType,
+				DatabaseType:  info.DatabaseType,
+			}
+			samples[key] = sample
+			current[key] = make(map[string]bool)
+			order = append(order, key)
+		}
+		current[key][s.ID] = true
+		sample.Open++
+
+		d, known := idle[s.ID]
+		if !known {
+			d, known = idle[tupleKey(s.SourceIP, s.SourcePort, s.DestIP, s.DestPort)]
+		}
+		if known {
+			if d < p.activeWithin {
+				sample.Active++
+			} else {
+				sample.Idle++
+			}
+		}
+	}
+
+	// Pools gone since the last sample
+	for key, info := range p.previousInfo {
+		if _, ok := samples[key]; !ok {
+			drained := info
+			drained.Timestamp = now
+			drained.Open, drained.Active, drained.Idle, drained.Opened, drained.Closed = 0, 0, 0, 0, 0
+			samples[key] = &drained
+			current[key] = map[string]bool{}
+			order = append(order, key)
+		}
+	}
+
+	var interval float64
+	if !p.lastSample.IsZero() {
+		interval = now.Sub(p.lastSample).Seconds()
+	}
+	result := make([]models.PoolSample, 0, len(order))
+	previousInfo := make(map[poolKey]models.PoolSample)
+	for _, key := range order {
+		sample := samples[key]
+		sample.Interval = interval
+		if p.previous != nil {
+			before := p.previous[key]
+			for id := range current[key] {
+				if !before[id] {
+					sample.Opened++
+				}
+			}
+			for id := range before {
+				if !current[key][id] {
+					sample.Closed++
+				}
+			}
+		}
+		if sample.Open > 0 {
+			previousInfo[key] = *sample
+		}
+		result = append(result, *sample)
+	}
+
+	p.previous = current
+	p.previousInfo = previousInfo
+	p.lastSample = now
+	return result, nil
+}
@@ -0,0 +1,433 @@
+package monitor
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/container"
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// tcpStates names the TCP states written to /proc/net/tcp
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+}
+
+// reportedStates are the states of sockets reported as connections: open,
+// and opening in either direction
+var reportedStates = map[string]bool{
+	"ESTABLISHED": true,
+	"SYN_SENT":    true,
+	"SYN_RECV":    true,
+}
+
+// ProcfsSource reads TCP sockets from /proc for every network namespace on
+// the host, so connections made inside containers are visible to a collector
+// running on the host (or in a container with the host's /proc mounted).
+// Connections are tagged with the owning container.
+type ProcfsSource struct {
+	procRoot string
+	interval time.Duration
+	runtime  *container.Runtime
+}
+
+// NewProcfsSource creates a source polling procRoot (usually /proc, or e.g.
+// /host/proc inside a container) at the given interval
+func NewProcfsSource(procRoot string, interval time.Duration) *ProcfsSource {
+	return &ProcfsSource{procRoot: procRoot, interval: interval}
+}
+
+// SetRuntime sets the container runtime used to look up names and images
+func (s *ProcfsSource) SetRuntime(runtime *container.Runtime) {
+	s.runtime = runtime
+}
+
+// Run polls the socket tables until stop is closed
+func (s *ProcfsSource) Run(stop <-chan struct{}, emit func(*models.Connection)) error {
+	if _, err := os.Stat(filepath.Join(s.procRoot, "self", "net", "tcp")); err != nil {
+		return fmt.Errorf("procfs source unavailable: %v", err)
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			s.checkConnections(emit)
+		}
+	}
+}
+
+// namespace is a network namespace and the processes inside it
+type namespace struct {
+	inode string
+	pids  []int
+}
+
+func (s *ProcfsSource) checkConnections(emit func(*models.Connection)) {
+	namespaces, err := s.namespaces()
+	if err != nil {
+		log.Printf("Error listing network namespaces: %v", err)
+		return
+	}
+
+	seenConnections := make(map[string]bool)
+	processes := make(map[int]string)
+	for _, ns := range namespaces {
+		sockets := s.socketOwners(ns.pids)
+		entries := s.readNamespace(ns)
+
+		listening := make(listenSet)
+		for _, entry := range entries {
+			if entry.conn.TCPState == "LISTEN" {
+				listening.add(entry.conn.SourceIP, entry.conn.SourcePort)
+			}
+		}
+
+		for _, entry := range entries {
+			conn := entry.conn
+			if !reportedStates[conn.TCPState] {
+				continue
+			}
+			orient(conn, listening)
+
+			connKey := fmt.Sprintf("%s-%s:%d-%s:%d", ns.inode, conn.SourceIP, conn.SourcePort, conn.DestIP, conn.DestPort)
+			if seenConnections[connKey] {
+				continue
+			}
+			seenConnections[connKey] = true
+
+			// Containers on one bridge network reuse the same addresses,
+			// so the namespace keeps their connections apart downstream
+			if conn.Metadata == nil {
+				conn.Metadata = make(map[string]interface{})
+			}
+			conn.Metadata["netns"] = ns.inode
+
+			// Attribute the socket to its owning process when known,
+			// otherwise to the namespace as a whole
+			pid, ok := sockets[entry.inode]
+			if ok {
+				name, cached := processes[pid]
+				if !cached {
+					name = s.processName(pid)
+					processes[pid] = name
+				}
+				if name != "" {
+					conn.Metadata["process"] = name
+				}
+			} else {
+				pid = ns.pids[0]
+			}
+			s.tagContainer(conn, pid)
+
+			emit(conn)
+		}
+	}
+}
+
+// readNamespace reads the TCP sockets of a network namespace. Any process
+// in the namespace can read its socket tables.
+func (s *ProcfsSource) readNamespace(ns namespace) []tcpEntry {
+	var entries []tcpEntry
+	for _, file := range []string{"tcp", "tcp6"} {
+		path := fmt.Sprintf("%s/%d/net/%s", s.procRoot, ns.pids[0], file)
+		table, err := readTCPTable(path)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, table...)
+	}
+	return entries
+}
+
+// Listeners lists the TCP sockets listening in every network namespace,
+// with the process that owns each one
+func (s *ProcfsSource) Listeners() ([]models.Listener, error) {
+	namespaces, err := s.namespaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list network namespaces: %v", err)
+	}
+
+	var listeners []models.Listener
+	for _, ns := range namespaces {
+		var sockets map[string]int
+		for _, entry := range s.readNamespace(ns) {
+			if entry.conn.TCPState != "LISTEN" {
+				continue
+			}
+			if sockets == nil {
+				sockets = s.socketOwners(ns.pids)
+			}
+
+			l := models.Listener{
+				Address:  entry.conn.SourceIP,
+				Port:     entry.conn.SourcePort,
+				Protocol: "TCP",
+			}
+			pid, ok := sockets[entry.inode]
+			if ok {
+				l.PID = pid
+				l.Process = s.processName(pid)
+			} else {
+				pid = ns.pids[0]
+			}
+
+			// Reuse the container lookup made for connections
+			tagged := &models.Connection{}
+			s.tagContainer(tagged, pid)
+			l.ContainerID = tagged.ContainerID
+			l.ContainerName = tagged.ContainerName
+			listeners = append(listeners, l)
+		}
+	}
+	return listeners, nil
+}
+
+// Sockets lists the established TCP sockets in every network namespace,
+// with the process and container that own each one
+func (s *ProcfsSource) Sockets() ([]Socket, error) {
+	namespaces, err := s.namespaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list network namespaces: %v", err)
+	}
+
+	var sockets []Socket
+	for _, ns := range namespaces {
+		entries := s.readNamespace(ns)
+		listening := make(listenSet)
+		for _, entry := range entries {
+			if entry.conn.TCPState == "LISTEN" {
+				listening.add(entry.conn.SourceIP, entry.conn.SourcePort)
+			}
+		}
+
+		var owners map[string]int
+		for _, entry := range entries {
+			conn := entry.conn
+			if conn.TCPState != "ESTABLISHED" {
+				continue
+			}
+			if owners == nil {
+				owners = s.socketOwners(ns.pids)
+			}
+			accepted := listening.has(conn.SourceIP, conn.SourcePort)
+			orient(conn, listening)
+
+			socket := Socket{
+				ID:         entry.inode,
+				SourceIP:   conn.SourceIP,
+				SourcePort: conn.SourcePort,
+				DestIP:     conn.DestIP,
+				DestPort:   conn.DestPort,
+				Accepted:   accepted,
+			}
+			pid, ok := owners[entry.inode]
+			if ok {
+				socket.PID = pid
+				socket.Process = s.processName(pid)
+			} else {
+				pid = ns.pids[0]
+			}
+			s.tagContainer(conn, pid)
+			socket.ContainerID = conn.ContainerID
+			socket.ContainerName = conn.ContainerName
+			sockets = append(sockets, socket)
+		}
+	}
+	return sockets, nil
+}
+
+// processName reads a process's command name
+func (s *ProcfsSource) processName(pid int) string {
+	comm, err := os.ReadFile(fmt.Sprintf("%s/%d/comm", s.procRoot, pid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(comm))
+}
+
+// namespaces groups the host's processes by network namespace
+func (s *ProcfsSource) namespaces() ([]namespace, error) {
+	entries, err := os.ReadDir(s.procRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	byInode := make(map[string]*namespace)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		// Link target looks like "net:[4026531992]"
+		link, err := os.Readlink(fmt.Sprintf("%s/%d/ns/net", s.procRoot, pid))
+		if err != nil {
+			continue
+		}
+
+		ns, ok := byInode[link]
+		if !ok {
+			ns = &namespace{inode: strings.TrimSuffix(strings.TrimPrefix(link, "net:["), "]")}
+			byInode[link] = ns
+		}
+		ns.pids = append(ns.pids, pid)
+	}
+
+	namespaces := make([]namespace, 0, len(byInode))
+	for _, ns := range byInode {
+		sort.Ints(ns.pids)
+		namespaces = append(namespaces, *ns)
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].pids[0] < namespaces[j].pids[0] })
+	return namespaces, nil
+}
+
+// socketOwners maps socket inodes to the process holding them
+func (s *ProcfsSource) socketOwners(pids []int) map[string]int {
+	owners := make(map[string]int)
+	for _, pid := range pids {
+		dir := fmt.Sprintf("%s/%d/fd", s.procRoot, pid)
+		fds, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			// Link target looks like "socket:[123456]"
+			link, err := os.Readlink(filepath.Join(dir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+			if _, ok := owners[inode]; !ok {
+				owners[inode] = pid
+			}
+		}
+	}
+	return owners
+}
+
+// tagContainer sets the container fields for a process running in one
+func (s *ProcfsSource) tagContainer(conn *models.Connection, pid int) {
+	id := container.IDForPID(s.procRoot, pid)
+	if id == "" {
+		return
+	}
+
+	conn.ContainerID = id
+	if s.runtime != nil {
+		if info, ok := s.runtime.Inspect(id); ok {
+			conn.ContainerName = info.Name
+			conn.ContainerImage = info.Image
+		}
+	}
+	conn.Tags = append(conn.Tags, "container")
+}
+
+type tcpEntry struct {
+	conn  *models.Connection
+	inode string
+}
+
+// readTCPTable parses the sockets in /proc/net/tcp{,6}. Source is the local
+// end; listening sockets have no destination.
+func readTCPTable(path string) ([]tcpEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []tcpEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		state, ok := tcpStates[fields[3]]
+		if !ok {
+			continue
+		}
+
+		sourceIP, sourcePort, err := parseProcAddr(fields[1])
+		if err != nil {
+			continue
+		}
+		destIP, destPort, err := parseProcAddr(fields[2])
+		if err != nil {
+			continue
+		}
+
+		timestamp := time.Now()
+		conn := &models.Connection{
+			ID:               fmt.Sprintf("%s:%d-%s:%d-%d-%s", sourceIP, sourcePort, destIP, destPort, timestamp.UnixNano(), fields[9]),
+			Timestamp:        timestamp,
+			SourceIP:         sourceIP,
+			SourcePort:       sourcePort,
+			DestIP:           destIP,
+			DestPort:         destPort,
+			Protocol:         "TCP",
+			TCPState:         state,
+			ServiceType:      models.ServiceTypeOther,
+			DatabaseType:     models.DatabaseTypeOther,
+			MessageQueueType: models.MessageQueueTypeOther,
+			Tags:             []string{"tcp", "network-monitor", "procfs"},
+		}
+		entries = append(entries, tcpEntry{conn: conn, inode: fields[9]})
+	}
+	return entries, scanner.Err()
+}
+
+// parseProcAddr decodes an address such as "0100007F:1F90". The address is
+// stored as native-endian 32-bit words, little-endian on supported hosts.
+func parseProcAddr(s string) (string, int, error) {
+	host, port, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("invalid address: %s", s)
+	}
+
+	raw, err := hex.DecodeString(host)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", 0, fmt.Errorf("invalid address: %s", s)
+	}
+	for i := 0; i < len(raw); i += 4 {
+		raw[i], raw[i+1], raw[i+2], raw[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+
+	p, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port: %s", s)
+	}
+
+	ip := net.IP(raw)
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	return ip.String(), int(p), nil
+}
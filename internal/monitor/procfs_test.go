@@ -0,0 +1,166 @@
+package monitor
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/container"
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// testdata/proc holds three network namespaces:
+//
+//	4026531992  host: pid 1 (systemd) and 100 (sshd), an accepted SSH
+//	            session and listeners on :22 and [::1]:8080
+//	4026532500  Docker container web (cgroup v2): pid 200 (nginx) listening
+//	            on :80, pid 201 (worker) holding an accepted connection and
+//	            one to Postgres
+//	4026532600  Kubernetes container (cgroup v1): pid 300 connecting to
+//	            Postgres from the same bridge address, with no owning fd
+const (
+	webID   = "a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1"
+	redisID = "b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2"
+)
+
+func testProcfsSource(t *testing.T) *ProcfsSource {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/"+webID+"/json" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"Id":%q,"Name":"/web","Config":{"Image":"nginx:1.25"}}`, webID)
+	}))
+	srv.Listener.Close()
+	srv.Listener = l
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	s := NewProcfsSource("testdata/proc", time.Second)
+	s.SetRuntime(container.NewRuntime(socket))
+	return s
+}
+
+func TestProcfsNamespaces(t *testing.T) {
+	namespaces, err := NewProcfsSource("testdata/proc", time.Second).namespaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, ns := range namespaces {
+		got = append(got, fmt.Sprintf("%s%v", ns.inode, ns.pids))
+	}
+	want := "4026531992[1 100] 4026532500[200 201] 4026532600[300]"
+	if strings.Join(got, " ") != want {
+		t.Errorf("namespaces = %v, want %s", got, want)
+	}
+}
+
+func TestProcfsConnections(t *testing.T) {
+	var conns []*models.Connection
+	testProcfsSource(t).checkConnections(func(conn *models.Connection) {
+		conns = append(conns, conn)
+	})
+
+	describe := func(conn *models.Connection) string {
+		return fmt.Sprintf("%s %s:%d>%s:%d %s %s netns=%v process=%v container=%.8s/%s/%s",
+			conn.TCPState, conn.SourceIP, conn.SourcePort, conn.DestIP, conn.DestPort, conn.Direction,
+			strings.Join(conn.Tags, ","), conn.Metadata["netns"], conn.Metadata["process"],
+			conn.ContainerID, conn.ContainerName, conn.ContainerImage)
+	}
+	var got []string
+	for _, conn := range conns {
+		got = append(got, describe(conn))
+	}
+	// The same addresses in two namespaces are two connections; the last
+	// socket has no owning fd and is attributed to its namespace's process
+	want := []string{
+		"ESTABLISHED 10.0.0.9:51000>10.0.0.5:22 inbound tcp,network-monitor,procfs netns=4026531992 process=sshd container=//",
+		"ESTABLISHED 172.17.0.1:40000>172.17.0.2:80 inbound tcp,network-monitor,procfs,container netns=4026532500 process=worker container=a1a1a1a1/web/nginx:1.25",
+		"ESTABLISHED 172.17.0.2:45000>10.0.0.7:5432 outbound tcp,network-monitor,procfs,container netns=4026532500 process=worker container=a1a1a1a1/web/nginx:1.25",
+		"SYN_SENT 172.17.0.2:45000>10.0.0.7:5432 outbound tcp,network-monitor,procfs,container netns=4026532600 process=<nil> container=b2b2b2b2//",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("connections:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if len(conns) > 0 && conns[len(conns)-1].ContainerID != redisID {
+		t.Errorf("ContainerID = %q, want %q", conns[len(conns)-1].ContainerID, redisID)
+	}
+}
+
+func TestProcfsListeners(t *testing.T) {
+	listeners, err := testProcfsSource(t).Listeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, l := range listeners {
+		got = append(got, fmt.Sprintf("%s %d pid=%d %s %.8s %s", net.JoinHostPort(l.Address, ""), l.Port, l.PID, l.Process, l.ContainerID, l.ContainerName))
+	}
+	sort.Strings(got)
+	want := []string{
+		"0.0.0.0: 22 pid=100 sshd  ",
+		"0.0.0.0: 80 pid=200 nginx a1a1a1a1 web",
+		"[::1]: 8080 pid=0   ",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("listeners:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestProcfsSockets(t *testing.T) {
+	sockets, err := testProcfsSource(t).Sockets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, s := range sockets {
+		got = append(got, fmt.Sprintf("%s %s:%d>%s:%d accepted=%v pid=%d %s %s",
+			s.ID, s.SourceIP, s.SourcePort, s.DestIP, s.DestPort, s.Accepted, s.PID, s.Process, s.ContainerName))
+	}
+	// Only established sockets are pooled
+	want := []string{
+		"1002 10.0.0.9:51000>10.0.0.5:22 accepted=true pid=100 sshd ",
+		"2002 172.17.0.1:40000>172.17.0.2:80 accepted=true pid=201 worker web",
+		"2003 172.17.0.2:45000>10.0.0.7:5432 accepted=false pid=201 worker web",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("sockets:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParseProcAddr(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		ip   string
+		port int
+	}{
+		{"0100007F:1F90", "127.0.0.1", 8080},
+		{"020011AC:0050", "172.17.0.2", 80},
+		{"00000000000000000000000001000000:0016", "::1", 22},
+		{"0000000000000000FFFF00000100007F:0050", "127.0.0.1", 80},
+		{"B80D0120000000000000000001000000:01BB", "2001:db8::1", 443},
+	} {
+		ip, port, err := parseProcAddr(tc.in)
+		if err != nil || ip != tc.ip || port != tc.port {
+			t.Errorf("parseProcAddr(%s) = %s, %d, %v, want %s, %d", tc.in, ip, port, err, tc.ip, tc.port)
+		}
+	}
+	for _, in := range []string{"0100007F", "01007F:0050", "0100007F:ZZZZ", "XX00007F:0050"} {
+		if _, _, err := parseProcAddr(in); err == nil {
+			t.Errorf("parseProcAddr(%s) succeeded", in)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// DefaultRetryWindow is how long after a failed attempt a new attempt to
+// the same endpoint counts as a retry
+const DefaultRetryWindow = time.Minute
+
+// retryTracker counts repeated attempts by a local process to the same
+// endpoint. A new socket to an endpoint whose previous attempts failed is a
+// retry of them; an attempt that succeeds ends the run.
+type retryTracker struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	endpoints map[string]*attempts
+	lastSweep time.Time
+}
+
+// attempts is the current run of attempts to one endpoint
+type attempts struct {
+	sockets map[int]*attempt // by source port
+	failed  int
+	last    time.Time
+}
+
+// attempt is one socket to an endpoint
+type attempt struct {
+	failed  bool
+	retries int
+}
+
+func newRetryTracker(window time.Duration) *retryTracker {
+	return &retryTracker{window: window, endpoints: make(map[string]*attempts)}
+}
+
+// observe adds the failed attempts before a connection to its RetryCount.
+// Sources that see a socket more than once, such as polling ones, report
+// the same count each time.
+func (t *retryTracker) observe(conn *models.Connection) {
+	if conn.Direction == models.DirectionInbound || conn.DestIP == "" {
+		return
+	}
+	failed := conn.Error != "" || conn.TCPState == "SYN_SENT"
+	key := conn.ContainerID + "|" + conn.SourceIP + "|" + conn.DestIP + ":" + strconv.Itoa(conn.DestPort)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	a, ok := t.endpoints[key]
+	if !ok || conn.Timestamp.Sub(a.last) > t.window {
+		a = &attempts{sockets: make(map[int]*attempt)}
+		t.endpoints[key] = a
+	}
+	a.last = conn.Timestamp
+
+	socket, seen := a.sockets[conn.SourcePort]
+	if !seen {
+		socket = &attempt{failed: failed, retries: a.failed}
+		a.sockets[conn.SourcePort] = socket
+		if failed {
+			a.failed++
+		} else {
+			a.failed = 0
+		}
+	} else if socket.failed && !failed {
+		// An attempt seen opening has connected after all
+		socket.failed = false
+		a.failed = 0
+	}
+	conn.RetryCount += socket.retries
+
+	if conn.Timestamp.Sub(t.lastSweep) >= t.window {
+		t.sweep(conn.Timestamp)
+		t.lastSweep = conn.Timestamp
+	}
+}
+
+// sweep drops endpoints with no attempt within the window
+func (t *retryTracker) sweep(now time.Time) {
+	for key, a := range t.endpoints {
+		if now.Sub(a.last) > t.window {
+			delete(t.endpoints, key)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// sock_diag constants from linux/sock_diag.h and linux/inet_diag.h
+const (
+	netlinkSockDiag   = 4
+	sockDiagByFamily  = 20
+	inetDiagInfo      = 2
+	tcpEstablishedBit = 1 << 1
+
+	inetDiagReqLen = 56
+	inetDiagMsgLen = 72
+
+	// Offsets of the idle times in struct tcp_info, in milliseconds
+	tcpInfoLastDataSent = 44
+	tcpInfoLastDataRecv = 52
+)
+
+// socketActivity reads how long each established TCP socket in the
+// collector's network namespace has gone without sending or receiving data,
+// keyed by socket inode and by tupleKey
+func socketActivity() (map[string]time.Duration, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM, netlinkSockDiag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sock_diag socket: %v", err)
+	}
+	defer syscall.Close(fd)
+
+	idle := make(map[string]time.Duration)
+	for _, family := range []uint8{syscall.AF_INET, syscall.AF_INET6} {
+		if err := dumpTCPInfo(fd, family, idle); err != nil {
+			return nil, err
+		}
+	}
+	return idle, nil
+}
+
+func dumpTCPInfo(fd int, family uint8, idle map[string]time.Duration) error {
+	req := make([]byte, syscall.NLMSG_HDRLEN+inetDiagReqLen)
+	native.PutUint32(req[0:], uint32(len(req)))
+	native.PutUint16(req[4:], sockDiagByFamily)
+	native.PutUint16(req[6:], syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP)
+	body := req[syscall.NLMSG_HDRLEN:]
+	body[0] = family
+	body[1] = syscall.IPPROTO_TCP
+	body[2] = 1 << (inetDiagInfo - 1)
+	native.PutUint32(body[4:], tcpEstablishedBit)
+
+	if err := syscall.Sendto(fd, req, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		return fmt.Errorf("failed to query sock_diag: %v", err)
+	}
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return fmt.Errorf("failed to read sock_diag: %v", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return fmt.Errorf("failed to parse sock_diag: %v", err)
+		}
+		for _, m := range msgs {
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				return nil
+			case syscall.NLMSG_ERROR:
+				return fmt.Errorf("sock_diag returned an error")
+			}
+			parseDiagMsg(m.Data, idle)
+		}
+	}
+}
+
+// parseDiagMsg records the idle time of one socket from an inet_diag_msg
+// and its tcp_info attribute
+func parseDiagMsg(data []byte, idle map[string]time.Duration) {
+	if len(data) < inetDiagMsgLen {
+		return
+	}
+	family := data[0]
+	// inet_diag_sockid: ports are big-endian, addresses in network order
+	sport := binary.BigEndian.Uint16(data[4:])
+	dport := binary.BigEndian.Uint16(data[6:])
+	ipLen := net.IPv4len
+	if family == syscall.AF_INET6 {
+		ipLen = net.IPv6len
+	}
+	src := net.IP(append([]byte(nil), data[8:8+ipLen]...))
+	dst := net.IP(append([]byte(nil), data[24:24+ipLen]...))
+	inode := native.Uint32(data[68:])
+
+	for attrs := data[inetDiagMsgLen:]; len(attrs) >= syscall.SizeofRtAttr; {
+		length := int(native.Uint16(attrs[0:]))
+		kind := native.Uint16(attrs[2:])
+		if length < syscall.SizeofRtAttr || length > len(attrs) {
+			return
+		}
+		value := attrs[syscall.SizeofRtAttr:length]
+		if kind == inetDiagInfo && len(value) >= tcpInfoLastDataRecv+4 {
+			sent := native.Uint32(value[tcpInfoLastDataSent:])
+			recv := native.Uint32(value[tcpInfoLastDataRecv:])
+			if recv < sent {
+				sent = recv
+			}
+			d := time.Duration(sent) * time.Millisecond
+			idle[strconv.FormatUint(uint64(inode), 10)] = d
+			idle[tupleKey(normalizeIP(src), int(sport), normalizeIP(dst), int(dport))] = d
+		}
+		aligned := (length + syscall.RTA_ALIGNTO - 1) &^ (syscall.RTA_ALIGNTO - 1)
+		if aligned > len(attrs) {
+			return
+		}
+		attrs = attrs[aligned:]
+	}
+}
+
+func normalizeIP(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return v4.String()
+	}
+	return ip.String()
+}
+
+// native is the host byte order netlink uses for its own fields
+var native = binary.NativeEndian
@@ -0,0 +1,54 @@
+package monitor
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestParseDiagMsg parses inet_diag_msg replies captured by
+// testdata/sockdiag.go for a client that last sent 1.5s and last received
+// 0.5s before the capture
+func TestParseDiagMsg(t *testing.T) {
+	if native.Uint16([]byte{1, 0}) != 1 {
+		t.Skip("the fixtures were captured on a little-endian host")
+	}
+	for _, tc := range []struct {
+		file string
+		want map[string]time.Duration
+	}{
+		{"inet_diag_tcp4.bin", map[string]time.Duration{
+			"225617":                          500 * time.Millisecond,
+			"127.0.0.1:53634-127.0.0.1:35617": 500 * time.Millisecond,
+		}},
+		{"inet_diag_tcp6.bin", map[string]time.Duration{
+			"225678":              500 * time.Millisecond,
+			"::1:41490-::1:34717": 500 * time.Millisecond,
+		}},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			data, err := os.ReadFile("testdata/" + tc.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			idle := make(map[string]time.Duration)
+			parseDiagMsg(data, idle)
+			if !reflect.DeepEqual(idle, tc.want) {
+				t.Errorf("idle = %v, want %v", idle, tc.want)
+			}
+
+			// The tcp_info attribute is the last; cut into it, the socket's
+			// idle time is unknown
+			idle = make(map[string]time.Duration)
+			parseDiagMsg(data[:len(data)-200], idle)
+			if len(idle) != 0 {
+				t.Errorf("truncated message: idle = %v", idle)
+			}
+			parseDiagMsg(data[:inetDiagMsgLen-1], idle)
+			if len(idle) != 0 {
+				t.Errorf("short message: idle = %v", idle)
+			}
+		})
+	}
+}
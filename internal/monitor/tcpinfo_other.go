@@ -0,0 +1,14 @@
+//go:build !linux
+
+package monitor
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// socketActivity needs sock_diag, which only Linux has
+func socketActivity() (map[string]time.Duration, error) {
+	return nil, fmt.Errorf("socket activity is not available on %s", runtime.GOOS)
+}
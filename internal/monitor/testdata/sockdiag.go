@@ -0,0 +1,97 @@
+//go:build ignore
+
+// sockdiag captures the inet_diag_msg fixtures for tcpinfo_linux_test.go.
+// It opens a loopback connection whose client sends at once and hears back
+// after a second, then half a second later writes the kernel's reply for
+// the client socket, tcp_info attribute included. Run it from the package
+// directory on a little-endian Linux host:
+//
+//	go run testdata/sockdiag.go tcp4 127.0.0.1:0 testdata/inet_diag_tcp4.bin
+//	go run testdata/sockdiag.go tcp6 [::1]:0 testdata/inet_diag_tcp6.bin
+//
+// Timings and inodes differ between captures, so update the expectations
+// in the test after recapturing.
+package main
+
+import (
+	"encoding/binary"
+	"log"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+func main() {
+	if len(os.Args) != 4 {
+		log.Fatal("usage: sockdiag tcp4|tcp6 address file")
+	}
+	network, address, file := os.Args[1], os.Args[2], os.Args[3]
+	family := uint8(syscall.AF_INET)
+	if network == "tcp6" {
+		family = syscall.AF_INET6
+	}
+
+	l, err := net.Listen(network, address)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			log.Fatal(err)
+		}
+		c.Read(make([]byte, 5))
+		time.Sleep(time.Second)
+		c.Write([]byte("world"))
+		select {}
+	}()
+	c, err := net.Dial(network, l.Addr().String())
+	if err != nil {
+		log.Fatal(err)
+	}
+	c.Write([]byte("hello"))
+	time.Sleep(1500 * time.Millisecond)
+	port := c.LocalAddr().(*net.TCPAddr).Port
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM, 4)
+	if err != nil {
+		log.Fatal(err)
+	}
+	native := binary.NativeEndian
+	req := make([]byte, syscall.NLMSG_HDRLEN+56)
+	native.PutUint32(req[0:], uint32(len(req)))
+	native.PutUint16(req[4:], 20)
+	native.PutUint16(req[6:], syscall.NLM_F_REQUEST|syscall.NLM_F_DUMP)
+	body := req[syscall.NLMSG_HDRLEN:]
+	body[0] = family
+	body[1] = syscall.IPPROTO_TCP
+	body[2] = 1 << 1
+	native.PutUint32(body[4:], 1<<1)
+	if err := syscall.Sendto(fd, req, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil {
+		log.Fatal(err)
+	}
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			log.Fatal(err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, m := range msgs {
+			if m.Header.Type == syscall.NLMSG_DONE {
+				log.Fatal("client socket not found")
+			}
+			if int(binary.BigEndian.Uint16(m.Data[4:])) == port {
+				if err := os.WriteFile(file, m.Data, 0o644); err != nil {
+					log.Fatal(err)
+				}
+				return
+			}
+		}
+	}
+}
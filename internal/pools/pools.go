@@ -0,0 +1,136 @@
+// Package pools summarizes the connection pool samples reported by
+// collectors: how many connections each process holds open to a database
+// or cache, how many of them are in use, and how fast they are replaced.
+package pools
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// DefaultBucket is the resolution of pool time series
+const DefaultBucket = time.Minute
+
+// poolKey identifies a process's pool to one endpoint
+type poolKey struct {
+	service     string
+	host        string
+	environment string
+	process     string
+	container   string
+	destination string
+}
+
+type pool struct {
+	summary  *models.PoolSummary
+	samples  int
+	openSum  int
+	opened   int
+	closed   int
+	interval float64
+	buckets  map[time.Time]*models.PoolPoint
+}
+
+// Summarize groups samples, oldest first, into one summary per pool with a
+// series bucketed at the given resolution. Pools closest to exhaustion, with
+// the most of their connections busy at peak, come first.
+func Summarize(samples []*models.PoolSample, bucket time.Duration) []*models.PoolSummary {
+	if bucket <= 0 {
+		bucket = DefaultBucket
+	}
+
+	byKey := make(map[poolKey]*pool)
+	var order []*pool
+	for _, s := range samples {
+		key := poolKey{s.ServiceName, s.Host, s.Environment, s.Process, s.ContainerName,
+			net.JoinHostPort(s.DestIP, strconv.Itoa(s.DestPort))}
+		p, ok := byKey[key]
+		if !ok {
+			p = &pool{
+				summary: &models.PoolSummary{
+					ServiceName:   s.ServiceName,
+					Host:          s.Host,
+					Environment:   s.Environment,
+					Process:       s.Process,
+					ContainerName: s.ContainerName,
+					Destination:   key.destination,
+					ServiceType:   s.ServiceType,
+					DatabaseType:  s.DatabaseType,
+				},
+				buckets: make(map[time.Time]*models.PoolPoint),
+			}
+			byKey[key] = p
+			order = append(order, p)
+		}
+		p.add(s, bucket)
+	}
+
+	summaries := make([]*models.PoolSummary, 0, len(order))
+	for _, p := range order {
+		summaries = append(summaries, p.finish())
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		if summaries[i].Utilization != summaries[j].Utilization {
+			return summaries[i].Utilization > summaries[j].Utilization
+		}
+		return summaries[i].PeakOpen > summaries[j].PeakOpen
+	})
+	return summaries
+}
+
+func (p *pool) add(s *models.PoolSample, bucket time.Duration) {
+	sum := p.summary
+	if !s.Timestamp.Before(sum.LastSeen) {
+		sum.LastSeen = s.Timestamp
+		sum.Open, sum.Active, sum.Idle = s.Open, s.Active, s.Idle
+	}
+	if s.Open > sum.PeakOpen {
+		sum.PeakOpen = s.Open
+	}
+	if s.Active > sum.PeakActive {
+		sum.PeakActive = s.Active
+	}
+	p.samples++
+	p.openSum += s.Open
+	p.opened += s.Opened
+	p.closed += s.Closed
+	p.interval += s.Interval
+
+	at := s.Timestamp.Truncate(bucket)
+	point, ok := p.buckets[at]
+	if !ok {
+		point = &models.PoolPoint{Timestamp: at}
+		p.buckets[at] = point
+	}
+	if s.Open >= point.Open {
+		point.Open, point.Idle = s.Open, s.Idle
+	}
+	if s.Active > point.Active {
+		point.Active = s.Active
+	}
+	point.Opened += s.Opened
+	point.Closed += s.Closed
+}
+
+func (p *pool) finish() *models.PoolSummary {
+	sum := p.summary
+	sum.AvgOpen = float64(p.openSum) / float64(p.samples)
+	if sum.PeakOpen > 0 {
+		sum.Utilization = float64(sum.PeakActive) / float64(sum.PeakOpen)
+	}
+	if minutes := p.interval / 60; minutes > 0 {
+		sum.OpenedPerMinute = float64(p.opened) / minutes
+		sum.ClosedPerMinute = float64(p.closed) / minutes
+	}
+
+	sum.Series = make([]models.PoolPoint, 0, len(p.buckets))
+	for _, point := range p.buckets {
+		sum.Series = append(sum.Series, *point)
+	}
+	sort.Slice(sum.Series, func(i, j int) bool { return sum.Series[i].Timestamp.Before(sum.Series[j].Timestamp) })
+	return sum
+}
@@ -0,0 +1,76 @@
+package pools
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+func TestSummarize(t *testing.T) {
+	base := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	sample := func(seconds int, process, ip string, port, open, active, opened, closed int, interval float64) *models.PoolSample {
+		return &models.PoolSample{
+			Timestamp:   base.Add(time.Duration(seconds) * time.Second),
+			Host:        "web-1",
+			ServiceName: "checkout",
+			Process:     process,
+			DestIP:      ip,
+			DestPort:    port,
+			Open:        open,
+			Active:      active,
+			Idle:        open - active,
+			Opened:      opened,
+			Closed:      closed,
+			Interval:    interval,
+		}
+	}
+	samples := []*models.PoolSample{
+		sample(0, "api", "10.0.0.5", 5432, 10, 4, 10, 0, 30),
+		sample(0, "api", "10.0.0.6", 6379, 4, 1, 4, 0, 30),
+		sample(30, "api", "10.0.0.5", 5432, 12, 9, 3, 1, 30),
+		sample(30, "api", "10.0.0.6", 6379, 4, 1, 0, 0, 30),
+		// As busy as the cache pool at peak but larger, so it comes first
+		sample(40, "worker", "10.0.0.5", 5432, 8, 2, 0, 0, 0),
+		sample(60, "api", "10.0.0.5", 5432, 8, 2, 0, 4, 30),
+		sample(70, "api", "fd00::5", 5432, 0, 0, 0, 0, 30),
+	}
+
+	summaries := Summarize(samples, 0)
+	var got []string
+	for _, s := range summaries {
+		got = append(got, fmt.Sprintf("%s %s latest=%d/%d/%d peak=%d/%d avg=%g util=%g churn=%.2f/%.2f points=%d",
+			s.Process, s.Destination, s.Open, s.Active, s.Idle, s.PeakOpen, s.PeakActive, s.AvgOpen, s.Utilization,
+			s.OpenedPerMinute, s.ClosedPerMinute, len(s.Series)))
+	}
+	want := []string{
+		"api 10.0.0.5:5432 latest=8/2/6 peak=12/9 avg=10 util=0.75 churn=8.67/3.33 points=2",
+		"worker 10.0.0.5:5432 latest=8/2/6 peak=8/2 avg=8 util=0.25 churn=0.00/0.00 points=1",
+		"api 10.0.0.6:6379 latest=4/1/3 peak=4/1 avg=4 util=0.25 churn=4.00/0.00 points=1",
+		"api [fd00::5]:5432 latest=0/0/0 peak=0/0 avg=0 util=0 churn=0.00/0.00 points=1",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("summaries:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Each minute keeps its largest pool, the idle count when it was
+	// largest, its busiest moment and the churn within it
+	wantSeries := []models.PoolPoint{
+		{Timestamp: base, Open: 12, Active: 9, Idle: 3, Opened: 13, Closed: 1},
+		{Timestamp: base.Add(time.Minute), Open: 8, Active: 2, Idle: 6, Opened: 0, Closed: 4},
+	}
+	if !reflect.DeepEqual(summaries[0].Series, wantSeries) {
+		t.Errorf("series = %+v, want %+v", summaries[0].Series, wantSeries)
+	}
+	if !summaries[0].LastSeen.Equal(base.Add(time.Minute)) {
+		t.Errorf("LastSeen = %v", summaries[0].LastSeen)
+	}
+
+	// A coarser bucket folds the series
+	if series := Summarize(samples, time.Hour)[0].Series; len(series) != 1 || series[0].Opened != 13 || series[0].Closed != 5 {
+		t.Errorf("hourly series = %+v", series)
+	}
+}
@@ -0,0 +1,261 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// Match evaluates a query against a connection, with the same semantics as
+// the SQL it compiles to. A nil query matches everything.
+func Match(n Node, conn *models.Connection) bool {
+	switch n := n.(type) {
+	case nil:
+		return true
+	case And:
+		return Match(n.Left, conn) && Match(n.Right, conn)
+	case Or:
+		return Match(n.Left, conn) || Match(n.Right, conn)
+	case Not:
+		return !Match(n.X, conn)
+	case Text:
+		for _, column := range TextColumns {
+			if containsFold(stringValue(conn, column), n.Value) {
+				return true
+			}
+		}
+		for _, tag := range conn.Tags {
+			if containsFold(tag, n.Value) {
+				return true
+			}
+		}
+		return metadataContains(conn.Metadata, n.Value)
+	case Compare:
+		return matchCompare(n, conn)
+	}
+	return false
+}
+
+func matchCompare(n Compare, conn *models.Connection) bool {
+	switch n.Kind {
+	case KindInt, KindFloat:
+		v := numberValue(conn, n.Field)
+		switch n.Op {
+		case ":", "=":
+			return v == n.Num
+		case "!=":
+			return v != n.Num
+		case "<":
+			return v < n.Num
+		case "<=":
+			return v <= n.Num
+		case ">":
+			return v > n.Num
+		case ">=":
+			return v >= n.Num
+		}
+		return false
+
+	case KindTag:
+		found := false
+		for _, tag := range conn.Tags {
+			if n.wildcard() && globMatch(n.Value, tag) || !n.wildcard() && tag == n.Value {
+				found = true
+				break
+			}
+		}
+		return found == (n.Op != "!=")
+	}
+
+	v := stringValue(conn, n.Field)
+	if n.Kind == KindMetadata {
+		v = metadataValue(conn.Metadata, n.Path)
+	}
+	var matched bool
+	if n.wildcard() {
+		matched = globMatch(n.Value, v)
+	} else {
+		matched = v == n.Value
+	}
+	return matched == (n.Op != "!=")
+}
+
+// globMatch matches a * pattern case-insensitively, as LIKE does in SQLite
+func globMatch(pattern, s string) bool {
+	pattern, s = strings.ToLower(pattern), strings.ToLower(s)
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for i, part := range parts[1:] {
+		if i == len(parts)-2 {
+			return strings.HasSuffix(s, part)
+		}
+		idx := strings.Index(s, part)
+		if idx < 0 {
+			return false
+		}
+		s = s[idx+len(part):]
+	}
+	return s == ""
+}
+
+// metadataValue formats the metadata value at path as the SQL backends do,
+// or returns "" when it is missing
+func metadataValue(metadata map[string]interface{}, path []string) string {
+	var v interface{} = metadata
+	for _, key := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		if v, ok = m[key]; !ok {
+			return ""
+		}
+	}
+	return formatValue(v)
+}
+
+// metadataContains reports whether a metadata key or value contains substr
+func metadataContains(v interface{}, substr string) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if containsFold(key, substr) || metadataContains(value, substr) {
+				return true
+			}
+		}
+		return false
+	case []interface{}:
+		for _, value := range v {
+			if metadataContains(value, substr) {
+				return true
+			}
+		}
+		return false
+	case nil:
+		return false
+	}
+	return containsFold(formatValue(v), substr)
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func stringValue(conn *models.Connection, field string) string {
+	switch field {
+	case "id":
+		return conn.ID
+	case "source_ip":
+		return conn.SourceIP
+	case "dest_ip":
+		return conn.DestIP
+	case "dest_hostname":
+		return conn.DestHostname
+	case "dest_rdns":
+		return conn.DestReverseDNS
+	case "dest_org":
+		return conn.DestOrg
+	case "dest_country":
+		return conn.DestCountry
+	case "dest_scope":
+		return conn.DestScope
+	case "dest_k8s_namespace":
+		return conn.DestK8sNamespace
+	case "dest_k8s_pod":
+		return conn.DestK8sPod
+	case "dest_k8s_service":
+		return conn.DestK8sService
+	case "protocol":
+		return conn.Protocol
+	case "app_protocol":
+		return conn.AppProtocol
+	case "tls_server_name":
+		return conn.TLSServerName
+	case "direction":
+		return string(conn.Direction)
+	case "tcp_state":
+		return conn.TCPState
+	case "service_name":
+		return conn.ServiceName
+	case "service_type":
+		return string(conn.ServiceType)
+	case "database_type":
+		return string(conn.DatabaseType)
+	case "message_queue_type":
+		return string(conn.MessageQueueType)
+	case "host":
+		return conn.Host
+	case "deployment_id":
+		return conn.DeploymentID
+	case "environment":
+		return conn.Environment
+	case "region":
+		return conn.Region
+	case "k8s_namespace":
+		return conn.K8sNamespace
+	case "k8s_pod":
+		return conn.K8sPod
+	case "k8s_deployment":
+		return conn.K8sDeployment
+	case "k8s_service":
+		return conn.K8sService
+	case "k8s_node":
+		return conn.K8sNode
+	case "container_id":
+		return conn.ContainerID
+	case "container_name":
+		return conn.ContainerName
+	case "container_image":
+		return conn.ContainerImage
+	case "error":
+		return conn.Error
+	}
+	return ""
+}
+
+func numberValue(conn *models.Connection, field string) float64 {
+	switch field {
+	case "source_port":
+		return float64(conn.SourcePort)
+	case "dest_port":
+		return float64(conn.DestPort)
+	case "dest_asn":
+		return float64(conn.DestASN)
+	case "latency_ms":
+		return conn.Latency
+	case "duration_ms":
+		return conn.Duration
+	case "dns_latency_ms":
+		return conn.DNSLatency
+	case "bytes_sent":
+		return float64(conn.BytesSent)
+	case "bytes_received":
+		return float64(conn.BytesReceived)
+	case "retry_count":
+		return float64(conn.RetryCount)
+	}
+	return 0
+}
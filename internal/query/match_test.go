@@ -0,0 +1,91 @@
+package query_test
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/query"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage/storagetest"
+)
+
+// TestMatchAgreesWithSQL checks that Match, used by the memory store and the
+// live tail, selects the same storagetest fixtures as the SQL ToSQL builds
+func TestMatchAgreesWithSQL(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "cinnamon.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	fixtures := storagetest.Fixtures(time.Now())
+	for _, conn := range fixtures {
+		if err := store.StoreConnection(conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  string // matching fixture IDs without the conformance- prefix
+	}{
+		{`service:checkout`, "1 3"},
+		{`SERVICE:Checkout`, ""},
+		{`service:check*`, "1 3"},
+		{`service!=checkout`, "2"},
+		{`latency_ms>=30`, "2 3"},
+		{`latency<30 OR retry_count>1`, "1 2"},
+		{`port:5432 OR port:443 NOT error:ECONNREFUSED`, "1"},
+		{`(port:5432 OR port:443) NOT error:ECONNREFUSED`, "1"},
+		{`NOT error:ETIMEDOUT`, "1 3"},
+		{`error=""`, "1"},
+		{`deployment_id!=""`, "1 2"},
+		{`k8s_namespace:payments`, "1"},
+		{`NOT k8s_namespace:payments`, "2 3"},
+		{`dest_country:US`, "2"},
+		{`dest_asn=396982`, "2"},
+		{`tag:tcp`, "1 2"},
+		{`tag:network-*`, "1"},
+		{`tag!=network-monitor`, "2 3"},
+		{`metadata.dns_query=broker-1`, "2"},
+		{`metadata.protocol!=TCP`, "3"},
+		{`orders-db`, "1"},
+		{`BROKER`, "2"},
+		{`monitor`, "1"},
+		{`checkout NOT postgres*`, "1 3"},
+		{`node-2 OR "orders-db.internal"`, "1 2"},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			node, err := query.Parse(tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var matched []string
+			for _, conn := range fixtures {
+				if query.Match(node, conn) {
+					matched = append(matched, strings.TrimPrefix(conn.ID, "conformance-"))
+				}
+			}
+			conns, err := store.GetConnections(storage.ConnectionFilter{Query: node})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var selected []string
+			for _, conn := range conns {
+				selected = append(selected, strings.TrimPrefix(conn.ID, "conformance-"))
+			}
+			sort.Strings(selected)
+
+			if got := strings.Join(matched, " "); got != tc.want {
+				t.Errorf("Match selects %q, want %q", got, tc.want)
+			}
+			if got := strings.Join(selected, " "); got != tc.want {
+				t.Errorf("SQL selects %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
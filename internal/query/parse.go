@@ -0,0 +1,271 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int // byte offset
+}
+
+func (t token) describe() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// lex splits a query into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(input) {
+		c := input[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == ':' || c == '=':
+			tokens = append(tokens, token{tokOp, string(c), i})
+			i++
+		case c == '!' || c == '<' || c == '>':
+			if i+1 < len(input) && input[i+1] == '=' {
+				tokens = append(tokens, token{tokOp, input[i : i+2], i})
+				i += 2
+			} else if c == '!' {
+				return nil, &Error{Column: i + 1, Msg: `"!" must be followed by "=" (use NOT to negate a term)`}
+			} else {
+				tokens = append(tokens, token{tokOp, string(c), i})
+				i++
+			}
+		case c == '"':
+			start := i
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(input) {
+					return nil, &Error{Column: start + 1, Msg: "unterminated quoted string"}
+				}
+				if input[i] == '\\' && i+1 < len(input) {
+					b.WriteByte(input[i+1])
+					i += 2
+					continue
+				}
+				if input[i] == '"' {
+					i++
+					break
+				}
+				b.WriteByte(input[i])
+				i++
+			}
+			tokens = append(tokens, token{tokString, b.String(), start})
+		default:
+			start := i
+			for i < len(input) && !strings.ContainsRune(" \t\r\n()\":=!<>", rune(input[i])) {
+				i++
+			}
+			word := input[start:i]
+			kind := tokWord
+			switch word {
+			case "AND", "and", "&&":
+				kind = tokAnd
+			case "OR", "or", "||":
+				kind = tokOr
+			case "NOT", "not":
+				kind = tokNot
+			}
+			tokens = append(tokens, token{kind, word, start})
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(input)}), nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func errorAt(t token, format string, args ...interface{}) error {
+	return &Error{Column: t.pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Parse parses a query. A blank query returns a nil Node, matching
+// everything.
+func Parse(input string) (Node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	if tokens[0].kind == tokEOF {
+		return nil, nil
+	}
+
+	p := &parser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		if t.kind == tokRParen {
+			return nil, errorAt(t, "unmatched closing parenthesis")
+		}
+		return nil, errorAt(t, "unexpected %s", t.describe())
+	}
+	return node, nil
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = Or{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek().kind {
+		case tokAnd:
+			p.next()
+		case tokWord, tokString, tokNot, tokLParen:
+			// Juxtaposed terms are ANDed
+		default:
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = And{left, right}
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.peek().kind == tokNot {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not{x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, errorAt(closing, "expected \")\" to close the parenthesis at column %d, found %s", t.pos+1, closing.describe())
+		}
+		return node, nil
+	case tokString:
+		if t.text == "" {
+			return nil, errorAt(t, "empty search term")
+		}
+		return Text{Value: t.text}, nil
+	case tokWord:
+		if p.peek().kind == tokOp {
+			return p.parseCompare(t)
+		}
+		return Text{Value: t.text}, nil
+	case tokEOF:
+		return nil, errorAt(t, "expected a search term, found end of query")
+	}
+	return nil, errorAt(t, "expected a search term, found %s", t.describe())
+}
+
+func (p *parser) parseCompare(fieldTok token) (Node, error) {
+	name, kind, ok := lookupField(fieldTok.text)
+	if !ok {
+		return nil, errorAt(fieldTok, "unknown field %q (known fields: %s)", fieldTok.text, strings.Join(Fields(), ", "))
+	}
+
+	opTok := p.next()
+	valueTok := p.next()
+	if valueTok.kind != tokWord && valueTok.kind != tokString {
+		return nil, errorAt(valueTok, "expected a value after %s%s, found %s", fieldTok.text, opTok.text, valueTok.describe())
+	}
+
+	c := Compare{Field: name, Kind: kind, Op: opTok.text, Value: valueTok.text}
+	switch kind {
+	case KindInt, KindFloat:
+		n, err := strconv.ParseFloat(c.Value, 64)
+		if err != nil || (kind == KindInt && n != float64(int64(n))) {
+			what := "a number"
+			if kind == KindInt {
+				what = "an integer"
+			}
+			return nil, errorAt(valueTok, "%s expects %s, got %q", name, what, c.Value)
+		}
+		c.Num = n
+	case KindMetadata:
+		c.Path = strings.Split(strings.TrimPrefix(name, metadataPrefix), ".")
+		for _, key := range c.Path {
+			if key == "" {
+				return nil, errorAt(fieldTok, "empty key in %s", fieldTok.text)
+			}
+		}
+		fallthrough
+	default:
+		if c.Op != ":" && c.Op != "=" && c.Op != "!=" {
+			return nil, errorAt(opTok, "%s does not support %q; use :, = or !=", name, c.Op)
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,87 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		query  string
+		column int
+		msg    string
+	}{
+		{`service:`, 9, "expected a value after service:, found end of query"},
+		{`bogus:1`, 1, `unknown field "bogus"`},
+		{`latency>abc`, 9, `latency_ms expects a number, got "abc"`},
+		{`port:1.5`, 6, `dest_port expects an integer, got "1.5"`},
+		{`service>api`, 8, `service_name does not support ">"`},
+		{`metadata.a..b:1`, 1, "empty key in metadata.a..b"},
+		{`(service:api`, 13, `expected ")" to close the parenthesis at column 1, found end of query`},
+		{`service:api)`, 12, "unmatched closing parenthesis"},
+		{`api !db`, 5, `"!" must be followed by "="`},
+		{`env:"prod`, 5, "unterminated quoted string"},
+		{`""`, 1, "empty search term"},
+		{`AND api`, 1, `expected a search term, found "AND"`},
+		{`api OR`, 7, "expected a search term, found end of query"},
+		{`api OR )`, 8, `expected a search term, found ")"`},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			_, err := Parse(tc.query)
+			var qerr *Error
+			if !errors.As(err, &qerr) {
+				t.Fatalf("Parse(%q) error = %v, want a query error", tc.query, err)
+			}
+			if qerr.Column != tc.column || !strings.Contains(qerr.Msg, tc.msg) {
+				t.Errorf("Parse(%q) = column %d: %s, want column %d: %s", tc.query, qerr.Column, qerr.Msg, tc.column, tc.msg)
+			}
+		})
+	}
+}
+
+func TestParsePrecedence(t *testing.T) {
+	a, b, c, d := Text{"a"}, Text{"b"}, Text{"c"}, Text{"d"}
+	for _, tc := range []struct {
+		query string
+		want  Node
+	}{
+		{``, nil},
+		{`a b`, And{a, b}},
+		{`a AND b and c`, And{And{a, b}, c}},
+		{`a OR b c`, Or{a, And{b, c}}},
+		{`a b || c`, Or{And{a, b}, c}},
+		{`a OR b AND NOT c OR d`, Or{Or{a, And{b, Not{c}}}, d}},
+		{`NOT a b`, And{Not{a}, b}},
+		{`NOT NOT a`, Not{Not{a}}},
+		{`NOT (a OR b)`, Not{Or{a, b}}},
+		{`(a OR b) c`, And{Or{a, b}, c}},
+		{`a && (b || (c d))`, And{a, Or{b, And{c, d}}}},
+		{`"a OR b"`, Text{"a OR b"}},
+		{
+			`port>=5432 NOT env:prod`,
+			And{
+				Compare{Field: "dest_port", Kind: KindInt, Op: ">=", Value: "5432", Num: 5432},
+				Not{Compare{Field: "environment", Kind: KindString, Op: ":", Value: "prod"}},
+			},
+		},
+		{
+			`Metadata.Pool.Name!="primary db" tags=canary`,
+			And{
+				Compare{Field: "metadata.Pool.Name", Kind: KindMetadata, Op: "!=", Value: "primary db", Path: []string{"Pool", "Name"}},
+				Compare{Field: "tag", Kind: KindTag, Op: "=", Value: "canary"},
+			},
+		},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			got, err := Parse(tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Parse(%q) = %#v, want %#v", tc.query, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+// Package query implements the connection search language used by the API
+// and the dashboard search box, e.g.
+//
+//	service:api-service AND dest_port:5432 AND latency_ms>100 AND NOT error:ECONNRESET AND tag:canary
+//
+// A query is a boolean combination of terms. Terms are field comparisons
+// (field:value, field=value, field!=value and, for numeric fields, <, <=, >,
+// >=) or bare words matched against the same text columns as the search
+// parameter and the words of tags and metadata. metadata.<key> compares a
+// metadata value, with dots separating the keys of nested objects. A * in a
+// string value matches any run of characters. Values containing spaces or
+// operators can be double quoted. Terms next to each other are ANDed; AND
+// binds tighter than OR, and parentheses group.
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Error is a syntax or validation error at a position in the query
+type Error struct {
+	Column int // 1-based
+	Msg    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Msg)
+}
+
+// Kind is the value type of a field
+type Kind int
+
+const (
+	KindString Kind = iota
+	KindInt
+	KindFloat
+	KindTag
+	KindMetadata
+)
+
+// fields are the queryable columns; tag matches any element of tags
+var fields = map[string]Kind{
+	"id": KindString, "source_ip": KindString, "source_port": KindInt,
+	"dest_ip": KindString, "dest_port": KindInt, "dest_hostname": KindString,
+	"dest_rdns": KindString, "dest_asn": KindInt, "dest_org": KindString,
+	"dest_country": KindString, "dest_scope": KindString,
+	"dest_k8s_namespace": KindString, "dest_k8s_pod": KindString, "dest_k8s_service": KindString,
+	"protocol": KindString, "app_protocol": KindString, "tls_server_name": KindString,
+	"direction": KindString, "tcp_state": KindString,
+	"service_name": KindString, "service_type": KindString, "database_type": KindString,
+	"message_queue_type": KindString, "host": KindString, "deployment_id": KindString,
+	"environment": KindString, "region": KindString,
+	"k8s_namespace": KindString, "k8s_pod": KindString, "k8s_deployment": KindString,
+	"k8s_service": KindString, "k8s_node": KindString,
+	"container_id": KindString, "container_name": KindString, "container_image": KindString,
+	"latency_ms": KindFloat, "duration_ms": KindFloat, "dns_latency_ms": KindFloat,
+	"bytes_sent": KindInt, "bytes_received": KindInt, "retry_count": KindInt,
+	"error": KindString, "tag": KindTag,
+}
+
+// aliases are shorthand field names
+var aliases = map[string]string{
+	"service":   "service_name",
+	"env":       "environment",
+	"port":      "dest_port",
+	"latency":   "latency_ms",
+	"sni":       "tls_server_name",
+	"namespace": "k8s_namespace",
+	"container": "container_name",
+	"image":     "container_image",
+	"tags":      "tag",
+}
+
+// Fields returns the queryable field names, sorted
+func Fields() []string {
+	names := make([]string, 0, len(fields)+1)
+	for name := range fields {
+		names = append(names, name)
+	}
+	names = append(names, metadataPrefix+"<key>")
+	sort.Strings(names)
+	return names
+}
+
+// metadataPrefix starts metadata field names
+const metadataPrefix = "metadata."
+
+// lookupField resolves a field name or alias. Metadata fields keep the case
+// of their keys.
+func lookupField(name string) (string, Kind, bool) {
+	if len(name) > len(metadataPrefix) && strings.EqualFold(name[:len(metadataPrefix)], metadataPrefix) {
+		return metadataPrefix + name[len(metadataPrefix):], KindMetadata, true
+	}
+	name = strings.ToLower(name)
+	if canonical, ok := aliases[name]; ok {
+		name = canonical
+	}
+	kind, ok := fields[name]
+	return name, kind, ok
+}
+
+// Node is a parsed query expression
+type Node interface {
+	node()
+}
+
+// And matches when both sides match
+type And struct{ Left, Right Node }
+
+// Or matches when either side matches
+type Or struct{ Left, Right Node }
+
+// Not inverts its operand
+type Not struct{ X Node }
+
+// Compare tests a field against a value
+type Compare struct {
+	Field string
+	Kind  Kind
+	Op    string // ":", "=", "!=", "<", "<=", ">", ">="
+	Value string
+	Num   float64  // parsed value of numeric fields
+	Path  []string // metadata keys, outermost first
+}
+
+// Text matches a word against the free-text columns
+type Text struct {
+	Value string
+}
+
+func (And) node()     {}
+func (Or) node()      {}
+func (Not) node()     {}
+func (Compare) node() {}
+func (Text) node()    {}
+
+// wildcard reports whether a string comparison uses * patterns
+func (c Compare) wildcard() bool {
+	return c.Kind != KindInt && c.Kind != KindFloat && (c.Op == ":" || c.Op == "=" || c.Op == "!=") &&
+		strings.Contains(c.Value, "*")
+}
+
+// TagEquals matches connections carrying tag
+func TagEquals(tag string) Node {
+	return Compare{Field: "tag", Kind: KindTag, Op: "=", Value: tag}
+}
+
+// MetadataEquals matches connections whose metadata value at key, a dotted
+// path, is value
+func MetadataEquals(key, value string) Node {
+	return Compare{Field: metadataPrefix + key, Kind: KindMetadata, Op: "=", Value: value, Path: strings.Split(key, ".")}
+}
+
+// TextColumns are matched by bare words, case-insensitively
+var TextColumns = []string{
+	"service_name", "host", "deployment_id", "dest_hostname", "dest_rdns", "k8s_pod", "dest_k8s_service",
+}
@@ -0,0 +1,196 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Dialect adapts generated SQL to a database
+type Dialect struct {
+	// Like is the case-insensitive LIKE operator
+	Like string
+	// TagMatch tests whether a connection carries a tag; %s is replaced by a
+	// comparison operator followed by a placeholder
+	TagMatch string
+	// FullText matches a word in the tags and metadata, with one placeholder
+	// bound to FullTextArg(word)
+	FullText    string
+	FullTextArg func(word string) string
+	// MetadataValue returns an expression for the metadata value at path as
+	// text, NULL when missing, and its arguments
+	MetadataValue func(path []string) (string, []interface{})
+	// False is the literal for a false boolean
+	False string
+}
+
+// Dialects of the supported SQL backends. SQLite tags are matched through
+// the connection_tags table; SQLiteFTS5 also searches the connections_fts
+// index, which needs a SQLite built with FTS5.
+var (
+	SQLite = Dialect{
+		Like:          "LIKE",
+		TagMatch:      "EXISTS (SELECT 1 FROM connection_tags WHERE connection_tags.connection_id = connections.id AND connection_tags.tag %s)",
+		FullText:      `(COALESCE(tags, '') || ' ' || COALESCE(metadata, '')) LIKE ? ESCAPE '\'`,
+		FullTextArg:   containsPattern,
+		MetadataValue: sqliteMetadataValue,
+		False:         "0",
+	}
+	SQLiteFTS5 = Dialect{
+		Like:          "LIKE",
+		TagMatch:      SQLite.TagMatch,
+		FullText:      "connections.rowid IN (SELECT rowid FROM connections_fts WHERE connections_fts MATCH ?)",
+		FullTextArg:   ftsPrefix,
+		MetadataValue: sqliteMetadataValue,
+		False:         "0",
+	}
+	Postgres = Dialect{
+		Like:          "ILIKE",
+		TagMatch:      "EXISTS (SELECT 1 FROM jsonb_array_elements_text(tags) AS tag WHERE tag %s)",
+		FullText:      `(COALESCE(tags::text, '') || ' ' || COALESCE(metadata::text, '')) ILIKE ? ESCAPE '\'`,
+		FullTextArg:   containsPattern,
+		MetadataValue: postgresMetadataValue,
+		False:         "FALSE",
+	}
+)
+
+// sqliteMetadataValue reads a metadata value with json_extract, spelling
+// booleans as true and false rather than 1 and 0
+func sqliteMetadataValue(path []string) (string, []interface{}) {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, key := range path {
+		b.WriteString(`."` + strings.ReplaceAll(key, `"`, `\"`) + `"`)
+	}
+	p := b.String()
+	return "(CASE json_type(metadata, ?) WHEN 'true' THEN 'true' WHEN 'false' THEN 'false' " +
+		"ELSE CAST(json_extract(metadata, ?) AS TEXT) END)", []interface{}{p, p}
+}
+
+// postgresMetadataValue reads a metadata value with #>>, passing the path as
+// a text[] literal
+func postgresMetadataValue(path []string) (string, []interface{}) {
+	quoted := make([]string, len(path))
+	for i, key := range path {
+		quoted[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(key) + `"`
+	}
+	return "(metadata #>> CAST(? AS text[]))", []interface{}{"{" + strings.Join(quoted, ",") + "}"}
+}
+
+// containsPattern is a LIKE pattern matching s anywhere
+func containsPattern(s string) string {
+	return "%" + escapeLike(s) + "%"
+}
+
+// ftsPrefix is an FTS5 phrase matching s, with its last word as a prefix
+func ftsPrefix(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"*`
+}
+
+// ToSQL compiles a query into a WHERE clause expression with ? placeholders
+// and the matching arguments. User values are only ever passed as arguments.
+func ToSQL(n Node, d Dialect) (string, []interface{}) {
+	c := &compiler{dialect: d}
+	return c.compile(n), c.args
+}
+
+type compiler struct {
+	dialect Dialect
+	args    []interface{}
+}
+
+func (c *compiler) compile(n Node) string {
+	switch n := n.(type) {
+	case And:
+		return "(" + c.compile(n.Left) + " AND " + c.compile(n.Right) + ")"
+	case Or:
+		return "(" + c.compile(n.Left) + " OR " + c.compile(n.Right) + ")"
+	case Not:
+		// NULL columns count as not matching, so their negation matches
+		return fmt.Sprintf("NOT COALESCE(%s, %s)", c.compile(n.X), c.dialect.False)
+	case Text:
+		terms := make([]string, 0, len(TextColumns)+1)
+		for _, column := range TextColumns {
+			terms = append(terms, column+" "+c.dialect.Like+` ? ESCAPE '\'`)
+			c.args = append(c.args, containsPattern(n.Value))
+		}
+		terms = append(terms, c.dialect.FullText)
+		c.args = append(c.args, c.dialect.FullTextArg(n.Value))
+		return "(" + strings.Join(terms, " OR ") + ")"
+	case Compare:
+		return c.compare(n)
+	}
+	return "1=1"
+}
+
+func (c *compiler) compare(n Compare) string {
+	switch n.Kind {
+	case KindInt, KindFloat:
+		op := n.Op
+		if op == ":" {
+			op = "="
+		}
+		c.args = append(c.args, n.Num)
+		return fmt.Sprintf("COALESCE(%s, 0) %s ?", n.Field, op)
+
+	case KindTag:
+		cond := "= ?"
+		value := interface{}(n.Value)
+		if n.wildcard() {
+			cond = c.dialect.Like + ` ? ESCAPE '\'`
+			value = likePattern(n.Value)
+		}
+		c.args = append(c.args, value)
+		exists := fmt.Sprintf(c.dialect.TagMatch, cond)
+		if n.Op == "!=" {
+			return "NOT " + exists
+		}
+		return exists
+	}
+
+	if n.wildcard() {
+		var expr string
+		if n.Op == "!=" {
+			col := c.column(n)
+			expr = fmt.Sprintf(`(%s IS NULL OR NOT %s %s ? ESCAPE '\')`, col, c.column(n), c.dialect.Like)
+		} else {
+			expr = fmt.Sprintf(`%s %s ? ESCAPE '\'`, c.column(n), c.dialect.Like)
+		}
+		c.args = append(c.args, likePattern(n.Value))
+		return expr
+	}
+
+	var expr string
+	switch {
+	case n.Op == "!=":
+		col := c.column(n)
+		expr = fmt.Sprintf("(%s IS NULL OR %s != ?)", col, c.column(n))
+	case n.Value == "":
+		// Empty values are stored as either '' or NULL
+		expr = fmt.Sprintf("COALESCE(%s, '') = ?", c.column(n))
+	default:
+		expr = c.column(n) + " = ?"
+	}
+	c.args = append(c.args, n.Value)
+	return expr
+}
+
+// column returns the SQL expression of a string field, adding any arguments
+// it needs. It is called once per use so arguments stay in textual order.
+func (c *compiler) column(n Compare) string {
+	if n.Kind != KindMetadata {
+		return n.Field
+	}
+	expr, args := c.dialect.MetadataValue(n.Path)
+	c.args = append(c.args, args...)
+	return expr
+}
+
+// escapeLike escapes LIKE metacharacters with backslashes
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// likePattern turns a * pattern into a LIKE pattern
+func likePattern(s string) string {
+	return strings.ReplaceAll(escapeLike(s), "*", "%")
+}
@@ -0,0 +1,128 @@
+package query
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToSQL(t *testing.T) {
+	type compiled struct {
+		sql  string
+		args []interface{}
+	}
+	// textSQL is the clause a bare word compiles to: every text column, then
+	// the dialect's full-text match
+	textSQL := func(like, fullText string) string {
+		terms := []string{}
+		for _, column := range TextColumns {
+			terms = append(terms, column+" "+like+` ? ESCAPE '\'`)
+		}
+		return "(" + strings.Join(append(terms, fullText), " OR ") + ")"
+	}
+	textArgs := func(word, fullTextArg string) []interface{} {
+		args := []interface{}{}
+		for range TextColumns {
+			args = append(args, word)
+		}
+		return append(args, fullTextArg)
+	}
+	sqliteTag := "EXISTS (SELECT 1 FROM connection_tags WHERE connection_tags.connection_id = connections.id AND connection_tags.tag %s)"
+	postgresTag := "EXISTS (SELECT 1 FROM jsonb_array_elements_text(tags) AS tag WHERE tag %s)"
+	sqliteMeta := "(CASE json_type(metadata, ?) WHEN 'true' THEN 'true' WHEN 'false' THEN 'false' ELSE CAST(json_extract(metadata, ?) AS TEXT) END)"
+
+	for _, tc := range []struct {
+		query string
+		// SQLiteFTS5 only differs for bare words; an empty fts5 is SQLite's
+		sqlite, fts5, postgres compiled
+	}{
+		{
+			query:    `latency>100`,
+			sqlite:   compiled{"COALESCE(latency_ms, 0) > ?", []interface{}{100.0}},
+			postgres: compiled{"COALESCE(latency_ms, 0) > ?", []interface{}{100.0}},
+		},
+		{
+			query:    `port:443 OR port:80`,
+			sqlite:   compiled{"(COALESCE(dest_port, 0) = ? OR COALESCE(dest_port, 0) = ?)", []interface{}{443.0, 80.0}},
+			postgres: compiled{"(COALESCE(dest_port, 0) = ? OR COALESCE(dest_port, 0) = ?)", []interface{}{443.0, 80.0}},
+		},
+		{
+			query:    `service:api_*`,
+			sqlite:   compiled{`service_name LIKE ? ESCAPE '\'`, []interface{}{`api\_%`}},
+			postgres: compiled{`service_name ILIKE ? ESCAPE '\'`, []interface{}{`api\_%`}},
+		},
+		{
+			query:    `env!=prod`,
+			sqlite:   compiled{"(environment IS NULL OR environment != ?)", []interface{}{"prod"}},
+			postgres: compiled{"(environment IS NULL OR environment != ?)", []interface{}{"prod"}},
+		},
+		{
+			query:    `host=""`,
+			sqlite:   compiled{"COALESCE(host, '') = ?", []interface{}{""}},
+			postgres: compiled{"COALESCE(host, '') = ?", []interface{}{""}},
+		},
+		{
+			query:    `NOT error:ECONNRESET`,
+			sqlite:   compiled{"NOT COALESCE(error = ?, 0)", []interface{}{"ECONNRESET"}},
+			postgres: compiled{"NOT COALESCE(error = ?, FALSE)", []interface{}{"ECONNRESET"}},
+		},
+		{
+			query:    `tag!=canary`,
+			sqlite:   compiled{"NOT " + strings.Replace(sqliteTag, "%s", "= ?", 1), []interface{}{"canary"}},
+			postgres: compiled{"NOT " + strings.Replace(postgresTag, "%s", "= ?", 1), []interface{}{"canary"}},
+		},
+		{
+			query:    `tag:canary-*`,
+			sqlite:   compiled{strings.Replace(sqliteTag, "%s", `LIKE ? ESCAPE '\'`, 1), []interface{}{"canary-%"}},
+			postgres: compiled{strings.Replace(postgresTag, "%s", `ILIKE ? ESCAPE '\'`, 1), []interface{}{"canary-%"}},
+		},
+		{
+			query:    `metadata.pool.name=primary`,
+			sqlite:   compiled{sqliteMeta + " = ?", []interface{}{`$."pool"."name"`, `$."pool"."name"`, "primary"}},
+			postgres: compiled{"(metadata #>> CAST(? AS text[])) = ?", []interface{}{`{"pool","name"}`, "primary"}},
+		},
+		{
+			query: `metadata.pool!=primary`,
+			sqlite: compiled{"(" + sqliteMeta + " IS NULL OR " + sqliteMeta + " != ?)",
+				[]interface{}{`$."pool"`, `$."pool"`, `$."pool"`, `$."pool"`, "primary"}},
+			postgres: compiled{"((metadata #>> CAST(? AS text[])) IS NULL OR (metadata #>> CAST(? AS text[])) != ?)",
+				[]interface{}{`{"pool"}`, `{"pool"}`, "primary"}},
+		},
+		{
+			query: `50%`,
+			sqlite: compiled{textSQL("LIKE", `(COALESCE(tags, '') || ' ' || COALESCE(metadata, '')) LIKE ? ESCAPE '\'`),
+				textArgs(`%50\%%`, `%50\%%`)},
+			fts5: compiled{textSQL("LIKE", "connections.rowid IN (SELECT rowid FROM connections_fts WHERE connections_fts MATCH ?)"),
+				textArgs(`%50\%%`, `"50%"*`)},
+			postgres: compiled{textSQL("ILIKE", `(COALESCE(tags::text, '') || ' ' || COALESCE(metadata::text, '')) ILIKE ? ESCAPE '\'`),
+				textArgs(`%50\%%`, `%50\%%`)},
+		},
+	} {
+		t.Run(tc.query, func(t *testing.T) {
+			node, err := Parse(tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.fts5.sql == "" {
+				tc.fts5 = tc.sqlite
+			}
+			for _, d := range []struct {
+				name    string
+				dialect Dialect
+				want    compiled
+			}{
+				{"sqlite", SQLite, tc.sqlite},
+				{"sqlite_fts5", SQLiteFTS5, tc.fts5},
+				{"postgres", Postgres, tc.postgres},
+			} {
+				sql, args := ToSQL(node, d.dialect)
+				if sql != d.want.sql {
+					t.Errorf("%s: ToSQL = %s\nwant %s", d.name, sql, d.want.sql)
+				}
+				if !reflect.DeepEqual(args, d.want.args) {
+					t.Errorf("%s: args = %#v, want %#v", d.name, args, d.want.args)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package queues
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/query"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// maxClients caps the clients listed per queue type
+const maxClients = 100
+
+type broker struct {
+	stats     *models.BrokerStats
+	latency   float64
+	latencies int
+	clients   map[string]bool
+}
+
+type client struct {
+	client  *models.QueueClient
+	cluster *Cluster
+	sockets map[string]bool
+	brokers map[string]bool
+}
+
+type analysis struct {
+	stats   *models.QueueStats
+	brokers map[string]*broker
+	clients map[string]*client
+}
+
+// Analyze adds ports, brokers and clients to per-type queue stats seeded
+// with the counts from storage, from the message queue connections matching
+// filter between start and end. Connections count every report of a connection as
+// the totals do, while client churn counts distinct sockets.
+func Analyze(store storage.Storage, start, end time.Time, filter storage.ConnectionFilter,
+	topology *Topology, stats map[models.MessageQueueType]*models.QueueStats) error {
+	filter.Start, filter.End = start, end
+	queues := query.Node(query.Compare{Field: "service_type", Kind: query.KindString, Op: "=", Value: string(models.ServiceTypeMessageQueue)})
+	if filter.Query != nil {
+		queues = query.And{Left: filter.Query, Right: queues}
+	}
+	filter.Query = queues
+
+	byType := make(map[models.MessageQueueType]*analysis)
+	err := store.IterateConnections(filter, func(conn *models.Connection) error {
+		a, ok := byType[conn.MessageQueueType]
+		if !ok {
+			queue, ok := stats[conn.MessageQueueType]
+			if !ok {
+				queue = &models.QueueStats{}
+				stats[conn.MessageQueueType] = queue
+			}
+			queue.Ports = make(map[string]int)
+			a = &analysis{stats: queue, brokers: make(map[string]*broker), clients: make(map[string]*client)}
+			byType[conn.MessageQueueType] = a
+		}
+		a.add(conn, topology.Lookup(conn))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read queue connections: %v", err)
+	}
+
+	for _, a := range byType {
+		a.finish(end.Sub(start))
+	}
+	return nil
+}
+
+func (a *analysis) add(conn *models.Connection, m Match) {
+	if role := PortRole(conn.MessageQueueType, conn.DestPort, m.Bootstrap); role != "" {
+		a.stats.Ports[role]++
+	}
+
+	clusterName := ""
+	if m.Cluster != nil {
+		clusterName = m.Cluster.Name
+	}
+	clientKey := clusterName + "|" + conn.Host + "|" + conn.ServiceName
+	c, ok := a.clients[clientKey]
+	if !ok {
+		c = &client{
+			client: &models.QueueClient{
+				Cluster:     clusterName,
+				Host:        conn.Host,
+				ServiceName: conn.ServiceName,
+				Brokers:     []string{},
+			},
+			cluster: m.Cluster,
+			sockets: make(map[string]bool),
+			brokers: make(map[string]bool),
+		}
+		a.clients[clientKey] = c
+	}
+	// Polling sources report an open socket more than once
+	socket := conn.ID
+	if conn.SourcePort != 0 {
+		socket = fmt.Sprintf("%s|%s|%d|%s|%d", conn.ContainerID, conn.SourceIP, conn.SourcePort, conn.DestIP, conn.DestPort)
+	}
+	c.sockets[socket] = true
+
+	if m.Bootstrap {
+		return
+	}
+	name, address := brokerName(conn, m)
+	c.brokers[name] = true
+
+	b, ok := a.brokers[clusterName+"|"+name]
+	if !ok {
+		b = &broker{
+			stats:   &models.BrokerStats{Cluster: clusterName, Broker: name, Address: address},
+			clients: make(map[string]bool),
+		}
+		a.brokers[clusterName+"|"+name] = b
+	}
+	b.stats.Connections++
+	b.clients[conn.Host+"|"+conn.ServiceName] = true
+	if conn.Error != "" {
+		b.stats.Errors++
+	}
+	if conn.Latency > 0 {
+		b.latency += conn.Latency
+		b.latencies++
+	}
+	b.stats.BytesSent += conn.BytesSent
+	b.stats.BytesReceived += conn.BytesReceived
+	if conn.Timestamp.After(b.stats.LastSeen) {
+		b.stats.LastSeen = conn.Timestamp
+	}
+}
+
+// brokerName names the broker a connection reached: its configured ID, or
+// else its address. Unconfigured RabbitMQ nodes are named by host alone so
+// their AMQP and management ports count as one node.
+func brokerName(conn *models.Connection, m Match) (string, string) {
+	if m.Broker != nil {
+		return strconv.Itoa(m.Broker.ID), m.Broker.Address
+	}
+	host := conn.DestHostname
+	if host == "" {
+		host = conn.DestIP
+	}
+	if conn.MessageQueueType == models.MessageQueueTypeRabbitMQ {
+		return host, host
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(conn.DestPort))
+	return address, address
+}
+
+func (a *analysis) finish(span time.Duration) {
+	a.stats.Brokers = make([]*models.BrokerStats, 0, len(a.brokers))
+	for _, b := range a.brokers {
+		b.stats.Clients = len(b.clients)
+		if b.latencies > 0 {
+			b.stats.AvgLatency = b.latency / float64(b.latencies)
+		}
+		a.stats.Brokers = append(a.stats.Brokers, b.stats)
+	}
+	sort.Slice(a.stats.Brokers, func(i, j int) bool {
+		x, y := a.stats.Brokers[i], a.stats.Brokers[j]
+		if x.Cluster != y.Cluster {
+			return x.Cluster < y.Cluster
+		}
+		if x.Connections != y.Connections {
+			return x.Connections > y.Connections
+		}
+		return x.Broker < y.Broker
+	})
+
+	clients := make([]*models.QueueClient, 0, len(a.clients))
+	for _, c := range a.clients {
+		qc := c.client
+		qc.Connections = len(c.sockets)
+		if minutes := span.Minutes(); minutes > 0 {
+			qc.ChurnPerMinute = float64(qc.Connections) / minutes
+		}
+		for name := range c.brokers {
+			qc.Brokers = append(qc.Brokers, name)
+		}
+		sort.Strings(qc.Brokers)
+		// A Kafka client reaching only some brokers cannot use the partitions
+		// the others lead
+		if c.cluster != nil && c.cluster.Type == models.MessageQueueTypeKafka {
+			for _, b := range c.cluster.Brokers {
+				if id := strconv.Itoa(b.ID); !c.brokers[id] {
+					qc.MissingBrokers = append(qc.MissingBrokers, id)
+				}
+			}
+			if len(qc.MissingBrokers) > 0 {
+				a.stats.PartialClients++
+			}
+		}
+		clients = append(clients, qc)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		x, y := clients[i], clients[j]
+		if (len(x.MissingBrokers) > 0) != (len(y.MissingBrokers) > 0) {
+			return len(x.MissingBrokers) > 0
+		}
+		if x.Connections != y.Connections {
+			return x.Connections > y.Connections
+		}
+		return x.Host < y.Host
+	})
+	if len(clients) > maxClients {
+		clients = clients[:maxClients]
+	}
+	a.stats.Clients = clients
+}
@@ -0,0 +1,167 @@
+package queues
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+var base = time.Now().Add(-time.Hour).Truncate(time.Minute)
+
+// queueConn is a connection from host to a queue at ip:port, opened from
+// sourcePort; ip may be given as hostname/ip
+func queueConn(id int, host, ip string, port, sourcePort int, queueType models.MessageQueueType) *models.Connection {
+	hostname, ip, ok := strings.Cut(ip, "/")
+	if !ok {
+		hostname, ip = "", hostname
+	}
+	return &models.Connection{
+		ID:               fmt.Sprint("c", id),
+		Timestamp:        base.Add(time.Duration(id) * time.Second),
+		Host:             host,
+		ServiceName:      "orders",
+		SourceIP:         "10.1.0." + strings.TrimPrefix(host, "app-"),
+		SourcePort:       sourcePort,
+		DestIP:           ip,
+		DestHostname:     hostname,
+		DestPort:         port,
+		ServiceType:      models.ServiceTypeMessageQueue,
+		MessageQueueType: queueType,
+		Latency:          2,
+		BytesSent:        100,
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	kafka, rabbit := models.MessageQueueTypeKafka, models.MessageQueueTypeRabbitMQ
+	store := storage.NewMemoryStorage(1000)
+	id := 0
+	add := func(host, ip string, port, sourcePort int, queueType models.MessageQueueType) {
+		id++
+		if err := store.StoreConnection(queueConn(id, host, ip, port, sourcePort, queueType)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// app-1 reaches every broker of the events cluster after bootstrapping;
+	// polling reported its broker 1 socket three times
+	add("app-1", "kafka.internal/10.0.5.9", 9092, 40000, kafka)
+	add("app-1", "10.0.5.1", 9092, 40001, kafka)
+	add("app-1", "10.0.5.1", 9092, 40001, kafka)
+	add("app-1", "10.0.5.1", 9092, 40001, kafka)
+	add("app-1", "10.0.5.2", 9092, 40002, kafka)
+	add("app-1", "kafka-3.internal/10.0.5.3", 9093, 40003, kafka)
+	// app-2 never reaches broker 3
+	add("app-2", "10.0.5.1", 9092, 41000, kafka)
+	add("app-2", "10.0.5.2", 9092, 41001, kafka)
+	// app-3 reconnects to an unconfigured broker for every message
+	for port := 42000; port < 42030; port++ {
+		add("app-3", "10.0.7.1", 9092, port, kafka)
+	}
+	// RabbitMQ AMQP and management ports of one unconfigured node count as
+	// one broker
+	add("app-1", "10.0.8.1", 5672, 43000, rabbit)
+	add("app-1", "10.0.8.1", 15672, 43001, rabbit)
+	// Not queue traffic
+	store.StoreConnection(&models.Connection{ID: "db", Timestamp: base, Host: "app-1", DestIP: "10.0.9.1", DestPort: 5432, ServiceType: models.ServiceTypeDatabase})
+
+	stats := map[models.MessageQueueType]*models.QueueStats{kafka: {Connections: 38}}
+	start, end := base.Add(-time.Minute), base.Add(9*time.Minute)
+	if err := Analyze(store, start, end, storage.ConnectionFilter{}, testTopology(t), stats); err != nil {
+		t.Fatal(err)
+	}
+
+	k := stats[kafka]
+	if k.Connections != 38 {
+		t.Errorf("Connections = %d, want the seeded count", k.Connections)
+	}
+	if want := map[string]int{"bootstrap": 1, "broker": 37}; !reflect.DeepEqual(k.Ports, want) {
+		t.Errorf("Ports = %v, want %v", k.Ports, want)
+	}
+
+	var brokers []string
+	for _, b := range k.Brokers {
+		brokers = append(brokers, fmt.Sprintf("%s/%s %s conns=%d clients=%d", b.Cluster, b.Broker, b.Address, b.Connections, b.Clients))
+	}
+	wantBrokers := []string{
+		"/10.0.7.1:9092 10.0.7.1:9092 conns=30 clients=1",
+		"events/1 10.0.5.1 conns=4 clients=2",
+		"events/2 10.0.5.2:9092 conns=2 clients=2",
+		"events/3 Kafka-3.internal:9093 conns=1 clients=1",
+	}
+	if !reflect.DeepEqual(brokers, wantBrokers) {
+		t.Errorf("brokers:\n%s\nwant:\n%s", strings.Join(brokers, "\n"), strings.Join(wantBrokers, "\n"))
+	}
+
+	// Partial clients first, then by distinct sockets
+	var clients []string
+	for _, c := range k.Clients {
+		clients = append(clients, fmt.Sprintf("%s %s sockets=%d churn=%.1f brokers=%v missing=%v",
+			c.Cluster, c.Host, c.Connections, c.ChurnPerMinute, c.Brokers, c.MissingBrokers))
+	}
+	wantClients := []string{
+		"events app-2 sockets=2 churn=0.2 brokers=[1 2] missing=[3]",
+		" app-3 sockets=30 churn=3.0 brokers=[10.0.7.1:9092] missing=[]",
+		"events app-1 sockets=4 churn=0.4 brokers=[1 2 3] missing=[]",
+	}
+	if !reflect.DeepEqual(clients, wantClients) {
+		t.Errorf("clients:\n%s\nwant:\n%s", strings.Join(clients, "\n"), strings.Join(wantClients, "\n"))
+	}
+	if k.PartialClients != 1 {
+		t.Errorf("PartialClients = %d, want 1", k.PartialClients)
+	}
+
+	r := stats[rabbit]
+	if r == nil || len(r.Brokers) != 1 || r.Brokers[0].Broker != "10.0.8.1" || r.Brokers[0].Connections != 2 {
+		t.Fatalf("rabbitmq = %+v", r)
+	}
+	if want := map[string]int{"amqp": 1, "management": 1}; !reflect.DeepEqual(r.Ports, want) {
+		t.Errorf("rabbitmq Ports = %v, want %v", r.Ports, want)
+	}
+}
+
+// countingStore counts connection scans
+type countingStore struct {
+	*storage.MemoryStorage
+	scans int
+}
+
+func (s *countingStore) IterateConnections(filter storage.ConnectionFilter, fn func(*models.Connection) error) error {
+	s.scans++
+	return s.MemoryStorage.IterateConnections(filter, fn)
+}
+
+func TestCache(t *testing.T) {
+	store := &countingStore{MemoryStorage: storage.NewMemoryStorage(100)}
+	store.StoreConnection(queueConn(1, "app-1", "10.0.5.1", 9092, 40000, models.MessageQueueTypeKafka))
+	topology := testTopology(t)
+	cache := NewCache(time.Hour)
+
+	analyze := func(end time.Time, filter storage.ConnectionFilter) *models.QueueStats {
+		t.Helper()
+		stats := map[models.MessageQueueType]*models.QueueStats{models.MessageQueueTypeKafka: {Connections: 7}}
+		if err := cache.Analyze(store, end.Add(-24*time.Hour), end, filter, topology, stats); err != nil {
+			t.Fatal(err)
+		}
+		return stats[models.MessageQueueTypeKafka]
+	}
+
+	now := time.Now().Truncate(time.Hour).Add(time.Minute)
+	first := analyze(now, storage.ConnectionFilter{})
+	second := analyze(now.Add(5*time.Second), storage.ConnectionFilter{})
+	if store.scans != 1 {
+		t.Errorf("%d scans for two polls in one interval, want 1", store.scans)
+	}
+	if second.Connections != 7 || !reflect.DeepEqual(first.Brokers, second.Brokers) || len(second.Brokers) != 1 {
+		t.Errorf("cached stats = %+v, want %+v", second, first)
+	}
+
+	analyze(now, storage.ConnectionFilter{Service: "billing"})
+	if store.scans != 2 {
+		t.Errorf("a different filter reused the cached analysis")
+	}
+}
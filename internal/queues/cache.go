@@ -0,0 +1,78 @@
+package queues
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// Cache reuses an analysis for an interval. The dashboard polls stats every
+// few seconds over the last day, and rescanning a day of queue connections
+// on every poll costs far more than a breakdown that is a minute old.
+type Cache struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	stats   map[models.MessageQueueType]*models.QueueStats
+	expires time.Time
+}
+
+// NewCache creates a cache holding each analysis for interval
+func NewCache(interval time.Duration) *Cache {
+	return &Cache{interval: interval, entries: make(map[string]cacheEntry)}
+}
+
+// Analyze is Analyze, answered from the cache when the same filter was
+// analyzed in this interval over a range that rounds to the same one. The
+// counts already in stats are kept; only the breakdowns are reused.
+func (c *Cache) Analyze(store storage.Storage, start, end time.Time, filter storage.ConnectionFilter,
+	topology *Topology, stats map[models.MessageQueueType]*models.QueueStats) error {
+	// Rolling ranges such as the last 24 hours move on every poll, so they
+	// are rounded to the interval to be recognized
+	filter.Start, filter.End = start.Truncate(c.interval), end.Truncate(c.interval)
+	key := fmt.Sprintf("%+v", filter)
+
+	now := time.Now()
+	c.mu.Lock()
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	cached, ok := c.entries[key]
+	c.mu.Unlock()
+
+	if !ok {
+		analyzed := make(map[models.MessageQueueType]*models.QueueStats, len(stats))
+		for queueType, queue := range stats {
+			analyzed[queueType] = &models.QueueStats{Connections: queue.Connections}
+		}
+		if err := Analyze(store, start, end, filter, topology, analyzed); err != nil {
+			return err
+		}
+		cached = cacheEntry{stats: analyzed, expires: now.Add(c.interval)}
+		c.mu.Lock()
+		c.entries[key] = cached
+		c.mu.Unlock()
+	}
+
+	for queueType, analyzed := range cached.stats {
+		queue, ok := stats[queueType]
+		if !ok {
+			queue = &models.QueueStats{}
+			stats[queueType] = queue
+		}
+		queue.Ports = analyzed.Ports
+		queue.Brokers = analyzed.Brokers
+		queue.Clients = analyzed.Clients
+		queue.PartialClients = analyzed.PartialClients
+	}
+	return nil
+}
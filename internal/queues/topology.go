@@ -0,0 +1,231 @@
+// Package queues adds message queue awareness to connection analysis: it
+// maps connections to the brokers of configured Kafka and RabbitMQ clusters,
+// tells RabbitMQ's AMQP, management and other ports apart, and breaks queue
+// stats down by broker and by client host.
+package queues
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// kafkaPort is assumed for Kafka addresses given without a port
+const kafkaPort = 9092
+
+// rabbitPorts names the role of each port a RabbitMQ node listens on
+var rabbitPorts = map[int]string{
+	5672:  "amqp",
+	5671:  "amqps",
+	15672: "management",
+	15671: "management",
+	5552:  "stream",
+	25672: "clustering",
+}
+
+// Cluster is a Kafka or RabbitMQ cluster. Kafka clients first reach one of
+// the Bootstrap addresses, then connect to the brokers it advertises.
+type Cluster struct {
+	Name      string                  `json:"name"`
+	Type      models.MessageQueueType `json:"type"`
+	Bootstrap []string                `json:"bootstrap,omitempty"`
+	Brokers   []Broker                `json:"brokers"`
+}
+
+// Broker is a Kafka broker or RabbitMQ node. Address is a host or IP,
+// optionally with a port; a Kafka address without one means port 9092 and
+// a RabbitMQ address matches every RabbitMQ port on the host.
+type Broker struct {
+	ID      int    `json:"id"`
+	Address string `json:"address"`
+}
+
+// Match is where a connection landed in a topology. Cluster is nil when the
+// destination is not part of a configured cluster.
+type Match struct {
+	Cluster   *Cluster
+	Broker    *Broker
+	Bootstrap bool
+}
+
+// Topology indexes the brokers of the configured clusters by address
+type Topology struct {
+	clusters  []*Cluster
+	endpoints map[string]Match
+}
+
+// NewTopology validates clusters and indexes their addresses
+func NewTopology(clusters []Cluster) (*Topology, error) {
+	t := &Topology{endpoints: make(map[string]Match)}
+	names := make(map[string]bool)
+	for i := range clusters {
+		c := &clusters[i]
+		if c.Name == "" {
+			return nil, fmt.Errorf("cluster %d has no name", i+1)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate cluster %q", c.Name)
+		}
+		names[c.Name] = true
+		if c.Type != models.MessageQueueTypeKafka && c.Type != models.MessageQueueTypeRabbitMQ {
+			return nil, fmt.Errorf("cluster %q: type must be kafka or rabbitmq", c.Name)
+		}
+		if len(c.Brokers) == 0 {
+			return nil, fmt.Errorf("cluster %q has no brokers", c.Name)
+		}
+
+		ids := make(map[int]bool)
+		for j := range c.Brokers {
+			b := &c.Brokers[j]
+			if ids[b.ID] {
+				return nil, fmt.Errorf("cluster %q: duplicate broker id %d", c.Name, b.ID)
+			}
+			ids[b.ID] = true
+			keys, err := endpointKeys(c.Type, b.Address)
+			if err != nil {
+				return nil, fmt.Errorf("cluster %q: broker %d: %v", c.Name, b.ID, err)
+			}
+			for _, key := range keys {
+				if other, ok := t.endpoints[key]; ok {
+					return nil, fmt.Errorf("cluster %q: %s is already a broker of cluster %q", c.Name, key, other.Cluster.Name)
+				}
+				t.endpoints[key] = Match{Cluster: c, Broker: b}
+			}
+		}
+		for _, address := range c.Bootstrap {
+			keys, err := endpointKeys(c.Type, address)
+			if err != nil {
+				return nil, fmt.Errorf("cluster %q: bootstrap: %v", c.Name, err)
+			}
+			// Bootstrap lists often name brokers themselves
+			for _, key := range keys {
+				if _, ok := t.endpoints[key]; !ok {
+					t.endpoints[key] = Match{Cluster: c, Bootstrap: true}
+				}
+			}
+		}
+		t.clusters = append(t.clusters, c)
+	}
+	return t, nil
+}
+
+// LoadTopologyFile reads clusters from a JSON file of the form
+// {"clusters": [{"name": ..., "type": "kafka", "bootstrap": [...], "brokers": [{"id": 1, "address": ...}]}]}
+func LoadTopologyFile(path string) (*Topology, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queue clusters: %v", err)
+	}
+	var file struct {
+		Clusters []Cluster `json:"clusters"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse queue clusters: %v", err)
+	}
+	return NewTopology(file.Clusters)
+}
+
+// endpointKeys returns the host:port keys an address stands for
+func endpointKeys(queueType models.MessageQueueType, address string) ([]string, error) {
+	if address == "" {
+		return nil, fmt.Errorf("empty address")
+	}
+	host, port := address, 0
+	if h, p, err := net.SplitHostPort(address); err == nil {
+		host = h
+		if port, err = strconv.Atoi(p); err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid port in %q", address)
+		}
+	}
+	host = strings.ToLower(host)
+
+	var ports []int
+	switch {
+	case queueType == models.MessageQueueTypeRabbitMQ:
+		for p := range rabbitPorts {
+			ports = append(ports, p)
+		}
+		if port != 0 && rabbitPorts[port] == "" {
+			ports = append(ports, port)
+		}
+	case port != 0:
+		ports = []int{port}
+	default:
+		ports = []int{kafkaPort}
+	}
+
+	keys := make([]string, 0, len(ports))
+	for _, p := range ports {
+		keys = append(keys, net.JoinHostPort(host, strconv.Itoa(p)))
+	}
+	return keys, nil
+}
+
+// Lookup finds the cluster and broker a connection's destination belongs
+// to, by address or resolved hostname
+func (t *Topology) Lookup(conn *models.Connection) Match {
+	if t == nil {
+		return Match{}
+	}
+	port := strconv.Itoa(conn.DestPort)
+	for _, host := range []string{conn.DestIP, conn.DestHostname} {
+		if host == "" {
+			continue
+		}
+		if m, ok := t.endpoints[net.JoinHostPort(strings.ToLower(host), port)]; ok {
+			return m
+		}
+	}
+	return Match{}
+}
+
+// Enrich marks connections to configured clusters as message queue traffic
+// and records the cluster, broker and port role in their metadata as
+// queue_cluster, queue_broker and queue_port
+func (t *Topology) Enrich(conn *models.Connection) {
+	m := t.Lookup(conn)
+	if m.Cluster != nil {
+		conn.ServiceType = models.ServiceTypeMessageQueue
+		conn.MessageQueueType = m.Cluster.Type
+	}
+	if conn.ServiceType != models.ServiceTypeMessageQueue {
+		return
+	}
+
+	if conn.Metadata == nil {
+		conn.Metadata = make(map[string]interface{})
+	}
+	if m.Cluster != nil {
+		conn.Metadata["queue_cluster"] = m.Cluster.Name
+	}
+	if m.Broker != nil {
+		conn.Metadata["queue_broker"] = strconv.Itoa(m.Broker.ID)
+	}
+	if role := PortRole(conn.MessageQueueType, conn.DestPort, m.Bootstrap); role != "" {
+		conn.Metadata["queue_port"] = role
+	}
+}
+
+// PortRole names what a queue port is for: bootstrap or broker for Kafka,
+// and amqp, amqps, management, stream or clustering for RabbitMQ. Unknown
+// RabbitMQ ports are taken to be AMQP listeners.
+func PortRole(queueType models.MessageQueueType, port int, bootstrap bool) string {
+	switch queueType {
+	case models.MessageQueueTypeKafka:
+		if bootstrap {
+			return "bootstrap"
+		}
+		return "broker"
+	case models.MessageQueueTypeRabbitMQ:
+		if role, ok := rabbitPorts[port]; ok {
+			return role
+		}
+		return "amqp"
+	}
+	return ""
+}
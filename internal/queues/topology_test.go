@@ -0,0 +1,116 @@
+package queues
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+func testTopology(t *testing.T) *Topology {
+	t.Helper()
+	topology, err := NewTopology([]Cluster{
+		{
+			Name:      "events",
+			Type:      models.MessageQueueTypeKafka,
+			Bootstrap: []string{"kafka.internal:9092", "10.0.5.1:9092"},
+			Brokers: []Broker{
+				{ID: 1, Address: "10.0.5.1"},
+				{ID: 2, Address: "10.0.5.2:9092"},
+				{ID: 3, Address: "Kafka-3.internal:9093"},
+			},
+		},
+		{
+			Name:    "jobs",
+			Type:    models.MessageQueueTypeRabbitMQ,
+			Brokers: []Broker{{ID: 1, Address: "10.0.6.1"}, {ID: 2, Address: "10.0.6.2:5673"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return topology
+}
+
+func TestTopologyLookup(t *testing.T) {
+	topology := testTopology(t)
+	for _, tc := range []struct {
+		name      string
+		conn      models.Connection
+		cluster   string
+		broker    int
+		bootstrap bool
+		role      string
+	}{
+		{"kafka default port", models.Connection{DestIP: "10.0.5.1", DestPort: 9092}, "events", 1, false, "broker"},
+		{"kafka explicit port", models.Connection{DestIP: "10.0.5.2", DestPort: 9092}, "events", 2, false, "broker"},
+		{"kafka hostname", models.Connection{DestIP: "10.0.5.3", DestHostname: "kafka-3.INTERNAL", DestPort: 9093}, "events", 3, false, "broker"},
+		{"kafka bootstrap", models.Connection{DestIP: "10.0.5.9", DestHostname: "kafka.internal", DestPort: 9092}, "events", 0, true, "bootstrap"},
+		{"kafka wrong port", models.Connection{DestIP: "10.0.5.3", DestPort: 9092}, "", 0, false, ""},
+		{"rabbitmq amqp", models.Connection{DestIP: "10.0.6.1", DestPort: 5672}, "jobs", 1, false, "amqp"},
+		{"rabbitmq management", models.Connection{DestIP: "10.0.6.1", DestPort: 15672}, "jobs", 1, false, "management"},
+		{"rabbitmq custom listener", models.Connection{DestIP: "10.0.6.2", DestPort: 5673}, "jobs", 2, false, "amqp"},
+		{"rabbitmq clustering", models.Connection{DestIP: "10.0.6.2", DestPort: 25672}, "jobs", 2, false, "clustering"},
+		{"rabbitmq other port", models.Connection{DestIP: "10.0.6.1", DestPort: 8080}, "", 0, false, ""},
+		{"elsewhere", models.Connection{DestIP: "10.0.9.9", DestPort: 5432}, "", 0, false, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := tc.conn
+			m := topology.Lookup(&conn)
+			cluster, broker := "", 0
+			if m.Cluster != nil {
+				cluster = m.Cluster.Name
+			}
+			if m.Broker != nil {
+				broker = m.Broker.ID
+			}
+			if cluster != tc.cluster || broker != tc.broker || m.Bootstrap != tc.bootstrap {
+				t.Fatalf("Lookup = %s/%d bootstrap %v, want %s/%d bootstrap %v", cluster, broker, m.Bootstrap, tc.cluster, tc.broker, tc.bootstrap)
+			}
+
+			topology.Enrich(&conn)
+			if tc.cluster == "" {
+				if conn.ServiceType == models.ServiceTypeMessageQueue {
+					t.Errorf("Enrich marked traffic outside the clusters as a queue")
+				}
+				return
+			}
+			if conn.ServiceType != models.ServiceTypeMessageQueue || conn.Metadata["queue_cluster"] != tc.cluster ||
+				conn.Metadata["queue_port"] != tc.role {
+				t.Errorf("Enrich = %s %s %v", conn.ServiceType, conn.MessageQueueType, conn.Metadata)
+			}
+		})
+	}
+
+	var nilTopology *Topology
+	if m := nilTopology.Lookup(&models.Connection{DestIP: "10.0.5.1", DestPort: 9092}); m.Cluster != nil {
+		t.Error("nil topology matched a cluster")
+	}
+}
+
+func TestNewTopologyErrors(t *testing.T) {
+	kafka := models.MessageQueueTypeKafka
+	for _, tc := range []struct {
+		clusters []Cluster
+		err      string
+	}{
+		{[]Cluster{{Type: kafka, Brokers: []Broker{{ID: 1, Address: "a"}}}}, "cluster 1 has no name"},
+		{[]Cluster{{Name: "a", Type: "redis", Brokers: []Broker{{ID: 1, Address: "a"}}}}, "type must be kafka or rabbitmq"},
+		{[]Cluster{{Name: "a", Type: kafka}}, "has no brokers"},
+		{[]Cluster{{Name: "a", Type: kafka, Brokers: []Broker{{ID: 1, Address: "a"}, {ID: 1, Address: "b"}}}}, "duplicate broker id 1"},
+		{[]Cluster{{Name: "a", Type: kafka, Brokers: []Broker{{ID: 1, Address: "a:99999"}}}}, "invalid port"},
+		{[]Cluster{{Name: "a", Type: kafka, Brokers: []Broker{{ID: 1}}}}, "empty address"},
+		{[]Cluster{
+			{Name: "a", Type: kafka, Brokers: []Broker{{ID: 1, Address: "h"}}},
+			{Name: "b", Type: kafka, Brokers: []Broker{{ID: 1, Address: "h:9092"}}},
+		}, `h:9092 is already a broker of cluster "a"`},
+		{[]Cluster{
+			{Name: "a", Type: kafka, Brokers: []Broker{{ID: 1, Address: "h"}}},
+			{Name: "a", Type: kafka, Brokers: []Broker{{ID: 1, Address: "i"}}},
+		}, `duplicate cluster "a"`},
+	} {
+		if _, err := NewTopology(tc.clusters); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("NewTopology error = %v, want %q", err, tc.err)
+		}
+	}
+}
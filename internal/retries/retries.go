@@ -0,0 +1,290 @@
+// Package retries correlates repeated failed or short-lived connections
+// from one client to one destination into retry sequences, measuring how
+// many attempts each took, how the client backed off between them and
+// whether it got through in the end.
+//
+// A client is a service on a host, identified by its source address and
+// container. An attempt fails when it errors or is still opening, and a
+// connection that succeeds but closes within ShortLived counts as a failed
+// attempt too, so reconnect loops show up alongside refused connections.
+// A sequence ends at the first lasting connection, or when the client stops
+// trying for longer than MaxGap.
+package retries
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// Config tunes sequence detection. Zero fields take the defaults.
+type Config struct {
+	// MaxGap is the longest pause between attempts in one sequence
+	MaxGap time.Duration
+	// ShortLived is the duration under which a connection that closed
+	// cleanly still counts as a failed attempt
+	ShortLived time.Duration
+	// MinAttempts is the number of attempts, including a final success,
+	// that make a sequence
+	MinAttempts int
+}
+
+// DefaultConfig reports any retry made within two minutes
+var DefaultConfig = Config{
+	MaxGap:      2 * time.Minute,
+	ShortLived:  time.Second,
+	MinAttempts: 2,
+}
+
+// tightLoop is the median interval below which a client is not backing
+// off at all
+const tightLoop = 100 * time.Millisecond
+
+// maxIntervals caps the intervals kept on a sequence
+const maxIntervals = 100
+
+func (c Config) withDefaults() Config {
+	if c.MaxGap <= 0 {
+		c.MaxGap = DefaultConfig.MaxGap
+	}
+	if c.ShortLived <= 0 {
+		c.ShortLived = DefaultConfig.ShortLived
+	}
+	if c.MinAttempts < 2 {
+		c.MinAttempts = DefaultConfig.MinAttempts
+	}
+	return c
+}
+
+// clientKey identifies a client and destination
+type clientKey struct {
+	service     string
+	host        string
+	sourceIP    string
+	container   string
+	destination string
+}
+
+// attempt is the part of a connection a sequence needs
+type attempt struct {
+	at            time.Time
+	sourcePort    int
+	failed        bool
+	err           string
+	containerName string
+}
+
+// Correlator groups connections into retry sequences. Connections may be
+// added in any order.
+type Correlator struct {
+	config  Config
+	clients map[clientKey][]attempt
+}
+
+// NewCorrelator creates a correlator
+func NewCorrelator(config Config) *Correlator {
+	return &Correlator{config: config.withDefaults(), clients: make(map[clientKey][]attempt)}
+}
+
+// Add records a connection. Inbound connections are skipped, as their
+// client is on another host.
+func (c *Correlator) Add(conn *models.Connection) {
+	if conn.Direction == models.DirectionInbound {
+		return
+	}
+	key := clientKey{
+		service:     conn.ServiceName,
+		host:        conn.Host,
+		sourceIP:    conn.SourceIP,
+		container:   conn.ContainerID,
+		destination: destination(conn),
+	}
+	failed := conn.Error != "" || conn.TCPState == "SYN_SENT" ||
+		(conn.Duration > 0 && conn.Duration < float64(c.config.ShortLived)/float64(time.Millisecond))
+	c.clients[key] = append(c.clients[key], attempt{
+		at:            conn.Timestamp,
+		sourcePort:    conn.SourcePort,
+		failed:        failed,
+		err:           conn.Error,
+		containerName: conn.ContainerName,
+	})
+}
+
+// Sequences returns the retry sequences found, most retries first.
+// Sequences still retrying within MaxGap of end are ongoing.
+func (c *Correlator) Sequences(end time.Time) []*models.RetrySequence {
+	var sequences []*models.RetrySequence
+	for key, attempts := range c.clients {
+		sort.SliceStable(attempts, func(i, j int) bool { return attempts[i].at.Before(attempts[j].at) })
+
+		var run []attempt
+		flush := func(outcome models.RetryOutcome) {
+			if len(run) >= c.config.MinAttempts {
+				sequences = append(sequences, c.sequence(key, run, outcome))
+			}
+			run = nil
+		}
+		for _, a := range attempts {
+			if len(run) > 0 {
+				last := run[len(run)-1]
+				// Polling sources report an open socket more than once
+				if a.sourcePort != 0 && a.sourcePort == last.sourcePort {
+					if !a.failed {
+						run[len(run)-1].failed = false
+						flush(models.RetrySucceeded)
+					}
+					continue
+				}
+				if a.at.Sub(last.at) > c.config.MaxGap {
+					flush(models.RetryFailed)
+				}
+			}
+			if !a.failed && len(run) == 0 {
+				continue
+			}
+			run = append(run, a)
+			if !a.failed {
+				flush(models.RetrySucceeded)
+			}
+		}
+		if len(run) > 0 && end.Sub(run[len(run)-1].at) <= c.config.MaxGap {
+			flush(models.RetryOngoing)
+		} else {
+			flush(models.RetryFailed)
+		}
+	}
+
+	sort.Slice(sequences, func(i, j int) bool {
+		if sequences[i].Retries != sequences[j].Retries {
+			return sequences[i].Retries > sequences[j].Retries
+		}
+		return sequences[i].Start.Before(sequences[j].Start)
+	})
+	return sequences
+}
+
+func (c *Correlator) sequence(key clientKey, run []attempt, outcome models.RetryOutcome) *models.RetrySequence {
+	s := &models.RetrySequence{
+		ServiceName: key.service,
+		Host:        key.host,
+		SourceIP:    key.sourceIP,
+		Destination: key.destination,
+		Start:       run[0].at,
+		End:         run[len(run)-1].at,
+		Attempts:    len(run),
+		Retries:     len(run) - 1,
+		Outcome:     outcome,
+		Errors:      make(map[string]int),
+	}
+	for i, a := range run {
+		if a.containerName != "" {
+			s.ContainerName = a.containerName
+		}
+		if a.err != "" {
+			s.Errors[a.err]++
+			s.LastError = a.err
+		}
+		if i > 0 && len(s.Intervals) < maxIntervals {
+			s.Intervals = append(s.Intervals, float64(a.at.Sub(run[i-1].at))/float64(time.Millisecond))
+		}
+	}
+	s.MedianInterval, s.BackoffFactor, s.Backoff = backoff(s.Intervals)
+	return s
+}
+
+// backoff classifies the pauses between attempts
+func backoff(intervals []float64) (float64, float64, string) {
+	if len(intervals) == 0 {
+		return 0, 0, "unknown"
+	}
+	sorted := append([]float64(nil), intervals...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var ratios []float64
+	for i := 1; i < len(intervals); i++ {
+		if intervals[i-1] > 0 {
+			ratios = append(ratios, intervals[i]/intervals[i-1])
+		}
+	}
+	factor := 0.0
+	if len(ratios) > 0 {
+		sort.Float64s(ratios)
+		factor = math.Round(ratios[len(ratios)/2]*100) / 100
+	}
+
+	switch {
+	case median < float64(tightLoop)/float64(time.Millisecond):
+		return median, factor, "none"
+	case len(ratios) == 0:
+		return median, factor, "unknown"
+	case factor >= 1.5:
+		return median, factor, "exponential"
+	default:
+		return median, factor, "fixed"
+	}
+}
+
+// Analyze finds the retry sequences among the connections matching filter
+func Analyze(store storage.Storage, filter storage.ConnectionFilter, config Config) ([]*models.RetrySequence, error) {
+	c := NewCorrelator(config)
+	err := store.IterateConnections(filter, func(conn *models.Connection) error {
+		c.Add(conn)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connections: %v", err)
+	}
+
+	end := filter.End
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return c.Sequences(end), nil
+}
+
+// Summarize totals sequences per service, keeping each service's worst
+// sequences, services with the most retries first
+func Summarize(sequences []*models.RetrySequence, worst int) []*models.ServiceRetries {
+	byService := make(map[string]*models.ServiceRetries)
+	var services []*models.ServiceRetries
+	for _, s := range sequences {
+		summary, ok := byService[s.ServiceName]
+		if !ok {
+			summary = &models.ServiceRetries{ServiceName: s.ServiceName, Worst: []*models.RetrySequence{}}
+			byService[s.ServiceName] = summary
+			services = append(services, summary)
+		}
+		summary.Sequences++
+		summary.Retries += s.Retries
+		switch s.Outcome {
+		case models.RetryFailed:
+			summary.Failed++
+		case models.RetryOngoing:
+			summary.Ongoing++
+		}
+		// Sequences arrive worst first
+		if len(summary.Worst) < worst {
+			summary.Worst = append(summary.Worst, s)
+		}
+	}
+
+	sort.SliceStable(services, func(i, j int) bool { return services[i].Retries > services[j].Retries })
+	return services
+}
+
+func destination(conn *models.Connection) string {
+	host := conn.DestHostname
+	if host == "" {
+		host = conn.DestK8sService
+	}
+	if host == "" {
+		host = conn.DestIP
+	}
+	return host + ":" + strconv.Itoa(conn.DestPort)
+}
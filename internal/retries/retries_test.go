@@ -0,0 +1,155 @@
+package retries
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+var base = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+// try is one connection from the test client, ms after base
+type try struct {
+	ms       int
+	port     int
+	err      string
+	state    string
+	duration float64 // ms; zero while open
+}
+
+const lasting = 60000
+
+func describe(sequences []*models.RetrySequence) []string {
+	lines := []string{}
+	for _, s := range sequences {
+		lines = append(lines, fmt.Sprintf("%s start=%d attempts=%d median=%g factor=%g backoff=%s errors=%v",
+			s.Outcome, s.Start.Sub(base)/time.Millisecond, s.Attempts, s.MedianInterval, s.BackoffFactor, s.Backoff, s.Errors))
+	}
+	return lines
+}
+
+func TestSequences(t *testing.T) {
+	refused := string(models.ErrConnRefused)
+	for _, tc := range []struct {
+		name  string
+		tries []try
+		want  []string
+	}{
+		{
+			"exponential backoff until success",
+			[]try{{0, 1, refused, "", 0}, {100, 2, refused, "", 0}, {300, 3, refused, "", 0}, {700, 4, refused, "", 0}, {1500, 5, "", "", lasting}},
+			[]string{"succeeded start=0 attempts=5 median=400 factor=2 backoff=exponential errors=map[ECONNREFUSED:4]"},
+		},
+		{
+			"short-lived successes are failed attempts",
+			[]try{{0, 1, "", "", 50}, {1000, 2, "", "", 50}, {2000, 3, "", "", 999}, {3000, 4, "", "", lasting}},
+			[]string{"succeeded start=0 attempts=4 median=1000 factor=1 backoff=fixed errors=map[]"},
+		},
+		{
+			"a pause longer than MaxGap splits sequences",
+			[]try{{0, 1, refused, "", 0}, {1000, 2, refused, "", 0}, {181000, 3, refused, "", 0}, {182000, 4, refused, "", 0}},
+			[]string{
+				"failed start=0 attempts=2 median=1000 factor=0 backoff=unknown errors=map[ECONNREFUSED:2]",
+				"failed start=181000 attempts=2 median=1000 factor=0 backoff=unknown errors=map[ECONNREFUSED:2]",
+			},
+		},
+		{
+			"tight loop still retrying at the end",
+			[]try{{540000, 1, refused, "", 0}, {540010, 2, refused, "", 0}, {540020, 3, refused, "", 0}, {540030, 4, refused, "", 0}},
+			[]string{"ongoing start=540000 attempts=4 median=10 factor=1 backoff=none errors=map[ECONNREFUSED:4]"},
+		},
+		{
+			"a socket polled while opening and once established",
+			[]try{{0, 1, refused, "", 0}, {1000, 2, "", "SYN_SENT", 0}, {1500, 2, "", "ESTABLISHED", 0}},
+			[]string{"succeeded start=0 attempts=2 median=1000 factor=0 backoff=unknown errors=map[ECONNREFUSED:1]"},
+		},
+		{
+			"one failure is not a retry",
+			[]try{{0, 1, refused, "", 0}, {200000, 2, "", "", lasting}},
+			[]string{},
+		},
+		{
+			"lasting connections are not retries",
+			[]try{{0, 1, "", "", lasting}, {1000, 2, "", "", lasting}, {2000, 3, "", "", lasting}},
+			[]string{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewCorrelator(Config{})
+			// Added out of order; sequences are built in time order
+			for i := len(tc.tries) - 1; i >= 0; i-- {
+				tr := tc.tries[i]
+				c.Add(&models.Connection{
+					Timestamp:   base.Add(time.Duration(tr.ms) * time.Millisecond),
+					ServiceName: "checkout",
+					Host:        "web-1",
+					SourceIP:    "10.0.0.1",
+					SourcePort:  40000 + tr.port,
+					DestIP:      "10.0.0.5",
+					DestPort:    5432,
+					Error:       tr.err,
+					TCPState:    tr.state,
+					Duration:    tr.duration,
+				})
+			}
+			// Inbound connections belong to a client elsewhere
+			c.Add(&models.Connection{Timestamp: base, Direction: models.DirectionInbound, Error: refused})
+			c.Add(&models.Connection{Timestamp: base.Add(time.Millisecond), Direction: models.DirectionInbound, Error: refused})
+
+			got := describe(c.Sequences(base.Add(10 * time.Minute)))
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("sequences:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		intervals []float64
+		median    float64
+		factor    float64
+		backoff   string
+	}{
+		{nil, 0, 0, "unknown"},
+		{[]float64{500}, 500, 0, "unknown"},
+		{[]float64{50, 60, 40}, 50, 1.2, "none"},
+		{[]float64{99, 99}, 99, 1, "none"},
+		{[]float64{100, 100}, 100, 1, "fixed"},
+		{[]float64{1000, 1100, 950}, 1000, 1.1, "fixed"},
+		{[]float64{100, 200, 400}, 200, 2, "exponential"},
+		{[]float64{1000, 1500}, 1500, 1.5, "exponential"},
+		// A ratio after a zero interval is skipped
+		{[]float64{0, 500, 1000}, 500, 2, "exponential"},
+	} {
+		median, factor, backoff := backoff(tc.intervals)
+		if median != tc.median || factor != tc.factor || backoff != tc.backoff {
+			t.Errorf("backoff(%v) = %v, %v, %s, want %v, %v, %s", tc.intervals, median, factor, backoff, tc.median, tc.factor, tc.backoff)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	sequences := []*models.RetrySequence{
+		{ServiceName: "checkout", Retries: 9, Outcome: models.RetryFailed},
+		{ServiceName: "billing", Retries: 5, Outcome: models.RetrySucceeded},
+		{ServiceName: "billing", Retries: 5, Outcome: models.RetryOngoing},
+		{ServiceName: "checkout", Retries: 2, Outcome: models.RetrySucceeded},
+		{ServiceName: "checkout", Retries: 1, Outcome: models.RetryOngoing},
+	}
+	var got []string
+	for _, s := range Summarize(sequences, 2) {
+		got = append(got, fmt.Sprintf("%s sequences=%d retries=%d failed=%d ongoing=%d worst=%d",
+			s.ServiceName, s.Sequences, s.Retries, s.Failed, s.Ongoing, len(s.Worst)))
+	}
+	want := []string{
+		"checkout sequences=3 retries=12 failed=1 ongoing=1 worst=2",
+		"billing sequences=2 retries=10 failed=0 ongoing=1 worst=2",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Summarize:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,209 @@
+package security
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// violationWindow collapses repeated violations of the same destination
+// into one event per window
+const violationWindow = time.Hour
+
+type policyKey struct {
+	service     string
+	environment string
+}
+
+// Guard evaluates connections as they are ingested. It caches the policies
+// in effect, so policies must be changed through SavePolicy.
+type Guard struct {
+	store storage.SecurityStore
+
+	mu       sync.RWMutex
+	policies map[policyKey]*models.EgressPolicy
+
+	// listenerEnvironments are the environments whose new listeners raise
+	// events
+	listenerEnvironments map[string]bool
+}
+
+// NewGuard creates a guard with the policies stored in store
+func NewGuard(store storage.SecurityStore) (*Guard, error) {
+	g := &Guard{store: store}
+	if err := g.Reload(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Reload reads the policies in effect from storage
+func (g *Guard) Reload() error {
+	stored, err := g.store.GetEgressPolicies()
+	if err != nil {
+		return fmt.Errorf("failed to load egress policies: %v", err)
+	}
+	policies := make(map[policyKey]*models.EgressPolicy, len(stored))
+	for _, p := range stored {
+		policies[policyKey{p.ServiceName, p.Environment}] = p
+	}
+
+	g.mu.Lock()
+	g.policies = policies
+	g.mu.Unlock()
+	return nil
+}
+
+// SavePolicy validates and stores a new version of a policy and puts it in
+// effect
+func (g *Guard) SavePolicy(p *models.EgressPolicy) error {
+	if err := Validate(p); err != nil {
+		return err
+	}
+	if err := g.store.SaveEgressPolicy(p); err != nil {
+		return err
+	}
+	saved := *p
+
+	g.mu.Lock()
+	g.policies[policyKey{p.ServiceName, p.Environment}] = &saved
+	g.mu.Unlock()
+	return nil
+}
+
+// Policy returns the policy in effect for a service in an environment: the
+// environment's own policy, or else the service's policy for every
+// environment
+func (g *Guard) Policy(service, environment string) *models.EgressPolicy {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if p := g.policies[policyKey{service, environment}]; p != nil {
+		return p
+	}
+	return g.policies[policyKey{service, ""}]
+}
+
+// SetListenerEnvironments sets the environments, such as production, whose
+// hosts raise an event for every new listening socket
+func (g *Guard) SetListenerEnvironments(environments []string) {
+	envs := make(map[string]bool, len(environments))
+	for _, env := range environments {
+		envs[env] = true
+	}
+
+	g.mu.Lock()
+	g.listenerEnvironments = envs
+	g.mu.Unlock()
+}
+
+// ObserveListeners stores a new_listener event for each listener opened on
+// a host in a watched environment. The first snapshot of a host only sets
+// its baseline.
+func (g *Guard) ObserveListeners(snapshot *models.ListenerSnapshot, changes []*models.ListenerChange, known bool) {
+	g.mu.RLock()
+	watched := g.listenerEnvironments[snapshot.Environment]
+	g.mu.RUnlock()
+	if !known || !watched {
+		return
+	}
+
+	for _, c := range changes {
+		if c.Kind != models.ListenerOpened {
+			continue
+		}
+		addr := net.JoinHostPort(c.Address, strconv.Itoa(c.Port))
+		process := c.Process
+		if process == "" {
+			process = "an unknown process"
+		}
+		if c.ContainerName != "" {
+			process += " in container " + c.ContainerName
+		}
+		sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%s|%s|%d", models.SecurityNewListener, c.Host, addr, c.Protocol, c.Timestamp.Unix())))
+		e := &models.SecurityEvent{
+			ID:          hex.EncodeToString(sum[:8]),
+			Timestamp:   c.Timestamp,
+			Kind:        models.SecurityNewListener,
+			ServiceName: snapshot.ServiceName,
+			Environment: c.Environment,
+			Host:        c.Host,
+			Destination: addr,
+			DestIP:      c.Address,
+			DestPort:    c.Port,
+			Message:     fmt.Sprintf("%s started listening on %s/%s on %s", process, addr, c.Protocol, c.Host),
+		}
+		if err := g.store.StoreSecurityEvent(e); err != nil {
+			log.Printf("Error storing security event: %v", err)
+		}
+	}
+}
+
+// Check evaluates a connection, recording its destination as seen, and
+// returns the events it raises
+func (g *Guard) Check(conn *models.Connection) ([]*models.SecurityEvent, error) {
+	if conn.ServiceName == "" {
+		return nil, nil
+	}
+	dest := destination(conn)
+	var events []*models.SecurityEvent
+
+	first, err := g.store.MarkDestinationSeen(conn.ServiceName, conn.Environment, dest, conn.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if first {
+		events = append(events, newEvent(models.SecurityNewDestination, conn, dest, "",
+			fmt.Sprintf("%s connected to %s for the first time", conn.ServiceName, dest)))
+	}
+
+	p := g.Policy(conn.ServiceName, conn.Environment)
+	if p != nil && p.Mode == models.PolicyEnforce && Allows(p, conn) == nil {
+		e := newEvent(models.SecurityPolicyViolation, conn, dest, conn.Timestamp.Truncate(violationWindow).Format(time.RFC3339),
+			fmt.Sprintf("%s connected to %s (%s), which egress policy v%d does not allow", conn.ServiceName, dest, conn.DestIP, p.Version))
+		e.PolicyVersion = p.Version
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// Observe checks a connection and stores the events it raises
+func (g *Guard) Observe(conn *models.Connection) {
+	events, err := g.Check(conn)
+	if err != nil {
+		log.Printf("Error checking connection %s against egress policy: %v", conn.ID, err)
+		return
+	}
+	for _, e := range events {
+		if err := g.store.StoreSecurityEvent(e); err != nil {
+			log.Printf("Error storing security event: %v", err)
+		}
+	}
+}
+
+// newEvent builds an event whose ID is derived from its kind, service,
+// environment, destination and scope, so repeats share an ID
+func newEvent(kind models.SecurityEventKind, conn *models.Connection, dest, scope, message string) *models.SecurityEvent {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%s|%s|%s", kind, conn.ServiceName, conn.Environment, dest, scope)))
+	return &models.SecurityEvent{
+		ID:           hex.EncodeToString(sum[:8]),
+		Timestamp:    conn.Timestamp,
+		Kind:         kind,
+		ServiceName:  conn.ServiceName,
+		Environment:  conn.Environment,
+		Host:         conn.Host,
+		Destination:  dest,
+		DestIP:       conn.DestIP,
+		DestPort:     conn.DestPort,
+		ConnectionID: conn.ID,
+		Message:      message,
+	}
+}
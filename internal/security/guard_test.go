@@ -0,0 +1,151 @@
+package security
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+func describeEvents(events []*models.SecurityEvent) string {
+	lines := []string{}
+	for _, e := range events {
+		line := fmt.Sprintf("%s %s", e.Kind, e.Destination)
+		if e.PolicyVersion != 0 {
+			line += fmt.Sprintf(" v%d", e.PolicyVersion)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestGuardCheck(t *testing.T) {
+	store := storage.NewMemoryStorage(100)
+	g, err := NewGuard(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	check := func(minute int, env string, conn models.Connection) []*models.SecurityEvent {
+		t.Helper()
+		conn.Timestamp = base.Add(time.Duration(minute) * time.Minute)
+		conn.ServiceName, conn.Environment = "checkout", env
+		events, err := g.Check(&conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return events
+	}
+	db := models.Connection{DestIP: "10.0.0.5", DestPort: 5432}
+	stripe := models.Connection{DestIP: "203.0.113.5", DestHostname: "api.stripe.com", DestPort: 443}
+
+	// Without a policy only new destinations are reported, once each
+	if got := describeEvents(check(0, "production", db)); got != "new_destination 10.0.0.5:5432" {
+		t.Errorf("first connection:\n%s", got)
+	}
+	if got := describeEvents(check(1, "production", db)); got != "" {
+		t.Errorf("repeat connection:\n%s", got)
+	}
+	if got := describeEvents(check(1, "staging", db)); got != "new_destination 10.0.0.5:5432" {
+		t.Errorf("first connection in another environment:\n%s", got)
+	}
+	if events, _ := g.Check(&models.Connection{DestIP: "10.0.0.9", DestPort: 22}); len(events) != 0 {
+		t.Errorf("connection without a service raised:\n%s", describeEvents(events))
+	}
+
+	if err := g.SavePolicy(&models.EgressPolicy{ServiceName: "checkout", Mode: "block"}); err == nil {
+		t.Error("SavePolicy accepted an invalid policy")
+	}
+	// A policy for every environment, then a stricter one for production
+	err = g.SavePolicy(&models.EgressPolicy{
+		ServiceName: "checkout",
+		Mode:        models.PolicyEnforce,
+		Rules:       []models.EgressRule{{CIDR: "10.0.0.0/8"}, {Hostname: "*.stripe.com", Ports: []int{443}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.SavePolicy(&models.EgressPolicy{
+		ServiceName: "checkout",
+		Environment: "production",
+		Mode:        models.PolicyEnforce,
+		Rules:       []models.EgressRule{{CIDR: "10.0.0.0/8", Ports: []int{5432}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := describeEvents(check(2, "production", db)); got != "" {
+		t.Errorf("allowed connection:\n%s", got)
+	}
+	if got := describeEvents(check(2, "staging", stripe)); got != "new_destination api.stripe.com:443" {
+		t.Errorf("connection allowed by the fallback policy:\n%s", got)
+	}
+	first := check(3, "production", stripe)
+	if got := describeEvents(first); got != "new_destination api.stripe.com:443\npolicy_violation api.stripe.com:443 v1" {
+		t.Errorf("violation:\n%s", got)
+	}
+
+	// Repeats within the hour share the violation's ID; the next hour's
+	// violation is a new event
+	again := check(50, "production", stripe)
+	later := check(70, "production", stripe)
+	if len(again) != 1 || len(later) != 1 || again[0].ID != first[1].ID || later[0].ID == first[1].ID {
+		t.Errorf("violation IDs: first %s, same hour %s, next hour %s", describeEvents(first), describeEvents(again), describeEvents(later))
+	}
+
+	// Learning mode reports new destinations but no violations
+	err = g.SavePolicy(&models.EgressPolicy{ServiceName: "checkout", Environment: "production", Mode: models.PolicyLearning})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := describeEvents(check(71, "production", models.Connection{DestIP: "198.51.100.1", DestPort: 25})); got != "new_destination 198.51.100.1:25" {
+		t.Errorf("learning mode:\n%s", got)
+	}
+
+	// A new guard reads the newest versions back from storage
+	reloaded, err := NewGuard(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := reloaded.Policy("checkout", "production"); p == nil || p.Version != 2 || p.Mode != models.PolicyLearning {
+		t.Errorf("reloaded production policy = %+v", p)
+	}
+	if p := reloaded.Policy("checkout", "development"); p == nil || p.Environment != "" || len(p.Rules) != 2 {
+		t.Errorf("reloaded fallback policy = %+v", p)
+	}
+}
+
+func TestObserveListeners(t *testing.T) {
+	store := storage.NewMemoryStorage(100)
+	g, err := NewGuard(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.SetListenerEnvironments([]string{"production"})
+
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	changes := []*models.ListenerChange{
+		{Kind: models.ListenerOpened, Timestamp: now, Host: "web-1", Environment: "production", Address: "0.0.0.0", Port: 4444, Protocol: "tcp", Process: "nc", ContainerName: "web"},
+		{Kind: models.ListenerClosed, Timestamp: now, Host: "web-1", Environment: "production", Address: "0.0.0.0", Port: 8080, Protocol: "tcp"},
+	}
+	g.ObserveListeners(&models.ListenerSnapshot{Host: "web-1", Environment: "staging"}, changes, true)
+	g.ObserveListeners(&models.ListenerSnapshot{Host: "web-1", Environment: "production"}, changes, false)
+	g.ObserveListeners(&models.ListenerSnapshot{Host: "web-1", Environment: "production", ServiceName: "web"}, changes, true)
+
+	events, err := store.GetSecurityEvents(storage.SecurityEventFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("events:\n%s\nwant one new listener", describeEvents(events))
+	}
+	e := events[0]
+	if e.Kind != models.SecurityNewListener || e.Destination != "0.0.0.0:4444" || e.ServiceName != "web" ||
+		e.Message != "nc in container web started listening on 0.0.0.0:4444/tcp on web-1" {
+		t.Errorf("event = %+v", e)
+	}
+}
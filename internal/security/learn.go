@@ -0,0 +1,84 @@
+package security
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// Propose builds an allowlist from the destinations a service reached
+// between start and end: one rule per destination, by host name where one
+// is known and by address otherwise, with the ports used. The proposal is
+// in enforce mode and is not saved.
+func Propose(store storage.Storage, service, environment string, start, end time.Time) (*models.EgressPolicy, error) {
+	if service == "" {
+		return nil, fmt.Errorf("service is required")
+	}
+
+	type observed struct {
+		rule        models.EgressRule
+		ports       map[int]bool
+		connections int
+	}
+	destinations := make(map[string]*observed)
+
+	filter := storage.ConnectionFilter{Service: service, Environment: environment, Start: start, End: end}
+	err := store.IterateConnections(filter, func(conn *models.Connection) error {
+		var rule models.EgressRule
+		switch {
+		case conn.DestHostname != "":
+			rule.Hostname = conn.DestHostname
+		case conn.DestK8sService != "":
+			rule.Hostname = conn.DestK8sService
+		default:
+			ip := net.ParseIP(conn.DestIP)
+			if ip == nil {
+				return nil
+			}
+			if ip.To4() != nil {
+				rule.CIDR = ip.String() + "/32"
+			} else {
+				rule.CIDR = ip.String() + "/128"
+			}
+		}
+
+		key := rule.Hostname + rule.CIDR
+		d := destinations[key]
+		if d == nil {
+			d = &observed{rule: rule, ports: make(map[int]bool)}
+			destinations[key] = d
+		}
+		d.ports[conn.DestPort] = true
+		d.connections++
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connections: %v", err)
+	}
+
+	policy := &models.EgressPolicy{
+		ServiceName: service,
+		Environment: environment,
+		Mode:        models.PolicyEnforce,
+		Rules:       []models.EgressRule{},
+	}
+	keys := make([]string, 0, len(destinations))
+	for key := range destinations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		d := destinations[key]
+		for port := range d.ports {
+			d.rule.Ports = append(d.rule.Ports, port)
+		}
+		sort.Ints(d.rule.Ports)
+		d.rule.Comment = fmt.Sprintf("learned from %d connections", d.connections)
+		policy.Rules = append(policy.Rules, d.rule)
+	}
+	return policy, nil
+}
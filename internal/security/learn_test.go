@@ -0,0 +1,79 @@
+package security
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+func TestPropose(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	store := storage.NewMemoryStorage(100)
+	id := 0
+	add := func(service, env string, conn models.Connection) {
+		id++
+		conn.ID = fmt.Sprint("c", id)
+		conn.Timestamp = base.Add(time.Duration(id) * time.Second)
+		conn.ServiceName, conn.Environment = service, env
+		if err := store.StoreConnection(&conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("checkout", "production", models.Connection{DestIP: "203.0.113.5", DestHostname: "api.stripe.com", DestPort: 443})
+	add("checkout", "production", models.Connection{DestIP: "203.0.113.6", DestHostname: "api.stripe.com", DestPort: 443})
+	add("checkout", "production", models.Connection{DestIP: "203.0.113.6", DestHostname: "api.stripe.com", DestPort: 80})
+	add("checkout", "production", models.Connection{DestIP: "172.20.0.9", DestK8sService: "orders.default", DestPort: 8080})
+	add("checkout", "production", models.Connection{DestIP: "10.0.0.5", DestPort: 6379})
+	add("checkout", "production", models.Connection{DestIP: "10.0.0.5", DestPort: 5432})
+	add("checkout", "production", models.Connection{DestIP: "10.0.0.5", DestPort: 5432})
+	add("checkout", "production", models.Connection{DestIP: "fd00::5", DestPort: 9000})
+	// No address to allow
+	add("checkout", "production", models.Connection{DestIP: "", DestPort: 9000})
+	// Other environments and services stay out of the proposal
+	add("checkout", "staging", models.Connection{DestIP: "10.9.0.1", DestPort: 5432})
+	add("billing", "production", models.Connection{DestIP: "10.8.0.1", DestPort: 5432})
+
+	policy, err := Propose(store, "checkout", "production", base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.ServiceName != "checkout" || policy.Environment != "production" || policy.Mode != models.PolicyEnforce {
+		t.Errorf("policy = %s/%s %s", policy.ServiceName, policy.Environment, policy.Mode)
+	}
+	want := []models.EgressRule{
+		{CIDR: "10.0.0.5/32", Ports: []int{5432, 6379}, Comment: "learned from 3 connections"},
+		{Hostname: "api.stripe.com", Ports: []int{80, 443}, Comment: "learned from 3 connections"},
+		{CIDR: "fd00::5/128", Ports: []int{9000}, Comment: "learned from 1 connections"},
+		{Hostname: "orders.default", Ports: []int{8080}, Comment: "learned from 1 connections"},
+	}
+	if !reflect.DeepEqual(policy.Rules, want) {
+		t.Errorf("rules:\n%+v\nwant:\n%+v", policy.Rules, want)
+	}
+	if err := Validate(policy); err != nil {
+		t.Errorf("proposal does not validate: %v", err)
+	}
+
+	// The proposal allows everything it was learned from
+	for _, c := range []models.Connection{
+		{DestIP: "203.0.113.7", DestHostname: "api.stripe.com", DestPort: 443},
+		{DestIP: "172.20.0.9", DestK8sService: "orders.default", DestPort: 8080},
+		{DestIP: "10.0.0.5", DestPort: 6379},
+		{DestIP: "fd00::5", DestPort: 9000},
+	} {
+		if Allows(policy, &c) == nil {
+			t.Errorf("proposal does not allow %s", destination(&c))
+		}
+	}
+
+	empty, err := Propose(store, "checkout", "production", base.Add(-2*time.Hour), base.Add(-time.Hour))
+	if err != nil || empty.Rules == nil || len(empty.Rules) != 0 {
+		t.Errorf("empty range = %+v, %v, want no rules", empty, err)
+	}
+	if _, err := Propose(store, "", "production", base, base.Add(time.Hour)); err == nil {
+		t.Error("Propose accepted an empty service")
+	}
+}
@@ -0,0 +1,111 @@
+// Package security evaluates connections against per-service egress
+// policies and reports violations and destinations a service has never used
+// before as security events.
+package security
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// Validate checks that a policy can be evaluated
+func Validate(p *models.EgressPolicy) error {
+	if p.ServiceName == "" {
+		return fmt.Errorf("service_name is required")
+	}
+	switch p.Mode {
+	case models.PolicyEnforce, models.PolicyLearning:
+	default:
+		return fmt.Errorf("mode must be %q or %q", models.PolicyEnforce, models.PolicyLearning)
+	}
+	for i, rule := range p.Rules {
+		if rule.CIDR == "" && rule.Hostname == "" && len(rule.Ports) == 0 {
+			return fmt.Errorf("rule %d: cidr, hostname or ports is required", i+1)
+		}
+		if rule.CIDR != "" {
+			if _, _, err := net.ParseCIDR(rule.CIDR); err != nil {
+				return fmt.Errorf("rule %d: invalid cidr %q", i+1, rule.CIDR)
+			}
+		}
+		if rule.Hostname != "" {
+			if _, err := path.Match(rule.Hostname, ""); err != nil {
+				return fmt.Errorf("rule %d: invalid hostname pattern %q", i+1, rule.Hostname)
+			}
+		}
+		for _, port := range rule.Ports {
+			if port < 1 || port > 65535 {
+				return fmt.Errorf("rule %d: invalid port %d", i+1, port)
+			}
+		}
+	}
+	return nil
+}
+
+// Allows returns the first rule of p that permits conn, or nil
+func Allows(p *models.EgressPolicy, conn *models.Connection) *models.EgressRule {
+	for i := range p.Rules {
+		if ruleMatches(&p.Rules[i], conn) {
+			return &p.Rules[i]
+		}
+	}
+	return nil
+}
+
+func ruleMatches(rule *models.EgressRule, conn *models.Connection) bool {
+	if rule.CIDR != "" {
+		_, network, err := net.ParseCIDR(rule.CIDR)
+		ip := net.ParseIP(conn.DestIP)
+		if err != nil || ip == nil || !network.Contains(ip) {
+			return false
+		}
+	}
+	if rule.Hostname != "" && !hostnameMatches(rule.Hostname, conn) {
+		return false
+	}
+	if len(rule.Ports) > 0 {
+		allowed := false
+		for _, port := range rule.Ports {
+			if port == conn.DestPort {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// hostnameMatches matches a pattern against every name the destination is
+// known by
+func hostnameMatches(pattern string, conn *models.Connection) bool {
+	pattern = strings.ToLower(pattern)
+	for _, name := range []string{conn.DestHostname, conn.DestK8sService, conn.TLSServerName} {
+		if name == "" {
+			continue
+		}
+		if ok, _ := path.Match(pattern, strings.ToLower(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// destination names a connection's far end: the best known name of its
+// destination, and the port
+func destination(conn *models.Connection) string {
+	host := conn.DestHostname
+	if host == "" {
+		host = conn.DestK8sService
+	}
+	if host == "" {
+		host = conn.DestIP
+	}
+	return host + ":" + strconv.Itoa(conn.DestPort)
+}
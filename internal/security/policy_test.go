@@ -0,0 +1,87 @@
+package security
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+func TestValidate(t *testing.T) {
+	policy := func(rules ...models.EgressRule) *models.EgressPolicy {
+		return &models.EgressPolicy{ServiceName: "checkout", Mode: models.PolicyEnforce, Rules: rules}
+	}
+	for _, tc := range []struct {
+		policy *models.EgressPolicy
+		err    string
+	}{
+		{policy(models.EgressRule{CIDR: "10.0.0.0/8"}, models.EgressRule{Hostname: "*.internal", Ports: []int{443}}), ""},
+		{&models.EgressPolicy{Mode: models.PolicyEnforce}, "service_name is required"},
+		{&models.EgressPolicy{ServiceName: "checkout", Mode: "audit"}, "mode must be"},
+		{policy(models.EgressRule{Comment: "everything"}), "rule 1: cidr, hostname or ports is required"},
+		{policy(models.EgressRule{Ports: []int{80}}, models.EgressRule{CIDR: "10.0.0.300/8"}), `rule 2: invalid cidr "10.0.0.300/8"`},
+		{policy(models.EgressRule{CIDR: "10.0.0.1"}), "invalid cidr"},
+		{policy(models.EgressRule{Hostname: "[a-"}), "invalid hostname pattern"},
+		{policy(models.EgressRule{Ports: []int{0}}), "invalid port 0"},
+		{policy(models.EgressRule{Ports: []int{443, 65536}}), "invalid port 65536"},
+	} {
+		err := Validate(tc.policy)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("Validate(%+v) = %v", tc.policy.Rules, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Validate(%+v) = %v, want %q", tc.policy.Rules, err, tc.err)
+		}
+	}
+}
+
+func TestAllows(t *testing.T) {
+	policy := &models.EgressPolicy{
+		ServiceName: "checkout",
+		Mode:        models.PolicyEnforce,
+		Rules: []models.EgressRule{
+			{CIDR: "10.0.0.0/16", Ports: []int{5432, 6379}, Comment: "databases"},
+			{CIDR: "fd00::/8", Comment: "cluster v6"},
+			{Hostname: "*.Payments.example.com", Ports: []int{443}, Comment: "payments"},
+			{Hostname: "orders.default.svc*", Comment: "orders"},
+			{CIDR: "192.168.1.0/24", Hostname: "metrics", Comment: "metrics"},
+			{Ports: []int{53}, Comment: "dns"},
+		},
+	}
+	for _, tc := range []struct {
+		name string
+		conn models.Connection
+		rule string // comment of the matching rule
+	}{
+		{"cidr and port", models.Connection{DestIP: "10.0.3.4", DestPort: 5432}, "databases"},
+		{"cidr wrong port", models.Connection{DestIP: "10.0.3.4", DestPort: 8080}, ""},
+		{"outside cidr", models.Connection{DestIP: "10.1.0.1", DestPort: 5432}, ""},
+		{"ipv6 cidr", models.Connection{DestIP: "fd12:3456::1", DestPort: 8080}, "cluster v6"},
+		{"ipv4 outside ipv6 cidr", models.Connection{DestIP: "172.16.0.1", DestPort: 8080}, ""},
+		{"unparsable address", models.Connection{DestIP: "unknown", DestPort: 5432}, ""},
+		{"hostname glob, any case", models.Connection{DestIP: "203.0.113.5", DestHostname: "API.payments.example.com", DestPort: 443}, "payments"},
+		{"glob needs a subdomain", models.Connection{DestIP: "203.0.113.5", DestHostname: "payments.example.com", DestPort: 443}, ""},
+		{"hostname wrong port", models.Connection{DestIP: "203.0.113.5", DestHostname: "api.payments.example.com", DestPort: 80}, ""},
+		{"tls server name", models.Connection{DestIP: "203.0.113.5", TLSServerName: "api.payments.example.com", DestPort: 443}, "payments"},
+		{"kubernetes service", models.Connection{DestIP: "172.20.0.9", DestK8sService: "orders.default.svc.cluster.local", DestPort: 8080}, "orders"},
+		{"cidr and hostname", models.Connection{DestIP: "192.168.1.7", DestHostname: "metrics", DestPort: 9090}, "metrics"},
+		{"hostname outside cidr", models.Connection{DestIP: "192.168.2.7", DestHostname: "metrics", DestPort: 9090}, ""},
+		{"port only", models.Connection{DestIP: "8.8.8.8", DestPort: 53}, "dns"},
+		// The dns rule would allow it too, but cluster v6 comes first
+		{"first match", models.Connection{DestIP: "fd00::53", DestPort: 53}, "cluster v6"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rule := Allows(policy, &tc.conn)
+			got := ""
+			if rule != nil {
+				got = rule.Comment
+			}
+			if got != tc.rule {
+				t.Errorf("Allows = %q, want %q", got, tc.rule)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// AnomalyStore is implemented by backends that keep anomaly events
+type AnomalyStore interface {
+	// StoreAnomaly saves an anomaly; one with an existing ID is ignored, so
+	// replaying history does not duplicate events
+	StoreAnomaly(a *models.Anomaly) error
+	// GetAnomalies returns matching anomalies, newest first
+	GetAnomalies(filter AnomalyFilter) ([]*models.Anomaly, error)
+}
+
+// AnomalyFilter narrows GetAnomalies. Empty fields match everything.
+type AnomalyFilter struct {
+	Service string
+	Kind    models.AnomalyKind
+	Start   time.Time
+	End     time.Time
+	// Limit caps the results; zero means 1000
+	Limit int
+}
+
+// Matches reports whether an anomaly passes the filter
+func (f AnomalyFilter) Matches(a *models.Anomaly) bool {
+	return (f.Service == "" || a.ServiceName == f.Service) &&
+		(f.Kind == "" || a.Kind == f.Kind) &&
+		(f.Start.IsZero() || !a.Timestamp.Before(f.Start)) &&
+		(f.End.IsZero() || !a.Timestamp.After(f.End))
+}
+
+func (f AnomalyFilter) limit() int {
+	if f.Limit <= 0 || f.Limit > connectionLimit {
+		return connectionLimit
+	}
+	return f.Limit
+}
+
+func (s *sqlDB) StoreAnomaly(a *models.Anomaly) error {
+	_, err := s.db.Exec(s.bind(`
+		INSERT INTO anomalies (id, timestamp, kind, service_name, destination, metric, value, baseline, score, message)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING
+	`), a.ID, a.Timestamp, a.Kind, a.ServiceName, a.Destination, a.Metric, a.Value, a.Baseline, a.Score, a.Message)
+	if err != nil {
+		return fmt.Errorf("failed to store anomaly: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlDB) GetAnomalies(filter AnomalyFilter) ([]*models.Anomaly, error) {
+	query := `
+		SELECT id, timestamp, kind, service_name, destination, metric, value, baseline, score, message
+		FROM anomalies
+		WHERE 1=1
+	`
+	args := []interface{}{}
+	if filter.Service != "" {
+		query += " AND service_name = ?"
+		args = append(args, filter.Service)
+	}
+	if filter.Kind != "" {
+		query += " AND kind = ?"
+		args = append(args, filter.Kind)
+	}
+	if !filter.Start.IsZero() {
+		query += " AND timestamp >= ?"
+		args = append(args, filter.Start)
+	}
+	if !filter.End.IsZero() {
+		query += " AND timestamp <= ?"
+		args = append(args, filter.End)
+	}
+	query += fmt.Sprintf(" ORDER BY timestamp DESC, id LIMIT %d", filter.limit())
+
+	rows, err := s.db.Query(s.bind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query anomalies: %v", err)
+	}
+	defer rows.Close()
+
+	anomalies := []*models.Anomaly{}
+	for rows.Next() {
+		var a models.Anomaly
+		err := rows.Scan(&a.ID, &a.Timestamp, &a.Kind, &a.ServiceName, &a.Destination, &a.Metric, &a.Value, &a.Baseline, &a.Score, &a.Message)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan anomaly: %v", err)
+		}
+		anomalies = append(anomalies, &a)
+	}
+	return anomalies, rows.Err()
+}
+
+// maxMemoryAnomalies bounds the anomalies kept by MemoryStorage
+const maxMemoryAnomalies = 10000
+
+func (s *MemoryStorage) StoreAnomaly(a *models.Anomaly) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.anomalies {
+		if existing.ID == a.ID {
+			return nil
+		}
+	}
+	stored := *a
+	s.anomalies = append(s.anomalies, &stored)
+	if len(s.anomalies) > maxMemoryAnomalies {
+		s.anomalies = s.anomalies[len(s.anomalies)-maxMemoryAnomalies:]
+	}
+	return nil
+}
+
+func (s *MemoryStorage) GetAnomalies(filter AnomalyFilter) ([]*models.Anomaly, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	anomalies := []*models.Anomaly{}
+	for _, a := range s.anomalies {
+		if filter.Matches(a) {
+			copied := *a
+			anomalies = append(anomalies, &copied)
+		}
+	}
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		if !anomalies[i].Timestamp.Equal(anomalies[j].Timestamp) {
+			return anomalies[i].Timestamp.After(anomalies[j].Timestamp)
+		}
+		return anomalies[i].ID < anomalies[j].ID
+	})
+	if limit := filter.limit(); len(anomalies) > limit {
+		anomalies = anomalies[:limit]
+	}
+	return anomalies, nil
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// CachedStorage keeps the most recent window of connections in memory in
+// front of a persistent backend. Writes go to both; reads that the cache can
+// answer completely, such as short-range stats and the live dashboard's
+// requests with ConnectionFilter.Live set, never reach the backend.
+type CachedStorage struct {
+	backend Storage
+	cache   *MemoryStorage
+	window  time.Duration
+
+	mu      sync.Mutex
+	since   time.Time // the cache holds every connection stored after this
+	trimmed time.Time // last time entries outside the window were dropped
+}
+
+// NewCachedStorage caches up to capacity connections from the last window
+func NewCachedStorage(backend Storage, window time.Duration, capacity int) *CachedStorage {
+	return &CachedStorage{
+		backend: backend,
+		cache:   NewMemoryStorage(capacity),
+		window:  window,
+		since:   time.Now(),
+	}
+}
+
+// Unwrap returns the persistent backend
+func (s *CachedStorage) Unwrap() Storage {
+	return s.backend
+}
+
+// Backend returns the store behind a cache, or s itself. Optional interfaces
+// such as AnomalyStore and ListenerStore are implemented by backends and not
+// by the cache, so they are looked up on the backend.
+func Backend(s Storage) Storage {
+	if cached, ok := s.(interface{ Unwrap() Storage }); ok {
+		return cached.Unwrap()
+	}
+	return s
+}
+
+func (s *CachedStorage) StoreConnection(conn *models.Connection) error {
+	if err := s.backend.StoreConnection(conn); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Evicting the oldest entry narrows the range the cache covers
+	s.cache.mu.RLock()
+	full := s.cache.count == len(s.cache.buf)
+	var oldest time.Time
+	if full {
+		oldest = s.cache.buf[s.cache.next].Timestamp
+	}
+	s.cache.mu.RUnlock()
+	if full && oldest.After(s.since) {
+		s.since = oldest
+	}
+
+	if err := s.cache.StoreConnection(conn); err != nil {
+		// Already persisted; the cache can no longer vouch for its range
+		s.since = time.Now()
+	}
+
+	s.trim()
+	return nil
+}
+
+// trim forgets connections older than the window, at most once a second.
+// The caller holds s.mu.
+func (s *CachedStorage) trim() {
+	now := time.Now()
+	if now.Sub(s.trimmed) < time.Second {
+		return
+	}
+	s.trimmed = now
+
+	cutoff := now.Add(-s.window)
+	if s.since.Before(cutoff) {
+		s.since = cutoff
+	}
+
+	c := s.cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.count > 0 {
+		oldest := (c.next - c.count + len(c.buf)) % len(c.buf)
+		if !c.buf[oldest].Timestamp.Before(cutoff) {
+			break
+		}
+		delete(c.byID, c.buf[oldest].ID)
+		c.buf[oldest] = nil
+		c.count--
+	}
+}
+
+// covered returns the start of the range the cache answers for
+func (s *CachedStorage) covered() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.since
+}
+
+// Covered returns the start of the range a cached store answers from
+// memory, or false for a store without a cache
+func Covered(s Storage) (time.Time, bool) {
+	if cached, ok := s.(*CachedStorage); ok {
+		return cached.covered(), true
+	}
+	return time.Time{}, false
+}
+
+// live reports whether the cache answers for a range starting at start,
+// narrowing a Live request to the covered range first
+func (s *CachedStorage) live(start *time.Time, live bool) bool {
+	since := s.covered()
+	if live && start.Before(since) {
+		*start = since
+	}
+	// Connections can arrive with old timestamps, so only a range the cache
+	// covers completely can be answered from it
+	return !start.IsZero() && !start.Before(since)
+}
+
+func (s *CachedStorage) GetConnections(filter ConnectionFilter) ([]*models.Connection, error) {
+	if s.live(&filter.Start, filter.Live) {
+		return s.cache.GetConnections(filter)
+	}
+	return s.backend.GetConnections(filter)
+}
+
+func (s *CachedStorage) IterateConnections(filter ConnectionFilter, fn func(*models.Connection) error) error {
+	if s.live(&filter.Start, filter.Live) {
+		return s.cache.IterateConnections(filter, fn)
+	}
+	return s.backend.IterateConnections(filter, fn)
+}
+
+func (s *CachedStorage) GetConnectionByID(id string) (*models.Connection, error) {
+	if conn, err := s.cache.GetConnectionByID(id); err == nil {
+		return conn, nil
+	}
+	return s.backend.GetConnectionByID(id)
+}
+
+func (s *CachedStorage) GetStats(startTime, endTime time.Time, filter ConnectionFilter) (*models.ConnectionStats, error) {
+	if s.live(&startTime, filter.Live) {
+		return s.cache.GetStats(startTime, endTime, filter)
+	}
+	return s.backend.GetStats(startTime, endTime, filter)
+}
+
+func (s *CachedStorage) GetServices() ([]string, error) {
+	return s.backend.GetServices()
+}
+
+func (s *CachedStorage) GetErrors() ([]string, error) {
+	return s.backend.GetErrors()
+}
+
+func (s *CachedStorage) GetEnvironments() ([]string, error) {
+	return s.backend.GetEnvironments()
+}
+
+func (s *CachedStorage) Close() error {
+	return s.backend.Close()
+}
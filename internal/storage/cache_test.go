@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+func TestCachedStorageGetConnectionsRange(t *testing.T) {
+	now := time.Now()
+	backend := NewMemoryStorage(0)
+	// Stored before the cache existed, so only the backend has it
+	if err := backend.StoreConnection(&models.Connection{ID: "before", Timestamp: now.Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+
+	store := NewCachedStorage(backend, time.Hour, 10)
+	// Replayed with an old timestamp
+	if err := store.StoreConnection(&models.Connection{ID: "replayed", Timestamp: now.Add(-48 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StoreConnection(&models.Connection{ID: "live", Timestamp: now.Add(time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter ConnectionFilter
+		want   []string
+	}{
+		{"unbounded", ConnectionFilter{}, []string{"live", "before", "replayed"}},
+		{"before the cache", ConnectionFilter{Start: now.Add(-2 * time.Minute)}, []string{"live", "before"}},
+		{"covered by the cache", ConnectionFilter{Start: store.covered()}, []string{"live"}},
+	} {
+		conns, err := store.GetConnections(tc.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, conn := range conns {
+			got = append(got, conn.ID)
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// CertificateStore is implemented by backends that keep an inventory of the
+// TLS certificates servers presented
+type CertificateStore interface {
+	// RecordCertificates stores a chain, leaf first, and links the leaf to
+	// the endpoint that presented it
+	RecordCertificates(chain []*models.Certificate, endpoint models.CertificateEndpoint) error
+	// GetCertificates returns matching certificates with the endpoints that
+	// presented them, soonest to expire first
+	GetCertificates(filter CertificateFilter) ([]*models.Certificate, error)
+}
+
+// CertificateFilter narrows GetCertificates. Empty fields match everything.
+type CertificateFilter struct {
+	// ExpiresBefore keeps certificates that expire before it
+	ExpiresBefore time.Time
+	// IncludeCA also returns the intermediate and root certificates of
+	// chains, not only those servers presented as their own
+	IncludeCA bool
+	// Host and Environment keep certificates presented to matching
+	// endpoints
+	Host        string
+	Environment string
+	// Search matches the subject, SANs, issuer, server names and addresses,
+	// ignoring case
+	Search string
+	// Limit caps the results; zero means 1000
+	Limit int
+}
+
+func (f CertificateFilter) limit() int {
+	if f.Limit <= 0 || f.Limit > connectionLimit {
+		return connectionLimit
+	}
+	return f.Limit
+}
+
+func (f CertificateFilter) matches(c *models.Certificate) bool {
+	if (!f.ExpiresBefore.IsZero() && !c.NotAfter.Before(f.ExpiresBefore)) || (len(c.Endpoints) == 0 && !f.IncludeCA) {
+		return false
+	}
+	if f.Host != "" || f.Environment != "" {
+		found := false
+		for _, e := range c.Endpoints {
+			if (f.Host == "" || e.Host == f.Host) && (f.Environment == "" || e.Environment == f.Environment) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Search == "" {
+		return true
+	}
+	search := strings.ToLower(f.Search)
+	fields := append([]string{c.Subject, c.Issuer, c.Fingerprint}, c.SANs...)
+	for _, e := range c.Endpoints {
+		fields = append(fields, e.ServerName, e.DestIP+":"+strconv.Itoa(e.DestPort))
+	}
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), search) {
+			return true
+		}
+	}
+	return false
+}
+
+// finishCertificates filters, sorts and caps certificates, setting DaysLeft
+func finishCertificates(certs []*models.Certificate, filter CertificateFilter, now time.Time) []*models.Certificate {
+	matched := []*models.Certificate{}
+	for _, c := range certs {
+		if !filter.matches(c) {
+			continue
+		}
+		c.DaysLeft = int(math.Floor(c.NotAfter.Sub(now).Hours() / 24))
+		sort.Slice(c.Endpoints, func(i, j int) bool { return c.Endpoints[i].LastSeen.After(c.Endpoints[j].LastSeen) })
+		matched = append(matched, c)
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if !matched[i].NotAfter.Equal(matched[j].NotAfter) {
+			return matched[i].NotAfter.Before(matched[j].NotAfter)
+		}
+		return matched[i].Fingerprint < matched[j].Fingerprint
+	})
+	if len(matched) > filter.limit() {
+		matched = matched[:filter.limit()]
+	}
+	return matched
+}
+
+const certificateColumns = `fingerprint, subject, sans, issuer, serial_number, not_before, not_after,
+	key_type, is_ca, issuer_fingerprint, first_seen, last_seen`
+
+const certificateEndpointColumns = `fingerprint, dest_ip, dest_port, server_name, host, environment,
+	service_name, source, first_seen, last_seen`
+
+func (s *sqlDB) RecordCertificates(chain []*models.Certificate, endpoint models.CertificateEndpoint) error {
+	if len(chain) == 0 {
+		return fmt.Errorf("certificate chain is empty")
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, c := range chain {
+		sans, err := json.Marshal(c.SANs)
+		if err != nil {
+			return fmt.Errorf("failed to encode certificate names: %v", err)
+		}
+		_, err = tx.Exec(s.bind(`
+			INSERT INTO certificates (`+certificateColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (fingerprint) DO UPDATE SET
+				last_seen = excluded.last_seen,
+				issuer_fingerprint = CASE WHEN excluded.issuer_fingerprint != '' THEN excluded.issuer_fingerprint
+					ELSE certificates.issuer_fingerprint END
+		`), c.Fingerprint, c.Subject, string(sans), c.Issuer, c.SerialNumber, c.NotBefore, c.NotAfter,
+			c.KeyType, c.IsCA, c.IssuerFingerprint, c.FirstSeen, c.LastSeen)
+		if err != nil {
+			return fmt.Errorf("failed to store certificate: %v", err)
+		}
+	}
+
+	e := endpoint
+	_, err = tx.Exec(s.bind(`
+		INSERT INTO certificate_endpoints (`+certificateEndpointColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (fingerprint, dest_ip, dest_port, server_name, host) DO UPDATE SET
+			environment = excluded.environment, service_name = excluded.service_name,
+			source = excluded.source, last_seen = excluded.last_seen
+	`), chain[0].Fingerprint, e.DestIP, e.DestPort, e.ServerName, e.Host, e.Environment,
+		e.ServiceName, e.Source, e.FirstSeen, e.LastSeen)
+	if err != nil {
+		return fmt.Errorf("failed to store certificate endpoint: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit certificates: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlDB) GetCertificates(filter CertificateFilter) ([]*models.Certificate, error) {
+	query := `SELECT ` + certificateColumns + ` FROM certificates WHERE 1=1`
+	args := []interface{}{}
+	if !filter.ExpiresBefore.IsZero() {
+		query += " AND not_after < ?"
+		args = append(args, filter.ExpiresBefore)
+	}
+
+	rows, err := s.db.Query(s.bind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query certificates: %v", err)
+	}
+	defer rows.Close()
+
+	byFingerprint := make(map[string]*models.Certificate)
+	var certs []*models.Certificate
+	for rows.Next() {
+		var c models.Certificate
+		var sans string
+		err := rows.Scan(&c.Fingerprint, &c.Subject, &sans, &c.Issuer, &c.SerialNumber, &c.NotBefore, &c.NotAfter,
+			&c.KeyType, &c.IsCA, &c.IssuerFingerprint, &c.FirstSeen, &c.LastSeen)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan certificate: %v", err)
+		}
+		if err := json.Unmarshal([]byte(sans), &c.SANs); err != nil {
+			return nil, fmt.Errorf("failed to decode certificate names: %v", err)
+		}
+		c.Endpoints = []models.CertificateEndpoint{}
+		byFingerprint[c.Fingerprint] = &c
+		certs = append(certs, &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query certificates: %v", err)
+	}
+
+	endpoints, err := s.db.Query(`SELECT ` + certificateEndpointColumns + ` FROM certificate_endpoints`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query certificate endpoints: %v", err)
+	}
+	defer endpoints.Close()
+	for endpoints.Next() {
+		var fingerprint string
+		var e models.CertificateEndpoint
+		err := endpoints.Scan(&fingerprint, &e.DestIP, &e.DestPort, &e.ServerName, &e.Host, &e.Environment,
+			&e.ServiceName, &e.Source, &e.FirstSeen, &e.LastSeen)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan certificate endpoint: %v", err)
+		}
+		if c, ok := byFingerprint[fingerprint]; ok {
+			c.Endpoints = append(c.Endpoints, e)
+		}
+	}
+	if err := endpoints.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query certificate endpoints: %v", err)
+	}
+
+	return finishCertificates(certs, filter, time.Now()), nil
+}
+
+// certificateEndpointKey identifies an endpoint of a certificate
+type certificateEndpointKey struct {
+	destIP     string
+	destPort   int
+	serverName string
+	host       string
+}
+
+func (s *MemoryStorage) RecordCertificates(chain []*models.Certificate, endpoint models.CertificateEndpoint) error {
+	if len(chain) == 0 {
+		return fmt.Errorf("certificate chain is empty")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.certificates == nil {
+		s.certificates = make(map[string]*models.Certificate)
+		s.certificateEndpoints = make(map[string]map[certificateEndpointKey]*models.CertificateEndpoint)
+	}
+	for _, c := range chain {
+		stored, ok := s.certificates[c.Fingerprint]
+		if !ok {
+			copied := *c
+			copied.SANs = append([]string(nil), c.SANs...)
+			copied.Endpoints = nil
+			s.certificates[c.Fingerprint] = &copied
+			continue
+		}
+		stored.LastSeen = c.LastSeen
+		if c.IssuerFingerprint != "" {
+			stored.IssuerFingerprint = c.IssuerFingerprint
+		}
+	}
+
+	leaf := chain[0].Fingerprint
+	endpoints, ok := s.certificateEndpoints[leaf]
+	if !ok {
+		endpoints = make(map[certificateEndpointKey]*models.CertificateEndpoint)
+		s.certificateEndpoints[leaf] = endpoints
+	}
+	key := certificateEndpointKey{endpoint.DestIP, endpoint.DestPort, endpoint.ServerName, endpoint.Host}
+	if stored, ok := endpoints[key]; ok {
+		endpoint.FirstSeen = stored.FirstSeen
+	}
+	endpoints[key] = &endpoint
+	return nil
+}
+
+func (s *MemoryStorage) GetCertificates(filter CertificateFilter) ([]*models.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	certs := make([]*models.Certificate, 0, len(s.certificates))
+	for fingerprint, stored := range s.certificates {
+		c := *stored
+		c.SANs = append([]string(nil), stored.SANs...)
+		c.Endpoints = []models.CertificateEndpoint{}
+		for _, e := range s.certificateEndpoints[fingerprint] {
+			c.Endpoints = append(c.Endpoints, *e)
+		}
+		certs = append(certs, &c)
+	}
+	return finishCertificates(certs, filter, time.Now()), nil
+}
@@ -0,0 +1,109 @@
+package storage_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// testCertificates records chains expiring at known distances from now and
+// checks how they are listed
+func testCertificates(t *testing.T, store storage.CertificateStore) {
+	now := time.Now().UTC().Truncate(time.Second)
+	// Half a day past whole days, so DaysLeft does not move during the test
+	expiresIn := func(days int) time.Time { return now.Add(time.Duration(days)*24*time.Hour + 12*time.Hour) }
+	cert := func(fingerprint, subject string, notAfter time.Time, sans ...string) *models.Certificate {
+		return &models.Certificate{
+			Fingerprint: fingerprint,
+			Subject:     subject,
+			SANs:        sans,
+			Issuer:      "Test Root",
+			NotBefore:   now.Add(-90 * 24 * time.Hour),
+			NotAfter:    notAfter,
+			KeyType:     "ECDSA-P-256",
+			// Leaves are issued by the root
+			IssuerFingerprint: "fp-root",
+			FirstSeen:         now.Add(-time.Hour),
+			LastSeen:          now.Add(-time.Hour),
+		}
+	}
+	root := cert("fp-root", "Test Root", expiresIn(3000))
+	root.IsCA, root.IssuerFingerprint = true, ""
+	endpoint := func(host, env, ip string, port int, serverName string, seen time.Time) models.CertificateEndpoint {
+		return models.CertificateEndpoint{DestIP: ip, DestPort: port, ServerName: serverName, Host: host, Environment: env,
+			ServiceName: "checkout", Source: "check", FirstSeen: seen, LastSeen: seen}
+	}
+
+	for _, r := range []struct {
+		leaf     *models.Certificate
+		endpoint models.CertificateEndpoint
+	}{
+		{cert("fp-a", "api", expiresIn(40), "api.example.com"), endpoint("web-1", "production", "10.0.0.8", 443, "api.example.com", now.Add(-time.Hour))},
+		{cert("fp-d", "db", expiresIn(5)), endpoint("web-2", "staging", "10.0.0.10", 5432, "", now.Add(-time.Hour))},
+		{cert("fp-b", "billing", expiresIn(5)), endpoint("web-2", "staging", "10.0.0.9", 443, "", now.Add(-time.Hour))},
+		{cert("fp-c", "cache", expiresIn(-2)), endpoint("web-1", "production", "10.0.0.11", 6380, "", now.Add(-time.Hour))},
+		// api seen again, from another host
+		{cert("fp-a", "api", expiresIn(40), "api.example.com"), endpoint("web-3", "production", "10.0.0.8", 443, "api.example.com", now)},
+	} {
+		if err := store.RecordCertificates([]*models.Certificate{r.leaf, root}, r.endpoint); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	describe := func(certs []*models.Certificate) string {
+		var out []string
+		for _, c := range certs {
+			out = append(out, fmt.Sprintf("%s %d", c.Subject, c.DaysLeft))
+		}
+		return strings.Join(out, ", ")
+	}
+	for _, tc := range []struct {
+		name   string
+		filter storage.CertificateFilter
+		want   string
+	}{
+		// Soonest to expire first, ties by fingerprint
+		{"all", storage.CertificateFilter{}, "cache -2, billing 5, db 5, api 40"},
+		{"expiring", storage.CertificateFilter{ExpiresBefore: now.Add(30 * 24 * time.Hour)}, "cache -2, billing 5, db 5"},
+		{"with CAs", storage.CertificateFilter{IncludeCA: true}, "cache -2, billing 5, db 5, api 40, Test Root 3000"},
+		{"host", storage.CertificateFilter{Host: "web-1"}, "cache -2, api 40"},
+		{"environment", storage.CertificateFilter{Environment: "staging"}, "billing 5, db 5"},
+		{"search name", storage.CertificateFilter{Search: "API.EXAMPLE"}, "api 40"},
+		{"search address", storage.CertificateFilter{Search: "10.0.0.9:443"}, "billing 5"},
+		{"limit", storage.CertificateFilter{Limit: 2}, "cache -2, billing 5"},
+	} {
+		certs, err := store.GetCertificates(tc.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := describe(certs); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+
+	certs, err := store.GetCertificates(storage.CertificateFilter{Search: "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 1 || len(certs[0].Endpoints) != 2 || certs[0].Endpoints[0].Host != "web-3" || certs[0].IssuerFingerprint != "fp-root" {
+		t.Errorf("api = %+v, want two endpoints, newest first, issued by the root", certs)
+	}
+}
+
+func TestMemoryCertificates(t *testing.T) {
+	testCertificates(t, storage.NewMemoryStorage(0))
+}
+
+func TestSQLiteCertificates(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "cinnamon.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	testCertificates(t, store)
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// FlowStore is implemented by backends that keep collector flow summaries
+type FlowStore interface {
+	StoreFlowSummaries(flows []*models.FlowSummary) error
+	// GetFlowSummaries returns matching summaries, oldest first
+	GetFlowSummaries(filter FlowFilter) ([]*models.FlowSummary, error)
+}
+
+// FlowFilter narrows GetFlowSummaries. Empty fields match everything.
+type FlowFilter struct {
+	Service     string
+	Environment string
+	Host        string
+	Start       time.Time
+	End         time.Time
+}
+
+func (f FlowFilter) matches(flow *models.FlowSummary) bool {
+	return (f.Service == "" || flow.ServiceName == f.Service) &&
+		(f.Environment == "" || flow.Environment == f.Environment) &&
+		(f.Host == "" || flow.Host == f.Host) &&
+		(f.Start.IsZero() || !flow.Timestamp.Before(f.Start)) &&
+		(f.End.IsZero() || !flow.Timestamp.After(f.End))
+}
+
+// FlowFilterFor returns the flow filter selecting what a connection filter
+// selects, or false when the connection filter narrows on something flow
+// summaries do not record
+func FlowFilterFor(f ConnectionFilter) (FlowFilter, bool) {
+	narrowed := f.Error != "" || f.Search != "" ||
+		f.DestCountry != "" || f.DestASN != 0 || f.DestOrg != "" || f.DestScope != "" ||
+		f.Namespace != "" || f.Deployment != "" || f.Pod != "" || f.Node != "" ||
+		f.Container != "" || f.Image != "" || f.queryNode() != nil
+	return FlowFilter{
+		Service:     f.Service,
+		Environment: f.Environment,
+		Start:       f.Start,
+		End:         f.End,
+	}, !narrowed
+}
+
+const flowColumns = `timestamp, interval_s, host, environment, service_name, deployment_id, region,
+	process, dest_ip, dest_port, service_type, database_type, message_queue_type, connections, errors,
+	bytes_sent, bytes_received, latency_count, latency_sum_ms, latency_max_ms, latency_buckets`
+
+func (s *sqlDB) StoreFlowSummaries(flows []*models.FlowSummary) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, f := range flows {
+		errors, err := json.Marshal(f.Errors)
+		if err != nil {
+			return fmt.Errorf("failed to encode flow errors: %v", err)
+		}
+		buckets, err := json.Marshal(f.LatencyBuckets)
+		if err != nil {
+			return fmt.Errorf("failed to encode latency buckets: %v", err)
+		}
+		_, err = tx.Exec(s.bind(`
+			INSERT INTO flow_summaries (`+flowColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`), f.Timestamp, f.Interval, f.Host, f.Environment, f.ServiceName, f.DeploymentID, f.Region,
+			f.Process, f.DestIP, f.DestPort, f.ServiceType, f.DatabaseType, f.MessageQueueType, f.Connections, string(errors),
+			f.BytesSent, f.BytesReceived, f.LatencyCount, f.LatencySum, f.LatencyMax, string(buckets))
+		if err != nil {
+			return fmt.Errorf("failed to store flow summary: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit flow summaries: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlDB) GetFlowSummaries(filter FlowFilter) ([]*models.FlowSummary, error) {
+	query := `SELECT ` + flowColumns + ` FROM flow_summaries WHERE 1=1`
+	args := []interface{}{}
+	for _, c := range []struct{ column, value string }{
+		{"service_name", filter.Service},
+		{"environment", filter.Environment},
+		{"host", filter.Host},
+	} {
+		if c.value != "" {
+			query += " AND " + c.column + " = ?"
+			args = append(args, c.value)
+		}
+	}
+	if !filter.Start.IsZero() {
+		query += " AND timestamp >= ?"
+		args = append(args, filter.Start)
+	}
+	if !filter.End.IsZero() {
+		query += " AND timestamp <= ?"
+		args = append(args, filter.End)
+	}
+	query += " ORDER BY timestamp"
+
+	rows, err := s.db.Query(s.bind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query flow summaries: %v", err)
+	}
+	defer rows.Close()
+
+	flows := []*models.FlowSummary{}
+	for rows.Next() {
+		var f models.FlowSummary
+		var errors, buckets string
+		err := rows.Scan(&f.Timestamp, &f.Interval, &f.Host, &f.Environment, &f.ServiceName, &f.DeploymentID, &f.Region,
+			&f.Process, &f.DestIP, &f.DestPort, &f.ServiceType, &f.DatabaseType, &f.MessageQueueType, &f.Connections, &errors,
+			&f.BytesSent, &f.BytesReceived, &f.LatencyCount, &f.LatencySum, &f.LatencyMax, &buckets)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan flow summary: %v", err)
+		}
+		if err := json.Unmarshal([]byte(errors), &f.Errors); err != nil {
+			return nil, fmt.Errorf("failed to decode flow errors: %v", err)
+		}
+		if err := json.Unmarshal([]byte(buckets), &f.LatencyBuckets); err != nil {
+			return nil, fmt.Errorf("failed to decode latency buckets: %v", err)
+		}
+		flows = append(flows, &f)
+	}
+	return flows, rows.Err()
+}
+
+// maxMemoryFlowSummaries bounds the flow summaries kept by MemoryStorage
+const maxMemoryFlowSummaries = 100000
+
+// copyFlowSummary copies a summary so stored records are not shared with
+// callers
+func copyFlowSummary(flow *models.FlowSummary) *models.FlowSummary {
+	f := *flow
+	if flow.Errors != nil {
+		f.Errors = make(map[string]int64, len(flow.Errors))
+		for code, n := range flow.Errors {
+			f.Errors[code] = n
+		}
+	}
+	f.LatencyBuckets = append([]int64(nil), flow.LatencyBuckets...)
+	return &f
+}
+
+func (s *MemoryStorage) StoreFlowSummaries(flows []*models.FlowSummary) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range flows {
+		s.flowSummaries = append(s.flowSummaries, copyFlowSummary(f))
+	}
+	if len(s.flowSummaries) > maxMemoryFlowSummaries {
+		s.flowSummaries = s.flowSummaries[len(s.flowSummaries)-maxMemoryFlowSummaries:]
+	}
+	return nil
+}
+
+func (s *MemoryStorage) GetFlowSummaries(filter FlowFilter) ([]*models.FlowSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	flows := []*models.FlowSummary{}
+	for _, f := range s.flowSummaries {
+		if filter.matches(f) {
+			flows = append(flows, copyFlowSummary(f))
+		}
+	}
+	return flows, nil
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// HTTPMetricStore is implemented by backends that keep HTTP request metrics
+type HTTPMetricStore interface {
+	StoreHTTPMetrics(metrics []*models.HTTPMetric) error
+	// GetHTTPMetrics returns matching metrics, oldest first
+	GetHTTPMetrics(filter HTTPMetricFilter) ([]*models.HTTPMetric, error)
+}
+
+// HTTPMetricFilter narrows GetHTTPMetrics. Empty fields match everything.
+type HTTPMetricFilter struct {
+	Service     string
+	Environment string
+	Host        string
+	Method      string
+	Route       string
+	Start       time.Time
+	End         time.Time
+}
+
+func (f HTTPMetricFilter) matches(m *models.HTTPMetric) bool {
+	return (f.Service == "" || m.ServiceName == f.Service) &&
+		(f.Environment == "" || m.Environment == f.Environment) &&
+		(f.Host == "" || m.Host == f.Host) &&
+		(f.Method == "" || m.Method == f.Method) &&
+		(f.Route == "" || m.Route == f.Route) &&
+		(f.Start.IsZero() || !m.Timestamp.Before(f.Start)) &&
+		(f.End.IsZero() || !m.Timestamp.After(f.End))
+}
+
+const httpMetricColumns = `timestamp, interval_s, host, environment, service_name, dest_ip, dest_port,
+	authority, method, route, requests, client_errors, server_errors, latency_sum_ms, latency_max_ms,
+	latency_buckets, source`
+
+func (s *sqlDB) StoreHTTPMetrics(metrics []*models.HTTPMetric) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, m := range metrics {
+		buckets, err := json.Marshal(m.LatencyBuckets)
+		if err != nil {
+			return fmt.Errorf("failed to encode latency buckets: %v", err)
+		}
+		_, err = tx.Exec(s.bind(`
+			INSERT INTO http_metrics (`+httpMetricColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`), m.Timestamp, m.Interval, m.Host, m.Environment, m.ServiceName, m.DestIP, m.DestPort,
+			m.Authority, m.Method, m.Route, m.Requests, m.ClientErrors, m.ServerErrors, m.LatencySum, m.LatencyMax,
+			string(buckets), m.Source)
+		if err != nil {
+			return fmt.Errorf("failed to store http metric: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit http metrics: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlDB) GetHTTPMetrics(filter HTTPMetricFilter) ([]*models.HTTPMetric, error) {
+	query := `SELECT ` + httpMetricColumns + ` FROM http_metrics WHERE 1=1`
+	args := []interface{}{}
+	for _, c := range []struct{ column, value string }{
+		{"service_name", filter.Service},
+		{"environment", filter.Environment},
+		{"host", filter.Host},
+		{"method", filter.Method},
+		{"route", filter.Route},
+	} {
+		if c.value != "" {
+			query += " AND " + c.column + " = ?"
+			args = append(args, c.value)
+		}
+	}
+	if !filter.Start.IsZero() {
+		query += " AND timestamp >= ?"
+		args = append(args, filter.Start)
+	}
+	if !filter.End.IsZero() {
+		query += " AND timestamp <= ?"
+		args = append(args, filter.End)
+	}
+	query += " ORDER BY timestamp"
+
+	rows, err := s.db.Query(s.bind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query http metrics: %v", err)
+	}
+	defer rows.Close()
+
+	metrics := []*models.HTTPMetric{}
+	for rows.Next() {
+		var m models.HTTPMetric
+		var buckets string
+		err := rows.Scan(&m.Timestamp, &m.Interval, &m.Host, &m.Environment, &m.ServiceName, &m.DestIP, &m.DestPort,
+			&m.Authority, &m.Method, &m.Route, &m.Requests, &m.ClientErrors, &m.ServerErrors, &m.LatencySum, &m.LatencyMax,
+			&buckets, &m.Source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan http metric: %v", err)
+		}
+		if err := json.Unmarshal([]byte(buckets), &m.LatencyBuckets); err != nil {
+			return nil, fmt.Errorf("failed to decode latency buckets: %v", err)
+		}
+		metrics = append(metrics, &m)
+	}
+	return metrics, rows.Err()
+}
+
+// maxMemoryHTTPMetrics bounds the HTTP metrics kept by MemoryStorage
+const maxMemoryHTTPMetrics = 100000
+
+func (s *MemoryStorage) StoreHTTPMetrics(metrics []*models.HTTPMetric) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range metrics {
+		stored := *m
+		stored.LatencyBuckets = append([]int64(nil), m.LatencyBuckets...)
+		s.httpMetrics = append(s.httpMetrics, &stored)
+	}
+	if len(s.httpMetrics) > maxMemoryHTTPMetrics {
+		s.httpMetrics = s.httpMetrics[len(s.httpMetrics)-maxMemoryHTTPMetrics:]
+	}
+	return nil
+}
+
+func (s *MemoryStorage) GetHTTPMetrics(filter HTTPMetricFilter) ([]*models.HTTPMetric, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	metrics := []*models.HTTPMetric{}
+	for _, m := range s.httpMetrics {
+		if filter.matches(m) {
+			copied := *m
+			copied.LatencyBuckets = append([]int64(nil), m.LatencyBuckets...)
+			metrics = append(metrics, &copied)
+		}
+	}
+	return metrics, nil
+}
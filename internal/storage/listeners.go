@@ -0,0 +1,359 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// ListenerStore is implemented by backends that keep an inventory of
+// listening sockets
+type ListenerStore interface {
+	// UpdateListeners replaces a host's listeners with a snapshot, marking
+	// listeners missing from it closed. It returns the changes and whether
+	// the host had reported before.
+	UpdateListeners(snapshot *models.ListenerSnapshot) ([]*models.ListenerChange, bool, error)
+	// GetListeners returns matching listeners ordered by host and port
+	GetListeners(filter ListenerFilter) ([]*models.Listener, error)
+	// GetListenerChanges returns matching changes, newest first
+	GetListenerChanges(filter ListenerFilter) ([]*models.ListenerChange, error)
+}
+
+// ListenerFilter narrows GetListeners and GetListenerChanges. Empty fields
+// match everything.
+type ListenerFilter struct {
+	Host        string
+	Environment string
+	// IncludeClosed also returns listeners that have gone away
+	IncludeClosed bool
+	// Start, End and Limit apply to changes; Limit zero means 1000
+	Start time.Time
+	End   time.Time
+	Limit int
+}
+
+func (f ListenerFilter) matchesListener(l *models.Listener) bool {
+	return (f.Host == "" || l.Host == f.Host) &&
+		(f.Environment == "" || l.Environment == f.Environment) &&
+		(f.IncludeClosed || l.ClosedAt == nil)
+}
+
+func (f ListenerFilter) matchesChange(c *models.ListenerChange) bool {
+	return (f.Host == "" || c.Host == f.Host) &&
+		(f.Environment == "" || c.Environment == f.Environment) &&
+		(f.Start.IsZero() || !c.Timestamp.Before(f.Start)) &&
+		(f.End.IsZero() || !c.Timestamp.After(f.End))
+}
+
+func (f ListenerFilter) limit() int {
+	if f.Limit <= 0 || f.Limit > connectionLimit {
+		return connectionLimit
+	}
+	return f.Limit
+}
+
+// listenerKey identifies a listener on a host
+type listenerKey struct {
+	containerID string
+	address     string
+	port        int
+	protocol    string
+}
+
+// applySnapshot merges a snapshot into a host's listeners, returning the
+// changes. Listeners are added, refreshed or closed in place.
+func applySnapshot(current map[listenerKey]*models.Listener, snapshot *models.ListenerSnapshot) []*models.ListenerChange {
+	ts := snapshot.Timestamp
+	var changes []*models.ListenerChange
+	change := func(kind models.ListenerChangeKind, l *models.Listener) {
+		changes = append(changes, &models.ListenerChange{
+			Timestamp:     ts,
+			Kind:          kind,
+			Host:          l.Host,
+			Environment:   l.Environment,
+			Address:       l.Address,
+			Port:          l.Port,
+			Protocol:      l.Protocol,
+			Process:       l.Process,
+			ContainerName: l.ContainerName,
+		})
+	}
+
+	seen := make(map[listenerKey]bool, len(snapshot.Listeners))
+	for i := range snapshot.Listeners {
+		l := snapshot.Listeners[i]
+		key := listenerKey{l.ContainerID, l.Address, l.Port, l.Protocol}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		l.Host = snapshot.Host
+		l.Environment = snapshot.Environment
+		if l.ServiceName == "" {
+			l.ServiceName = snapshot.ServiceName
+		}
+		l.LastSeen = ts
+		l.ClosedAt = nil
+
+		existing := current[key]
+		if existing == nil || existing.ClosedAt != nil {
+			l.FirstSeen = ts
+			current[key] = &l
+			change(models.ListenerOpened, &l)
+			continue
+		}
+		l.FirstSeen = existing.FirstSeen
+		current[key] = &l
+	}
+
+	for key, l := range current {
+		if !seen[key] && l.ClosedAt == nil {
+			closed := ts
+			l.ClosedAt = &closed
+			change(models.ListenerClosed, l)
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Port != changes[j].Port {
+			return changes[i].Port < changes[j].Port
+		}
+		return changes[i].Address < changes[j].Address
+	})
+	return changes
+}
+
+func sortListeners(listeners []*models.Listener) {
+	sort.Slice(listeners, func(i, j int) bool {
+		a, b := listeners[i], listeners[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+		return a.Protocol < b.Protocol
+	})
+}
+
+const listenerColumns = `host, environment, service_name, address, port, protocol, pid, process,
+	container_id, container_name, first_seen, last_seen, closed_at`
+
+func scanListener(row rowScanner) (*models.Listener, error) {
+	var l models.Listener
+	var closedAt sql.NullTime
+	err := row.Scan(&l.Host, &l.Environment, &l.ServiceName, &l.Address, &l.Port, &l.Protocol, &l.PID, &l.Process,
+		&l.ContainerID, &l.ContainerName, &l.FirstSeen, &l.LastSeen, &closedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan listener: %v", err)
+	}
+	if closedAt.Valid {
+		l.ClosedAt = &closedAt.Time
+	}
+	return &l, nil
+}
+
+func (s *sqlDB) UpdateListeners(snapshot *models.ListenerSnapshot) ([]*models.ListenerChange, bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(s.bind(`SELECT `+listenerColumns+` FROM listeners WHERE host = ?`), snapshot.Host)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query listeners: %v", err)
+	}
+	current := make(map[listenerKey]*models.Listener)
+	for rows.Next() {
+		l, err := scanListener(rows)
+		if err != nil {
+			rows.Close()
+			return nil, false, err
+		}
+		current[listenerKey{l.ContainerID, l.Address, l.Port, l.Protocol}] = l
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to query listeners: %v", err)
+	}
+	known := len(current) > 0
+
+	changes := applySnapshot(current, snapshot)
+	for _, l := range current {
+		var closedAt interface{}
+		if l.ClosedAt != nil {
+			closedAt = *l.ClosedAt
+		}
+		_, err := tx.Exec(s.bind(`
+			INSERT INTO listeners (`+listenerColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (host, container_id, address, port, protocol) DO UPDATE SET
+				environment = excluded.environment, service_name = excluded.service_name,
+				pid = excluded.pid, process = excluded.process, container_name = excluded.container_name,
+				first_seen = excluded.first_seen, last_seen = excluded.last_seen, closed_at = excluded.closed_at
+		`), l.Host, l.Environment, l.ServiceName, l.Address, l.Port, l.Protocol, l.PID, l.Process,
+			l.ContainerID, l.ContainerName, l.FirstSeen, l.LastSeen, closedAt)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to store listener: %v", err)
+		}
+	}
+	for _, c := range changes {
+		_, err := tx.Exec(s.bind(`
+			INSERT INTO listener_changes (timestamp, kind, host, environment, address, port, protocol, process, container_name)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`), c.Timestamp, c.Kind, c.Host, c.Environment, c.Address, c.Port, c.Protocol, c.Process, c.ContainerName)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to store listener change: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("failed to commit listeners: %v", err)
+	}
+	return changes, known, nil
+}
+
+func (s *sqlDB) GetListeners(filter ListenerFilter) ([]*models.Listener, error) {
+	query := `SELECT ` + listenerColumns + ` FROM listeners WHERE 1=1`
+	args := []interface{}{}
+	if filter.Host != "" {
+		query += " AND host = ?"
+		args = append(args, filter.Host)
+	}
+	if filter.Environment != "" {
+		query += " AND environment = ?"
+		args = append(args, filter.Environment)
+	}
+	if !filter.IncludeClosed {
+		query += " AND closed_at IS NULL"
+	}
+	query += " ORDER BY host, port, address, protocol"
+
+	rows, err := s.db.Query(s.bind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query listeners: %v", err)
+	}
+	defer rows.Close()
+
+	listeners := []*models.Listener{}
+	for rows.Next() {
+		l, err := scanListener(rows)
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, rows.Err()
+}
+
+func (s *sqlDB) GetListenerChanges(filter ListenerFilter) ([]*models.ListenerChange, error) {
+	query := `
+		SELECT timestamp, kind, host, environment, address, port, protocol, process, container_name
+		FROM listener_changes
+		WHERE 1=1
+	`
+	args := []interface{}{}
+	if filter.Host != "" {
+		query += " AND host = ?"
+		args = append(args, filter.Host)
+	}
+	if filter.Environment != "" {
+		query += " AND environment = ?"
+		args = append(args, filter.Environment)
+	}
+	if !filter.Start.IsZero() {
+		query += " AND timestamp >= ?"
+		args = append(args, filter.Start)
+	}
+	if !filter.End.IsZero() {
+		query += " AND timestamp <= ?"
+		args = append(args, filter.End)
+	}
+	query += fmt.Sprintf(" ORDER BY timestamp DESC, host, port LIMIT %d", filter.limit())
+
+	rows, err := s.db.Query(s.bind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query listener changes: %v", err)
+	}
+	defer rows.Close()
+
+	changes := []*models.ListenerChange{}
+	for rows.Next() {
+		var c models.ListenerChange
+		err := rows.Scan(&c.Timestamp, &c.Kind, &c.Host, &c.Environment, &c.Address, &c.Port, &c.Protocol, &c.Process, &c.ContainerName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan listener change: %v", err)
+		}
+		changes = append(changes, &c)
+	}
+	return changes, rows.Err()
+}
+
+// maxMemoryListenerChanges bounds the changes kept by MemoryStorage
+const maxMemoryListenerChanges = 10000
+
+func (s *MemoryStorage) UpdateListeners(snapshot *models.ListenerSnapshot) ([]*models.ListenerChange, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listeners == nil {
+		s.listeners = make(map[string]map[listenerKey]*models.Listener)
+	}
+	current, known := s.listeners[snapshot.Host]
+	if !known {
+		current = make(map[listenerKey]*models.Listener)
+		s.listeners[snapshot.Host] = current
+	}
+
+	changes := applySnapshot(current, snapshot)
+	for _, c := range changes {
+		stored := *c
+		s.listenerChanges = append(s.listenerChanges, &stored)
+	}
+	if len(s.listenerChanges) > maxMemoryListenerChanges {
+		s.listenerChanges = s.listenerChanges[len(s.listenerChanges)-maxMemoryListenerChanges:]
+	}
+	return changes, known, nil
+}
+
+func (s *MemoryStorage) GetListeners(filter ListenerFilter) ([]*models.Listener, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	listeners := []*models.Listener{}
+	for _, host := range s.listeners {
+		for _, l := range host {
+			if filter.matchesListener(l) {
+				copied := *l
+				listeners = append(listeners, &copied)
+			}
+		}
+	}
+	sortListeners(listeners)
+	return listeners, nil
+}
+
+func (s *MemoryStorage) GetListenerChanges(filter ListenerFilter) ([]*models.ListenerChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	changes := []*models.ListenerChange{}
+	for i := len(s.listenerChanges) - 1; i >= 0; i-- {
+		if c := s.listenerChanges[i]; filter.matchesChange(c) {
+			copied := *c
+			changes = append(changes, &copied)
+			if len(changes) == filter.limit() {
+				break
+			}
+		}
+	}
+	return changes, nil
+}
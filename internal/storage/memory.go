@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/query"
+)
+
+// DefaultMemoryCapacity is the number of connections kept by a memory store
+// when no capacity is given
+const DefaultMemoryCapacity = 100000
+
+// connectionLimit caps GetConnections results, as the SQL backends do
+const connectionLimit = 1000
+
+// MemoryStorage keeps the most recent connections in a bounded ring buffer.
+// It needs no database and loses everything on restart, which suits local
+// debugging and tests. Queries follow the SQL backends' semantics.
+type MemoryStorage struct {
+	mu    sync.RWMutex
+	buf   []*models.Connection
+	next  int // slot for the next write
+	count int
+	byID  map[string]*models.Connection
+
+	anomalies       []*models.Anomaly // oldest first
+	policies        map[policyKey][]*models.EgressPolicy
+	seen            map[string]bool                             // service, environment and destination
+	securityEvents  []*models.SecurityEvent                     // oldest first
+	listeners       map[string]map[listenerKey]*models.Listener // by host
+	listenerChanges []*models.ListenerChange                    // oldest first
+	poolSamples     []*models.PoolSample                        // oldest first
+	httpMetrics     []*models.HTTPMetric                        // oldest first
+	flowSummaries   []*models.FlowSummary                       // oldest first
+
+	certificates         map[string]*models.Certificate // by fingerprint
+	certificateEndpoints map[string]map[certificateEndpointKey]*models.CertificateEndpoint
+}
+
+// NewMemoryStorage creates a store holding at most capacity connections
+func NewMemoryStorage(capacity int) *MemoryStorage {
+	if capacity <= 0 {
+		capacity = DefaultMemoryCapacity
+	}
+	return &MemoryStorage{
+		buf:  make([]*models.Connection, capacity),
+		byID: make(map[string]*models.Connection),
+	}
+}
+
+func (s *MemoryStorage) StoreConnection(conn *models.Connection) error {
+	if conn == nil {
+		return fmt.Errorf("connection is nil")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.byID[conn.ID]; exists {
+		return fmt.Errorf("failed to store connection: duplicate id %s", conn.ID)
+	}
+
+	if old := s.buf[s.next]; old != nil {
+		delete(s.byID, old.ID)
+	}
+	stored := copyConnection(conn)
+	s.buf[s.next] = stored
+	s.byID[conn.ID] = stored
+	s.next = (s.next + 1) % len(s.buf)
+	if s.count < len(s.buf) {
+		s.count++
+	}
+	return nil
+}
+
+// each calls fn for every stored connection, oldest first, until fn returns
+// false. The caller holds s.mu.
+func (s *MemoryStorage) each(fn func(conn *models.Connection) bool) {
+	start := (s.next - s.count + len(s.buf)) % len(s.buf)
+	for i := 0; i < s.count; i++ {
+		if !fn(s.buf[(start+i)%len(s.buf)]) {
+			return
+		}
+	}
+}
+
+func (s *MemoryStorage) GetConnections(filter ConnectionFilter) ([]*models.Connection, error) {
+	matches := s.matching(filter)
+	if len(matches) > connectionLimit {
+		matches = matches[:connectionLimit]
+	}
+
+	connections := make([]*models.Connection, len(matches))
+	for i, conn := range matches {
+		connections[i] = copyConnection(conn)
+	}
+	return connections, nil
+}
+
+func (s *MemoryStorage) IterateConnections(filter ConnectionFilter, fn func(*models.Connection) error) error {
+	for _, conn := range s.matching(filter) {
+		if err := fn(copyConnection(conn)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matching returns the stored connections passing filter, newest first
+func (s *MemoryStorage) matching(filter ConnectionFilter) []*models.Connection {
+	s.mu.RLock()
+	var matches []*models.Connection
+	s.each(func(conn *models.Connection) bool {
+		if filter.Matches(conn) {
+			matches = append(matches, conn)
+		}
+		return true
+	})
+	s.mu.RUnlock()
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Timestamp.After(matches[j].Timestamp)
+	})
+	return matches
+}
+
+func (s *MemoryStorage) GetConnectionByID(id string) (*models.Connection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conn, ok := s.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("connection not found")
+	}
+	return copyConnection(conn), nil
+}
+
+func (s *MemoryStorage) GetStats(startTime, endTime time.Time, filter ConnectionFilter) (*models.ConnectionStats, error) {
+	stats := &models.ConnectionStats{
+		ErrorCounts:      make(map[string]int64),
+		ServiceTypeStats: make(map[models.ServiceType]int),
+		DatabaseStats:    make(map[models.DatabaseType]int),
+		QueueStats:       make(map[models.MessageQueueType]int),
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var totalLatency float64
+	s.each(func(conn *models.Connection) bool {
+		if conn.Timestamp.Before(startTime) || conn.Timestamp.After(endTime) || !filter.Matches(conn) {
+			return true
+		}
+
+		stats.TotalConnections++
+		stats.ErrorCounts[conn.Error]++
+		totalLatency += conn.Latency
+		stats.TotalBytesSent += conn.BytesSent
+		stats.TotalBytesReceived += conn.BytesReceived
+		stats.ServiceTypeStats[conn.ServiceType]++
+		switch conn.ServiceType {
+		case models.ServiceTypeDatabase:
+			stats.DatabaseStats[conn.DatabaseType]++
+		case models.ServiceTypeMessageQueue:
+			stats.QueueStats[conn.MessageQueueType]++
+		}
+		return true
+	})
+	if stats.TotalConnections > 0 {
+		stats.AvgLatency = totalLatency / float64(stats.TotalConnections)
+	}
+
+	return stats, nil
+}
+
+// distinct returns the non-empty values of a field
+func (s *MemoryStorage) distinct(field func(conn *models.Connection) string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var values []string
+	s.each(func(conn *models.Connection) bool {
+		if v := field(conn); v != "" && !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+		return true
+	})
+	sort.Strings(values)
+	return values
+}
+
+func (s *MemoryStorage) GetServices() ([]string, error) {
+	return s.distinct(func(conn *models.Connection) string { return conn.ServiceName }), nil
+}
+
+func (s *MemoryStorage) GetErrors() ([]string, error) {
+	return s.distinct(func(conn *models.Connection) string { return conn.Error }), nil
+}
+
+func (s *MemoryStorage) GetEnvironments() ([]string, error) {
+	return s.distinct(func(conn *models.Connection) string { return conn.Environment }), nil
+}
+
+func (s *MemoryStorage) Close() error {
+	return nil
+}
+
+// Matches reports whether a connection passes the filter, with the same
+// semantics as the SQL backends
+func (f ConnectionFilter) Matches(conn *models.Connection) bool {
+	if !f.Start.IsZero() && conn.Timestamp.Before(f.Start) || !f.End.IsZero() && conn.Timestamp.After(f.End) {
+		return false
+	}
+	if f.Service != "" && conn.ServiceName != f.Service {
+		return false
+	}
+	if f.Error != "" && conn.Error != f.Error {
+		return false
+	}
+	if f.Environment != "" && conn.Environment != f.Environment {
+		return false
+	}
+	if f.Search != "" && !query.Match(query.Text{Value: f.Search}, conn) {
+		return false
+	}
+	// Countries are stored as uppercase ISO codes
+	if f.DestCountry != "" && conn.DestCountry != strings.ToUpper(f.DestCountry) {
+		return false
+	}
+	if f.DestASN != 0 && conn.DestASN != f.DestASN {
+		return false
+	}
+	if f.DestOrg != "" && conn.DestOrg != f.DestOrg {
+		return false
+	}
+	if f.DestScope != "" && conn.DestScope != f.DestScope {
+		return false
+	}
+	if f.Namespace != "" && conn.K8sNamespace != f.Namespace && conn.DestK8sNamespace != f.Namespace {
+		return false
+	}
+	if f.Deployment != "" && conn.K8sDeployment != f.Deployment {
+		return false
+	}
+	if f.Pod != "" && conn.K8sPod != f.Pod && conn.DestK8sPod != f.Pod {
+		return false
+	}
+	if f.Node != "" && conn.K8sNode != f.Node {
+		return false
+	}
+	if f.Container != "" && conn.ContainerName != f.Container && !strings.HasPrefix(conn.ContainerID, f.Container) {
+		return false
+	}
+	if f.Image != "" && conn.ContainerImage != f.Image {
+		return false
+	}
+	return query.Match(f.queryNode(), conn)
+}
+
+// copyConnection copies a connection so stored records are not shared with
+// callers. Metadata values are copied shallowly.
+func copyConnection(conn *models.Connection) *models.Connection {
+	c := *conn
+	if conn.Tags != nil {
+		c.Tags = append([]string{}, conn.Tags...)
+	}
+	if conn.Metadata != nil {
+		c.Metadata = make(map[string]interface{}, len(conn.Metadata))
+		for k, v := range conn.Metadata {
+			c.Metadata[k] = v
+		}
+	}
+	return &c
+}
@@ -0,0 +1,14 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage/storagetest"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	if err := storagetest.TestStorage(storage.NewMemoryStorage(0)); err != nil {
+		t.Fatal(err)
+	}
+}
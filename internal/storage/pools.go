@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// PoolStore is implemented by backends that keep connection pool samples
+type PoolStore interface {
+	StorePoolSamples(samples []*models.PoolSample) error
+	// GetPoolSamples returns matching samples, oldest first
+	GetPoolSamples(filter PoolFilter) ([]*models.PoolSample, error)
+}
+
+// PoolFilter narrows GetPoolSamples. Empty fields match everything.
+type PoolFilter struct {
+	Service     string
+	Environment string
+	Host        string
+	Start       time.Time
+	End         time.Time
+}
+
+func (f PoolFilter) matches(p *models.PoolSample) bool {
+	return (f.Service == "" || p.ServiceName == f.Service) &&
+		(f.Environment == "" || p.Environment == f.Environment) &&
+		(f.Host == "" || p.Host == f.Host) &&
+		(f.Start.IsZero() || !p.Timestamp.Before(f.Start)) &&
+		(f.End.IsZero() || !p.Timestamp.After(f.End))
+}
+
+const poolSampleColumns = `timestamp, host, environment, service_name, process, container_name,
+	dest_ip, dest_port, service_type, database_type, open, active, idle, opened, closed, interval_s`
+
+func (s *sqlDB) StorePoolSamples(samples []*models.PoolSample) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	for _, p := range samples {
+		_, err := tx.Exec(s.bind(`
+			INSERT INTO pool_samples (`+poolSampleColumns+`)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`), p.Timestamp, p.Host, p.Environment, p.ServiceName, p.Process, p.ContainerName,
+			p.DestIP, p.DestPort, p.ServiceType, p.DatabaseType, p.Open, p.Active, p.Idle, p.Opened, p.Closed, p.Interval)
+		if err != nil {
+			return fmt.Errorf("failed to store pool sample: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit pool samples: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlDB) GetPoolSamples(filter PoolFilter) ([]*models.PoolSample, error) {
+	query := `SELECT ` + poolSampleColumns + ` FROM pool_samples WHERE 1=1`
+	args := []interface{}{}
+	if filter.Service != "" {
+		query += " AND service_name = ?"
+		args = append(args, filter.Service)
+	}
+	if filter.Environment != "" {
+		query += " AND environment = ?"
+		args = append(args, filter.Environment)
+	}
+	if filter.Host != "" {
+		query += " AND host = ?"
+		args = append(args, filter.Host)
+	}
+	if !filter.Start.IsZero() {
+		query += " AND timestamp >= ?"
+		args = append(args, filter.Start)
+	}
+	if !filter.End.IsZero() {
+		query += " AND timestamp <= ?"
+		args = append(args, filter.End)
+	}
+	query += " ORDER BY timestamp"
+
+	rows, err := s.db.Query(s.bind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pool samples: %v", err)
+	}
+	defer rows.Close()
+
+	samples := []*models.PoolSample{}
+	for rows.Next() {
+		var p models.PoolSample
+		err := rows.Scan(&p.Timestamp, &p.Host, &p.Environment, &p.ServiceName, &p.Process, &p.ContainerName,
+			&p.DestIP, &p.DestPort, &p.ServiceType, &p.DatabaseType, &p.Open, &p.Active, &p.Idle, &p.Opened, &p.Closed, &p.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan pool sample: %v", err)
+		}
+		samples = append(samples, &p)
+	}
+	return samples, rows.Err()
+}
+
+// maxMemoryPoolSamples bounds the pool samples kept by MemoryStorage
+const maxMemoryPoolSamples = 100000
+
+func (s *MemoryStorage) StorePoolSamples(samples []*models.PoolSample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range samples {
+		stored := *p
+		s.poolSamples = append(s.poolSamples, &stored)
+	}
+	if len(s.poolSamples) > maxMemoryPoolSamples {
+		s.poolSamples = s.poolSamples[len(s.poolSamples)-maxMemoryPoolSamples:]
+	}
+	return nil
+}
+
+func (s *MemoryStorage) GetPoolSamples(filter PoolFilter) ([]*models.PoolSample, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	samples := []*models.PoolSample{}
+	for _, p := range s.poolSamples {
+		if filter.matches(p) {
+			copied := *p
+			samples = append(samples, &copied)
+		}
+	}
+	return samples, nil
+}
@@ -0,0 +1,334 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// SecurityStore is implemented by backends that keep egress policies and
+// security events
+type SecurityStore interface {
+	// SaveEgressPolicy stores p as the next version of its service and
+	// environment's policy, setting Version and CreatedAt
+	SaveEgressPolicy(p *models.EgressPolicy) error
+	// GetEgressPolicies returns the newest version of every policy
+	GetEgressPolicies() ([]*models.EgressPolicy, error)
+	// GetEgressPolicyHistory returns every version of a policy, newest first
+	GetEgressPolicyHistory(service, environment string) ([]*models.EgressPolicy, error)
+
+	// MarkDestinationSeen records that a service reached a destination and
+	// reports whether it was the first time
+	MarkDestinationSeen(service, environment, destination string, t time.Time) (bool, error)
+
+	// StoreSecurityEvent saves an event; one with an existing ID is ignored
+	StoreSecurityEvent(e *models.SecurityEvent) error
+	// GetSecurityEvents returns matching events, newest first
+	GetSecurityEvents(filter SecurityEventFilter) ([]*models.SecurityEvent, error)
+}
+
+// SecurityEventFilter narrows GetSecurityEvents. Empty fields match
+// everything.
+type SecurityEventFilter struct {
+	Service     string
+	Environment string
+	Kind        models.SecurityEventKind
+	Start       time.Time
+	End         time.Time
+	// Limit caps the results; zero means 1000
+	Limit int
+}
+
+// Matches reports whether an event passes the filter
+func (f SecurityEventFilter) Matches(e *models.SecurityEvent) bool {
+	return (f.Service == "" || e.ServiceName == f.Service) &&
+		(f.Environment == "" || e.Environment == f.Environment) &&
+		(f.Kind == "" || e.Kind == f.Kind) &&
+		(f.Start.IsZero() || !e.Timestamp.Before(f.Start)) &&
+		(f.End.IsZero() || !e.Timestamp.After(f.End))
+}
+
+func (f SecurityEventFilter) limit() int {
+	if f.Limit <= 0 || f.Limit > connectionLimit {
+		return connectionLimit
+	}
+	return f.Limit
+}
+
+// sqlDestination names a connection's destination in SQL the way the
+// security package does: the best known host name, and the port
+const sqlDestination = `COALESCE(NULLIF(dest_hostname, ''), NULLIF(dest_k8s_service, ''), dest_ip) || ':' || dest_port`
+
+func (s *sqlDB) SaveEgressPolicy(p *models.EgressPolicy) error {
+	rules, err := json.Marshal(p.Rules)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rules: %v", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var version int
+	err = tx.QueryRow(s.bind(`
+		SELECT COALESCE(MAX(version), 0) FROM egress_policies
+		WHERE service_name = ? AND environment = ?
+	`), p.ServiceName, p.Environment).Scan(&version)
+	if err != nil {
+		return fmt.Errorf("failed to read policy version: %v", err)
+	}
+
+	createdAt := time.Now().UTC()
+	_, err = tx.Exec(s.bind(`
+		INSERT INTO egress_policies (service_name, environment, version, mode, rules, created_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`), p.ServiceName, p.Environment, version+1, p.Mode, string(rules), createdAt, p.CreatedBy)
+	if err != nil {
+		return fmt.Errorf("failed to store policy: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit policy: %v", err)
+	}
+
+	p.Version = version + 1
+	p.CreatedAt = createdAt
+	return nil
+}
+
+const egressPolicyColumns = `service_name, environment, version, mode, rules, created_at, created_by`
+
+func (s *sqlDB) GetEgressPolicies() ([]*models.EgressPolicy, error) {
+	return s.queryEgressPolicies(`
+		SELECT ` + egressPolicyColumns + ` FROM egress_policies p
+		WHERE version = (
+			SELECT MAX(version) FROM egress_policies
+			WHERE service_name = p.service_name AND environment = p.environment
+		)
+		ORDER BY service_name, environment
+	`)
+}
+
+func (s *sqlDB) GetEgressPolicyHistory(service, environment string) ([]*models.EgressPolicy, error) {
+	return s.queryEgressPolicies(`
+		SELECT `+egressPolicyColumns+` FROM egress_policies
+		WHERE service_name = ? AND environment = ?
+		ORDER BY version DESC
+	`, service, environment)
+}
+
+func (s *sqlDB) queryEgressPolicies(query string, args ...interface{}) ([]*models.EgressPolicy, error) {
+	rows, err := s.db.Query(s.bind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query policies: %v", err)
+	}
+	defer rows.Close()
+
+	policies := []*models.EgressPolicy{}
+	for rows.Next() {
+		var p models.EgressPolicy
+		var rules []byte
+		var createdBy sql.NullString
+		if err := rows.Scan(&p.ServiceName, &p.Environment, &p.Version, &p.Mode, &rules, &p.CreatedAt, &createdBy); err != nil {
+			return nil, fmt.Errorf("failed to scan policy: %v", err)
+		}
+		if err := json.Unmarshal(rules, &p.Rules); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal rules: %v", err)
+		}
+		p.CreatedBy = createdBy.String
+		policies = append(policies, &p)
+	}
+	return policies, rows.Err()
+}
+
+func (s *sqlDB) MarkDestinationSeen(service, environment, destination string, t time.Time) (bool, error) {
+	result, err := s.db.Exec(s.bind(`
+		INSERT INTO seen_destinations (service_name, environment, destination, first_seen)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT DO NOTHING
+	`), service, environment, destination, t)
+	if err != nil {
+		return false, fmt.Errorf("failed to record destination: %v", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to record destination: %v", err)
+	}
+	return n > 0, nil
+}
+
+func (s *sqlDB) StoreSecurityEvent(e *models.SecurityEvent) error {
+	_, err := s.db.Exec(s.bind(`
+		INSERT INTO security_events (id, timestamp, kind, service_name, environment, host, destination, dest_ip, dest_port, connection_id, policy_version, message)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING
+	`), e.ID, e.Timestamp, e.Kind, e.ServiceName, e.Environment, e.Host, e.Destination, e.DestIP, e.DestPort, e.ConnectionID, e.PolicyVersion, e.Message)
+	if err != nil {
+		return fmt.Errorf("failed to store security event: %v", err)
+	}
+	return nil
+}
+
+func (s *sqlDB) GetSecurityEvents(filter SecurityEventFilter) ([]*models.SecurityEvent, error) {
+	query := `
+		SELECT id, timestamp, kind, service_name, environment, host, destination, dest_ip, dest_port, connection_id, policy_version, message
+		FROM security_events
+		WHERE 1=1
+	`
+	args := []interface{}{}
+	if filter.Service != "" {
+		query += " AND service_name = ?"
+		args = append(args, filter.Service)
+	}
+	if filter.Environment != "" {
+		query += " AND environment = ?"
+		args = append(args, filter.Environment)
+	}
+	if filter.Kind != "" {
+		query += " AND kind = ?"
+		args = append(args, filter.Kind)
+	}
+	if !filter.Start.IsZero() {
+		query += " AND timestamp >= ?"
+		args = append(args, filter.Start)
+	}
+	if !filter.End.IsZero() {
+		query += " AND timestamp <= ?"
+		args = append(args, filter.End)
+	}
+	query += fmt.Sprintf(" ORDER BY timestamp DESC, id LIMIT %d", filter.limit())
+
+	rows, err := s.db.Query(s.bind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query security events: %v", err)
+	}
+	defer rows.Close()
+
+	events := []*models.SecurityEvent{}
+	for rows.Next() {
+		var e models.SecurityEvent
+		err := rows.Scan(&e.ID, &e.Timestamp, &e.Kind, &e.ServiceName, &e.Environment, &e.Host, &e.Destination,
+			&e.DestIP, &e.DestPort, &e.ConnectionID, &e.PolicyVersion, &e.Message)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan security event: %v", err)
+		}
+		events = append(events, &e)
+	}
+	return events, rows.Err()
+}
+
+// maxMemorySecurityEvents bounds the events kept by MemoryStorage
+const maxMemorySecurityEvents = 10000
+
+// policyKey identifies a policy in MemoryStorage
+type policyKey struct {
+	service     string
+	environment string
+}
+
+func (s *MemoryStorage) SaveEgressPolicy(p *models.EgressPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.policies == nil {
+		s.policies = make(map[policyKey][]*models.EgressPolicy)
+	}
+	key := policyKey{p.ServiceName, p.Environment}
+	p.Version = len(s.policies[key]) + 1
+	p.CreatedAt = time.Now().UTC()
+	stored := *p
+	stored.Rules = append([]models.EgressRule(nil), p.Rules...)
+	s.policies[key] = append(s.policies[key], &stored)
+	return nil
+}
+
+func (s *MemoryStorage) GetEgressPolicies() ([]*models.EgressPolicy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	policies := []*models.EgressPolicy{}
+	for _, versions := range s.policies {
+		copied := *versions[len(versions)-1]
+		policies = append(policies, &copied)
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		if policies[i].ServiceName != policies[j].ServiceName {
+			return policies[i].ServiceName < policies[j].ServiceName
+		}
+		return policies[i].Environment < policies[j].Environment
+	})
+	return policies, nil
+}
+
+func (s *MemoryStorage) GetEgressPolicyHistory(service, environment string) ([]*models.EgressPolicy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	versions := s.policies[policyKey{service, environment}]
+	policies := make([]*models.EgressPolicy, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		copied := *versions[i]
+		policies = append(policies, &copied)
+	}
+	return policies, nil
+}
+
+func (s *MemoryStorage) MarkDestinationSeen(service, environment, destination string, t time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seen == nil {
+		s.seen = make(map[string]bool)
+	}
+	key := service + "\x00" + environment + "\x00" + destination
+	if s.seen[key] {
+		return false, nil
+	}
+	s.seen[key] = true
+	return true, nil
+}
+
+func (s *MemoryStorage) StoreSecurityEvent(e *models.SecurityEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.securityEvents {
+		if existing.ID == e.ID {
+			return nil
+		}
+	}
+	stored := *e
+	s.securityEvents = append(s.securityEvents, &stored)
+	if len(s.securityEvents) > maxMemorySecurityEvents {
+		s.securityEvents = s.securityEvents[len(s.securityEvents)-maxMemorySecurityEvents:]
+	}
+	return nil
+}
+
+func (s *MemoryStorage) GetSecurityEvents(filter SecurityEventFilter) ([]*models.SecurityEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := []*models.SecurityEvent{}
+	for _, e := range s.securityEvents {
+		if filter.Matches(e) {
+			copied := *e
+			events = append(events, &copied)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].Timestamp.Equal(events[j].Timestamp) {
+			return events[i].Timestamp.After(events[j].Timestamp)
+		}
+		return events[i].ID < events[j].ID
+	})
+	if limit := filter.limit(); len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
@@ -0,0 +1,559 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/query"
+)
+
+// sqlDB implements Storage on top of database/sql and is shared by the SQL
+// backends. Queries are written with ? placeholders and rewritten by bind
+// for drivers that number their parameters.
+type sqlDB struct {
+	db      *sql.DB
+	bind    func(query string) string
+	dialect query.Dialect
+}
+
+// bindQuestion leaves ? placeholders untouched
+func bindQuestion(query string) string {
+	return query
+}
+
+// bindDollar rewrites ? placeholders as $1, $2, ...
+func bindDollar(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// connectionColumns lists the connections table columns in the order used by
+// StoreConnection and scanConnection
+const connectionColumns = `id, timestamp, source_ip, source_port, dest_ip, dest_port, dest_hostname,
+	dest_rdns, dest_asn, dest_org, dest_country, dest_scope, dest_k8s_namespace, dest_k8s_pod, dest_k8s_service,
+	protocol, app_protocol, tls_server_name, direction, tcp_state, service_name, service_type, database_type, message_queue_type,
+	host, deployment_id, environment, region, k8s_namespace, k8s_pod, k8s_deployment, k8s_service, k8s_node,
+	container_id, container_name, container_image, latency_ms, duration_ms, dns_latency_ms,
+	bytes_sent, bytes_received, retry_count, error, tags, metadata`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (s *sqlDB) StoreConnection(conn *models.Connection) error {
+	if conn == nil {
+		return fmt.Errorf("connection is nil")
+	}
+
+	tags, err := json.Marshal(conn.Tags)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tags: %v", err)
+	}
+
+	metadata, err := json.Marshal(conn.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %v", err)
+	}
+
+	_, err = s.db.Exec(s.bind(`
+		INSERT INTO connections (`+connectionColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+			?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`),
+		conn.ID, conn.Timestamp, conn.SourceIP, conn.SourcePort, conn.DestIP, conn.DestPort, conn.DestHostname,
+		conn.DestReverseDNS, conn.DestASN, conn.DestOrg, conn.DestCountry, conn.DestScope, conn.DestK8sNamespace, conn.DestK8sPod, conn.DestK8sService,
+		conn.Protocol, conn.AppProtocol, conn.TLSServerName, conn.Direction, conn.TCPState, conn.ServiceName, conn.ServiceType, conn.DatabaseType, conn.MessageQueueType,
+		conn.Host, conn.DeploymentID, conn.Environment, conn.Region, conn.K8sNamespace, conn.K8sPod, conn.K8sDeployment, conn.K8sService, conn.K8sNode,
+		conn.ContainerID, conn.ContainerName, conn.ContainerImage, conn.Latency, conn.Duration, conn.DNSLatency,
+		conn.BytesSent, conn.BytesReceived, conn.RetryCount, conn.Error, string(tags), string(metadata),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store connection: %v", err)
+	}
+
+	return nil
+}
+
+// scanConnection reads a row selected with connectionColumns
+func scanConnection(row rowScanner) (*models.Connection, error) {
+	var conn models.Connection
+	var tags, metadata []byte
+	var destHostname, destRDNS, destOrg, destCountry, destScope, appProtocol, serverName, serviceType, dbType, queueType sql.NullString
+	var direction, tcpState sql.NullString
+	var destK8sNamespace, destK8sPod, destK8sService, k8sNamespace, k8sPod, k8sDeployment, k8sService, k8sNode sql.NullString
+	var containerID, containerName, containerImage sql.NullString
+	var duration, dnsLatency sql.NullFloat64
+	var destASN sql.NullInt64
+
+	err := row.Scan(
+		&conn.ID, &conn.Timestamp, &conn.SourceIP, &conn.SourcePort, &conn.DestIP, &conn.DestPort, &destHostname,
+		&destRDNS, &destASN, &destOrg, &destCountry, &destScope, &destK8sNamespace, &destK8sPod, &destK8sService,
+		&conn.Protocol, &appProtocol, &serverName, &direction, &tcpState, &conn.ServiceName, &serviceType, &dbType, &queueType,
+		&conn.Host, &conn.DeploymentID, &conn.Environment, &conn.Region, &k8sNamespace, &k8sPod, &k8sDeployment, &k8sService, &k8sNode,
+		&containerID, &containerName, &containerImage, &conn.Latency, &duration, &dnsLatency,
+		&conn.BytesSent, &conn.BytesReceived, &conn.RetryCount, &conn.Error, &tags, &metadata,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Handle NULL values
+	conn.DestHostname = destHostname.String
+	conn.DestReverseDNS = destRDNS.String
+	conn.DestASN = int(destASN.Int64)
+	conn.DestOrg = destOrg.String
+	conn.DestCountry = destCountry.String
+	conn.DestScope = destScope.String
+	conn.DestK8sNamespace = destK8sNamespace.String
+	conn.DestK8sPod = destK8sPod.String
+	conn.DestK8sService = destK8sService.String
+	conn.K8sNamespace = k8sNamespace.String
+	conn.K8sPod = k8sPod.String
+	conn.K8sDeployment = k8sDeployment.String
+	conn.K8sService = k8sService.String
+	conn.K8sNode = k8sNode.String
+	conn.ContainerID = containerID.String
+	conn.ContainerName = containerName.String
+	conn.ContainerImage = containerImage.String
+	conn.AppProtocol = appProtocol.String
+	conn.TLSServerName = serverName.String
+	conn.Direction = models.Direction(direction.String)
+	conn.TCPState = tcpState.String
+	conn.Duration = duration.Float64
+	conn.DNSLatency = dnsLatency.Float64
+	if serviceType.Valid {
+		conn.ServiceType = models.ServiceType(serviceType.String)
+	}
+	if dbType.Valid {
+		conn.DatabaseType = models.DatabaseType(dbType.String)
+	}
+	if queueType.Valid {
+		conn.MessageQueueType = models.MessageQueueType(queueType.String)
+	}
+
+	if err := json.Unmarshal(tags, &conn.Tags); err != nil {
+		log.Printf("Warning: failed to unmarshal tags: %v", err)
+	}
+	if err := json.Unmarshal(metadata, &conn.Metadata); err != nil {
+		log.Printf("Warning: failed to unmarshal metadata: %v", err)
+	}
+
+	return &conn, nil
+}
+
+func (s *sqlDB) GetConnections(filter ConnectionFilter) ([]*models.Connection, error) {
+	var connections []*models.Connection
+	err := s.queryConnections(filter, connectionLimit, func(conn *models.Connection) error {
+		connections = append(connections, conn)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return connections, nil
+}
+
+func (s *sqlDB) IterateConnections(filter ConnectionFilter, fn func(*models.Connection) error) error {
+	return s.queryConnections(filter, 0, fn)
+}
+
+// filterClause returns the " AND ..." conditions selecting the connections
+// matching filter, and their arguments
+func (s *sqlDB) filterClause(filter ConnectionFilter) (string, []interface{}) {
+	clause := ""
+	args := []interface{}{}
+
+	if !filter.Start.IsZero() {
+		clause += " AND timestamp >= ?"
+		args = append(args, filter.Start)
+	}
+	if !filter.End.IsZero() {
+		clause += " AND timestamp <= ?"
+		args = append(args, filter.End)
+	}
+	if filter.Service != "" {
+		clause += " AND service_name = ?"
+		args = append(args, filter.Service)
+	}
+	if filter.Error != "" {
+		clause += " AND error = ?"
+		args = append(args, filter.Error)
+	}
+	if filter.Environment != "" {
+		clause += " AND environment = ?"
+		args = append(args, filter.Environment)
+	}
+	if filter.Search != "" {
+		search, searchArgs := query.ToSQL(query.Text{Value: filter.Search}, s.dialect)
+		clause += " AND " + search
+		args = append(args, searchArgs...)
+	}
+	if filter.DestCountry != "" {
+		clause += " AND dest_country = ?"
+		// Countries are stored as uppercase ISO codes
+		args = append(args, strings.ToUpper(filter.DestCountry))
+	}
+	if filter.DestASN != 0 {
+		clause += " AND dest_asn = ?"
+		args = append(args, filter.DestASN)
+	}
+	if filter.DestOrg != "" {
+		clause += " AND dest_org = ?"
+		args = append(args, filter.DestOrg)
+	}
+	if filter.DestScope != "" {
+		clause += " AND dest_scope = ?"
+		args = append(args, filter.DestScope)
+	}
+	if filter.Namespace != "" {
+		clause += " AND (k8s_namespace = ? OR dest_k8s_namespace = ?)"
+		args = append(args, filter.Namespace, filter.Namespace)
+	}
+	if filter.Deployment != "" {
+		clause += " AND k8s_deployment = ?"
+		args = append(args, filter.Deployment)
+	}
+	if filter.Pod != "" {
+		clause += " AND (k8s_pod = ? OR dest_k8s_pod = ?)"
+		args = append(args, filter.Pod, filter.Pod)
+	}
+	if filter.Node != "" {
+		clause += " AND k8s_node = ?"
+		args = append(args, filter.Node)
+	}
+	if filter.Container != "" {
+		clause += " AND (container_name = ? OR container_id LIKE ?)"
+		args = append(args, filter.Container, filter.Container+"%")
+	}
+	if filter.Image != "" {
+		clause += " AND container_image = ?"
+		args = append(args, filter.Image)
+	}
+	if node := filter.queryNode(); node != nil {
+		where, queryArgs := query.ToSQL(node, s.dialect)
+		clause += " AND " + where
+		args = append(args, queryArgs...)
+	}
+
+	return clause, args
+}
+
+// queryConnections streams the connections matching filter, newest first,
+// to fn. A limit of zero returns every match.
+func (s *sqlDB) queryConnections(filter ConnectionFilter, limit int, fn func(*models.Connection) error) error {
+	where, args := s.filterClause(filter)
+	stmt := `
+		SELECT ` + connectionColumns + `
+		FROM connections
+		WHERE 1=1` + where + `
+		ORDER BY timestamp DESC`
+	if limit > 0 {
+		stmt += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := s.db.Query(s.bind(stmt), args...)
+	if err != nil {
+		return fmt.Errorf("failed to query connections: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		conn, err := scanConnection(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan connection: %v", err)
+		}
+		if err := fn(conn); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating connections: %v", err)
+	}
+
+	return nil
+}
+
+func (s *sqlDB) GetConnectionByID(id string) (*models.Connection, error) {
+	conn, err := scanConnection(s.db.QueryRow(s.bind(`
+		SELECT `+connectionColumns+`
+		FROM connections
+		WHERE id = ?
+	`), id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("connection not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+
+	return conn, nil
+}
+
+func (s *sqlDB) GetStats(startTime, endTime time.Time, filter ConnectionFilter) (*models.ConnectionStats, error) {
+	stats := &models.ConnectionStats{
+		ErrorCounts:      make(map[string]int64),
+		ServiceTypeStats: make(map[models.ServiceType]int),
+		DatabaseStats:    make(map[models.DatabaseType]int),
+		QueueStats:       make(map[models.MessageQueueType]int),
+	}
+
+	where, filterArgs := s.filterClause(filter)
+	args := append([]interface{}{startTime, endTime}, filterArgs...)
+
+	// Get total connections
+	err := s.db.QueryRow(s.bind(`
+		SELECT COUNT(*) FROM connections
+		WHERE timestamp BETWEEN ? AND ?`+where+`
+	`), args...).Scan(&stats.TotalConnections)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get total connections: %v", err)
+	}
+
+	// Get error counts
+	rows, err := s.db.Query(s.bind(`
+		SELECT error, COUNT(*) FROM connections
+		WHERE timestamp BETWEEN ? AND ?`+where+` AND error IS NOT NULL
+		GROUP BY error
+	`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get error counts: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var errorType string
+		var count int64
+		if err := rows.Scan(&errorType, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan error count: %v", err)
+		}
+		stats.ErrorCounts[errorType] = count
+	}
+
+	// Get average latency
+	var avgLatency sql.NullFloat64
+	err = s.db.QueryRow(s.bind(`
+		SELECT AVG(latency_ms) FROM connections
+		WHERE timestamp BETWEEN ? AND ?`+where+` AND latency_ms IS NOT NULL
+	`), args...).Scan(&avgLatency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get average latency: %v", err)
+	}
+	if avgLatency.Valid {
+		stats.AvgLatency = avgLatency.Float64
+	}
+
+	// Get total bytes
+	var totalBytesSent, totalBytesReceived sql.NullInt64
+	err = s.db.QueryRow(s.bind(`
+		SELECT SUM(bytes_sent), SUM(bytes_received) FROM connections
+		WHERE timestamp BETWEEN ? AND ?`+where+`
+	`), args...).Scan(&totalBytesSent, &totalBytesReceived)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get total bytes: %v", err)
+	}
+	if totalBytesSent.Valid {
+		stats.TotalBytesSent = totalBytesSent.Int64
+	}
+	if totalBytesReceived.Valid {
+		stats.TotalBytesReceived = totalBytesReceived.Int64
+	}
+
+	// Get service type stats
+	rows, err = s.db.Query(s.bind(`
+		SELECT service_type, COUNT(*) FROM connections
+		WHERE timestamp BETWEEN ? AND ?`+where+` AND service_type IS NOT NULL
+		GROUP BY service_type
+	`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service type stats: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var serviceType sql.NullString
+		var count int
+		if err := rows.Scan(&serviceType, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan service type: %v", err)
+		}
+		if serviceType.Valid {
+			stats.ServiceTypeStats[models.ServiceType(serviceType.String)] = count
+		}
+	}
+
+	// Get database stats
+	rows, err = s.db.Query(s.bind(`
+		SELECT database_type, COUNT(*) FROM connections
+		WHERE timestamp BETWEEN ? AND ?`+where+` AND service_type = 'database' AND database_type IS NOT NULL
+		GROUP BY database_type
+	`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database stats: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dbType sql.NullString
+		var count int
+		if err := rows.Scan(&dbType, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan database type: %v", err)
+		}
+		if dbType.Valid {
+			stats.DatabaseStats[models.DatabaseType(dbType.String)] = count
+		}
+	}
+
+	// Get queue stats
+	rows, err = s.db.Query(s.bind(`
+		SELECT message_queue_type, COUNT(*) FROM connections
+		WHERE timestamp BETWEEN ? AND ?`+where+` AND service_type = 'message_queue' AND message_queue_type IS NOT NULL
+		GROUP BY message_queue_type
+	`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue stats: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var queueType sql.NullString
+		var count int
+		if err := rows.Scan(&queueType, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan queue type: %v", err)
+		}
+		if queueType.Valid {
+			stats.QueueStats[models.MessageQueueType(queueType.String)] = count
+		}
+	}
+
+	return stats, nil
+}
+
+func (s *sqlDB) GetServices() ([]string, error) {
+	rows, err := s.db.Query("SELECT DISTINCT service_name FROM connections WHERE service_name != ''")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get services: %v", err)
+	}
+	defer rows.Close()
+
+	var services []string
+	for rows.Next() {
+		var service string
+		if err := rows.Scan(&service); err != nil {
+			return nil, fmt.Errorf("failed to scan service: %v", err)
+		}
+		services = append(services, service)
+	}
+	return services, nil
+}
+
+func (s *sqlDB) GetErrors() ([]string, error) {
+	rows, err := s.db.Query("SELECT DISTINCT error FROM connections WHERE error != ''")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get errors: %v", err)
+	}
+	defer rows.Close()
+
+	var errors []string
+	for rows.Next() {
+		var errorType string
+		if err := rows.Scan(&errorType); err != nil {
+			return nil, fmt.Errorf("failed to scan error: %v", err)
+		}
+		errors = append(errors, errorType)
+	}
+	return errors, nil
+}
+
+func (s *sqlDB) GetEnvironments() ([]string, error) {
+	rows, err := s.db.Query("SELECT DISTINCT environment FROM connections WHERE environment != ''")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get environments: %v", err)
+	}
+	defer rows.Close()
+
+	var environments []string
+	for rows.Next() {
+		var env string
+		if err := rows.Scan(&env); err != nil {
+			return nil, fmt.Errorf("failed to scan environment: %v", err)
+		}
+		environments = append(environments, env)
+	}
+	return environments, nil
+}
+
+func (s *sqlDB) ConnectionsBefore(cutoff time.Time, fn func(*models.Connection) error) error {
+	rows, err := s.db.Query(s.bind(`
+		SELECT `+connectionColumns+`
+		FROM connections
+		WHERE timestamp < ?
+		ORDER BY timestamp
+	`), cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to query connections: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		conn, err := scanConnection(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan connection: %v", err)
+		}
+		if err := fn(conn); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqlDB) DeleteConnections(ids []string) (int64, error) {
+	const batchSize = 500
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var deleted int64
+	for start := 0; start < len(ids); start += batchSize {
+		batch := ids[start:min(start+batchSize, len(ids))]
+		args := make([]interface{}, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", ")
+		result, err := tx.Exec(s.bind("DELETE FROM connections WHERE id IN ("+placeholders+")"), args...)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete connections: %v", err)
+		}
+		n, _ := result.RowsAffected()
+		deleted += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return deleted, nil
+}
+
+func (s *sqlDB) Close() error {
+	return s.db.Close()
+}
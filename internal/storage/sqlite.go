@@ -2,17 +2,66 @@ package storage
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"log"
-	"time"
+	"strings"
 
-	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/query"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// sqliteColumns is the connections table schema. Columns missing from an
+// existing database are added on startup, so new columns must be nullable.
+var sqliteColumns = []string{
+	"id TEXT PRIMARY KEY",
+	"timestamp DATETIME NOT NULL",
+	"source_ip TEXT NOT NULL",
+	"source_port INTEGER NOT NULL",
+	"dest_ip TEXT NOT NULL",
+	"dest_port INTEGER NOT NULL",
+	"dest_hostname TEXT",
+	"dest_rdns TEXT",
+	"dest_asn INTEGER",
+	"dest_org TEXT",
+	"dest_country TEXT",
+	"dest_scope TEXT",
+	"dest_k8s_namespace TEXT",
+	"dest_k8s_pod TEXT",
+	"dest_k8s_service TEXT",
+	"protocol TEXT NOT NULL",
+	"app_protocol TEXT",
+	"tls_server_name TEXT",
+	"direction TEXT",
+	"tcp_state TEXT",
+	"service_name TEXT",
+	"service_type TEXT",
+	"database_type TEXT",
+	"message_queue_type TEXT",
+	"host TEXT",
+	"deployment_id TEXT",
+	"environment TEXT",
+	"region TEXT",
+	"k8s_namespace TEXT",
+	"k8s_pod TEXT",
+	"k8s_deployment TEXT",
+	"k8s_service TEXT",
+	"k8s_node TEXT",
+	"container_id TEXT",
+	"container_name TEXT",
+	"container_image TEXT",
+	"latency_ms REAL",
+	"duration_ms REAL",
+	"dns_latency_ms REAL",
+	"bytes_sent INTEGER",
+	"bytes_received INTEGER",
+	"retry_count INTEGER",
+	"error TEXT",
+	"tags TEXT",
+	"metadata TEXT",
+}
+
 type SQLiteStorage struct {
-	db *sql.DB
+	sqlDB
 }
 
 func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
@@ -27,421 +76,502 @@ func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
 		return nil, fmt.Errorf("failed to connect to database: %v", err)
 	}
 
-	storage := &SQLiteStorage{db: db}
-	if err := storage.migrate(); err != nil {
+	storage := &SQLiteStorage{sqlDB{db: db, bind: bindQuestion, dialect: query.SQLite}}
+	fts, err := storage.migrate()
+	if err != nil {
 		db.Close()
 		return nil, err
 	}
+	if fts {
+		storage.dialect = query.SQLiteFTS5
+	} else {
+		log.Printf("SQLite was built without FTS5; searching tags and metadata with LIKE (build with -tags sqlite_fts5 to index them)")
+	}
 
 	return storage, nil
 }
 
-func (s *SQLiteStorage) migrate() error {
+// sqliteTagTriggers keep connection_tags, the normalized tags used for exact
+// tag matches, in step with the connections table
+var sqliteTagTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS connection_tags_insert AFTER INSERT ON connections BEGIN
+		INSERT OR IGNORE INTO connection_tags (connection_id, tag)
+		SELECT new.id, value FROM json_each(new.tags) WHERE type = 'text';
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS connection_tags_delete AFTER DELETE ON connections BEGIN
+		DELETE FROM connection_tags WHERE connection_id = old.id;
+	END`,
+}
+
+// sqliteFTSText is the indexed text of a connection: its tags, and the keys
+// and scalar values of its metadata
+const sqliteFTSText = `(SELECT group_concat(value, ' ') FROM json_each(%[1]s.tags) WHERE type = 'text'),
+	(SELECT group_concat(key || ' ' || atom, ' ') FROM json_tree(%[1]s.metadata) WHERE atom IS NOT NULL)`
+
+// sqliteFTSTriggers keep connections_fts in step with the connections table
+var sqliteFTSTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS connections_fts_insert AFTER INSERT ON connections BEGIN
+		INSERT INTO connections_fts (rowid, tags, metadata) VALUES (new.rowid, ` + fmt.Sprintf(sqliteFTSText, "new") + `);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS connections_fts_delete AFTER DELETE ON connections BEGIN
+		DELETE FROM connections_fts WHERE rowid = old.rowid;
+	END`,
+}
+
+// migrate brings the schema up to date and reports whether the FTS5 index
+// is available
+func (s *SQLiteStorage) migrate() (bool, error) {
 	// Start a transaction
 	tx, err := s.db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %v", err)
+		return false, fmt.Errorf("failed to begin transaction: %v", err)
 	}
 	defer tx.Rollback()
 
-	// Drop existing table if it exists
-	_, err = tx.Exec("DROP TABLE IF EXISTS connections")
+	// Create the table on first use
+	_, err = tx.Exec("CREATE TABLE IF NOT EXISTS connections (\n" + strings.Join(sqliteColumns, ",\n") + "\n)")
 	if err != nil {
-		return fmt.Errorf("failed to drop existing table: %v", err)
+		return false, fmt.Errorf("failed to create table: %v", err)
 	}
 
-	// Create the table with all required columns
-	_, err = tx.Exec(`
-		CREATE TABLE connections (
-			id TEXT PRIMARY KEY,
-			timestamp DATETIME NOT NULL,
-			source_ip TEXT NOT NULL,
-			source_port INTEGER NOT NULL,
-			dest_ip TEXT NOT NULL,
-			dest_port INTEGER NOT NULL,
-			protocol TEXT NOT NULL,
-			service_name TEXT,
-			service_type TEXT,
-			database_type TEXT,
-			message_queue_type TEXT,
-			host TEXT,
-			deployment_id TEXT,
-			environment TEXT,
-			region TEXT,
-			latency_ms REAL,
-			bytes_sent INTEGER,
-			bytes_received INTEGER,
-			retry_count INTEGER,
-			error TEXT,
-			tags TEXT,
-			metadata TEXT
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("failed to create table: %v", err)
+	// Add columns introduced since the database was created
+	if err := addColumns(tx, "connections", sqliteColumns); err != nil {
+		return false, err
 	}
 
 	// Create indexes
 	indexes := []string{
-		"CREATE INDEX idx_connections_timestamp ON connections(timestamp)",
-		"CREATE INDEX idx_connections_service ON connections(service_name)",
-		"CREATE INDEX idx_connections_error ON connections(error)",
-		"CREATE INDEX idx_connections_environment ON connections(environment)",
-		"CREATE INDEX idx_connections_service_type ON connections(service_type)",
+		"CREATE INDEX IF NOT EXISTS idx_connections_timestamp ON connections(timestamp)",
+		"CREATE INDEX IF NOT EXISTS idx_connections_service ON connections(service_name)",
+		"CREATE INDEX IF NOT EXISTS idx_connections_error ON connections(error)",
+		"CREATE INDEX IF NOT EXISTS idx_connections_environment ON connections(environment)",
+		"CREATE INDEX IF NOT EXISTS idx_connections_service_type ON connections(service_type)",
+		"CREATE INDEX IF NOT EXISTS idx_connections_dest_hostname ON connections(dest_hostname)",
+		"CREATE INDEX IF NOT EXISTS idx_connections_dest_country ON connections(dest_country)",
+		"CREATE INDEX IF NOT EXISTS idx_connections_dest_asn ON connections(dest_asn)",
+		"CREATE INDEX IF NOT EXISTS idx_connections_k8s_namespace ON connections(k8s_namespace)",
+		"CREATE INDEX IF NOT EXISTS idx_connections_k8s_deployment ON connections(k8s_deployment)",
+		"CREATE INDEX IF NOT EXISTS idx_connections_container_name ON connections(container_name)",
 	}
 
 	for _, idx := range indexes {
 		if _, err := tx.Exec(idx); err != nil {
-			return fmt.Errorf("failed to create index: %v", err)
+			return false, fmt.Errorf("failed to create index: %v", err)
 		}
 	}
 
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %v", err)
+	if err := migrateTags(tx); err != nil {
+		return false, err
 	}
-
-	return nil
-}
-
-func (s *SQLiteStorage) StoreConnection(conn *models.Connection) error {
-	if conn == nil {
-		return fmt.Errorf("connection is nil")
+	if err := migrateAnomalies(tx); err != nil {
+		return false, err
 	}
-
-	tags, err := json.Marshal(conn.Tags)
-	if err != nil {
-		return fmt.Errorf("failed to marshal tags: %v", err)
+	if err := migrateSecurity(tx); err != nil {
+		return false, err
 	}
-
-	metadata, err := json.Marshal(conn.Metadata)
-	if err != nil {
-		return fmt.Errorf("failed to marshal metadata: %v", err)
-	}
-
-	_, err = s.db.Exec(`
-		INSERT INTO connections (
-			id, timestamp, source_ip, source_port, dest_ip, dest_port,
-			protocol, service_name, service_type, database_type, message_queue_type,
-			host, deployment_id, environment, region, latency_ms,
-			bytes_sent, bytes_received, retry_count, error, tags, metadata
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`,
-		conn.ID, conn.Timestamp, conn.SourceIP, conn.SourcePort, conn.DestIP, conn.DestPort,
-		conn.Protocol, conn.ServiceName, conn.ServiceType, conn.DatabaseType, conn.MessageQueueType,
-		conn.Host, conn.DeploymentID, conn.Environment, conn.Region, conn.Latency,
-		conn.BytesSent, conn.BytesReceived, conn.RetryCount, conn.Error, tags, metadata,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to store connection: %v", err)
+	if err := migrateListeners(tx); err != nil {
+		return false, err
 	}
-
-	return nil
-}
-
-func (s *SQLiteStorage) GetConnections(service, errorType, environment, search string) ([]*models.Connection, error) {
-	query := `
-		SELECT id, timestamp, source_ip, source_port, dest_ip, dest_port,
-			protocol, service_name, service_type, database_type, message_queue_type,
-			host, deployment_id, environment, region, latency_ms,
-			bytes_sent, bytes_received, retry_count, error, tags, metadata
-		FROM connections
-		WHERE 1=1
-	`
-	args := []interface{}{}
-
-	if service != "" {
-		query += " AND service_name = ?"
-		args = append(args, service)
+	if err := migratePools(tx); err != nil {
+		return false, err
 	}
-	if errorType != "" {
-		query += " AND error = ?"
-		args = append(args, errorType)
+	if err := migrateCertificates(tx); err != nil {
+		return false, err
 	}
-	if environment != "" {
-		query += " AND environment = ?"
-		args = append(args, environment)
+	if err := migrateHTTPMetrics(tx); err != nil {
+		return false, err
 	}
-	if search != "" {
-		query += " AND (service_name LIKE ? OR host LIKE ? OR deployment_id LIKE ?)"
-		searchArg := "%" + search + "%"
-		args = append(args, searchArg, searchArg, searchArg)
+	if err := migrateFlows(tx); err != nil {
+		return false, err
 	}
-
-	query += " ORDER BY timestamp DESC LIMIT 1000"
-
-	rows, err := s.db.Query(query, args...)
+	fts, err := migrateFTS(tx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query connections: %v", err)
+		return false, err
 	}
-	defer rows.Close()
 
-	var connections []*models.Connection
-	for rows.Next() {
-		var conn models.Connection
-		var tags, metadata []byte
-		var serviceType, dbType, queueType sql.NullString
-
-		err := rows.Scan(
-			&conn.ID, &conn.Timestamp, &conn.SourceIP, &conn.SourcePort, &conn.DestIP, &conn.DestPort,
-			&conn.Protocol, &conn.ServiceName, &serviceType, &dbType, &queueType,
-			&conn.Host, &conn.DeploymentID, &conn.Environment, &conn.Region, &conn.Latency,
-			&conn.BytesSent, &conn.BytesReceived, &conn.RetryCount, &conn.Error, &tags, &metadata,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan connection: %v", err)
-		}
-
-		// Handle NULL values
-		if serviceType.Valid {
-			conn.ServiceType = models.ServiceType(serviceType.String)
-		}
-		if dbType.Valid {
-			conn.DatabaseType = models.DatabaseType(dbType.String)
-		}
-		if queueType.Valid {
-			conn.MessageQueueType = models.MessageQueueType(queueType.String)
-		}
-
-		if err := json.Unmarshal(tags, &conn.Tags); err != nil {
-			log.Printf("Warning: failed to unmarshal tags: %v", err)
-		}
-		if err := json.Unmarshal(metadata, &conn.Metadata); err != nil {
-			log.Printf("Warning: failed to unmarshal metadata: %v", err)
-		}
-
-		connections = append(connections, &conn)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating connections: %v", err)
+	// Commit the transaction
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %v", err)
 	}
 
-	return connections, nil
+	return fts, nil
 }
 
-func (s *SQLiteStorage) GetConnectionByID(id string) (*models.Connection, error) {
-	var conn models.Connection
-	var tags, metadata []byte
-	err := s.db.QueryRow(`
-		SELECT id, timestamp, source_ip, source_port, dest_ip, dest_port,
-			protocol, service_name, service_type, database_type, message_queue_type,
-			host, deployment_id, environment, region, latency_ms,
-			bytes_sent, bytes_received, retry_count, error, tags, metadata
-		FROM connections
-		WHERE id = ?
-	`, id).Scan(
-		&conn.ID, &conn.Timestamp, &conn.SourceIP, &conn.SourcePort, &conn.DestIP, &conn.DestPort,
-		&conn.Protocol, &conn.ServiceName, &conn.ServiceType, &conn.DatabaseType, &conn.MessageQueueType,
-		&conn.Host, &conn.DeploymentID, &conn.Environment, &conn.Region, &conn.Latency,
-		&conn.BytesSent, &conn.BytesReceived, &conn.RetryCount, &conn.Error, &tags, &metadata,
-	)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("connection not found")
-	}
+// addColumns adds the columns a table is missing
+func addColumns(tx *sql.Tx, table string, columns []string) error {
+	existing := make(map[string]bool)
+	rows, err := tx.Query("SELECT name FROM pragma_table_info(?)", table)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get connection: %v", err)
-	}
-
-	if err := json.Unmarshal(tags, &conn.Tags); err != nil {
-		log.Printf("Warning: failed to unmarshal tags: %v", err)
+		return fmt.Errorf("failed to read table schema: %v", err)
 	}
-	if err := json.Unmarshal(metadata, &conn.Metadata); err != nil {
-		log.Printf("Warning: failed to unmarshal metadata: %v", err)
-	}
-
-	return &conn, nil
-}
-
-func (s *SQLiteStorage) GetStats(startTime, endTime time.Time) (*models.ConnectionStats, error) {
-	stats := &models.ConnectionStats{
-		ErrorCounts:      make(map[string]int64),
-		ServiceTypeStats: make(map[models.ServiceType]int),
-		DatabaseStats:    make(map[models.DatabaseType]int),
-		QueueStats:       make(map[models.MessageQueueType]int),
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read table schema: %v", err)
+		}
+		existing[name] = true
 	}
+	rows.Close()
 
-	// Get total connections
-	err := s.db.QueryRow(`
-		SELECT COUNT(*) FROM connections
-		WHERE timestamp BETWEEN ? AND ?
-	`, startTime, endTime).Scan(&stats.TotalConnections)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get total connections: %v", err)
+	for _, column := range columns {
+		if name := strings.Fields(column)[0]; !existing[name] {
+			if _, err := tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + column); err != nil {
+				return fmt.Errorf("failed to add column %s: %v", name, err)
+			}
+		}
 	}
+	return nil
+}
 
-	// Get error counts
-	rows, err := s.db.Query(`
-		SELECT error, COUNT(*) FROM connections
-		WHERE timestamp BETWEEN ? AND ? AND error IS NOT NULL
-		GROUP BY error
-	`, startTime, endTime)
+// hasTrigger reports whether a trigger exists. Triggers are created after
+// their table is filled, so a missing trigger means the table needs a
+// backfill.
+func hasTrigger(tx *sql.Tx, name string) (bool, error) {
+	var n int
+	err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?", name).Scan(&n)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get error counts: %v", err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var errorType string
-		var count int64
-		if err := rows.Scan(&errorType, &count); err != nil {
-			return nil, fmt.Errorf("failed to scan error count: %v", err)
-		}
-		stats.ErrorCounts[errorType] = count
+		return false, fmt.Errorf("failed to read schema: %v", err)
 	}
+	return n > 0, nil
+}
 
-	// Get average latency
-	var avgLatency sql.NullFloat64
-	err = s.db.QueryRow(`
-		SELECT AVG(latency_ms) FROM connections
-		WHERE timestamp BETWEEN ? AND ? AND latency_ms IS NOT NULL
-	`, startTime, endTime).Scan(&avgLatency)
+func migrateTags(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS connection_tags (
+		connection_id TEXT NOT NULL,
+		tag TEXT NOT NULL,
+		PRIMARY KEY (tag, connection_id)
+	)`)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get average latency: %v", err)
+		return fmt.Errorf("failed to create tags table: %v", err)
 	}
-	if avgLatency.Valid {
-		stats.AvgLatency = avgLatency.Float64
+	if _, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_connection_tags_connection ON connection_tags(connection_id)"); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
 	}
 
-	// Get total bytes
-	var totalBytesSent, totalBytesReceived sql.NullInt64
-	err = s.db.QueryRow(`
-		SELECT SUM(bytes_sent), SUM(bytes_received) FROM connections
-		WHERE timestamp BETWEEN ? AND ?
-	`, startTime, endTime).Scan(&totalBytesSent, &totalBytesReceived)
+	exists, err := hasTrigger(tx, "connection_tags_insert")
 	if err != nil {
-		return nil, fmt.Errorf("failed to get total bytes: %v", err)
+		return err
 	}
-	if totalBytesSent.Valid {
-		stats.TotalBytesSent = totalBytesSent.Int64
+	if !exists {
+		_, err = tx.Exec(`INSERT OR IGNORE INTO connection_tags (connection_id, tag)
+			SELECT connections.id, json_each.value FROM connections, json_each(connections.tags)
+			WHERE json_each.type = 'text'`)
+		if err != nil {
+			return fmt.Errorf("failed to index tags: %v", err)
+		}
 	}
-	if totalBytesReceived.Valid {
-		stats.TotalBytesReceived = totalBytesReceived.Int64
+	for _, trigger := range sqliteTagTriggers {
+		if _, err := tx.Exec(trigger); err != nil {
+			return fmt.Errorf("failed to create trigger: %v", err)
+		}
 	}
+	return nil
+}
 
-	// Get service type stats
-	rows, err = s.db.Query(`
-		SELECT service_type, COUNT(*) FROM connections
-		WHERE timestamp BETWEEN ? AND ? AND service_type IS NOT NULL
-		GROUP BY service_type
-	`, startTime, endTime)
+func migrateAnomalies(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS anomalies (
+		id TEXT PRIMARY KEY,
+		timestamp DATETIME NOT NULL,
+		kind TEXT NOT NULL,
+		service_name TEXT NOT NULL,
+		destination TEXT NOT NULL,
+		metric TEXT NOT NULL,
+		value REAL NOT NULL,
+		baseline REAL NOT NULL,
+		score REAL NOT NULL,
+		message TEXT NOT NULL
+	)`)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get service type stats: %v", err)
+		return fmt.Errorf("failed to create anomalies table: %v", err)
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var serviceType sql.NullString
-		var count int
-		if err := rows.Scan(&serviceType, &count); err != nil {
-			return nil, fmt.Errorf("failed to scan service type: %v", err)
-		}
-		if serviceType.Valid {
-			stats.ServiceTypeStats[models.ServiceType(serviceType.String)] = count
+	for _, idx := range []string{
+		"CREATE INDEX IF NOT EXISTS idx_anomalies_timestamp ON anomalies(timestamp)",
+		"CREATE INDEX IF NOT EXISTS idx_anomalies_service ON anomalies(service_name)",
+	} {
+		if _, err := tx.Exec(idx); err != nil {
+			return fmt.Errorf("failed to create index: %v", err)
 		}
 	}
+	return nil
+}
 
-	// Get database stats
-	rows, err = s.db.Query(`
-		SELECT database_type, COUNT(*) FROM connections
-		WHERE timestamp BETWEEN ? AND ? AND service_type = 'database' AND database_type IS NOT NULL
-		GROUP BY database_type
-	`, startTime, endTime)
+func migrateSecurity(tx *sql.Tx) error {
+	var seenExists int
+	err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'seen_destinations'").Scan(&seenExists)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get database stats: %v", err)
+		return fmt.Errorf("failed to read schema: %v", err)
+	}
+
+	tables := []string{
+		`CREATE TABLE IF NOT EXISTS egress_policies (
+			service_name TEXT NOT NULL,
+			environment TEXT NOT NULL,
+			version INTEGER NOT NULL,
+			mode TEXT NOT NULL,
+			rules TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			created_by TEXT,
+			PRIMARY KEY (service_name, environment, version)
+		)`,
+		`CREATE TABLE IF NOT EXISTS seen_destinations (
+			service_name TEXT NOT NULL,
+			environment TEXT NOT NULL,
+			destination TEXT NOT NULL,
+			first_seen DATETIME NOT NULL,
+			PRIMARY KEY (service_name, environment, destination)
+		)`,
+		`CREATE TABLE IF NOT EXISTS security_events (
+			id TEXT PRIMARY KEY,
+			timestamp DATETIME NOT NULL,
+			kind TEXT NOT NULL,
+			service_name TEXT NOT NULL,
+			environment TEXT NOT NULL,
+			destination TEXT NOT NULL,
+			dest_ip TEXT NOT NULL,
+			dest_port INTEGER NOT NULL,
+			connection_id TEXT NOT NULL,
+			policy_version INTEGER NOT NULL,
+			message TEXT NOT NULL,
+			host TEXT NOT NULL DEFAULT ''
+		)`,
+		"CREATE INDEX IF NOT EXISTS idx_security_events_timestamp ON security_events(timestamp)",
+		"CREATE INDEX IF NOT EXISTS idx_security_events_service ON security_events(service_name)",
+	}
+	for _, stmt := range tables {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create security tables: %v", err)
+		}
+	}
+	if err := addColumns(tx, "security_events", []string{"host TEXT NOT NULL DEFAULT ''"}); err != nil {
+		return err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var dbType sql.NullString
-		var count int
-		if err := rows.Scan(&dbType, &count); err != nil {
-			return nil, fmt.Errorf("failed to scan database type: %v", err)
-		}
-		if dbType.Valid {
-			stats.DatabaseStats[models.DatabaseType(dbType.String)] = count
+	// Destinations already in the database are not new
+	if seenExists == 0 {
+		_, err = tx.Exec(`INSERT OR IGNORE INTO seen_destinations (service_name, environment, destination, first_seen)
+			SELECT service_name, COALESCE(environment, ''), ` + sqlDestination + `, MIN(timestamp)
+			FROM connections WHERE service_name <> ''
+			GROUP BY 1, 2, 3`)
+		if err != nil {
+			return fmt.Errorf("failed to record known destinations: %v", err)
 		}
 	}
+	return nil
+}
 
-	// Get queue stats
-	rows, err = s.db.Query(`
-		SELECT message_queue_type, COUNT(*) FROM connections
-		WHERE timestamp BETWEEN ? AND ? AND service_type = 'message_queue' AND message_queue_type IS NOT NULL
-		GROUP BY message_queue_type
-	`, startTime, endTime)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get queue stats: %v", err)
+func migrateListeners(tx *sql.Tx) error {
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS listeners (
+			host TEXT NOT NULL,
+			environment TEXT NOT NULL,
+			service_name TEXT NOT NULL,
+			address TEXT NOT NULL,
+			port INTEGER NOT NULL,
+			protocol TEXT NOT NULL,
+			pid INTEGER NOT NULL,
+			process TEXT NOT NULL,
+			container_id TEXT NOT NULL,
+			container_name TEXT NOT NULL,
+			first_seen DATETIME NOT NULL,
+			last_seen DATETIME NOT NULL,
+			closed_at DATETIME,
+			PRIMARY KEY (host, container_id, address, port, protocol)
+		)`,
+		`CREATE TABLE IF NOT EXISTS listener_changes (
+			timestamp DATETIME NOT NULL,
+			kind TEXT NOT NULL,
+			host TEXT NOT NULL,
+			environment TEXT NOT NULL,
+			address TEXT NOT NULL,
+			port INTEGER NOT NULL,
+			protocol TEXT NOT NULL,
+			process TEXT NOT NULL,
+			container_name TEXT NOT NULL
+		)`,
+		"CREATE INDEX IF NOT EXISTS idx_listener_changes_timestamp ON listener_changes(timestamp)",
+		"CREATE INDEX IF NOT EXISTS idx_listener_changes_host ON listener_changes(host)",
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create listener tables: %v", err)
+		}
 	}
-	defer rows.Close()
+	return nil
+}
 
-	for rows.Next() {
-		var queueType sql.NullString
-		var count int
-		if err := rows.Scan(&queueType, &count); err != nil {
-			return nil, fmt.Errorf("failed to scan queue type: %v", err)
-		}
-		if queueType.Valid {
-			stats.QueueStats[models.MessageQueueType(queueType.String)] = count
+func migratePools(tx *sql.Tx) error {
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS pool_samples (
+			timestamp DATETIME NOT NULL,
+			host TEXT NOT NULL,
+			environment TEXT NOT NULL,
+			service_name TEXT NOT NULL,
+			process TEXT NOT NULL,
+			container_name TEXT NOT NULL,
+			dest_ip TEXT NOT NULL,
+			dest_port INTEGER NOT NULL,
+			service_type TEXT NOT NULL,
+			database_type TEXT NOT NULL,
+			open INTEGER NOT NULL,
+			active INTEGER NOT NULL,
+			idle INTEGER NOT NULL,
+			opened INTEGER NOT NULL,
+			closed INTEGER NOT NULL,
+			interval_s REAL NOT NULL
+		)`,
+		"CREATE INDEX IF NOT EXISTS idx_pool_samples_timestamp ON pool_samples(timestamp)",
+		"CREATE INDEX IF NOT EXISTS idx_pool_samples_service ON pool_samples(service_name)",
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create pool_samples table: %v", err)
 		}
 	}
-
-	return stats, nil
+	return nil
 }
 
-func (s *SQLiteStorage) GetServices() ([]string, error) {
-	rows, err := s.db.Query("SELECT DISTINCT service_name FROM connections WHERE service_name != ''")
-	if err != nil {
-		return nil, fmt.Errorf("failed to get services: %v", err)
+func migrateCertificates(tx *sql.Tx) error {
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS certificates (
+			fingerprint TEXT PRIMARY KEY,
+			subject TEXT NOT NULL,
+			sans TEXT NOT NULL,
+			issuer TEXT NOT NULL,
+			serial_number TEXT NOT NULL,
+			not_before DATETIME NOT NULL,
+			not_after DATETIME NOT NULL,
+			key_type TEXT NOT NULL,
+			is_ca BOOLEAN NOT NULL,
+			issuer_fingerprint TEXT NOT NULL,
+			first_seen DATETIME NOT NULL,
+			last_seen DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS certificate_endpoints (
+			fingerprint TEXT NOT NULL,
+			dest_ip TEXT NOT NULL,
+			dest_port INTEGER NOT NULL,
+			server_name TEXT NOT NULL,
+			host TEXT NOT NULL,
+			environment TEXT NOT NULL,
+			service_name TEXT NOT NULL,
+			source TEXT NOT NULL,
+			first_seen DATETIME NOT NULL,
+			last_seen DATETIME NOT NULL,
+			PRIMARY KEY (fingerprint, dest_ip, dest_port, server_name, host)
+		)`,
+		"CREATE INDEX IF NOT EXISTS idx_certificates_not_after ON certificates(not_after)",
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create certificate tables: %v", err)
+		}
 	}
-	defer rows.Close()
+	return nil
+}
 
-	var services []string
-	for rows.Next() {
-		var service string
-		if err := rows.Scan(&service); err != nil {
-			return nil, fmt.Errorf("failed to scan service: %v", err)
+func migrateHTTPMetrics(tx *sql.Tx) error {
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS http_metrics (
+			timestamp DATETIME NOT NULL,
+			interval_s REAL NOT NULL,
+			host TEXT NOT NULL,
+			environment TEXT NOT NULL,
+			service_name TEXT NOT NULL,
+			dest_ip TEXT NOT NULL,
+			dest_port INTEGER NOT NULL,
+			authority TEXT NOT NULL,
+			method TEXT NOT NULL,
+			route TEXT NOT NULL,
+			requests INTEGER NOT NULL,
+			client_errors INTEGER NOT NULL,
+			server_errors INTEGER NOT NULL,
+			latency_sum_ms REAL NOT NULL,
+			latency_max_ms REAL NOT NULL,
+			latency_buckets TEXT NOT NULL,
+			source TEXT NOT NULL
+		)`,
+		"CREATE INDEX IF NOT EXISTS idx_http_metrics_timestamp ON http_metrics(timestamp)",
+		"CREATE INDEX IF NOT EXISTS idx_http_metrics_service ON http_metrics(service_name)",
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create http_metrics table: %v", err)
 		}
-		services = append(services, service)
 	}
-	return services, nil
+	return nil
 }
 
-func (s *SQLiteStorage) GetErrors() ([]string, error) {
-	rows, err := s.db.Query("SELECT DISTINCT error FROM connections WHERE error != ''")
-	if err != nil {
-		return nil, fmt.Errorf("failed to get errors: %v", err)
+func migrateFlows(tx *sql.Tx) error {
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS flow_summaries (
+			timestamp DATETIME NOT NULL,
+			interval_s REAL NOT NULL,
+			host TEXT NOT NULL,
+			environment TEXT NOT NULL,
+			service_name TEXT NOT NULL,
+			deployment_id TEXT NOT NULL,
+			region TEXT NOT NULL,
+			process TEXT NOT NULL,
+			dest_ip TEXT NOT NULL,
+			dest_port INTEGER NOT NULL,
+			service_type TEXT NOT NULL,
+			database_type TEXT NOT NULL,
+			message_queue_type TEXT NOT NULL,
+			connections INTEGER NOT NULL,
+			errors TEXT NOT NULL,
+			bytes_sent INTEGER NOT NULL,
+			bytes_received INTEGER NOT NULL,
+			latency_count INTEGER NOT NULL,
+			latency_sum_ms REAL NOT NULL,
+			latency_max_ms REAL NOT NULL,
+			latency_buckets TEXT NOT NULL
+		)`,
+		"CREATE INDEX IF NOT EXISTS idx_flow_summaries_timestamp ON flow_summaries(timestamp)",
+		"CREATE INDEX IF NOT EXISTS idx_flow_summaries_service ON flow_summaries(service_name)",
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create flow_summaries table: %v", err)
+		}
 	}
-	defer rows.Close()
+	return nil
+}
 
-	var errors []string
-	for rows.Next() {
-		var errorType string
-		if err := rows.Scan(&errorType); err != nil {
-			return nil, fmt.Errorf("failed to scan error: %v", err)
+// migrateFTS maintains the connections_fts full-text index when SQLite has
+// FTS5. Without it the triggers are dropped, since they could not write to
+// the index, and the index is rebuilt once FTS5 is available again.
+func migrateFTS(tx *sql.Tx) (bool, error) {
+	var enabled bool
+	if err := tx.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled); err != nil {
+		return false, fmt.Errorf("failed to check for FTS5: %v", err)
+	}
+	if !enabled {
+		for _, name := range []string{"connections_fts_insert", "connections_fts_delete"} {
+			if _, err := tx.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+				return false, fmt.Errorf("failed to drop trigger: %v", err)
+			}
 		}
-		errors = append(errors, errorType)
+		return false, nil
 	}
-	return errors, nil
-}
 
-func (s *SQLiteStorage) GetEnvironments() ([]string, error) {
-	rows, err := s.db.Query("SELECT DISTINCT environment FROM connections WHERE environment != ''")
-	if err != nil {
-		return nil, fmt.Errorf("failed to get environments: %v", err)
+	if _, err := tx.Exec("CREATE VIRTUAL TABLE IF NOT EXISTS connections_fts USING fts5(tags, metadata)"); err != nil {
+		return false, fmt.Errorf("failed to create full-text index: %v", err)
 	}
-	defer rows.Close()
 
-	var environments []string
-	for rows.Next() {
-		var env string
-		if err := rows.Scan(&env); err != nil {
-			return nil, fmt.Errorf("failed to scan environment: %v", err)
+	exists, err := hasTrigger(tx, "connections_fts_insert")
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		if _, err := tx.Exec("DELETE FROM connections_fts"); err != nil {
+			return false, fmt.Errorf("failed to rebuild full-text index: %v", err)
+		}
+		_, err = tx.Exec("INSERT INTO connections_fts (rowid, tags, metadata) SELECT rowid, " +
+			fmt.Sprintf(sqliteFTSText, "connections") + " FROM connections")
+		if err != nil {
+			return false, fmt.Errorf("failed to rebuild full-text index: %v", err)
 		}
-		environments = append(environments, env)
 	}
-	return environments, nil
-}
-
-func (s *SQLiteStorage) Close() error {
-	return s.db.Close()
+	for _, trigger := range sqliteFTSTriggers {
+		if _, err := tx.Exec(trigger); err != nil {
+			return false, fmt.Errorf("failed to create trigger: %v", err)
+		}
+	}
+	return true, nil
 }
@@ -0,0 +1,103 @@
+//go:build sqlite_fts5
+
+package storage_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage/storagetest"
+)
+
+// TestSQLiteFTS5 runs with -tags sqlite_fts5, as make test does, and checks
+// that tags and metadata are searched through the full-text index
+func TestSQLiteFTS5(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cinnamon.db")
+	store, err := storage.NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { store.Close() }()
+	for _, conn := range storagetest.Fixtures(time.Now()) {
+		if err := store.StoreConnection(conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	raw, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	indexed := func() int {
+		t.Helper()
+		var n int
+		if err := raw.QueryRow("SELECT COUNT(*) FROM connections_fts").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	search := func(text string) []string {
+		t.Helper()
+		conns, err := store.GetConnections(storage.ConnectionFilter{Search: text})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, conn := range conns {
+			ids = append(ids, conn.ID)
+		}
+		return ids
+	}
+	check := func(when string) {
+		t.Helper()
+		if n := indexed(); n != 3 {
+			t.Errorf("%s: %d connections indexed, want 3", when, n)
+		}
+		for _, tc := range []struct {
+			text string
+			want []string
+		}{
+			// The last word matches as a prefix
+			{"netw", []string{"conformance-1"}},
+			{"network monitor", []string{"conformance-1"}},
+			// Metadata keys and values are indexed
+			{"dns_query", []string{"conformance-2"}},
+			{"broker", []string{"conformance-2"}},
+			{"tcp", []string{"conformance-1", "conformance-2"}},
+			// Words are matched whole or by prefix, unlike LIKE, which
+			// would find this inside network-monitor
+			{"etwork", nil},
+		} {
+			if got := search(tc.text); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("%s: search %q = %v, want %v", when, tc.text, got, tc.want)
+			}
+		}
+	}
+	check("stored")
+
+	// An index left behind by a binary without FTS5, which dropped the
+	// triggers, is rebuilt on the next start
+	if _, err := raw.Exec("DROP TRIGGER connections_fts_insert; DELETE FROM connections_fts"); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	if store, err = storage.NewSQLiteStorage(path); err != nil {
+		t.Fatal(err)
+	}
+	check("rebuilt")
+
+	if _, err := store.DeleteConnections([]string{"conformance-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := indexed(); n != 2 {
+		t.Errorf("%d connections indexed after deleting one, want 2", n)
+	}
+	if got := search("netw"); got != nil {
+		t.Errorf("search of a deleted connection = %v", got)
+	}
+}
@@ -0,0 +1,35 @@
+package storage_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage/storagetest"
+)
+
+func TestSQLiteStorage(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "cinnamon.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := storagetest.TestStorage(store); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCachedSQLiteStorage(t *testing.T) {
+	backend, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "cinnamon.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := storage.NewCachedStorage(backend, time.Hour, 1000)
+	defer store.Close()
+
+	if err := storagetest.TestStorage(store); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,20 +1,28 @@
 package storage
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/query"
 )
 
 // Storage defines the interface for storing and retrieving connection data
 type Storage interface {
 	// Basic CRUD operations
 	StoreConnection(conn *models.Connection) error
-	GetConnections(service, errorType, environment, search string) ([]*models.Connection, error)
+	GetConnections(filter ConnectionFilter) ([]*models.Connection, error)
+	// IterateConnections streams every connection matching filter, newest
+	// first, without GetConnections' row cap. Iteration stops at the first
+	// error returned by fn.
+	IterateConnections(filter ConnectionFilter, fn func(*models.Connection) error) error
 	GetConnectionByID(id string) (*models.Connection, error)
 
 	// Statistics and analytics
-	GetStats(startTime, endTime time.Time) (*models.ConnectionStats, error)
+	GetStats(startTime, endTime time.Time, filter ConnectionFilter) (*models.ConnectionStats, error)
 	GetServices() ([]string, error)
 	GetErrors() ([]string, error)
 	GetEnvironments() ([]string, error)
@@ -22,3 +30,100 @@ type Storage interface {
 	// Cleanup
 	Close() error
 }
+
+// Pruner is implemented by backends that can hand over and remove old rows,
+// as the archiver does when data ages out of retention
+type Pruner interface {
+	// ConnectionsBefore calls fn for each connection older than cutoff,
+	// oldest first, stopping at the first error
+	ConnectionsBefore(cutoff time.Time, fn func(*models.Connection) error) error
+	// DeleteConnections removes connections by ID, returning how many existed
+	DeleteConnections(ids []string) (int64, error)
+}
+
+// ConnectionFilter narrows the connections returned by GetConnections and
+// counted by GetStats. Empty fields match everything.
+type ConnectionFilter struct {
+	Service     string
+	Error       string
+	Environment string
+	Search      string
+
+	// Destination enrichment
+	DestCountry string
+	DestASN     int
+	DestOrg     string
+	DestScope   string
+
+	// Kubernetes workload; namespace and pod match either side
+	Namespace  string
+	Deployment string
+	Pod        string
+	Node       string
+
+	// Container name or ID prefix, and image
+	Container string
+	Image     string
+
+	// Time range, inclusive; zero times are unbounded
+	Start time.Time
+	End   time.Time
+	// Live narrows the range to the recent data a cache holds in memory,
+	// so polling never reaches the backend. Uncached stores ignore it.
+	Live bool
+
+	// Tags must all be present; Metadata maps dotted key paths to values
+	Tags     []string
+	Metadata map[string]string
+
+	// Query is a parsed query language expression; nil matches everything
+	Query query.Node
+}
+
+// queryNode combines Query with the tag and metadata filters, or returns nil
+// when none are set
+func (f ConnectionFilter) queryNode() query.Node {
+	node := f.Query
+	and := func(n query.Node) {
+		if node == nil {
+			node = n
+		} else {
+			node = query.And{Left: node, Right: n}
+		}
+	}
+	for _, tag := range f.Tags {
+		and(query.TagEquals(tag))
+	}
+	keys := make([]string, 0, len(f.Metadata))
+	for key := range f.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		and(query.MetadataEquals(key, f.Metadata[key]))
+	}
+	return node
+}
+
+// Open creates the Storage for a driver name: "sqlite" takes a file path,
+// "postgres" a connection string and "memory" an optional capacity
+func Open(driver, dsn string) (Storage, error) {
+	switch driver {
+	case "memory":
+		capacity := DefaultMemoryCapacity
+		if dsn != "" {
+			n, err := strconv.Atoi(dsn)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid memory capacity: %s", dsn)
+			}
+			capacity = n
+		}
+		return NewMemoryStorage(capacity), nil
+	case "sqlite":
+		return NewSQLiteStorage(dsn)
+	case "postgres", "postgresql":
+		return NewPostgresStorage(dsn)
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %s", driver)
+	}
+}
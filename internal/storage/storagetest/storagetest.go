@@ -0,0 +1,251 @@
+// Package storagetest checks that a Storage implementation behaves like the
+// others. It follows testing/fstest: TestStorage returns an error describing
+// every mismatch, so it can back a _test.go file or a smoke check against a
+// freshly provisioned database.
+package storagetest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// Fixtures returns the connections stored by TestStorage, newest first
+func Fixtures(base time.Time) []*models.Connection {
+	base = base.UTC().Truncate(time.Second)
+	return []*models.Connection{
+		{
+			ID:               "conformance-1",
+			Timestamp:        base,
+			SourceIP:         "10.0.0.5",
+			SourcePort:       50000,
+			DestIP:           "10.0.1.10",
+			DestPort:         5432,
+			DestHostname:     "orders-db.internal",
+			DestScope:        "private",
+			DestK8sNamespace: "data",
+			DestK8sService:   "orders-db",
+			Protocol:         "TCP",
+			AppProtocol:      "postgresql",
+			ServiceName:      "checkout",
+			ServiceType:      models.ServiceTypeDatabase,
+			DatabaseType:     models.DatabaseTypePostgreSQL,
+			MessageQueueType: models.MessageQueueTypeOther,
+			Host:             "node-1",
+			DeploymentID:     "checkout-7d9f8c",
+			Environment:      "production",
+			Region:           "eu-west-1",
+			K8sNamespace:     "payments",
+			K8sPod:           "checkout-7d9f8c-abcde",
+			K8sDeployment:    "checkout",
+			K8sNode:          "node-1",
+			ContainerID:      "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			ContainerName:    "checkout",
+			ContainerImage:   "registry.local/checkout:1.4.2",
+			Latency:          12.5,
+			Duration:         340,
+			DNSLatency:       1.5,
+			BytesSent:        1200,
+			BytesReceived:    64000,
+			RetryCount:       0,
+			Tags:             []string{"tcp", "network-monitor"},
+			Metadata:         map[string]interface{}{"protocol": "TCP"},
+		},
+		{
+			ID:               "conformance-2",
+			Timestamp:        base.Add(-time.Minute),
+			SourceIP:         "10.0.0.6",
+			SourcePort:       50001,
+			DestIP:           "34.120.1.1",
+			DestPort:         9092,
+			DestReverseDNS:   "broker-1.example.net",
+			DestASN:          396982,
+			DestOrg:          "GOOGLE-CLOUD-PLATFORM",
+			DestCountry:      "US",
+			DestScope:        "public",
+			Protocol:         "TCP",
+			ServiceName:      "billing",
+			ServiceType:      models.ServiceTypeMessageQueue,
+			DatabaseType:     models.DatabaseTypeOther,
+			MessageQueueType: models.MessageQueueTypeKafka,
+			Host:             "node-2",
+			DeploymentID:     "billing-55f",
+			Environment:      "staging",
+			Latency:          80,
+			RetryCount:       2,
+			Error:            string(models.ErrConnTimeout),
+			Tags:             []string{"tcp"},
+			Metadata:         map[string]interface{}{"protocol": "TCP", "dns_query": "broker-1"},
+		},
+		{
+			ID:               "conformance-3",
+			Timestamp:        base.Add(-2 * time.Minute),
+			SourceIP:         "10.0.0.5",
+			SourcePort:       50002,
+			DestIP:           "10.0.2.20",
+			DestPort:         443,
+			Protocol:         "TCP",
+			ServiceName:      "checkout",
+			ServiceType:      models.ServiceTypeAPI,
+			DatabaseType:     models.DatabaseTypeOther,
+			MessageQueueType: models.MessageQueueTypeOther,
+			Host:             "node-1",
+			Environment:      "production",
+			Latency:          30,
+			Error:            string(models.ErrConnRefused),
+			Tags:             []string{},
+			Metadata:         map[string]interface{}{},
+		},
+	}
+}
+
+// TestStorage stores the fixtures in an empty store and checks that they can
+// be read back through every query method
+func TestStorage(s storage.Storage) error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	base := time.Now()
+	fixtures := Fixtures(base)
+	for _, conn := range fixtures {
+		if err := s.StoreConnection(conn); err != nil {
+			return fmt.Errorf("StoreConnection(%s): %v", conn.ID, err)
+		}
+	}
+
+	// Round trip
+	for _, want := range fixtures {
+		got, err := s.GetConnectionByID(want.ID)
+		if err != nil {
+			fail("GetConnectionByID(%s): %v", want.ID, err)
+			continue
+		}
+		if diff := compare(want, got); diff != "" {
+			fail("GetConnectionByID(%s): %s", want.ID, diff)
+		}
+	}
+	if _, err := s.GetConnectionByID("conformance-missing"); err == nil {
+		fail("GetConnectionByID(missing): expected an error")
+	}
+
+	// Filters
+	filters := []struct {
+		name   string
+		filter storage.ConnectionFilter
+		want   []string
+	}{
+		{"all", storage.ConnectionFilter{}, []string{"conformance-1", "conformance-2", "conformance-3"}},
+		{"service", storage.ConnectionFilter{Service: "checkout"}, []string{"conformance-1", "conformance-3"}},
+		{"error", storage.ConnectionFilter{Error: "ETIMEDOUT"}, []string{"conformance-2"}},
+		{"environment", storage.ConnectionFilter{Environment: "staging"}, []string{"conformance-2"}},
+		{"search", storage.ConnectionFilter{Search: "ORDERS-DB"}, []string{"conformance-1"}},
+		{"dest country", storage.ConnectionFilter{DestCountry: "US"}, []string{"conformance-2"}},
+		{"dest country, lowercase", storage.ConnectionFilter{DestCountry: "us"}, []string{"conformance-2"}},
+		{"dest asn", storage.ConnectionFilter{DestASN: 396982}, []string{"conformance-2"}},
+		{"dest scope", storage.ConnectionFilter{DestScope: "private"}, []string{"conformance-1"}},
+		{"namespace", storage.ConnectionFilter{Namespace: "data"}, []string{"conformance-1"}},
+		{"deployment", storage.ConnectionFilter{Deployment: "checkout"}, []string{"conformance-1"}},
+		{"container id prefix", storage.ConnectionFilter{Container: "0123456789ab"}, []string{"conformance-1"}},
+		{"combined", storage.ConnectionFilter{Service: "checkout", Error: "ECONNREFUSED"}, []string{"conformance-3"}},
+		{"tag", storage.ConnectionFilter{Tags: []string{"tcp"}}, []string{"conformance-1", "conformance-2"}},
+		{"tags", storage.ConnectionFilter{Tags: []string{"tcp", "network-monitor"}}, []string{"conformance-1"}},
+		{"metadata", storage.ConnectionFilter{Metadata: map[string]string{"dns_query": "broker-1"}}, []string{"conformance-2"}},
+		{"search tags", storage.ConnectionFilter{Search: "network"}, []string{"conformance-1"}},
+	}
+	for _, tc := range filters {
+		conns, err := s.GetConnections(tc.filter)
+		if err != nil {
+			fail("GetConnections(%s): %v", tc.name, err)
+			continue
+		}
+		var got []string
+		for _, conn := range conns {
+			got = append(got, conn.ID)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			fail("GetConnections(%s) = %v, want %v (newest first)", tc.name, got, tc.want)
+		}
+	}
+
+	// Statistics
+	stats, err := s.GetStats(base.Add(-time.Hour), base.Add(time.Hour), storage.ConnectionFilter{})
+	if err != nil {
+		fail("GetStats: %v", err)
+	} else {
+		if stats.TotalConnections != 3 {
+			fail("GetStats: total_connections = %d, want 3", stats.TotalConnections)
+		}
+		if stats.ErrorCounts["ETIMEDOUT"] != 1 || stats.ErrorCounts["ECONNREFUSED"] != 1 {
+			fail("GetStats: error_counts = %v", stats.ErrorCounts)
+		}
+		if stats.TotalBytesSent != 1200 || stats.TotalBytesReceived != 64000 {
+			fail("GetStats: bytes = %d/%d, want 1200/64000", stats.TotalBytesSent, stats.TotalBytesReceived)
+		}
+		if avg := (12.5 + 80 + 30) / 3; stats.AvgLatency < avg-0.001 || stats.AvgLatency > avg+0.001 {
+			fail("GetStats: avg_latency = %v, want %v", stats.AvgLatency, avg)
+		}
+		if stats.ServiceTypeStats[models.ServiceTypeDatabase] != 1 || stats.ServiceTypeStats[models.ServiceTypeAPI] != 1 {
+			fail("GetStats: service_type_stats = %v", stats.ServiceTypeStats)
+		}
+		if stats.DatabaseStats[models.DatabaseTypePostgreSQL] != 1 {
+			fail("GetStats: database_stats = %v", stats.DatabaseStats)
+		}
+		if stats.QueueStats[models.MessageQueueTypeKafka] != 1 {
+			fail("GetStats: queue_stats = %v", stats.QueueStats)
+		}
+	}
+	if stats, err := s.GetStats(base.Add(time.Hour), base.Add(2*time.Hour), storage.ConnectionFilter{}); err == nil && stats.TotalConnections != 0 {
+		fail("GetStats outside the stored range: total_connections = %d, want 0", stats.TotalConnections)
+	}
+	filter := storage.ConnectionFilter{Tags: []string{"tcp"}, Metadata: map[string]string{"protocol": "TCP"}}
+	if stats, err := s.GetStats(base.Add(-time.Hour), base.Add(time.Hour), filter); err != nil {
+		fail("GetStats(filtered): %v", err)
+	} else if stats.TotalConnections != 2 || stats.ErrorCounts["ETIMEDOUT"] != 1 || stats.ErrorCounts["ECONNREFUSED"] != 0 {
+		fail("GetStats(filtered): total_connections = %d, error_counts = %v", stats.TotalConnections, stats.ErrorCounts)
+	}
+
+	// Distinct values
+	distinct := []struct {
+		name string
+		get  func() ([]string, error)
+		want []string
+	}{
+		{"GetServices", s.GetServices, []string{"billing", "checkout"}},
+		{"GetErrors", s.GetErrors, []string{"ECONNREFUSED", "ETIMEDOUT"}},
+		{"GetEnvironments", s.GetEnvironments, []string{"production", "staging"}},
+	}
+	for _, tc := range distinct {
+		got, err := tc.get()
+		if err != nil {
+			fail("%s: %v", tc.name, err)
+			continue
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tc.want) {
+			fail("%s = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// compare describes the differences between two connections
+func compare(want, got *models.Connection) string {
+	if !want.Timestamp.Equal(got.Timestamp) {
+		return fmt.Sprintf("timestamp = %v, want %v", got.Timestamp, want.Timestamp)
+	}
+
+	w, g := *want, *got
+	w.Timestamp, g.Timestamp = time.Time{}, time.Time{}
+	if !reflect.DeepEqual(w, g) {
+		return fmt.Sprintf("got %+v, want %+v", g, w)
+	}
+	return ""
+}
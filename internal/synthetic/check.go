@@ -0,0 +1,161 @@
+// Package synthetic runs active checks from the collector: TCP connects,
+// TLS handshakes, HTTP requests, DNS lookups and database protocol pings.
+// Each run is reported as a connection with the latency and error it saw,
+// so availability shows up in the same stats, error trends and alerts as
+// observed traffic.
+package synthetic
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Type is the kind of a check
+type Type string
+
+const (
+	TypeTCP      Type = "tcp"
+	TypeTLS      Type = "tls"
+	TypeHTTP     Type = "http"
+	TypeDNS      Type = "dns"
+	TypePostgres Type = "postgres"
+	TypeRedis    Type = "redis"
+	TypeMySQL    Type = "mysql"
+)
+
+// defaultPorts completes targets given without a port
+var defaultPorts = map[Type]int{
+	TypeTLS:      443,
+	TypePostgres: 5432,
+	TypeRedis:    6379,
+	TypeMySQL:    3306,
+}
+
+// Defaults for fields left empty
+const (
+	DefaultInterval   = 30 * time.Second
+	DefaultTimeout    = 5 * time.Second
+	DefaultCertExpiry = 14 * 24 * time.Hour
+)
+
+// Duration is a time.Duration written as a string such as "30s" in JSON
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Check is one scheduled probe
+type Check struct {
+	Name string `json:"name"`
+	Type Type   `json:"type"`
+	// Target is host:port, a URL for http checks or the name to resolve for
+	// dns checks
+	Target   string   `json:"target"`
+	Interval Duration `json:"interval,omitempty"`
+	Timeout  Duration `json:"timeout,omitempty"`
+
+	// ExpectStatus is the status an http check requires, 200 by default.
+	// Redirects are not followed.
+	ExpectStatus int `json:"expect_status,omitempty"`
+	// CertExpiry fails tls and https checks whose certificate expires
+	// within it, 14 days by default
+	CertExpiry Duration `json:"cert_expiry,omitempty"`
+	ServerName string   `json:"server_name,omitempty"`
+	Insecure   bool     `json:"insecure,omitempty"`
+
+	// Resolver is the host:port of the server dns checks query, the
+	// system's resolver by default
+	Resolver string `json:"resolver,omitempty"`
+
+	Tags []string `json:"tags,omitempty"`
+}
+
+// LoadChecksFile reads a JSON file of the form {"checks": [...]}
+func LoadChecksFile(path string) ([]*Check, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checks: %v", err)
+	}
+	var file struct {
+		Checks []*Check `json:"checks"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse checks: %v", err)
+	}
+	for i, c := range file.Checks {
+		if err := c.Validate(); err != nil {
+			return nil, fmt.Errorf("check %d: %v", i+1, err)
+		}
+	}
+	return file.Checks, nil
+}
+
+// Validate checks the target and fills in defaults
+func (c *Check) Validate() error {
+	if c.Target == "" {
+		return fmt.Errorf("target is required")
+	}
+	switch c.Type {
+	case TypeHTTP:
+		u, err := url.Parse(c.Target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("http target must be an http or https URL: %s", c.Target)
+		}
+		if c.ExpectStatus == 0 {
+			c.ExpectStatus = 200
+		}
+	case TypeDNS:
+		if c.Resolver != "" {
+			if _, _, err := net.SplitHostPort(c.Resolver); err != nil {
+				c.Resolver = net.JoinHostPort(c.Resolver, "53")
+			}
+		}
+	case TypeTCP, TypeTLS, TypePostgres, TypeRedis, TypeMySQL:
+		if _, port, err := net.SplitHostPort(c.Target); err == nil {
+			if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+				return fmt.Errorf("invalid port in target %s", c.Target)
+			}
+		} else if port, ok := defaultPorts[c.Type]; ok {
+			c.Target = net.JoinHostPort(c.Target, strconv.Itoa(port))
+		} else {
+			return fmt.Errorf("%s target must be host:port: %s", c.Type, c.Target)
+		}
+	default:
+		return fmt.Errorf("unknown check type %q", c.Type)
+	}
+
+	if c.Name == "" {
+		c.Name = string(c.Type) + " " + c.Target
+	}
+	if c.Interval <= 0 {
+		c.Interval = Duration(DefaultInterval)
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = Duration(DefaultTimeout)
+	}
+	if c.CertExpiry <= 0 {
+		c.CertExpiry = Duration(DefaultCertExpiry)
+	}
+	return nil
+}
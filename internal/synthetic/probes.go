@@ -0,0 +1,332 @@
+package synthetic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/fingerprint"
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// probe is one run of a check, filling in its connection as it goes
+type probe struct {
+	check *Check
+	// mu guards conn against dials from resolver goroutines
+	mu   sync.Mutex
+	conn *models.Connection
+	// chain is the server's certificate chain in DER, leaf first
+	chain [][]byte
+}
+
+// dial connects to address, timing the DNS lookup of a hostname and
+// recording both ends of the connection
+func (p *probe) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ip := host
+	var lookup time.Duration
+	if net.ParseIP(host) == nil {
+		start := time.Now()
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		lookup = time.Since(start)
+		if err == nil && len(addrs) == 0 {
+			err = &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+		}
+		if err != nil {
+			p.mu.Lock()
+			p.conn.DestHostname = host
+			p.conn.DNSLatency = milliseconds(lookup)
+			p.mu.Unlock()
+			return nil, err
+		}
+		ip = addrs[0].IP.String()
+	}
+
+	p.mu.Lock()
+	p.conn.Protocol = strings.TrimRight(network, "46")
+	p.conn.DestIP = ip
+	p.conn.DestPort, _ = strconv.Atoi(port)
+	if ip != host {
+		p.conn.DestHostname = host
+		p.conn.DNSLatency = milliseconds(lookup)
+	}
+	p.mu.Unlock()
+
+	var d net.Dialer
+	c, err := d.DialContext(ctx, network, net.JoinHostPort(ip, port))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+
+	p.mu.Lock()
+	switch local := c.LocalAddr().(type) {
+	case *net.TCPAddr:
+		p.conn.SourceIP, p.conn.SourcePort = local.IP.String(), local.Port
+	case *net.UDPAddr:
+		p.conn.SourceIP, p.conn.SourcePort = local.IP.String(), local.Port
+	}
+	p.mu.Unlock()
+	return c, nil
+}
+
+func (p *probe) tcp(ctx context.Context) error {
+	c, err := p.dial(ctx, "tcp", p.check.Target)
+	if err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+func (p *probe) tlsConfig(host string) *tls.Config {
+	name := p.check.ServerName
+	if name == "" {
+		name = host
+	}
+	return &tls.Config{ServerName: name, InsecureSkipVerify: p.check.Insecure}
+}
+
+func (p *probe) tls(ctx context.Context) error {
+	c, err := p.dial(ctx, "tcp", p.check.Target)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	host, _, _ := net.SplitHostPort(p.check.Target)
+	config := p.tlsConfig(host)
+	p.conn.ServiceType = models.ServiceTypeAPI
+	p.conn.AppProtocol = string(fingerprint.ProtocolTLS)
+	p.conn.TLSServerName = config.ServerName
+
+	tc := tls.Client(c, config)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		return err
+	}
+	return p.certificate(tc.ConnectionState())
+}
+
+// certificate records the server's chain and its certificate's expiry,
+// failing the check when it is within CertExpiry
+func (p *probe) certificate(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	for _, cert := range state.PeerCertificates {
+		p.chain = append(p.chain, cert.Raw)
+	}
+	leaf := state.PeerCertificates[0]
+	left := time.Until(leaf.NotAfter)
+	days := int(left.Hours() / 24)
+	p.conn.Metadata["cert_subject"] = leaf.Subject.CommonName
+	p.conn.Metadata["cert_issuer"] = leaf.Issuer.CommonName
+	p.conn.Metadata["cert_expiry"] = leaf.NotAfter.UTC().Format(time.RFC3339)
+	p.conn.Metadata["cert_days_left"] = days
+
+	switch {
+	case left <= 0:
+		return failed(models.ErrCertExpired, "certificate expired on %s", leaf.NotAfter.UTC().Format(time.RFC3339))
+	case left < time.Duration(p.check.CertExpiry):
+		return failed(models.ErrCertExpiring, "certificate expires in %d days", days)
+	}
+	return nil
+}
+
+func (p *probe) http(ctx context.Context) error {
+	u, err := url.Parse(p.check.Target)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext:       p.dial,
+			TLSClientConfig:   p.tlsConfig(u.Hostname()),
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.check.Target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "cinnamon-synthetic/1.0")
+
+	p.conn.ServiceType = models.ServiceTypeAPI
+	p.conn.AppProtocol = string(fingerprint.ProtocolHTTP1)
+	p.conn.Metadata["url"] = p.check.Target
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	n, _ := io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	p.conn.BytesReceived = n
+	p.conn.Metadata["http_status"] = resp.StatusCode
+
+	if resp.StatusCode != p.check.ExpectStatus {
+		return failed(models.ErrHTTPStatus, "expected status %d, got %d", p.check.ExpectStatus, resp.StatusCode)
+	}
+	if resp.TLS != nil {
+		p.conn.TLSServerName = resp.TLS.ServerName
+		return p.certificate(*resp.TLS)
+	}
+	return nil
+}
+
+func (p *probe) dns(ctx context.Context) error {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if p.check.Resolver != "" {
+				address = p.check.Resolver
+			}
+			return p.dial(ctx, network, address)
+		},
+	}
+	p.conn.AppProtocol = "dns"
+	p.conn.Metadata["dns_name"] = p.check.Target
+
+	addrs, err := resolver.LookupHost(ctx, p.check.Target)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.conn.Metadata["dns_answers"] = addrs
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *probe) database(dbType models.DatabaseType, protocol fingerprint.Protocol) {
+	p.conn.ServiceType = models.ServiceTypeDatabase
+	p.conn.DatabaseType = dbType
+	p.conn.AppProtocol = string(protocol)
+}
+
+// postgres sends an SSLRequest, which any PostgreSQL server answers with a
+// single S or N before authentication
+func (p *probe) postgres(ctx context.Context) error {
+	p.database(models.DatabaseTypePostgreSQL, fingerprint.ProtocolPostgreSQL)
+	c, err := p.dial(ctx, "tcp", p.check.Target)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if _, err := c.Write([]byte{0, 0, 0, 8, 0x04, 0xd2, 0x16, 0x2f}); err != nil {
+		return err
+	}
+	reply := make([]byte, 1)
+	if _, err := io.ReadFull(c, reply); err != nil {
+		return err
+	}
+	if reply[0] != 'S' && reply[0] != 'N' {
+		return failed(models.ErrProtocol, "unexpected reply %q to SSLRequest", reply[0])
+	}
+	return nil
+}
+
+// redis sends PING. A server requiring authentication still answers, with
+// NOAUTH, which is enough to show it is up.
+func (p *probe) redis(ctx context.Context) error {
+	p.database(models.DatabaseTypeRedis, fingerprint.ProtocolRedis)
+	c, err := p.dial(ctx, "tcp", p.check.Target)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if _, err := c.Write([]byte("PING\r\n")); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	line = strings.TrimSpace(line)
+	switch {
+	case line == "+PONG":
+	case strings.HasPrefix(line, "-NOAUTH"):
+		p.conn.Metadata["redis_auth_required"] = true
+	default:
+		return failed(models.ErrProtocol, "unexpected reply %q to PING", line)
+	}
+	return nil
+}
+
+// mysql reads the greeting a MySQL server sends on connect
+func (p *probe) mysql(ctx context.Context) error {
+	p.database(models.DatabaseTypeMySQL, fingerprint.ProtocolMySQL)
+	c, err := p.dial(ctx, "tcp", p.check.Target)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(c, header); err != nil {
+		return err
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	if length == 0 || length > 1<<16 {
+		return failed(models.ErrProtocol, "invalid greeting length %d", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c, payload); err != nil {
+		return err
+	}
+
+	switch payload[0] {
+	case 0x0a:
+		if end := bytes.IndexByte(payload[1:], 0); end >= 0 {
+			p.conn.Metadata["mysql_version"] = string(payload[1 : 1+end])
+		}
+		return nil
+	case 0xff:
+		// Error packet: code, then the message, after a SQL state marker
+		// on newer servers
+		if len(payload) < 3 {
+			return failed(models.ErrProtocol, "server refused connection")
+		}
+		code := binary.LittleEndian.Uint16(payload[1:])
+		message := string(payload[3:])
+		if strings.HasPrefix(message, "#") && len(message) >= 6 {
+			message = message[6:]
+		}
+		return failed(models.ErrProtocol, "server refused connection: %d %s", code, message)
+	}
+	return failed(models.ErrProtocol, "unexpected greeting 0x%02x", payload[0])
+}
+
+// isTLSError reports whether a handshake failed on certificates or the TLS
+// protocol rather than the network
+func isTLSError(err error) bool {
+	var (
+		record    tls.RecordHeaderError
+		alert     tls.AlertError
+		verify    *tls.CertificateVerificationError
+		authority x509.UnknownAuthorityError
+		hostname  x509.HostnameError
+		invalid   x509.CertificateInvalidError
+	)
+	return errors.As(err, &record) || errors.As(err, &alert) || errors.As(err, &verify) ||
+		errors.As(err, &authority) || errors.As(err, &hostname) || errors.As(err, &invalid)
+}
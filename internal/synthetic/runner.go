@@ -0,0 +1,179 @@
+package synthetic
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// Runner runs checks on their schedules. It is a connection source for the
+// collector's monitor.
+type Runner struct {
+	checks       []*Check
+	certificates func(*models.CertificateObservation)
+}
+
+// NewRunner creates a runner for validated checks
+func NewRunner(checks []*Check) *Runner {
+	return &Runner{checks: checks}
+}
+
+// OnCertificate passes the certificate chain presented to every TLS and
+// HTTPS check to fn, which must not block
+func (r *Runner) OnCertificate(fn func(*models.CertificateObservation)) {
+	r.certificates = fn
+}
+
+// Run starts every check at once, then repeats each at its interval until
+// stop is closed
+func (r *Runner) Run(stop <-chan struct{}, emit func(*models.Connection)) error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range r.checks {
+		wg.Add(1)
+		go func(c *Check) {
+			defer wg.Done()
+			ticker := time.NewTicker(time.Duration(c.Interval))
+			defer ticker.Stop()
+			for {
+				conn, chain := c.run()
+				mu.Lock()
+				emit(conn)
+				if r.certificates != nil && len(chain) > 0 {
+					r.certificates(&models.CertificateObservation{
+						Timestamp:  conn.Timestamp,
+						DestIP:     conn.DestIP,
+						DestPort:   conn.DestPort,
+						ServerName: conn.TLSServerName,
+						Source:     "check",
+						Chain:      chain,
+					})
+				}
+				mu.Unlock()
+
+				select {
+				case <-ticker.C:
+				case <-stop:
+					return
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+	return nil
+}
+
+// Run performs the check once and returns it as a connection, with Latency
+// covering the whole check and Error set when it failed
+func (c *Check) Run() *models.Connection {
+	conn, _ := c.run()
+	return conn
+}
+
+// run performs the check, also returning the server's certificate chain
+// when it presented one
+func (c *Check) run() (*models.Connection, [][]byte) {
+	p := &probe{check: c, conn: &models.Connection{
+		Timestamp:   time.Now(),
+		Direction:   models.DirectionOutbound,
+		ServiceType: models.ServiceTypeOther,
+		Tags:        append([]string{"synthetic"}, c.Tags...),
+		Metadata: map[string]interface{}{
+			"synthetic":  true,
+			"check":      c.Name,
+			"check_type": string(c.Type),
+		},
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.Timeout))
+	defer cancel()
+
+	var err error
+	switch c.Type {
+	case TypeTCP:
+		err = p.tcp(ctx)
+	case TypeTLS:
+		err = p.tls(ctx)
+	case TypeHTTP:
+		err = p.http(ctx)
+	case TypeDNS:
+		err = p.dns(ctx)
+	case TypePostgres:
+		err = p.postgres(ctx)
+	case TypeRedis:
+		err = p.redis(ctx)
+	case TypeMySQL:
+		err = p.mysql(ctx)
+	}
+
+	// A dial the HTTP transport gave up on may still be finishing
+	p.mu.Lock()
+	conn := *p.conn
+	chain := p.chain
+	p.mu.Unlock()
+
+	conn.Latency = milliseconds(time.Since(conn.Timestamp))
+	if err != nil {
+		conn.Error = string(classify(err))
+		conn.Metadata["check_error"] = err.Error()
+	}
+	conn.ID = fmt.Sprintf("%s:%d-%s:%d-%d-check", conn.SourceIP, conn.SourcePort, conn.DestIP, conn.DestPort, conn.Timestamp.UnixNano())
+	return &conn, chain
+}
+
+// checkError is a failure with a known error code
+type checkError struct {
+	code models.ConnectionError
+	err  error
+}
+
+func (e *checkError) Error() string { return e.err.Error() }
+func (e *checkError) Unwrap() error { return e.err }
+
+func failed(code models.ConnectionError, format string, args ...interface{}) error {
+	return &checkError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+// classify maps a check failure onto a connection error code
+func classify(err error) models.ConnectionError {
+	var coded *checkError
+	var dnsErr *net.DNSError
+	var invalid x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &coded):
+		return coded.code
+	case errors.As(err, &dnsErr):
+		return models.ErrDNSFailure
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return models.ErrConnRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return models.ErrConnReset
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return models.ErrHostUnreach
+	case errors.Is(err, syscall.ENETUNREACH):
+		return models.ErrNetworkUnreach
+	case errors.Is(err, syscall.ENETDOWN):
+		return models.ErrNetworkDown
+	case errors.Is(err, context.DeadlineExceeded), os.IsTimeout(err):
+		return models.ErrConnTimeout
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		return models.ErrCertExpired
+	case isTLSError(err):
+		return models.ErrTLSHandshake
+	}
+	return models.ErrConnAborted
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
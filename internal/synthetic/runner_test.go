@@ -0,0 +1,304 @@
+package synthetic
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+)
+
+// runCheck validates and runs a check once
+func runCheck(t *testing.T, c *Check) *models.Connection {
+	t.Helper()
+	if c.Timeout == 0 {
+		c.Timeout = Duration(2 * time.Second)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return c.Run()
+}
+
+// expect checks a run's error code and that its latency covers at least
+// minLatency
+func expect(t *testing.T, conn *models.Connection, code models.ConnectionError, minLatency time.Duration) {
+	t.Helper()
+	if conn.Error != string(code) {
+		t.Errorf("Error = %q (%v), want %q", conn.Error, conn.Metadata["check_error"], code)
+	}
+	if conn.Latency <= 0 || conn.Latency < milliseconds(minLatency) {
+		t.Errorf("Latency = %vms, want at least %v", conn.Latency, minLatency)
+	}
+}
+
+// fakeServer accepts TCP connections on a loopback port, handing each to
+// handle, and returns the port's address
+func fakeServer(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				handle(c)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// closedPort returns the address of a loopback port nothing listens on
+func closedPort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+// tlsServer starts an HTTPS server presenting a self-signed certificate
+// that expires at notAfter
+func tlsServer(t *testing.T, notAfter time.Time) *httptest.Server {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "db.internal.example"},
+		DNSNames:     []string{"db.internal.example"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTCPCheck(t *testing.T) {
+	addr := fakeServer(t, func(net.Conn) {})
+	conn := runCheck(t, &Check{Type: TypeTCP, Target: addr})
+	expect(t, conn, "", 0)
+	if got := net.JoinHostPort(conn.DestIP, strconv.Itoa(conn.DestPort)); got != addr {
+		t.Errorf("destination = %s, want %s", got, addr)
+	}
+
+	conn = runCheck(t, &Check{Type: TypeTCP, Target: closedPort(t)})
+	expect(t, conn, models.ErrConnRefused, 0)
+}
+
+func TestTLSCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		notAfter time.Time
+		insecure bool
+		code     models.ConnectionError
+	}{
+		{"valid", time.Now().Add(90 * 24 * time.Hour), true, ""},
+		{"expiring", time.Now().Add(48 * time.Hour), true, models.ErrCertExpiring},
+		{"expired", time.Now().Add(-time.Hour), true, models.ErrCertExpired},
+		{"untrusted", time.Now().Add(90 * 24 * time.Hour), false, models.ErrTLSHandshake},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := tlsServer(t, tc.notAfter)
+			conn := runCheck(t, &Check{
+				Type:       TypeTLS,
+				Target:     srv.Listener.Addr().String(),
+				ServerName: "db.internal.example",
+				Insecure:   tc.insecure,
+			})
+			expect(t, conn, tc.code, 0)
+			if tc.insecure && conn.Metadata["cert_subject"] != "db.internal.example" {
+				t.Errorf("cert_subject = %v", conn.Metadata["cert_subject"])
+			}
+		})
+	}
+}
+
+func TestHTTPCheck(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	conn := runCheck(t, &Check{Type: TypeHTTP, Target: srv.URL + "/slow"})
+	expect(t, conn, "", 50*time.Millisecond)
+
+	conn = runCheck(t, &Check{Type: TypeHTTP, Target: srv.URL + "/down"})
+	expect(t, conn, models.ErrHTTPStatus, 0)
+	if conn.Metadata["http_status"] != http.StatusServiceUnavailable {
+		t.Errorf("http_status = %v", conn.Metadata["http_status"])
+	}
+
+	conn = runCheck(t, &Check{Type: TypeHTTP, Target: srv.URL + "/down", ExpectStatus: http.StatusServiceUnavailable})
+	expect(t, conn, "", 0)
+
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsSrv.Close()
+	conn = runCheck(t, &Check{Type: TypeHTTP, Target: tlsSrv.URL, Insecure: true})
+	expect(t, conn, "", 0)
+	if conn.Metadata["cert_expiry"] == nil {
+		t.Error("https check did not record the certificate")
+	}
+}
+
+// dnsServer answers A queries for name with 10.9.8.7 and every other query
+// with NXDOMAIN
+func dnsServer(t *testing.T, name string) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			query := buf[:n]
+			// The question follows the 12 byte header: labels, then type
+			// and class
+			end := 12
+			var labels []string
+			for end < n && query[end] != 0 {
+				labels = append(labels, string(query[end+1:end+1+int(query[end])]))
+				end += 1 + int(query[end])
+			}
+			end += 5
+			if end > n {
+				continue
+			}
+			qtype := binary.BigEndian.Uint16(query[end-4:])
+
+			reply := append([]byte(nil), query[:end]...)
+			binary.BigEndian.PutUint16(reply[2:], 0x8180)
+			binary.BigEndian.PutUint16(reply[6:], 0)
+			switch {
+			case strings.Join(labels, ".") != name:
+				reply[3] |= 3 // NXDOMAIN
+			case qtype == 1:
+				binary.BigEndian.PutUint16(reply[6:], 1)
+				reply = append(reply, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4, 10, 9, 8, 7)
+			}
+			pc.WriteTo(reply, addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func TestDNSCheck(t *testing.T) {
+	resolver := dnsServer(t, "db.internal.example")
+
+	conn := runCheck(t, &Check{Type: TypeDNS, Target: "db.internal.example.", Resolver: resolver})
+	expect(t, conn, "", 0)
+	if answers, _ := conn.Metadata["dns_answers"].([]string); len(answers) != 1 || answers[0] != "10.9.8.7" {
+		t.Errorf("dns_answers = %v", conn.Metadata["dns_answers"])
+	}
+
+	conn = runCheck(t, &Check{Type: TypeDNS, Target: "missing.internal.example.", Resolver: resolver})
+	expect(t, conn, models.ErrDNSFailure, 0)
+}
+
+func TestDatabaseChecks(t *testing.T) {
+	postgres := func(reply byte) string {
+		return fakeServer(t, func(c net.Conn) {
+			request := make([]byte, 8)
+			if _, err := io.ReadFull(c, request); err == nil {
+				c.Write([]byte{reply})
+			}
+		})
+	}
+	redis := func(delay time.Duration, reply string) string {
+		return fakeServer(t, func(c net.Conn) {
+			if _, err := bufio.NewReader(c).ReadString('\n'); err == nil {
+				time.Sleep(delay)
+				io.WriteString(c, reply)
+			}
+		})
+	}
+	mysql := func(payload []byte) string {
+		return fakeServer(t, func(c net.Conn) {
+			header := []byte{byte(len(payload)), byte(len(payload) >> 8), byte(len(payload) >> 16), 0}
+			c.Write(append(header, payload...))
+		})
+	}
+	greeting := append([]byte{0x0a}, "8.0.36\x00"...)
+	greeting = append(greeting, make([]byte, 20)...)
+	refusal := append([]byte{0xff, 0x6a, 0x04}, "#HY000Host is not allowed"...)
+
+	for _, tc := range []struct {
+		name       string
+		typ        Type
+		target     string
+		code       models.ConnectionError
+		minLatency time.Duration
+		key        string
+		value      interface{}
+	}{
+		{"postgres", TypePostgres, postgres('N'), "", 0, "", nil},
+		{"postgres garbage", TypePostgres, postgres('X'), models.ErrProtocol, 0, "", nil},
+		{"redis", TypeRedis, redis(50*time.Millisecond, "+PONG\r\n"), "", 50 * time.Millisecond, "", nil},
+		{"redis auth", TypeRedis, redis(0, "-NOAUTH Authentication required.\r\n"), "", 0, "redis_auth_required", true},
+		{"mysql", TypeMySQL, mysql(greeting), "", 0, "mysql_version", "8.0.36"},
+		{"mysql refused", TypeMySQL, mysql(refusal), models.ErrProtocol, 0, "", nil},
+		{"closed port", TypePostgres, closedPort(t), models.ErrConnRefused, 0, "", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := runCheck(t, &Check{Type: tc.typ, Target: tc.target})
+			expect(t, conn, tc.code, tc.minLatency)
+			if conn.ServiceType != models.ServiceTypeDatabase {
+				t.Errorf("ServiceType = %q", conn.ServiceType)
+			}
+			if tc.key != "" && conn.Metadata[tc.key] != tc.value {
+				t.Errorf("%s = %v, want %v", tc.key, conn.Metadata[tc.key], tc.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+// Package topology builds the graph of which workloads talk to which from
+// stored connections. Each side is named by the most specific identity
+// enrichment found for it: the Kubernetes deployment, service or pod when
+// the address belongs to the cluster, otherwise the collector's service
+// name, the host or the address itself. Hosts whose collectors report flow
+// summaries instead of every connection join the graph through their
+// summaries.
+package topology
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+// Node kinds
+const (
+	KindDeployment = "deployment"
+	KindService    = "service"
+	KindPod        = "pod"
+	KindHost       = "host"
+	KindExternal   = "external"
+)
+
+// Node is a workload or endpoint in the graph
+type Node struct {
+	ID        string `json:"id"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// Edge summarizes the connections from one node to another
+type Edge struct {
+	Source        string  `json:"source"`
+	Target        string  `json:"target"`
+	Connections   int64   `json:"connections"`
+	Errors        int64   `json:"errors"`
+	ErrorRate     float64 `json:"error_rate"`
+	AvgLatency    float64 `json:"avg_latency"`
+	BytesSent     int64   `json:"bytes_sent"`
+	BytesReceived int64   `json:"bytes_received"`
+}
+
+// Graph is the topology over a time range
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// Build reads the connections and flow summaries matching filter and groups
+// them into edges between the nodes at either end. Edges are ordered busiest
+// first.
+func Build(store storage.Storage, filter storage.ConnectionFilter) (*Graph, error) {
+	b := &builder{
+		nodes:   make(map[string]Node),
+		edges:   make(map[[2]string]*Edge),
+		latency: make(map[[2]string]float64),
+		timed:   make(map[[2]string]int64),
+	}
+
+	err := store.IterateConnections(filter, func(conn *models.Connection) error {
+		errors := int64(0)
+		if conn.Error != "" {
+			errors = 1
+		}
+		b.add(source(conn), destination(conn), 1, errors, conn.BytesSent, conn.BytesReceived, conn.Latency, 1)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connections: %v", err)
+	}
+
+	// Summaries only record the collector's identity and the destination
+	// address, so they are skipped when the filter narrows on anything else
+	if flowStore, ok := storage.Backend(store).(storage.FlowStore); ok {
+		if flowFilter, ok := storage.FlowFilterFor(filter); ok {
+			summaries, err := flowStore.GetFlowSummaries(flowFilter)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read flow summaries: %v", err)
+			}
+			for _, f := range summaries {
+				b.add(flowSource(f), flowDestination(f), f.Connections, f.ErrorCount(),
+					f.BytesSent, f.BytesReceived, f.LatencySum, f.LatencyCount)
+			}
+		}
+	}
+
+	return b.graph(), nil
+}
+
+// builder accumulates edges; latency and timed hold each edge's latency sum
+// and the number of connections it covers
+type builder struct {
+	nodes   map[string]Node
+	edges   map[[2]string]*Edge
+	latency map[[2]string]float64
+	timed   map[[2]string]int64
+}
+
+func (b *builder) add(src, dst Node, connections, errors, sent, received int64, latency float64, timed int64) {
+	b.nodes[src.ID], b.nodes[dst.ID] = src, dst
+
+	key := [2]string{src.ID, dst.ID}
+	edge, ok := b.edges[key]
+	if !ok {
+		edge = &Edge{Source: src.ID, Target: dst.ID}
+		b.edges[key] = edge
+	}
+	edge.Connections += connections
+	edge.Errors += errors
+	edge.BytesSent += sent
+	edge.BytesReceived += received
+	b.latency[key] += latency
+	b.timed[key] += timed
+}
+
+func (b *builder) graph() *Graph {
+	graph := &Graph{Nodes: []Node{}, Edges: []Edge{}}
+	for _, node := range b.nodes {
+		graph.Nodes = append(graph.Nodes, node)
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].ID < graph.Nodes[j].ID })
+
+	for key, edge := range b.edges {
+		if edge.Connections > 0 {
+			edge.ErrorRate = float64(edge.Errors) / float64(edge.Connections)
+		}
+		if b.timed[key] > 0 {
+			edge.AvgLatency = b.latency[key] / float64(b.timed[key])
+		}
+		graph.Edges = append(graph.Edges, *edge)
+	}
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		a, b := graph.Edges[i], graph.Edges[j]
+		if a.Connections != b.Connections {
+			return a.Connections > b.Connections
+		}
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		return a.Target < b.Target
+	})
+	return graph
+}
+
+func newNode(kind, namespace, name string) Node {
+	id := kind + ":" + name
+	if namespace != "" {
+		id = kind + ":" + namespace + "/" + name
+	}
+	return Node{ID: id, Kind: kind, Namespace: namespace, Name: name}
+}
+
+// source names the client side of a connection
+func source(conn *models.Connection) Node {
+	switch {
+	case conn.K8sDeployment != "":
+		return newNode(KindDeployment, conn.K8sNamespace, conn.K8sDeployment)
+	case conn.K8sService != "":
+		return newNode(KindService, conn.K8sNamespace, conn.K8sService)
+	case conn.K8sPod != "":
+		return newNode(KindPod, conn.K8sNamespace, conn.K8sPod)
+	case conn.ServiceName != "":
+		return newNode(KindService, "", conn.ServiceName)
+	case conn.Host != "":
+		return newNode(KindHost, "", conn.Host)
+	default:
+		return newNode(KindHost, "", conn.SourceIP)
+	}
+}
+
+// destination names the server side of a connection. Addresses outside the
+// cluster keep their port, since one host often serves several things.
+func destination(conn *models.Connection) Node {
+	switch {
+	case conn.DestK8sService != "":
+		return newNode(KindService, conn.DestK8sNamespace, conn.DestK8sService)
+	case conn.DestK8sPod != "":
+		return newNode(KindPod, conn.DestK8sNamespace, conn.DestK8sPod)
+	}
+	host := conn.DestHostname
+	if host == "" {
+		host = conn.DestIP
+	}
+	return newNode(KindExternal, "", net.JoinHostPort(host, strconv.Itoa(conn.DestPort)))
+}
+
+// flowSource names the collector that reported a flow summary, as source
+// does for a connection without Kubernetes identity
+func flowSource(f *models.FlowSummary) Node {
+	if f.ServiceName != "" {
+		return newNode(KindService, "", f.ServiceName)
+	}
+	return newNode(KindHost, "", f.Host)
+}
+
+// flowDestination names a flow summary's destination address
+func flowDestination(f *models.FlowSummary) Node {
+	return newNode(KindExternal, "", net.JoinHostPort(f.DestIP, strconv.Itoa(f.DestPort)))
+}
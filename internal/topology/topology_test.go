@@ -0,0 +1,68 @@
+package topology
+
+import (
+	"testing"
+	"time"
+
+	"github.com/karthik-minnikanti/cinnamon/internal/models"
+	"github.com/karthik-minnikanti/cinnamon/internal/storage"
+)
+
+func TestBuild(t *testing.T) {
+	now := time.Now()
+	store := storage.NewMemoryStorage(100)
+	for i, conn := range []*models.Connection{
+		{K8sNamespace: "shop", K8sDeployment: "checkout", DestK8sNamespace: "bank", DestK8sService: "ledger", Latency: 10},
+		{K8sNamespace: "shop", K8sDeployment: "checkout", DestK8sNamespace: "bank", DestK8sService: "ledger", Latency: 30, Error: string(models.ErrConnReset)},
+		{ServiceName: "billing", DestHostname: "api.stripe.com", DestIP: "3.18.12.63", DestPort: 443, Latency: 80},
+	} {
+		conn.ID = string(rune('a' + i))
+		conn.Timestamp = now.Add(-time.Minute)
+		conn.BytesSent = 100
+		if err := store.StoreConnection(conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A host running the collector with --aggregate only reports summaries
+	err := store.StoreFlowSummaries([]*models.FlowSummary{
+		{Timestamp: now.Add(-time.Minute), Host: "batch-1", DestIP: "10.0.0.9", DestPort: 5432,
+			Connections: 4, Errors: map[string]int64{string(models.ErrConnTimeout): 1}, BytesSent: 400, LatencyCount: 3, LatencySum: 60},
+		{Timestamp: now.Add(-time.Minute), Host: "batch-1", DestIP: "10.0.0.9", DestPort: 5432,
+			Connections: 2, BytesSent: 200, LatencyCount: 2, LatencySum: 20},
+		{Timestamp: now.Add(-48 * time.Hour), Host: "batch-1", DestIP: "10.0.0.9", DestPort: 6379, Connections: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	graph, err := Build(store, storage.ConnectionFilter{Start: now.Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Edge{
+		{Source: "host:batch-1", Target: "external:10.0.0.9:5432", Connections: 6, Errors: 1, ErrorRate: 1.0 / 6, AvgLatency: 16, BytesSent: 600},
+		{Source: "deployment:shop/checkout", Target: "service:bank/ledger", Connections: 2, Errors: 1, ErrorRate: 0.5, AvgLatency: 20, BytesSent: 200},
+		{Source: "service:billing", Target: "external:api.stripe.com:443", Connections: 1, AvgLatency: 80, BytesSent: 100},
+	}
+	if len(graph.Edges) != len(want) {
+		t.Fatalf("edges = %+v", graph.Edges)
+	}
+	for i, edge := range graph.Edges {
+		if edge != want[i] {
+			t.Errorf("edge %d = %+v, want %+v", i, edge, want[i])
+		}
+	}
+	if len(graph.Nodes) != 6 {
+		t.Errorf("nodes = %+v", graph.Nodes)
+	}
+
+	// Summaries carry no Kubernetes identity, so a namespace filter drops them
+	graph, err = Build(store, storage.ConnectionFilter{Start: now.Add(-time.Hour), Namespace: "shop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graph.Edges) != 1 || graph.Edges[0].Source != "deployment:shop/checkout" {
+		t.Errorf("namespace filtered edges = %+v", graph.Edges)
+	}
+}
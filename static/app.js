@@ -36,6 +36,16 @@ navLinks.forEach(link => {
                 view.classList.add('active');
             }
         });
+
+        if (viewId === 'errors') {
+            loadRetries();
+        } else if (viewId === 'topology') {
+            loadTopology();
+        } else if (viewId === 'pools') {
+            loadPools();
+        } else if (viewId === 'http') {
+            loadHTTPEndpoints();
+        }
     });
 });
 
@@ -47,7 +57,9 @@ const charts = {
     serviceTypes: null,
     errorDistribution: null,
     latencyTrends: null,
-    errorTimeline: null
+    errorTimeline: null,
+    poolUsage: null,
+    httpEndpoint: null
 };
 
 function initializeCharts() {
@@ -292,13 +304,35 @@ function initializeCharts() {
 }
 
 // Data fetching and updating
+// Query language search from the header search box
+let currentQuery = '';
+
+document.getElementById('query-search').addEventListener('keydown', (e) => {
+    if (e.key === 'Enter') {
+        currentQuery = e.target.value.trim();
+        fetchData();
+    }
+});
+
 async function fetchData() {
     try {
+        // live=true keeps polling on the server's in-memory cache, when it
+        // has one
+        const params = new URLSearchParams({ live: 'true' });
+        if (currentQuery) params.set('q', currentQuery);
         const [statsResponse, connectionsResponse] = await Promise.all([
-            fetch('/api/connections/stats'),
-            fetch('/api/connections')
+            fetch('/api/connections/stats?live=true'),
+            fetch('/api/connections?' + params.toString())
         ]);
 
+        // Invalid queries come back as 400 with the error position
+        const queryError = document.getElementById('query-error');
+        if (connectionsResponse.status === 400) {
+            queryError.textContent = (await connectionsResponse.text()).trim();
+            return;
+        }
+        queryError.textContent = '';
+
         const stats = await statsResponse.json();
         const connections = await connectionsResponse.json();
 
@@ -333,9 +367,9 @@ function updateConnections(connections) {
     errorConnections.forEach(conn => {
         const row = document.createElement('tr');
         row.innerHTML = `
-            <td>${conn.service_name || '-'}</td>
-            <td>${conn.source_ip}:${conn.source_port}</td>
-            <td>${conn.dest_ip}:${conn.dest_port}</td>
+            <td>${conn.service_name || conn.k8s_deployment || '-'}${conn.k8s_namespace ? ` <small>(${conn.k8s_namespace})</small>` : ''}</td>
+            <td>${conn.source_ip}:${conn.source_port}${conn.container_name ? ` <small>(${conn.container_name})</small>` : ''}</td>
+            <td>${conn.dest_k8s_service || conn.dest_hostname || conn.dest_ip}:${conn.dest_port}</td>
             <td>
                 <span class="status-badge error">
                     ${conn.error}
@@ -363,6 +397,16 @@ function updateCharts(stats) {
     charts.serviceDistribution.data.datasets[0].data = serviceData.map(([, count]) => count);
     charts.serviceDistribution.update();
 
+    // Errors per hour, across error types
+    const errorsByHour = new Map();
+    (stats.error_trends || []).forEach(trend => {
+        errorsByHour.set(trend.timestamp, (errorsByHour.get(trend.timestamp) || 0) + trend.count);
+    });
+    const errorHours = [...errorsByHour.keys()].sort();
+    charts.errorTimeline.data.labels = errorHours.map(t => new Date(t).toLocaleTimeString());
+    charts.errorTimeline.data.datasets[0].data = errorHours.map(t => errorsByHour.get(t));
+    charts.errorTimeline.update();
+
     // Update other charts similarly...
 }
 
@@ -420,6 +464,582 @@ function updateFilterOptions(filterId, options) {
     });
 }
 
+// Export handling
+// exportQuery narrows the header search, which the table shows, by the
+// export box's own query, so the download matches what is on screen
+function exportQuery() {
+    const query = document.getElementById('connection-search').value.trim();
+    if (currentQuery && query) return `(${currentQuery}) AND (${query})`;
+    return currentQuery || query;
+}
+
+function connectionFilterParams() {
+    const params = new URLSearchParams();
+    const filters = {
+        service: document.getElementById('service-filter').value,
+        error: document.getElementById('error-filter').value,
+        environment: document.getElementById('environment-filter').value,
+        q: exportQuery()
+    };
+    Object.entries(filters).forEach(([key, value]) => {
+        if (value) params.set(key, value);
+    });
+    return params;
+}
+
+document.getElementById('export-connections').addEventListener('click', () => {
+    const params = connectionFilterParams();
+    params.set('format', document.getElementById('export-format').value);
+    window.location.href = '/api/connections/export?' + params.toString();
+});
+
+// Deployment comparison
+async function loadCompareServices() {
+    try {
+        const response = await fetch('/api/services');
+        updateFilterOptions('compare-service', await response.json() || []);
+    } catch (error) {
+        console.error('Error fetching services:', error);
+    }
+}
+
+async function loadDeploymentOptions() {
+    const params = new URLSearchParams({ group_by: 'deployment_id', limit: '50' });
+    const service = document.getElementById('compare-service').value;
+    if (service) params.set('service', service);
+    try {
+        const response = await fetch('/api/query/aggregate?' + params.toString());
+        const result = await response.json();
+        const datalist = document.getElementById('deployment-options');
+        datalist.innerHTML = '';
+        result.groups.forEach(group => {
+            if (!group.key.deployment_id) return;
+            const opt = document.createElement('option');
+            opt.value = group.key.deployment_id;
+            opt.textContent = `${group.metrics.count} connections`;
+            datalist.appendChild(opt);
+        });
+    } catch (error) {
+        console.error('Error fetching deployments:', error);
+    }
+}
+
+function escapeHTML(value) {
+    return String(value).replace(/[&<>"']/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;' }[c]));
+}
+
+function formatPercent(rate) {
+    return (rate * 100).toFixed(2) + '%';
+}
+
+// significanceCell marks a difference when it is significant; higher values
+// are worse for every compared metric
+function significanceCell(significant, worse, pValue) {
+    if (!significant) return `<td>p=${pValue.toFixed(3)}</td>`;
+    const cls = worse ? 'worse' : 'better';
+    return `<td class="significant ${cls}">${worse ? 'worse' : 'better'} (p=${pValue.toFixed(3)})</td>`;
+}
+
+function renderDependencies(title, deps) {
+    const rows = deps.length
+        ? deps.map(d => `<tr><td>${escapeHTML(d.destination)}</td><td>${d.connections}</td></tr>`).join('')
+        : '<tr><td colspan="2">None</td></tr>';
+    return `
+        <div class="compare-section">
+            <h3>${title}</h3>
+            <div class="table-container">
+                <table>
+                    <thead><tr><th>Destination</th><th>Connections</th></tr></thead>
+                    <tbody>${rows}</tbody>
+                </table>
+            </div>
+        </div>`;
+}
+
+function renderCompareReport(report) {
+    const b = report.baseline;
+    const c = report.candidate;
+    const latency = report.latency;
+    const reasons = report.reasons.map(r => `<li>${escapeHTML(r)}</li>`).join('');
+    const errorRows = report.error_types.map(t => `
+        <tr>
+            <td>${escapeHTML(t.error)}</td>
+            <td>${formatPercent(t.baseline)}</td>
+            <td>${formatPercent(t.candidate)}</td>
+            ${significanceCell(t.significant, t.delta > 0, t.p_value)}
+        </tr>`).join('') || '<tr><td colspan="4">No errors</td></tr>';
+
+    document.getElementById('compare-report').innerHTML = `
+        <div class="verdict ${report.verdict}">
+            <h3>${report.verdict.replace('_', ' ').toUpperCase()}</h3>
+            ${reasons ? `<ul>${reasons}</ul>` : '<p>No significant regressions.</p>'}
+        </div>
+        <div class="compare-section">
+            <h3>Overview</h3>
+            <div class="table-container">
+                <table>
+                    <thead><tr><th>Metric</th><th>${escapeHTML(b.deployment_id)}</th><th>${escapeHTML(c.deployment_id)}</th><th>Significance</th></tr></thead>
+                    <tbody>
+                        <tr><td>Connections</td><td>${b.connections}</td><td>${c.connections}</td><td></td></tr>
+                        <tr><td>Error rate</td><td>${formatPercent(b.error_rate)}</td><td>${formatPercent(c.error_rate)}</td>
+                            ${significanceCell(report.error_rate.significant, report.error_rate.delta > 0, report.error_rate.p_value)}</tr>
+                        <tr><td>Latency p50</td><td>${b.latency.p50.toFixed(1)}ms</td><td>${c.latency.p50.toFixed(1)}ms</td>
+                            ${significanceCell(latency.significant, latency.slower, latency.p_value)}</tr>
+                        <tr><td>Latency p95</td><td>${b.latency.p95.toFixed(1)}ms</td><td>${c.latency.p95.toFixed(1)}ms</td><td></td></tr>
+                        <tr><td>Latency p99</td><td>${b.latency.p99.toFixed(1)}ms</td><td>${c.latency.p99.toFixed(1)}ms</td><td></td></tr>
+                    </tbody>
+                </table>
+            </div>
+        </div>
+        <div class="compare-section">
+            <h3>Error Types</h3>
+            <div class="table-container">
+                <table>
+                    <thead><tr><th>Error</th><th>Baseline</th><th>Candidate</th><th>Significance</th></tr></thead>
+                    <tbody>${errorRows}</tbody>
+                </table>
+            </div>
+        </div>
+        ${renderDependencies('New Dependencies', report.new_dependencies)}
+        ${renderDependencies('Removed Dependencies', report.removed_dependencies)}`;
+}
+
+document.getElementById('compare-service').addEventListener('change', loadDeploymentOptions);
+
+document.getElementById('compare-deployments').addEventListener('click', async () => {
+    const params = new URLSearchParams({
+        baseline: document.getElementById('compare-baseline').value.trim(),
+        candidate: document.getElementById('compare-candidate').value.trim()
+    });
+    const service = document.getElementById('compare-service').value;
+    if (service) params.set('service', service);
+
+    const container = document.getElementById('compare-report');
+    try {
+        const response = await fetch('/api/deployments/compare?' + params.toString());
+        if (!response.ok) {
+            container.innerHTML = `<p class="compare-hint">${escapeHTML((await response.text()).trim())}</p>`;
+            return;
+        }
+        renderCompareReport(await response.json());
+    } catch (error) {
+        console.error('Error comparing deployments:', error);
+    }
+});
+
+// Security events and egress policies
+async function loadSecurityEvents() {
+    const params = new URLSearchParams();
+    const service = document.getElementById('security-service').value;
+    const kind = document.getElementById('security-kind').value;
+    if (service) params.set('service', service);
+    if (kind) params.set('kind', kind);
+    params.set('limit', '200');
+
+    const tbody = document.getElementById('security-events-body');
+    try {
+        const response = await fetch('/api/security/events?' + params.toString());
+        if (!response.ok) {
+            tbody.innerHTML = `<tr><td colspan="6">${escapeHTML((await response.text()).trim())}</td></tr>`;
+            return;
+        }
+        const events = await response.json();
+        tbody.innerHTML = events.map(e => `
+            <tr>
+                <td>${new Date(e.timestamp).toLocaleString()}</td>
+                <td class="security-kind ${e.kind}">${e.kind.replace('_', ' ')}</td>
+                <td>${escapeHTML(e.service_name)}</td>
+                <td>${escapeHTML(e.environment || '')}</td>
+                <td>${escapeHTML(e.destination)}</td>
+                <td>${escapeHTML(e.message)}</td>
+            </tr>`).join('') || '<tr><td colspan="6">No security events</td></tr>';
+    } catch (error) {
+        console.error('Error fetching security events:', error);
+    }
+}
+
+async function loadPolicies() {
+    const tbody = document.getElementById('policies-body');
+    try {
+        const response = await fetch('/api/security/policies');
+        if (!response.ok) {
+            tbody.innerHTML = `<tr><td colspan="6">${escapeHTML((await response.text()).trim())}</td></tr>`;
+            return;
+        }
+        const policies = await response.json();
+        tbody.innerHTML = policies.map(p => `
+            <tr>
+                <td>${escapeHTML(p.service_name)}</td>
+                <td>${escapeHTML(p.environment || 'all')}</td>
+                <td>v${p.version}</td>
+                <td>${p.mode}</td>
+                <td>${p.rules.length}</td>
+                <td>${new Date(p.created_at).toLocaleString()}</td>
+            </tr>`).join('') || '<tr><td colspan="6">No policies</td></tr>';
+    } catch (error) {
+        console.error('Error fetching egress policies:', error);
+    }
+}
+
+// Workloads and the traffic between them
+function topologyLabel(node) {
+    if (!node) return '';
+    const name = node.namespace ? `${node.namespace}/${node.name}` : node.name;
+    return node.kind === 'external' || node.kind === 'host' ? name : `${name} (${node.kind})`;
+}
+
+async function loadTopology() {
+    const params = new URLSearchParams();
+    const namespace = document.getElementById('topology-namespace').value.trim();
+    if (namespace) params.set('k8s_namespace', namespace);
+
+    const tbody = document.getElementById('topology-body');
+    try {
+        const response = await fetch('/api/topology?' + params.toString());
+        if (!response.ok) {
+            tbody.innerHTML = `<tr><td colspan="6">${escapeHTML((await response.text()).trim())}</td></tr>`;
+            return;
+        }
+        const graph = await response.json();
+        const nodes = new Map(graph.nodes.map(n => [n.id, n]));
+        tbody.innerHTML = graph.edges.map(e => `
+            <tr>
+                <td>${escapeHTML(topologyLabel(nodes.get(e.source)))}</td>
+                <td>${escapeHTML(topologyLabel(nodes.get(e.target)))}</td>
+                <td>${e.connections}</td>
+                <td>${formatPercent(e.error_rate)}</td>
+                <td>${formatLatency(e.avg_latency)}</td>
+                <td>${e.bytes_sent} / ${e.bytes_received}</td>
+            </tr>`).join('') || '<tr><td colspan="6">No connections in this range</td></tr>';
+    } catch (error) {
+        console.error('Error fetching topology:', error);
+    }
+}
+
+document.getElementById('topology-namespace').addEventListener('change', loadTopology);
+
+// Database and cache connection pools
+let poolSummaries = [];
+
+function poolLabel(p) {
+    const owner = p.container_name || p.process || p.host;
+    return `${p.service_name || p.host} ${owner ? `(${owner}) ` : ''}→ ${p.destination}`;
+}
+
+function renderPoolChart(p) {
+    document.getElementById('pool-chart-title').textContent = p ? `Pool Usage: ${poolLabel(p)}` : 'Pool Usage';
+    if (charts.poolUsage) {
+        charts.poolUsage.destroy();
+        charts.poolUsage = null;
+    }
+    if (!p) return;
+
+    charts.poolUsage = new Chart(document.getElementById('pool-usage-chart'), {
+        type: 'line',
+        data: {
+            labels: p.series.map(point => new Date(point.timestamp).toLocaleTimeString()),
+            datasets: [
+                { label: 'Open', data: p.series.map(point => point.open), borderColor: '#000000', fill: false },
+                { label: 'Active', data: p.series.map(point => point.active), borderColor: '#00c853', fill: false },
+                { label: 'Idle', data: p.series.map(point => point.idle), borderColor: '#999999', fill: false },
+                { label: 'Opened', data: p.series.map(point => point.opened), borderColor: '#ff3d00', borderDash: [4, 4], fill: false }
+            ]
+        },
+        options: {
+            responsive: true,
+            maintainAspectRatio: false,
+            scales: { y: { beginAtZero: true } }
+        }
+    });
+}
+
+async function loadPools() {
+    const params = new URLSearchParams();
+    const service = document.getElementById('pool-service').value;
+    if (service) params.set('service', service);
+
+    const tbody = document.getElementById('pools-body');
+    try {
+        const response = await fetch('/api/pools?' + params.toString());
+        if (!response.ok) {
+            tbody.innerHTML = `<tr><td colspan="9">${escapeHTML((await response.text()).trim())}</td></tr>`;
+            return;
+        }
+        poolSummaries = await response.json();
+        tbody.innerHTML = poolSummaries.map((p, i) => `
+            <tr class="pool-row" data-index="${i}">
+                <td>${escapeHTML(p.service_name || p.host)}</td>
+                <td>${escapeHTML(p.container_name || p.process || '')}</td>
+                <td>${escapeHTML(p.destination)}${p.database_type ? ` (${escapeHTML(p.database_type)})` : ''}</td>
+                <td>${p.open}</td>
+                <td>${p.active} / ${p.idle}</td>
+                <td>${p.peak_open}</td>
+                <td>${p.peak_active}</td>
+                <td>${(p.utilization * 100).toFixed(0)}%</td>
+                <td>${p.opened_per_minute.toFixed(1)} / ${p.closed_per_minute.toFixed(1)}</td>
+            </tr>`).join('') || '<tr><td colspan="9">No connection pools reported</td></tr>';
+        renderPoolChart(poolSummaries[0]);
+    } catch (error) {
+        console.error('Error fetching connection pools:', error);
+    }
+}
+
+async function loadPoolServices() {
+    try {
+        const response = await fetch('/api/services');
+        updateFilterOptions('pool-service', await response.json() || []);
+    } catch (error) {
+        console.error('Error fetching services:', error);
+    }
+}
+
+document.getElementById('pool-service').addEventListener('change', loadPools);
+
+document.getElementById('pools-body').addEventListener('click', event => {
+    const row = event.target.closest('.pool-row');
+    if (row) renderPoolChart(poolSummaries[Number(row.dataset.index)]);
+});
+
+// HTTP request rate, errors and duration per endpoint
+let httpEndpoints = [];
+
+function httpLabel(e) {
+    return `${e.method} ${e.route} → ${e.destination}`;
+}
+
+function formatLatency(ms) {
+    return ms >= 1000 ? (ms / 1000).toFixed(2) + 's' : ms.toFixed(1) + 'ms';
+}
+
+function renderHTTPChart(e) {
+    document.getElementById('http-chart-title').textContent = e ? `Requests: ${httpLabel(e)}` : 'Requests';
+    if (charts.httpEndpoint) {
+        charts.httpEndpoint.destroy();
+        charts.httpEndpoint = null;
+    }
+    if (!e) return;
+
+    charts.httpEndpoint = new Chart(document.getElementById('http-endpoint-chart'), {
+        type: 'line',
+        data: {
+            labels: e.series.map(point => new Date(point.timestamp).toLocaleTimeString()),
+            datasets: [
+                { label: 'Requests', data: e.series.map(point => point.requests), borderColor: '#000000', fill: false, yAxisID: 'y' },
+                { label: '5xx', data: e.series.map(point => point.server_errors), borderColor: '#ff3d00', fill: false, yAxisID: 'y' },
+                { label: 'p95 (ms)', data: e.series.map(point => point.p95_latency), borderColor: '#999999', borderDash: [4, 4], fill: false, yAxisID: 'latency' }
+            ]
+        },
+        options: {
+            responsive: true,
+            maintainAspectRatio: false,
+            scales: {
+                y: { beginAtZero: true },
+                latency: { beginAtZero: true, position: 'right', grid: { display: false } }
+            }
+        }
+    });
+}
+
+async function loadHTTPEndpoints() {
+    const params = new URLSearchParams();
+    const service = document.getElementById('http-service').value;
+    if (service) params.set('service', service);
+
+    const tbody = document.getElementById('http-body');
+    try {
+        const response = await fetch('/api/http/endpoints?' + params.toString());
+        if (!response.ok) {
+            tbody.innerHTML = `<tr><td colspan="8">${escapeHTML((await response.text()).trim())}</td></tr>`;
+            return;
+        }
+        httpEndpoints = await response.json();
+        tbody.innerHTML = httpEndpoints.map((e, i) => `
+            <tr class="http-row" data-index="${i}">
+                <td>${escapeHTML(e.service_name || '-')}</td>
+                <td>${escapeHTML(e.destination)}</td>
+                <td>${escapeHTML(e.method)} ${escapeHTML(e.route)}</td>
+                <td>${e.requests}</td>
+                <td>${e.rate.toFixed(2)}</td>
+                <td>${formatPercent(e.error_rate)}</td>
+                <td>${e.client_errors}</td>
+                <td>${formatLatency(e.p50_latency)} / ${formatLatency(e.p95_latency)} / ${formatLatency(e.p99_latency)}</td>
+            </tr>`).join('') || '<tr><td colspan="8">No HTTP requests reported</td></tr>';
+        renderHTTPChart(httpEndpoints[0]);
+    } catch (error) {
+        console.error('Error fetching HTTP endpoints:', error);
+    }
+}
+
+async function loadHTTPServices() {
+    try {
+        const response = await fetch('/api/services');
+        updateFilterOptions('http-service', await response.json() || []);
+    } catch (error) {
+        console.error('Error fetching services:', error);
+    }
+}
+
+document.getElementById('http-service').addEventListener('change', loadHTTPEndpoints);
+
+document.getElementById('http-body').addEventListener('click', event => {
+    const row = event.target.closest('.http-row');
+    if (row) renderHTTPChart(httpEndpoints[Number(row.dataset.index)]);
+});
+
+// Worst retry sequences of each service
+function describeBackoff(s) {
+    if (s.backoff === 'none') return 'none (tight loop)';
+    const interval = s.median_interval_ms >= 1000
+        ? `${(s.median_interval_ms / 1000).toFixed(1)}s`
+        : `${Math.round(s.median_interval_ms)}ms`;
+    if (s.backoff === 'exponential') return `exponential ×${s.backoff_factor} from ${interval}`;
+    return `${s.backoff} ${interval}`;
+}
+
+async function loadRetries() {
+    const tbody = document.getElementById('retries-body');
+    try {
+        const response = await fetch('/api/retries?worst=5');
+        if (!response.ok) {
+            tbody.innerHTML = `<tr><td colspan="8">${escapeHTML((await response.text()).trim())}</td></tr>`;
+            return;
+        }
+        const services = await response.json();
+        tbody.innerHTML = services.flatMap(svc => svc.worst).map(s => `
+            <tr>
+                <td>${escapeHTML(s.service_name)}</td>
+                <td>${escapeHTML(s.destination)}</td>
+                <td>${escapeHTML(s.container_name || s.host || s.source_ip)}</td>
+                <td>${s.attempts}</td>
+                <td>${escapeHTML(describeBackoff(s))}</td>
+                <td>${s.outcome}</td>
+                <td>${escapeHTML(s.last_error || '')}</td>
+                <td>${new Date(s.start).toLocaleString()}</td>
+            </tr>`).join('') || '<tr><td colspan="8">No retry sequences</td></tr>';
+    } catch (error) {
+        console.error('Error fetching retries:', error);
+    }
+}
+
+// Listening sockets per host and how they changed
+function listenerAddress(l) {
+    const address = l.address.includes(':') ? `[${l.address}]` : l.address;
+    return `${address}:${l.port}/${l.protocol}`;
+}
+
+async function loadListeners() {
+    const tbody = document.getElementById('listeners-body');
+    try {
+        const response = await fetch('/api/listeners');
+        if (!response.ok) {
+            tbody.innerHTML = `<tr><td colspan="6">${escapeHTML((await response.text()).trim())}</td></tr>`;
+            return;
+        }
+        const listeners = await response.json();
+        tbody.innerHTML = listeners.map(l => `
+            <tr>
+                <td>${escapeHTML(l.host)}</td>
+                <td>${escapeHTML(l.environment || '')}</td>
+                <td>${escapeHTML(listenerAddress(l))}</td>
+                <td>${escapeHTML(l.process || '')}${l.pid ? ` (${l.pid})` : ''}</td>
+                <td>${escapeHTML(l.container_name || '')}</td>
+                <td>${new Date(l.first_seen).toLocaleString()}</td>
+            </tr>`).join('') || '<tr><td colspan="6">No listening sockets reported</td></tr>';
+    } catch (error) {
+        console.error('Error fetching listeners:', error);
+    }
+}
+
+async function loadListenerChanges() {
+    const tbody = document.getElementById('listener-changes-body');
+    try {
+        const response = await fetch('/api/listeners/changes?limit=100');
+        if (!response.ok) {
+            tbody.innerHTML = `<tr><td colspan="5">${escapeHTML((await response.text()).trim())}</td></tr>`;
+            return;
+        }
+        const changes = await response.json();
+        tbody.innerHTML = changes.map(c => `
+            <tr>
+                <td>${new Date(c.timestamp).toLocaleString()}</td>
+                <td>${c.kind}</td>
+                <td>${escapeHTML(c.host)}</td>
+                <td>${escapeHTML(listenerAddress(c))}</td>
+                <td>${escapeHTML(c.process || '')}</td>
+            </tr>`).join('') || '<tr><td colspan="5">No listener changes</td></tr>';
+    } catch (error) {
+        console.error('Error fetching listener changes:', error);
+    }
+}
+
+async function loadSecurityServices() {
+    try {
+        const response = await fetch('/api/services');
+        updateFilterOptions('security-service', await response.json() || []);
+    } catch (error) {
+        console.error('Error fetching services:', error);
+    }
+}
+
+document.getElementById('security-service').addEventListener('change', loadSecurityEvents);
+document.getElementById('security-kind').addEventListener('change', loadSecurityEvents);
+
+document.getElementById('propose-policy').addEventListener('click', async () => {
+    const service = document.getElementById('security-service').value;
+    const errorEl = document.getElementById('policy-error');
+    const editor = document.getElementById('policy-editor');
+    errorEl.textContent = '';
+    if (!service) {
+        editor.hidden = false;
+        errorEl.textContent = 'Pick a service to propose an allowlist for.';
+        return;
+    }
+    try {
+        const response = await fetch('/api/security/policies/propose?' + new URLSearchParams({ service }).toString());
+        if (!response.ok) {
+            errorEl.textContent = (await response.text()).trim();
+            return;
+        }
+        const policy = await response.json();
+        document.getElementById('policy-json').value = JSON.stringify({
+            service_name: policy.service_name,
+            environment: policy.environment,
+            rules: policy.rules
+        }, null, 2);
+        editor.hidden = false;
+    } catch (error) {
+        console.error('Error proposing egress policy:', error);
+    }
+});
+
+document.getElementById('save-policy').addEventListener('click', async () => {
+    const errorEl = document.getElementById('policy-error');
+    errorEl.textContent = '';
+    let policy;
+    try {
+        policy = JSON.parse(document.getElementById('policy-json').value);
+    } catch (error) {
+        errorEl.textContent = 'Invalid JSON: ' + error.message;
+        return;
+    }
+    policy.mode = document.getElementById('policy-mode').value;
+    try {
+        const response = await fetch('/api/security/policies', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(policy)
+        });
+        if (!response.ok) {
+            errorEl.textContent = (await response.text()).trim();
+            return;
+        }
+        document.getElementById('policy-editor').hidden = true;
+        loadPolicies();
+    } catch (error) {
+        console.error('Error saving egress policy:', error);
+    }
+});
+
 // Settings handling
 document.getElementById('refresh-interval').addEventListener('change', (e) => {
     const interval = parseInt(e.target.value) * 1000;
@@ -453,5 +1073,14 @@ async function requestNotificationPermission() {
 document.addEventListener('DOMContentLoaded', () => {
     initializeCharts();
     fetchData();
+    loadCompareServices();
+    loadDeploymentOptions();
+    loadSecurityServices();
+    loadPoolServices();
+    loadHTTPServices();
+    loadSecurityEvents();
+    loadPolicies();
+    loadListeners();
+    loadListenerChanges();
     window.refreshInterval = setInterval(fetchData, 5000);
 }); 
\ No newline at end of file